@@ -1,31 +1,64 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
 
-	"github.com/go-chi/chi/v5"
-
-	"github.com/chrishaylesai/sitesecurity/api/internal/auth/keycloak"
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
 	"github.com/chrishaylesai/sitesecurity/api/internal/config"
 	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/metrics"
 	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/openapi"
+	"github.com/chrishaylesai/sitesecurity/api/internal/ratelimit"
 	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+	"github.com/chrishaylesai/sitesecurity/api/internal/tracing"
 )
 
 func main() {
 	cfg := config.Load()
 
+	// Logging
+	logger := logging.New(os.Stdout, cfg.Log.Level)
+	slog.SetDefault(logger)
+
+	// Tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Database
 	db, err := repository.NewDB(cfg.Database)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("failed to connect to database", err)
 	}
 	defer db.Close()
 
+	// "server migrate ..." manages the schema and exits; see migrate.go.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), db, os.Args[2:]); err != nil {
+			fatal("migration failed", err)
+		}
+		return
+	}
+	if cfg.Database.MigrateOnStart {
+		if err := runMigrate(context.Background(), db, []string{"up"}); err != nil {
+			fatal("migration failed", err)
+		}
+	}
+
 	// Auth provider
-	authProvider := keycloak.New(cfg.Auth)
+	authProvider, err := newAuthProvider(cfg.Auth)
+	if err != nil {
+		fatal("failed to initialise auth provider", err)
+	}
 
 	// Repositories
 	companyRepo := repository.NewCompanyRepository(db)
@@ -39,49 +72,88 @@ func main() {
 	reportRepo := repository.NewShiftReportRepository(db)
 	checkInRepo := repository.NewLocationCheckInRepository(db)
 	alarmRepo := repository.NewAlarmRepository(db)
+	scopeRepo := repository.NewScopeRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	auditRepo := repository.NewAuditEventRepository(db)
 
 	// Services
-	companySvc := service.NewCompanyService(companyRepo)
-	worksiteSvc := service.NewWorksiteService(worksiteRepo)
-	workerSvc := service.NewWorkerService(workerRepo, certRepo, wcRepo)
-	shiftSvc := service.NewShiftService(shiftRepo, assignmentRepo)
-	shiftReportSvc := service.NewShiftReportService(templateRepo, reportRepo)
-	locationSvc := service.NewLocationService(checkInRepo)
-	alarmSvc := service.NewAlarmService(alarmRepo)
-
-	// Handlers
-	companyHandler := handler.NewCompanyHandler(companySvc)
-	worksiteHandler := handler.NewWorksiteHandler(worksiteSvc)
-	workerHandler := handler.NewWorkerHandler(workerSvc)
-	shiftHandler := handler.NewShiftHandler(shiftSvc)
-	shiftReportHandler := handler.NewShiftReportHandler(shiftReportSvc)
-	locationHandler := handler.NewLocationHandler(locationSvc)
-	alarmHandler := handler.NewAlarmHandler(alarmSvc)
-	authHandler := handler.NewAuthHandler(authProvider)
+	uow := repository.NewTransactor(db)
+	auditSvc := service.NewAuditService(auditRepo, scopeRepo)
+	companySvc := service.NewCompanyService(companyRepo, auditSvc)
+	worksiteSvc := service.NewWorksiteService(worksiteRepo, auditSvc)
+	workerSvc := service.NewWorkerService(workerRepo, certRepo, wcRepo, auditSvc, uow)
+	shiftSvc := service.NewShiftService(shiftRepo, assignmentRepo, auditSvc, uow)
+	shiftReportSvc := service.NewShiftReportService(templateRepo, reportRepo, auditSvc)
+	locationSvc := service.NewLocationService(checkInRepo, auditSvc)
+	alarmSvc := service.NewAlarmService(alarmRepo, auditSvc)
+	accessSvc := service.NewAccessService(scopeRepo, wcRepo, auditSvc)
+	apiKeySvc := service.NewAPIKeyService(apiKeyRepo, auditSvc)
+
+	// Retries of the requests guards' phones resend on patchy connections
+	// replay the first response rather than repeating it.
+	idempotent := middleware.Idempotency(repository.NewIdempotencyRepository(db), cfg.Idempotency.TTL)
+
+	// Readiness checks the API's dependencies; liveness checks none, so
+	// an outage takes pods out of service without restarting them.
+	checks := map[string]handler.Check{"database": db.PingContext}
+	if checker, ok := authProvider.(auth.ReadinessChecker); ok {
+		checks["identity_provider"] = checker.Ready
+	}
+	readiness := handler.NewReadiness(checks)
+
+	// Rate limits are kept per replica, or in Postgres to share them.
+	var limitStore ratelimit.Store
+	switch cfg.RateLimit.Store {
+	case "memory":
+		limitStore = ratelimit.NewMemoryStore()
+	case "postgres":
+		limitStore = repository.NewRateLimitRepository(db)
+	default:
+		fatal("invalid RATE_LIMIT_STORE", fmt.Errorf("unknown store %q (supported: memory, postgres)", cfg.RateLimit.Store))
+	}
+	limiter := ratelimit.New(limitStore, cfg.RateLimit)
 
 	// Router
-	r := chi.NewRouter()
-	r.Use(middleware.Logging)
-	r.Use(middleware.CORS(cfg.CORS.Origins))
-
-	// Public routes
-	r.Get("/health", handler.Health)
-	r.Mount("/api/v1/auth", authHandler.Routes())
-
-	// Protected routes
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.Auth(authProvider))
-		r.Mount("/api/v1/companies", companyHandler.Routes())
-		r.Mount("/api/v1/worksites", worksiteHandler.Routes())
-		r.Mount("/api/v1/workers", workerHandler.Routes())
-		r.Mount("/api/v1/shifts", shiftHandler.Routes())
-		r.Mount("/api/v1/shift-reports", shiftReportHandler.Routes())
-		r.Mount("/api/v1/check-ins", locationHandler.Routes())
-		r.Mount("/api/v1/alarms", alarmHandler.Routes())
-	})
-
-	log.Printf("Starting server on :%s", cfg.Server.Port)
-	if err := http.ListenAndServe(":"+cfg.Server.Port, r); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	var validate func(http.Handler) http.Handler
+	if cfg.Server.ValidateRequests {
+		validator, err := openapi.NewValidator()
+		if err != nil {
+			fatal("failed to load the OpenAPI document", err)
+		}
+		validate = validator.Middleware
+	}
+	a := &api{
+		logger:         logger,
+		corsOrigins:    cfg.CORS.Origins,
+		trustedProxies: cfg.Server.TrustedProxies,
+		readiness:      readiness,
+		metrics:        metrics.Handler(metrics.NewRegistry(db, repository.NewStatsRepository(db)), logger),
+		limiter:        limiter,
+		authenticate:   middleware.Auth(authProvider, apiKeySvc),
+		validate:       validate,
+		worker:         middleware.Worker(workerSvc, authProvider),
+		tenant:         middleware.Tenant(repository.NewTenants(db), wcRepo),
+
+		auth:        handler.NewAuthHandler(authProvider, []byte(cfg.Auth.StateSecret)),
+		me:          handler.NewMeHandler(workerSvc, shiftSvc, shiftReportSvc, alarmSvc, locationSvc),
+		companies:   handler.NewCompanyHandler(companySvc, accessSvc),
+		worksites:   handler.NewWorksiteHandler(worksiteSvc, accessSvc),
+		workers:     handler.NewWorkerHandler(workerSvc, accessSvc),
+		shifts:      handler.NewShiftHandler(shiftSvc, accessSvc, idempotent),
+		reports:     handler.NewShiftReportHandler(shiftReportSvc, accessSvc, idempotent),
+		checkIns:    handler.NewLocationHandler(locationSvc, accessSvc, idempotent),
+		alarms:      handler.NewAlarmHandler(alarmSvc, accessSvc, idempotent),
+		apiKeys:     handler.NewAPIKeyHandler(apiKeySvc, accessSvc),
+		auditEvents: handler.NewAuditHandler(auditSvc, accessSvc),
+	}
+
+	if err := serve(cfg.Server, a.router(), readiness, logger); err != nil {
+		fatal("server failed", err)
 	}
 }
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Error(err))
+	os.Exit(1)
+}
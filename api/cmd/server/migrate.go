@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/migrate"
+	"github.com/chrishaylesai/sitesecurity/api/migrations"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up                apply every pending migration
+  down [n]          roll back the last n migrations (default 1)
+  status            list migrations and whether they are applied
+  redo              roll back the last migration and apply it again
+  baseline <version>
+                    record migrations up to version as applied without
+                    running them, for a database created before
+                    schema_migrations existed`
+
+// runMigrate runs a "server migrate" subcommand against db.
+func runMigrate(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		ran, err := m.Up(ctx)
+		logMigrations("applied migration", ran)
+		if err == nil && len(ran) == 0 {
+			slog.Info("schema is up to date")
+		}
+		return err
+
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return fmt.Errorf("invalid migration count %q", args[1])
+			}
+		}
+		ran, err := m.Down(ctx, n)
+		logMigrations("rolled back migration", ran)
+		return err
+
+	case "redo":
+		redone, err := m.Redo(ctx)
+		if redone != nil {
+			slog.Info("redid migration", slog.String("migration", redone.String()))
+		}
+		return err
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, s := range statuses {
+			state, at := "pending", ""
+			if s.AppliedAt != nil {
+				state, at = "applied", s.AppliedAt.UTC().Format("2006-01-02 15:04:05Z")
+			}
+			if s.Modified {
+				state = "modified"
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+		}
+		return w.Flush()
+
+	case "baseline":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := m.Baseline(ctx, version); err != nil {
+			return err
+		}
+		slog.Info("recorded migrations as applied", slog.Int("through_version", version))
+		return nil
+	}
+	return errors.New(migrateUsage)
+}
+
+func logMigrations(msg string, ran []migrate.Migration) {
+	for _, mig := range ran {
+		slog.Info(msg, slog.String("migration", mig.String()))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth/keycloak"
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth/oidc"
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+)
+
+// providerFactory builds an auth.Provider from configuration.
+type providerFactory func(ctx context.Context, cfg config.AuthConfig) (auth.Provider, error)
+
+func newOIDCProvider(ctx context.Context, cfg config.AuthConfig) (auth.Provider, error) {
+	return oidc.New(ctx, cfg)
+}
+
+// authProviders maps AUTH_PROVIDER values to their implementations. Hosted
+// providers are aliases for the generic discovery-driven OIDC provider.
+// Google is not among them: its access tokens are opaque rather than JWTs,
+// so they cannot be verified against its JWKS.
+var authProviders = map[string]providerFactory{
+	"keycloak": func(ctx context.Context, cfg config.AuthConfig) (auth.Provider, error) {
+		return keycloak.New(cfg)
+	},
+	"oidc":  newOIDCProvider,
+	"auth0": newOIDCProvider,
+	"entra": newOIDCProvider,
+	"dex":   newOIDCProvider,
+}
+
+// newAuthProvider selects and builds the provider named by cfg.Provider.
+func newAuthProvider(cfg config.AuthConfig) (auth.Provider, error) {
+	factory, ok := authProviders[strings.ToLower(cfg.Provider)]
+	if !ok {
+		names := make([]string, 0, len(authProviders))
+		for name := range authProviders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown AUTH_PROVIDER %q (supported: %s)", cfg.Provider, strings.Join(names, ", "))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return factory(ctx, cfg)
+}
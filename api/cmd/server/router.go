@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/openapi"
+	"github.com/chrishaylesai/sitesecurity/api/internal/ratelimit"
+)
+
+// api is everything the router serves, assembled by main.
+type api struct {
+	logger      *slog.Logger
+	corsOrigins string
+	// trustedProxies may set X-Forwarded-For.
+	trustedProxies []netip.Prefix
+	readiness      http.Handler
+	metrics        http.Handler
+	limiter        *ratelimit.Limiter
+	// authenticate, validate, worker and tenant are the protected routes'
+	// middleware: Auth, request validation against the OpenAPI document,
+	// Worker and Tenant. Any left nil is skipped.
+	authenticate func(http.Handler) http.Handler
+	validate     func(http.Handler) http.Handler
+	worker       func(http.Handler) http.Handler
+	tenant       func(http.Handler) http.Handler
+
+	auth        *handler.AuthHandler
+	me          *handler.MeHandler
+	companies   *handler.CompanyHandler
+	worksites   *handler.WorksiteHandler
+	workers     *handler.WorkerHandler
+	shifts      *handler.ShiftHandler
+	reports     *handler.ShiftReportHandler
+	checkIns    *handler.LocationHandler
+	alarms      *handler.AlarmHandler
+	apiKeys     *handler.APIKeyHandler
+	auditEvents *handler.AuditHandler
+}
+
+// router mounts every route. The OpenAPI document must describe each of
+// them; see router_test.go.
+func (a *api) router() chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RealIP(a.trustedProxies))
+	r.Use(middleware.Logging(a.logger))
+	r.Use(middleware.Metrics)
+	r.Use(middleware.Tracing)
+	r.Use(middleware.CORS(a.corsOrigins))
+
+	// Public routes. Probes and /metrics are served inside the cluster;
+	// the ingress only forwards /api to the API.
+	r.Get("/health", handler.Health)
+	r.Get("/livez", handler.Health)
+	r.Method(http.MethodGet, "/readyz", a.readiness)
+	r.Method(http.MethodGet, "/metrics", a.metrics)
+	r.Get("/api/v1/openapi.json", openapi.Document)
+	r.Get("/api/v1/docs", openapi.Docs)
+	r.With(middleware.RateLimitIP(a.limiter), middleware.RateLimit(a.limiter)).Mount("/api/v1/auth", a.auth.Routes())
+
+	// Protected routes run in a tenant session, so row-level security limits
+	// every query to the caller's companies, and audit their writes as the
+	// caller. API keys are limited to the resources their scopes name; "me",
+	// "companies", "api-keys" and "audit-events" are never granted to a key.
+	// Requests are rate limited by address before their credentials are
+	// checked, and callers by subject, and their requests validated, before
+	// their session takes a connection.
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RateLimitIP(a.limiter))
+		use(r, a.authenticate)
+		r.Use(middleware.RateLimit(a.limiter))
+		use(r, a.validate)
+		r.Use(middleware.Actor)
+		use(r, a.worker)
+		use(r, a.tenant)
+		r.With(middleware.RequireScope("me")).Mount("/api/v1/me", a.me.Routes())
+		r.With(middleware.RequireScope("companies")).Mount("/api/v1/companies", a.companies.Routes())
+		r.With(middleware.RequireScope("worksites")).Mount("/api/v1/worksites", a.worksites.Routes())
+		r.With(middleware.RequireScope("workers")).Mount("/api/v1/workers", a.workers.Routes())
+		r.With(middleware.RequireScope("shifts")).Mount("/api/v1/shifts", a.shifts.Routes())
+		r.With(middleware.RequireScope("reports")).Mount("/api/v1/shift-reports", a.reports.Routes())
+		r.With(middleware.RequireScope("check-ins")).Mount("/api/v1/check-ins", a.checkIns.Routes())
+		r.With(middleware.RequireScope("alarms")).Mount("/api/v1/alarms", a.alarms.Routes())
+		r.With(middleware.RequireScope("api-keys")).Mount("/api/v1/api-keys", a.apiKeys.Routes())
+		r.With(middleware.RequireScope("audit-events")).Mount("/api/v1/audit-events", a.auditEvents.Routes())
+	})
+	return r
+}
+
+func use(r chi.Router, mw func(http.Handler) http.Handler) {
+	if mw != nil {
+		r.Use(mw)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/ratelimit"
+)
+
+// testRouter mounts every route without the services behind them, as the
+// routes are only listed, never served.
+func testRouter() chi.Router {
+	a := &api{
+		logger:    slog.New(slog.DiscardHandler),
+		readiness: http.NotFoundHandler(),
+		metrics:   http.NotFoundHandler(),
+		limiter:   ratelimit.New(ratelimit.NewMemoryStore(), config.RateLimitConfig{}),
+
+		auth:        handler.NewAuthHandler(nil, []byte("test")),
+		me:          handler.NewMeHandler(nil, nil, nil, nil, nil),
+		companies:   handler.NewCompanyHandler(nil, nil),
+		worksites:   handler.NewWorksiteHandler(nil, nil),
+		workers:     handler.NewWorkerHandler(nil, nil),
+		shifts:      handler.NewShiftHandler(nil, nil, nil),
+		reports:     handler.NewShiftReportHandler(nil, nil, nil),
+		checkIns:    handler.NewLocationHandler(nil, nil, nil),
+		alarms:      handler.NewAlarmHandler(nil, nil, nil),
+		apiKeys:     handler.NewAPIKeyHandler(nil, nil),
+		auditEvents: handler.NewAuditHandler(nil, nil),
+	}
+	return a.router()
+}
+
+type specParameter struct {
+	Name string `json:"name"`
+	In   string `json:"in"`
+	Ref  string `json:"$ref"`
+}
+
+type specOperation struct {
+	Parameters []specParameter `json:"parameters"`
+}
+
+// specDocument is the part of the OpenAPI document routes are checked
+// against.
+type specDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Parameters map[string]specParameter `json:"parameters"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T, r chi.Router) specDocument {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the document to be served, got %d", rr.Code)
+	}
+	var doc specDocument
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode the document: %v", err)
+	}
+	return doc
+}
+
+// routes lists the router's routes as "METHOD /path", written the way the
+// document writes them: without the trailing slash of a mounted "/".
+func routes(t *testing.T, r chi.Router) []string {
+	t.Helper()
+	var found []string
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		found = append(found, method+" "+route)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk routes: %v", err)
+	}
+	sort.Strings(found)
+	return slices.Compact(found)
+}
+
+func TestRouter_MatchesOpenAPIDocument(t *testing.T) {
+	r := testRouter()
+	doc := loadSpec(t, r)
+
+	var documented []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method != "parameters" {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(documented)
+	mounted := routes(t, r)
+
+	for _, route := range mounted {
+		if _, found := slices.BinarySearch(documented, route); !found {
+			t.Errorf("route %s is not in openapi.json", route)
+		}
+	}
+	for _, op := range documented {
+		if _, found := slices.BinarySearch(mounted, op); !found {
+			t.Errorf("openapi.json describes %s, which is not mounted", op)
+		}
+	}
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Every parameter in a path must be declared, by the path or by each of
+// its operations, and no others.
+func TestRouter_OpenAPIPathParameters(t *testing.T) {
+	doc := loadSpec(t, testRouter())
+
+	// declared lists the path parameters among params.
+	declared := func(params []specParameter) []string {
+		var names []string
+		for _, p := range params {
+			if p.Ref != "" {
+				p = doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+			}
+			if p.In == "path" {
+				names = append(names, p.Name)
+			}
+		}
+		return names
+	}
+
+	for path, item := range doc.Paths {
+		var want []string
+		for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+			want = append(want, m[1])
+		}
+		sort.Strings(want)
+
+		var shared []specParameter
+		if raw, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				t.Fatalf("failed to decode the parameters of %s: %v", path, err)
+			}
+		}
+		for method, raw := range item {
+			if method == "parameters" {
+				continue
+			}
+			var op specOperation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				t.Fatalf("failed to decode %s %s: %v", method, path, err)
+			}
+			got := append(declared(shared), declared(op.Parameters)...)
+			sort.Strings(got)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s %s declares path parameters %v, want %v", strings.ToUpper(method), path, got, want)
+			}
+		}
+	}
+}
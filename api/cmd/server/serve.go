@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+)
+
+// serve runs the API until SIGTERM or an interrupt. It then reports itself
+// unready for cfg.DrainDelay while still serving, so Kubernetes removes the
+// pod from its endpoints before the listener closes, and lets in-flight
+// requests finish within cfg.ShutdownTimeout.
+func serve(cfg config.ServerConfig, h http.Handler, readiness *handler.Readiness, logger *slog.Logger) error {
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           h,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	failed := make(chan error, 1)
+	go func() {
+		logger.Info("starting server", slog.String("port", cfg.Port))
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	logger.Info("draining", slog.Duration("delay", cfg.DrainDelay))
+	readiness.Drain()
+	time.Sleep(cfg.DrainDelay)
+
+	logger.Info("shutting down", slog.Duration("timeout", cfg.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	logger.Info("server stopped")
+	return nil
+}
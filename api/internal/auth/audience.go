@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+)
+
+// Audiences returns the token audiences a provider accepts: the
+// comma-separated AUTH_AUDIENCE, defaulting to the API's own client ID.
+func Audiences(cfg config.AuthConfig) []string {
+	var result []string
+	for _, a := range strings.Split(cfg.Audience, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			result = append(result, a)
+		}
+	}
+	if len(result) == 0 && cfg.ClientID != "" {
+		result = []string{cfg.ClientID}
+	}
+	return result
+}
@@ -0,0 +1,202 @@
+// Package jwks verifies JWTs against the signing keys an identity provider
+// publishes as a JSON Web Key Set.
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultMinRefreshInterval limits how often an unknown key ID can force the
+// key set to be refetched, so a stream of forged tokens cannot hammer the
+// identity provider.
+const DefaultMinRefreshInterval = 30 * time.Second
+
+// DefaultCacheTTL is how long a fetched key set is trusted before it is
+// refreshed in the background of the next lookup.
+const DefaultCacheTTL = time.Hour
+
+// Set fetches and caches a JSON Web Key Set. Keys are looked up by their
+// "kid" header; an unknown kid triggers a refetch so rotated keys are picked
+// up without a restart.
+type Set struct {
+	url        string
+	httpClient *http.Client
+	minRefresh time.Duration
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu        sync.RWMutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+// NewSet creates a key set that is loaded lazily from url.
+func NewSet(url string, httpClient *http.Client) *Set {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Set{
+		url:        url,
+		httpClient: httpClient,
+		minRefresh: DefaultMinRefreshInterval,
+		ttl:        DefaultCacheTTL,
+		now:        time.Now,
+	}
+}
+
+// SetMinRefreshInterval overrides DefaultMinRefreshInterval. Tests use it to
+// exercise rotation without waiting.
+func (s *Set) SetMinRefreshInterval(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minRefresh = d
+}
+
+// Key returns the public key for kid, refetching the set if the kid is
+// unknown or the cache has expired.
+func (s *Set) Key(ctx context.Context, kid string) (interface{}, error) {
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	fresh := !s.fetchedAt.IsZero() && s.now().Sub(s.fetchedAt) < s.ttl
+	canRefresh := s.fetchedAt.IsZero() || s.now().Sub(s.fetchedAt) >= s.minRefresh
+	s.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+	if !canRefresh {
+		if ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if err := s.refresh(ctx); err != nil {
+		if ok {
+			// Keep serving the cached key if the provider is briefly unreachable.
+			return key, nil
+		}
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok = s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (s *Set) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create jwks request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("jwks request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip keys we cannot use rather than rejecting the whole set.
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.fetchedAt = s.now()
+	s.mu.Unlock()
+	return nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key parameter: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,253 @@
+package jwks_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth/jwks"
+)
+
+const testIssuer = "https://idp.example.com/realms/test"
+
+// jwksServer is a local JWKS endpoint whose keys can be rotated mid-test.
+type jwksServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	keys     map[string]*rsa.PrivateKey
+	requests int
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: map[string]*rsa.PrivateKey{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+
+		var keys []map[string]string
+		for kid, key := range s.keys {
+			keys = append(keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) addKey(t *testing.T, kid string) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	s.mu.Lock()
+	s.keys[kid] = key
+	s.mu.Unlock()
+	return key
+}
+
+func (s *jwksServer) removeKey(kid string) {
+	s.mu.Lock()
+	delete(s.keys, kid)
+	s.mu.Unlock()
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": testIssuer,
+		"sub": "user-123",
+		"aud": "sitesecurity-api",
+		"azp": "sitesecurity-frontend",
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+func newVerifier(srv *jwksServer) *jwks.Verifier {
+	keys := jwks.NewSet(srv.URL, srv.Client())
+	keys.SetMinRefreshInterval(0)
+	return jwks.NewVerifier(keys, jwks.Options{
+		Issuer:    testIssuer,
+		Audiences: []string{"sitesecurity-api"},
+		ClockSkew: 30 * time.Second,
+	})
+}
+
+func TestVerify_ValidToken(t *testing.T) {
+	srv := newJWKSServer(t)
+	key := srv.addKey(t, "k1")
+	v := newVerifier(srv)
+
+	claims, err := v.Verify(context.Background(), sign(t, key, "k1", validClaims()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims["sub"] != "user-123" {
+		t.Errorf("expected sub 'user-123', got '%v'", claims["sub"])
+	}
+}
+
+func TestVerify_CachesKeySet(t *testing.T) {
+	srv := newJWKSServer(t)
+	key := srv.addKey(t, "k1")
+	v := newVerifier(srv)
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(context.Background(), sign(t, key, "k1", validClaims())); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if srv.requests != 1 {
+		t.Errorf("expected 1 jwks fetch, got %d", srv.requests)
+	}
+}
+
+func TestVerify_KeyRotation(t *testing.T) {
+	srv := newJWKSServer(t)
+	oldKey := srv.addKey(t, "old")
+	v := newVerifier(srv)
+
+	if _, err := v.Verify(context.Background(), sign(t, oldKey, "old", validClaims())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	newKey := srv.addKey(t, "new")
+	srv.removeKey("old")
+
+	if _, err := v.Verify(context.Background(), sign(t, newKey, "new", validClaims())); err != nil {
+		t.Fatalf("expected rotated key to be accepted, got: %v", err)
+	}
+	if srv.requests != 2 {
+		t.Errorf("expected unknown kid to trigger a refetch, got %d fetches", srv.requests)
+	}
+}
+
+func TestVerify_UnknownKidRateLimited(t *testing.T) {
+	srv := newJWKSServer(t)
+	key := srv.addKey(t, "k1")
+	keys := jwks.NewSet(srv.URL, srv.Client())
+	v := jwks.NewVerifier(keys, jwks.Options{Issuer: testIssuer})
+
+	if _, err := v.Verify(context.Background(), sign(t, key, "k1", validClaims())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := v.Verify(context.Background(), sign(t, key, "forged", validClaims())); err == nil {
+			t.Fatal("expected error for unknown kid")
+		}
+	}
+	if srv.requests != 1 {
+		t.Errorf("expected unknown kids not to refetch within the refresh interval, got %d fetches", srv.requests)
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	srv := newJWKSServer(t)
+	key := srv.addKey(t, "k1")
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	v := newVerifier(srv)
+
+	with := func(mutate func(jwt.MapClaims)) jwt.MapClaims {
+		c := validClaims()
+		mutate(c)
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong signature", sign(t, otherKey, "k1", validClaims())},
+		{"unsigned", func() string {
+			s, _ := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return s
+		}()},
+		{"hmac", func() string {
+			tok := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+			tok.Header["kid"] = "k1"
+			s, _ := tok.SignedString([]byte("secret"))
+			return s
+		}()},
+		{"wrong issuer", sign(t, key, "k1", with(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }))},
+		{"wrong audience", sign(t, key, "k1", with(func(c jwt.MapClaims) { c["aud"] = "other"; c["azp"] = "other" }))},
+		{"expired", sign(t, key, "k1", with(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }))},
+		{"missing exp", sign(t, key, "k1", with(func(c jwt.MapClaims) { delete(c, "exp") }))},
+		{"not yet valid", sign(t, key, "k1", with(func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Minute).Unix() }))},
+		{"garbage", "not-a-jwt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), tt.token)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !errors.Is(err, auth.ErrInvalidToken) {
+				t.Errorf("expected auth.ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_AuthorizedPartyAccepted(t *testing.T) {
+	srv := newJWKSServer(t)
+	key := srv.addKey(t, "k1")
+	v := newVerifier(srv)
+
+	claims := validClaims()
+	claims["aud"] = "account"
+	claims["azp"] = "sitesecurity-api"
+
+	if _, err := v.Verify(context.Background(), sign(t, key, "k1", claims)); err != nil {
+		t.Fatalf("expected azp match to be accepted, got: %v", err)
+	}
+}
+
+func TestVerify_ClockSkew(t *testing.T) {
+	srv := newJWKSServer(t)
+	key := srv.addKey(t, "k1")
+	v := newVerifier(srv)
+
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-10 * time.Second).Unix()
+	claims["nbf"] = time.Now().Add(10 * time.Second).Unix()
+
+	if _, err := v.Verify(context.Background(), sign(t, key, "k1", claims)); err != nil {
+		t.Fatalf("expected token within clock skew to be accepted, got: %v", err)
+	}
+}
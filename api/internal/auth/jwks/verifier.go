@@ -0,0 +1,108 @@
+package jwks
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+)
+
+// signingMethods are the algorithms accepted from the identity provider.
+// "none" and the HMAC family are deliberately excluded.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Options configures which tokens a Verifier accepts.
+type Options struct {
+	// Issuer must match the token's "iss" claim exactly.
+	Issuer string
+	// Audiences lists the client IDs the token must be intended for. A token
+	// is accepted if any "aud" value or its "azp" claim is in the list.
+	// An empty list disables the audience check.
+	Audiences []string
+	// ClockSkew is the leeway applied to "exp", "nbf" and "iat".
+	ClockSkew time.Duration
+}
+
+// Verifier checks JWT signatures against a key Set and validates the
+// registered claims.
+type Verifier struct {
+	keys *Set
+	opts Options
+}
+
+// NewVerifier creates a Verifier backed by keys.
+func NewVerifier(keys *Set, opts Options) *Verifier {
+	return &Verifier{keys: keys, opts: opts}
+}
+
+// Verify parses tokenStr, verifies its signature and claims, and returns
+// the claims. All failures wrap auth.ErrInvalidToken.
+func (v *Verifier) Verify(ctx context.Context, tokenStr string) (jwt.MapClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(v.opts.Issuer),
+		jwt.WithLeeway(v.opts.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", auth.ErrInvalidToken, err)
+	}
+
+	if err := v.checkAudience(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", auth.ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+// VerifyIDToken verifies an ID token like Verify and additionally requires
+// its "nonce" claim to equal nonce, binding the token to the login request
+// that asked for it.
+func (v *Verifier) VerifyIDToken(ctx context.Context, tokenStr, nonce string) (jwt.MapClaims, error) {
+	claims, err := v.Verify(ctx, tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	got, _ := claims["nonce"].(string)
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", auth.ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) checkAudience(claims jwt.MapClaims) error {
+	if len(v.opts.Audiences) == 0 {
+		return nil
+	}
+
+	aud, err := claims.GetAudience()
+	if err != nil {
+		return err
+	}
+	azp, _ := claims["azp"].(string)
+
+	for _, allowed := range v.opts.Audiences {
+		if azp == allowed {
+			return nil
+		}
+		for _, a := range aud {
+			if a == allowed {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("token audience %v (azp %q) is not accepted", []string(aud), azp)
+}
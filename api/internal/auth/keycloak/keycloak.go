@@ -7,54 +7,85 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth/jwks"
 	"github.com/chrishaylesai/sitesecurity/api/internal/config"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/chrishaylesai/sitesecurity/api/internal/tracing"
 )
 
 // Provider implements auth.Provider for Keycloak.
 type Provider struct {
-	issuerURL    string
-	clientID     string
-	clientSecret string
-	redirectURL  string
-	httpClient   *http.Client
+	issuerURL             string
+	clientID              string
+	clientSecret          string
+	redirectURL           string
+	postLogoutRedirectURL string
+	httpClient            *http.Client
+	verifier              *jwks.Verifier
+	idTokenVerifier       *jwks.Verifier
+	mapper                *auth.ClaimMapper
 }
 
 // New creates a new Keycloak auth provider.
-func New(cfg config.AuthConfig) *Provider {
-	return &Provider{
-		issuerURL:    cfg.IssuerURL,
-		clientID:     cfg.ClientID,
-		clientSecret: cfg.ClientSecret,
-		redirectURL:  cfg.RedirectURL,
-		httpClient:   &http.Client{},
+func New(cfg config.AuthConfig) (*Provider, error) {
+	mapper, err := auth.NewClaimMapper(cfg.ClaimMappings, cfg.ClientID)
+	if err != nil {
+		return nil, err
 	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second, Transport: tracing.NewTransport(nil)}
+	keys := jwks.NewSet(cfg.IssuerURL+"/protocol/openid-connect/certs", httpClient)
+
+	tokenIssuer := cfg.TokenIssuer
+	if tokenIssuer == "" {
+		tokenIssuer = cfg.IssuerURL
+	}
+
+	return &Provider{
+		issuerURL:             cfg.IssuerURL,
+		clientID:              cfg.ClientID,
+		clientSecret:          cfg.ClientSecret,
+		redirectURL:           cfg.RedirectURL,
+		postLogoutRedirectURL: cfg.PostLogoutRedirectURL,
+		httpClient:            httpClient,
+		verifier: jwks.NewVerifier(keys, jwks.Options{
+			Issuer:    tokenIssuer,
+			Audiences: auth.Audiences(cfg),
+			ClockSkew: cfg.ClockSkew,
+		}),
+		idTokenVerifier: jwks.NewVerifier(keys, jwks.Options{
+			Issuer:    tokenIssuer,
+			Audiences: []string{cfg.ClientID},
+			ClockSkew: cfg.ClockSkew,
+		}),
+		mapper: mapper,
+	}, nil
 }
 
-// ValidateToken verifies a Keycloak access token and returns its claims.
+// ValidateToken verifies a Keycloak access token's signature against the
+// realm JWKS, checks iss, aud/azp, exp and nbf, and returns its claims.
 func (p *Provider) ValidateToken(ctx context.Context, tokenStr string) (*auth.Claims, error) {
-	// Parse the token without verification first to extract claims.
-	// In production, you would verify the signature using Keycloak's JWKS endpoint.
-	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
-	token, _, err := parser.ParseUnverified(tokenStr, jwt.MapClaims{})
+	mapClaims, err := p.verifier.Verify(ctx, tokenStr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
-	}
-
-	mapClaims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid token claims")
+		return nil, err
 	}
 
 	claims := &auth.Claims{
-		Subject: getStringClaim(mapClaims, "sub"),
-		Email:   getStringClaim(mapClaims, "email"),
-		Name:    getStringClaim(mapClaims, "name"),
-		Roles:   extractRoles(mapClaims),
+		Subject:       getStringClaim(mapClaims, "sub"),
+		Email:         getStringClaim(mapClaims, "email"),
+		EmailVerified: mapClaims["email_verified"] == true,
+		Name:          getStringClaim(mapClaims, "name"),
+		GivenName:     getStringClaim(mapClaims, "given_name"),
+		FamilyName:    getStringClaim(mapClaims, "family_name"),
+		Roles:         p.extractRoles(mapClaims),
 	}
+	p.mapper.Apply(ctx, mapClaims, claims)
 
 	return claims, nil
 }
@@ -86,39 +117,135 @@ func (p *Provider) GetUserInfo(ctx context.Context, token string) (*auth.UserInf
 	}
 
 	info := &auth.UserInfo{
-		Subject:   getStringFromMap(result, "sub"),
-		Email:     getStringFromMap(result, "email"),
-		FirstName: getStringFromMap(result, "given_name"),
-		LastName:  getStringFromMap(result, "family_name"),
+		Subject:       getStringFromMap(result, "sub"),
+		Email:         getStringFromMap(result, "email"),
+		EmailVerified: result["email_verified"] == true,
+		FirstName:     getStringFromMap(result, "given_name"),
+		LastName:      getStringFromMap(result, "family_name"),
 	}
 
 	return info, nil
 }
 
 // GetLoginURL returns the Keycloak authorization endpoint URL.
-func (p *Provider) GetLoginURL(state string) string {
+func (p *Provider) GetLoginURL(req auth.LoginRequest) string {
 	authURL := p.issuerURL + "/protocol/openid-connect/auth"
 	params := url.Values{
 		"client_id":     {p.clientID},
 		"redirect_uri":  {p.redirectURL},
 		"response_type": {"code"},
 		"scope":         {"openid profile email"},
-		"state":         {state},
+		"state":         {req.State},
+	}
+	if req.Nonce != "" {
+		params.Set("nonce", req.Nonce)
+	}
+	if req.CodeChallenge != "" {
+		params.Set("code_challenge", req.CodeChallenge)
+		params.Set("code_challenge_method", "S256")
 	}
 	return authURL + "?" + params.Encode()
 }
 
 // ExchangeCode exchanges an authorization code for tokens.
-func (p *Provider) ExchangeCode(ctx context.Context, code string) (*auth.TokenSet, error) {
-	tokenURL := p.issuerURL + "/protocol/openid-connect/token"
-
+func (p *Provider) ExchangeCode(ctx context.Context, req auth.CodeExchange) (*auth.TokenSet, error) {
 	data := url.Values{
-		"grant_type":    {"authorization_code"},
-		"code":          {code},
-		"redirect_uri":  {p.redirectURL},
-		"client_id":     {p.clientID},
-		"client_secret": {p.clientSecret},
+		"grant_type":   {"authorization_code"},
+		"code":         {req.Code},
+		"redirect_uri": {p.redirectURL},
+	}
+	if req.CodeVerifier != "" {
+		data.Set("code_verifier", req.CodeVerifier)
+	}
+
+	tokens, err := p.tokenRequest(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Nonce != "" {
+		if _, err := p.idTokenVerifier.VerifyIDToken(ctx, tokens.IDToken, req.Nonce); err != nil {
+			return nil, fmt.Errorf("failed to verify id token: %w", err)
+		}
+	}
+
+	return tokens, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token set.
+func (p *Provider) RefreshToken(ctx context.Context, refreshToken string) (*auth.TokenSet, error) {
+	return p.tokenRequest(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+// Logout ends the Keycloak session. When a refresh token is supplied the
+// session is terminated server-side through the logout endpoint and the
+// token is then revoked, so it is rejected even if it outlives the session
+// (an offline token does); the returned URL lets the browser clear
+// Keycloak's SSO cookie as well.
+func (p *Provider) Logout(ctx context.Context, req auth.LogoutRequest) (string, error) {
+	logoutURL := p.issuerURL + "/protocol/openid-connect/logout"
+
+	if req.RefreshToken != "" {
+		if err := p.postForm(ctx, logoutURL, url.Values{"refresh_token": {req.RefreshToken}}); err != nil {
+			return "", fmt.Errorf("failed to end session: %w", err)
+		}
+		if err := p.RevokeToken(ctx, req.RefreshToken, "refresh_token"); err != nil {
+			return "", err
+		}
+	}
+
+	params := url.Values{"client_id": {p.clientID}}
+	if p.postLogoutRedirectURL != "" {
+		params.Set("post_logout_redirect_uri", p.postLogoutRedirectURL)
 	}
+	if req.IDTokenHint != "" {
+		params.Set("id_token_hint", req.IDTokenHint)
+	}
+	return logoutURL + "?" + params.Encode(), nil
+}
+
+// RevokeToken revokes an access or refresh token (RFC 7009).
+func (p *Provider) RevokeToken(ctx context.Context, token, tokenTypeHint string) error {
+	data := url.Values{"token": {token}}
+	if tokenTypeHint != "" {
+		data.Set("token_type_hint", tokenTypeHint)
+	}
+	if err := p.postForm(ctx, p.issuerURL+"/protocol/openid-connect/revoke", data); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// Ready implements auth.ReadinessChecker by fetching the realm's discovery
+// document.
+func (p *Provider) Ready(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create discovery request: %w", err)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovery request failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// tokenRequest calls the token endpoint with client credentials.
+func (p *Provider) tokenRequest(ctx context.Context, data url.Values) (*auth.TokenSet, error) {
+	tokenURL := p.issuerURL + "/protocol/openid-connect/token"
+
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(data.Encode()))
 	if err != nil {
@@ -128,13 +255,13 @@ func (p *Provider) ExchangeCode(ctx context.Context, code string) (*auth.TokenSe
 
 	resp, err := p.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to exchange code: %w", err)
+		return nil, fmt.Errorf("failed to call token endpoint: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("token exchange failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	var result struct {
@@ -155,6 +282,31 @@ func (p *Provider) ExchangeCode(ctx context.Context, code string) (*auth.TokenSe
 	}, nil
 }
 
+// postForm sends an authenticated form POST to a Keycloak endpoint that
+// answers with an empty 200 or 204 on success.
+func (p *Provider) postForm(ctx context.Context, endpoint string, data url.Values) error {
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
 func getStringClaim(claims jwt.MapClaims, key string) string {
 	if val, ok := claims[key]; ok {
 		if s, ok := val.(string); ok {
@@ -173,19 +325,18 @@ func getStringFromMap(m map[string]interface{}, key string) string {
 	return ""
 }
 
-func extractRoles(claims jwt.MapClaims) []string {
-	var roles []string
-
-	// Extract realm roles
-	if realmAccess, ok := claims["realm_access"].(map[string]interface{}); ok {
-		if rolesArr, ok := realmAccess["roles"].([]interface{}); ok {
-			for _, r := range rolesArr {
-				if s, ok := r.(string); ok {
-					roles = append(roles, s)
+// extractRoles returns the realm roles and this client's roles. Groups and
+// other clients' roles are only honoured through claim mapping rules.
+func (p *Provider) extractRoles(claims jwt.MapClaims) []string {
+	roles := auth.ClaimStrings(claims, "realm_access.roles")
+	if resourceAccess, ok := claims["resource_access"].(map[string]interface{}); ok {
+		if client, ok := resourceAccess[p.clientID].(map[string]interface{}); ok {
+			for _, role := range auth.ClaimStrings(client, "roles") {
+				if !slices.Contains(roles, role) {
+					roles = append(roles, role)
 				}
 			}
 		}
 	}
-
 	return roles
 }
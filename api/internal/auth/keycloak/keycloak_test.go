@@ -0,0 +1,368 @@
+package keycloak_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth/keycloak"
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/tracing/tracingtest"
+)
+
+// fakeKeycloak serves the realm endpoints the provider talks to.
+type fakeKeycloak struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	// refreshTokens maps valid refresh tokens to the access token issued
+	// for them; logout and revoke delete entries.
+	refreshTokens map[string]string
+	revoked       []string
+	// traceparent is the trace context of the last token request.
+	traceparent string
+}
+
+func newFakeKeycloak(t *testing.T) *fakeKeycloak {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	kc := &fakeKeycloak{key: key, refreshTokens: map[string]string{"refresh-1": "access-2"}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/realms/test/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": kc.issuer()})
+	})
+	mux.HandleFunc("/realms/test/protocol/openid-connect/certs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "realm-key",
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/realms/test/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		kc.traceparent = r.Header.Get("traceparent")
+		r.ParseForm()
+		if r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		access, ok := kc.refreshTokens[r.PostForm.Get("refresh_token")]
+		if r.PostForm.Get("grant_type") != "refresh_token" || !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  access,
+			"refresh_token": "refresh-2",
+			"expires_in":    300,
+		})
+	})
+	mux.HandleFunc("/realms/test/protocol/openid-connect/logout", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if _, ok := kc.refreshTokens[r.PostForm.Get("refresh_token")]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(kc.refreshTokens, r.PostForm.Get("refresh_token"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/realms/test/protocol/openid-connect/revoke", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		kc.revoked = append(kc.revoked, r.PostForm.Get("token"))
+		delete(kc.refreshTokens, r.PostForm.Get("token"))
+		w.WriteHeader(http.StatusOK)
+	})
+	kc.Server = httptest.NewServer(mux)
+	t.Cleanup(kc.Close)
+	return kc
+}
+
+func (kc *fakeKeycloak) issuer() string {
+	return kc.URL + "/realms/test"
+}
+
+func (kc *fakeKeycloak) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "realm-key"
+	s, err := token.SignedString(kc.key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return s
+}
+
+func (kc *fakeKeycloak) provider(t *testing.T, mappings ...config.ClaimMapping) *keycloak.Provider {
+	t.Helper()
+	p, err := keycloak.New(config.AuthConfig{
+		IssuerURL:             kc.issuer(),
+		ClientID:              "sitesecurity-api",
+		ClientSecret:          "secret",
+		PostLogoutRedirectURL: "http://localhost:3000",
+		ClockSkew:             30 * time.Second,
+		ClaimMappings:         mappings,
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	return p
+}
+
+func accessTokenClaims(issuer string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   issuer,
+		"sub":   "f3b0c6a2-1111-4a4a-9c9c-000000000001",
+		"aud":   []string{"sitesecurity-api", "account"},
+		"azp":   "sitesecurity-frontend",
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"email": "john.smith@sitesecurity.local",
+		"name":  "John Smith",
+		"realm_access": map[string]interface{}{
+			"roles": []string{"worker", "default-roles-sitesecurity"},
+		},
+	}
+}
+
+func TestValidateToken_Valid(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p := kc.provider(t)
+
+	claims, err := p.ValidateToken(context.Background(), kc.sign(t, accessTokenClaims(kc.issuer())))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Email != "john.smith@sitesecurity.local" {
+		t.Errorf("expected email 'john.smith@sitesecurity.local', got '%s'", claims.Email)
+	}
+	if len(claims.Roles) != 2 || claims.Roles[0] != "worker" {
+		t.Errorf("expected realm roles, got %v", claims.Roles)
+	}
+}
+
+func TestValidateToken_ClientRolesAndGroups(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p := kc.provider(t,
+		config.ClaimMapping{Claim: "groups", Match: "/companies/([^/]+)/admins", Company: "$1", Role: "company_admin"},
+		config.ClaimMapping{Claim: "groups", Match: "/companies/([^/]+)/site-admins", Company: "$1", Role: "site_admin"},
+		config.ClaimMapping{Claim: "https://sitesecurity.example/roles", Match: "ss-(.+)", Role: "$1"},
+	)
+
+	claims := accessTokenClaims(kc.issuer())
+	claims["resource_access"] = map[string]interface{}{
+		"sitesecurity-api": map[string]interface{}{"roles": []string{"site_admin", "worker"}},
+		"account":          map[string]interface{}{"roles": []string{"manage-account"}},
+	}
+	claims["groups"] = []string{"/companies/a1b2c3d4-0001-4000-8000-000000000001/admins", "/companies/a1b2c3d4-0001-4000-8000-000000000002/site-admins", "/staff"}
+	claims["https://sitesecurity.example/roles"] = []string{"ss-auditor", "unrelated"}
+
+	got, err := p.ValidateToken(context.Background(), kc.sign(t, claims))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantRoles := []string{"worker", "default-roles-sitesecurity", "site_admin", "auditor"}
+	if !reflect.DeepEqual(got.Roles, wantRoles) {
+		t.Errorf("expected roles %v, got %v", wantRoles, got.Roles)
+	}
+	wantCompanies := []auth.CompanyRole{
+		{CompanyID: "a1b2c3d4-0001-4000-8000-000000000001", Role: "company_admin"},
+		{CompanyID: "a1b2c3d4-0001-4000-8000-000000000002", Role: "site_admin"},
+	}
+	if !reflect.DeepEqual(got.CompanyRoles, wantCompanies) {
+		t.Errorf("expected company roles %v, got %v", wantCompanies, got.CompanyRoles)
+	}
+}
+
+func TestNew_InvalidClaimMapping(t *testing.T) {
+	_, err := keycloak.New(config.AuthConfig{
+		IssuerURL:     "http://keycloak/realms/test",
+		ClientID:      "sitesecurity-api",
+		ClaimMappings: []config.ClaimMapping{{Claim: "groups", Match: "/companies/([^/]+"}},
+	})
+	if err == nil {
+		t.Fatal("expected an invalid match pattern to be rejected")
+	}
+}
+
+func TestValidateToken_ForgedToken(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p := kc.provider(t)
+
+	// A token carrying admin roles but signed with an attacker's key.
+	forger, _ := rsa.GenerateKey(rand.Reader, 2048)
+	claims := accessTokenClaims(kc.issuer())
+	claims["realm_access"] = map[string]interface{}{"roles": []string{"company_admin"}}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "realm-key"
+	forged, _ := token.SignedString(forger)
+
+	if _, err := p.ValidateToken(context.Background(), forged); err == nil {
+		t.Fatal("expected forged token to be rejected")
+	}
+}
+
+func TestValidateToken_TokenIssuerOverride(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p, err := keycloak.New(config.AuthConfig{
+		IssuerURL:   kc.issuer(),
+		TokenIssuer: "http://localhost:8180/realms/test",
+		ClientID:    "sitesecurity-api",
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	if _, err := p.ValidateToken(context.Background(), kc.sign(t, accessTokenClaims("http://localhost:8180/realms/test"))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := p.ValidateToken(context.Background(), kc.sign(t, accessTokenClaims(kc.issuer()))); err == nil {
+		t.Fatal("expected token from the internal issuer to be rejected")
+	}
+}
+
+func TestValidateToken_WrongAudience(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p := kc.provider(t)
+
+	claims := accessTokenClaims(kc.issuer())
+	claims["aud"] = "account"
+	claims["azp"] = "some-other-client"
+
+	if _, err := p.ValidateToken(context.Background(), kc.sign(t, claims)); err == nil {
+		t.Fatal("expected token for another client to be rejected")
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p := kc.provider(t)
+
+	tokens, err := p.RefreshToken(context.Background(), "refresh-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tokens.AccessToken != "access-2" || tokens.RefreshToken != "refresh-2" {
+		t.Errorf("unexpected token set: %+v", tokens)
+	}
+
+	if _, err := p.RefreshToken(context.Background(), "unknown"); err == nil {
+		t.Fatal("expected error for invalid refresh token")
+	}
+}
+
+func TestRefreshToken_Traced(t *testing.T) {
+	spans := tracingtest.Record(t)
+	kc := newFakeKeycloak(t)
+	p := kc.provider(t)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "login")
+	if _, err := p.RefreshToken(ctx, "refresh-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	call := tracingtest.Find(t, spans, "POST /realms/test/protocol/openid-connect/token")
+	if call.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected the token request to be a child of the caller's span")
+	}
+	if !strings.Contains(kc.traceparent, parent.SpanContext().TraceID().String()) {
+		t.Errorf("expected the trace context to reach Keycloak, got traceparent %q", kc.traceparent)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p := kc.provider(t)
+
+	logoutURL, err := p.Logout(context.Background(), auth.LogoutRequest{
+		RefreshToken: "refresh-1",
+		IDTokenHint:  "id-token",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := kc.refreshTokens["refresh-1"]; ok {
+		t.Error("expected session to be ended server-side")
+	}
+	if len(kc.revoked) != 1 || kc.revoked[0] != "refresh-1" {
+		t.Errorf("expected refresh-1 to be revoked, got %v", kc.revoked)
+	}
+
+	u, _ := url.Parse(logoutURL)
+	if u.Path != "/realms/test/protocol/openid-connect/logout" {
+		t.Errorf("unexpected end-session path %s", u.Path)
+	}
+	if u.Query().Get("id_token_hint") != "id-token" || u.Query().Get("post_logout_redirect_uri") != "http://localhost:3000" {
+		t.Errorf("unexpected end-session parameters: %s", u.RawQuery)
+	}
+
+	if _, err := p.Logout(context.Background(), auth.LogoutRequest{RefreshToken: "refresh-1"}); err == nil {
+		t.Fatal("expected error when the session is already gone")
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p := kc.provider(t)
+
+	if err := p.RevokeToken(context.Background(), "refresh-1", "refresh_token"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(kc.revoked) != 1 || kc.revoked[0] != "refresh-1" {
+		t.Errorf("expected refresh-1 to be revoked, got %v", kc.revoked)
+	}
+	if _, err := p.RefreshToken(context.Background(), "refresh-1"); err == nil {
+		t.Fatal("expected revoked refresh token to be rejected")
+	}
+}
+
+func TestReady(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p := kc.provider(t)
+
+	if err := p.Ready(context.Background()); err != nil {
+		t.Fatalf("expected realm to be ready, got %v", err)
+	}
+
+	kc.Close()
+	if err := p.Ready(context.Background()); err == nil {
+		t.Fatal("expected error once Keycloak is unreachable")
+	}
+}
+
+func TestReady_UnknownRealm(t *testing.T) {
+	kc := newFakeKeycloak(t)
+	p, err := keycloak.New(config.AuthConfig{IssuerURL: kc.URL + "/realms/missing", ClientID: "sitesecurity-api"})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	if err := p.Ready(context.Background()); err == nil {
+		t.Fatal("expected error for a realm without a discovery document")
+	}
+}
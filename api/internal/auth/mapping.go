@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+)
+
+// companyIDPattern matches the canonical UUID form company IDs take.
+var companyIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// CompanyRole is a role the identity provider grants within one company,
+// e.g. from membership of a /companies/<id>/admins group.
+type CompanyRole struct {
+	CompanyID string
+	Role      string
+}
+
+// ClaimMapper applies config.ClaimMapping rules to verified token claims.
+// A nil ClaimMapper maps nothing.
+type ClaimMapper struct {
+	rules []mappingRule
+}
+
+type mappingRule struct {
+	claim   string
+	match   *regexp.Regexp
+	role    string
+	company string
+}
+
+// NewClaimMapper compiles rules, substituting clientID for "{clientId}" in
+// claim paths.
+func NewClaimMapper(rules []config.ClaimMapping, clientID string) (*ClaimMapper, error) {
+	m := &ClaimMapper{}
+	for i, r := range rules {
+		if r.Claim == "" {
+			return nil, fmt.Errorf("claim mapping %d: claim is required", i)
+		}
+		pattern := r.Match
+		if pattern == "" {
+			pattern = ".*"
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("claim mapping %d: invalid match: %w", i, err)
+		}
+		m.rules = append(m.rules, mappingRule{
+			claim:   strings.ReplaceAll(r.Claim, "{clientId}", clientID),
+			match:   re,
+			role:    r.Role,
+			company: r.Company,
+		})
+	}
+	return m, nil
+}
+
+// Apply adds the roles and company roles the rules derive from raw to
+// claims. A company grant whose ID is not a UUID, such as a group named
+// by slug, is dropped with a warning: the ID would otherwise reach the
+// tenant session and fail every query the caller makes.
+func (m *ClaimMapper) Apply(ctx context.Context, raw map[string]interface{}, claims *Claims) {
+	if m == nil {
+		return
+	}
+	for _, rule := range m.rules {
+		for _, value := range ClaimStrings(raw, rule.claim) {
+			groups := rule.match.FindStringSubmatchIndex(value)
+			if groups == nil {
+				continue
+			}
+			role := value
+			if rule.role != "" {
+				role = string(rule.match.ExpandString(nil, rule.role, value, groups))
+			}
+			if role == "" {
+				continue
+			}
+			if rule.company == "" {
+				claims.Roles = appendUnique(claims.Roles, role)
+				continue
+			}
+			companyID := string(rule.match.ExpandString(nil, rule.company, value, groups))
+			if companyID == "" {
+				continue
+			}
+			if !companyIDPattern.MatchString(companyID) {
+				logging.FromContext(ctx).Warn("ignoring company role with an invalid company ID",
+					slog.String("claim", rule.claim), slog.String("company_id", companyID))
+				continue
+			}
+			claims.CompanyRoles = append(claims.CompanyRoles, CompanyRole{CompanyID: companyID, Role: role})
+		}
+	}
+}
+
+// ClaimStrings reads a string-array claim. The name is tried as-is first
+// so namespaced URL claims work, then as a dot-separated path into nested
+// objects (e.g. "realm_access.roles"). A space-separated string is split.
+func ClaimStrings(m map[string]interface{}, name string) []string {
+	if name == "" {
+		return nil
+	}
+
+	val, ok := m[name]
+	if !ok {
+		var cur interface{} = m
+		for _, part := range strings.Split(name, ".") {
+			obj, isObj := cur.(map[string]interface{})
+			if !isObj {
+				return nil
+			}
+			cur = obj[part]
+		}
+		val = cur
+	}
+
+	switch v := val.(type) {
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	case []string:
+		return v
+	case string:
+		return strings.Fields(v)
+	default:
+		return nil
+	}
+}
+
+func appendUnique(values []string, v string) []string {
+	for _, existing := range values {
+		if existing == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
@@ -0,0 +1,384 @@
+// Package oidc implements auth.Provider for any OpenID Connect provider
+// that publishes a discovery document and issues JWT access tokens (Auth0,
+// Entra ID, Dex, ...).
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth/jwks"
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/tracing"
+)
+
+// Discovery holds the fields of /.well-known/openid-configuration the
+// provider uses.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+}
+
+// Provider implements auth.Provider using endpoints from the issuer's
+// discovery document.
+type Provider struct {
+	issuerURL             string
+	discovery             Discovery
+	clientID              string
+	clientSecret          string
+	redirectURL           string
+	postLogoutRedirectURL string
+	scopes                string
+	loginAudience         string
+	rolesClaim            string
+	mapper                *auth.ClaimMapper
+	httpClient            *http.Client
+	verifier              *jwks.Verifier
+	idTokenVerifier       *jwks.Verifier
+}
+
+// New fetches the discovery document for cfg.IssuerURL and creates a
+// provider from it.
+func New(ctx context.Context, cfg config.AuthConfig) (*Provider, error) {
+	httpClient := &http.Client{Timeout: 10 * time.Second, Transport: tracing.NewTransport(nil)}
+
+	mapper, err := auth.NewClaimMapper(cfg.ClaimMappings, cfg.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	discovery, err := discover(ctx, httpClient, cfg.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenIssuer := cfg.TokenIssuer
+	if tokenIssuer == "" {
+		tokenIssuer = discovery.Issuer
+	}
+
+	keys := jwks.NewSet(discovery.JWKSURI, httpClient)
+
+	return &Provider{
+		issuerURL:             cfg.IssuerURL,
+		discovery:             *discovery,
+		clientID:              cfg.ClientID,
+		clientSecret:          cfg.ClientSecret,
+		redirectURL:           cfg.RedirectURL,
+		postLogoutRedirectURL: cfg.PostLogoutRedirectURL,
+		scopes:                cfg.Scopes,
+		loginAudience:         cfg.LoginAudience,
+		rolesClaim:            cfg.RolesClaim,
+		mapper:                mapper,
+		httpClient:            httpClient,
+		verifier: jwks.NewVerifier(keys, jwks.Options{
+			Issuer:    tokenIssuer,
+			Audiences: auth.Audiences(cfg),
+			ClockSkew: cfg.ClockSkew,
+		}),
+		idTokenVerifier: jwks.NewVerifier(keys, jwks.Options{
+			Issuer:    tokenIssuer,
+			Audiences: []string{cfg.ClientID},
+			ClockSkew: cfg.ClockSkew,
+		}),
+	}, nil
+}
+
+func discover(ctx context.Context, httpClient *http.Client, issuerURL string) (*Discovery, error) {
+	discoveryURL := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("discovery request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var d Discovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+	if d.Issuer == "" || d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document is missing required endpoints")
+	}
+	return &d, nil
+}
+
+// Ready implements auth.ReadinessChecker by fetching the discovery
+// document again.
+func (p *Provider) Ready(ctx context.Context) error {
+	_, err := discover(ctx, p.httpClient, p.issuerURL)
+	return err
+}
+
+// Discovery returns the endpoints the provider was configured with.
+func (p *Provider) Discovery() Discovery {
+	return p.discovery
+}
+
+// ValidateToken verifies an access token against the issuer's JWKS and
+// returns its claims.
+func (p *Provider) ValidateToken(ctx context.Context, tokenStr string) (*auth.Claims, error) {
+	mapClaims, err := p.verifier.Verify(ctx, tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &auth.Claims{
+		Subject:       getString(mapClaims, "sub"),
+		Email:         getString(mapClaims, "email"),
+		EmailVerified: getBool(mapClaims, "email_verified"),
+		Name:          getString(mapClaims, "name"),
+		GivenName:     getString(mapClaims, "given_name"),
+		FamilyName:    getString(mapClaims, "family_name"),
+		Roles:         auth.ClaimStrings(mapClaims, p.rolesClaim),
+	}
+	p.mapper.Apply(ctx, mapClaims, claims)
+	return claims, nil
+}
+
+// GetUserInfo retrieves user info from the discovered userinfo endpoint.
+func (p *Provider) GetUserInfo(ctx context.Context, token string) (*auth.UserInfo, error) {
+	if p.discovery.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("provider does not publish a userinfo endpoint")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create userinfo request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch userinfo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("userinfo request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode userinfo: %w", err)
+	}
+
+	return &auth.UserInfo{
+		Subject:       getString(result, "sub"),
+		Email:         getString(result, "email"),
+		EmailVerified: getBool(result, "email_verified"),
+		FirstName:     getString(result, "given_name"),
+		LastName:      getString(result, "family_name"),
+		Roles:         auth.ClaimStrings(result, p.rolesClaim),
+	}, nil
+}
+
+// GetLoginURL returns the discovered authorization endpoint URL.
+func (p *Provider) GetLoginURL(req auth.LoginRequest) string {
+	params := url.Values{
+		"client_id":     {p.clientID},
+		"redirect_uri":  {p.redirectURL},
+		"response_type": {"code"},
+		"scope":         {p.scopes},
+		"state":         {req.State},
+	}
+	if req.Nonce != "" {
+		params.Set("nonce", req.Nonce)
+	}
+	if req.CodeChallenge != "" {
+		params.Set("code_challenge", req.CodeChallenge)
+		params.Set("code_challenge_method", "S256")
+	}
+	if p.loginAudience != "" {
+		params.Set("audience", p.loginAudience)
+	}
+	return withQuery(p.discovery.AuthorizationEndpoint, params)
+}
+
+// ExchangeCode exchanges an authorization code at the discovered token
+// endpoint.
+func (p *Provider) ExchangeCode(ctx context.Context, req auth.CodeExchange) (*auth.TokenSet, error) {
+	data := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {req.Code},
+		"redirect_uri": {p.redirectURL},
+	}
+	if req.CodeVerifier != "" {
+		data.Set("code_verifier", req.CodeVerifier)
+	}
+
+	tokens, err := p.tokenRequest(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Nonce != "" {
+		if _, err := p.idTokenVerifier.VerifyIDToken(ctx, tokens.IDToken, req.Nonce); err != nil {
+			return nil, fmt.Errorf("failed to verify id token: %w", err)
+		}
+	}
+
+	return tokens, nil
+}
+
+// RefreshToken exchanges a refresh token at the discovered token endpoint.
+func (p *Provider) RefreshToken(ctx context.Context, refreshToken string) (*auth.TokenSet, error) {
+	return p.tokenRequest(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+// Logout revokes the refresh token, if the provider supports revocation,
+// and returns the discovered end-session URL for RP-initiated logout.
+func (p *Provider) Logout(ctx context.Context, req auth.LogoutRequest) (string, error) {
+	if req.RefreshToken != "" && p.discovery.RevocationEndpoint != "" {
+		if err := p.RevokeToken(ctx, req.RefreshToken, "refresh_token"); err != nil {
+			return "", fmt.Errorf("failed to end session: %w", err)
+		}
+	}
+
+	if p.discovery.EndSessionEndpoint == "" {
+		return "", nil
+	}
+
+	params := url.Values{"client_id": {p.clientID}}
+	if p.postLogoutRedirectURL != "" {
+		params.Set("post_logout_redirect_uri", p.postLogoutRedirectURL)
+	}
+	if req.IDTokenHint != "" {
+		params.Set("id_token_hint", req.IDTokenHint)
+	}
+	return withQuery(p.discovery.EndSessionEndpoint, params), nil
+}
+
+// RevokeToken revokes a token at the discovered revocation endpoint
+// (RFC 7009).
+func (p *Provider) RevokeToken(ctx context.Context, token, tokenTypeHint string) error {
+	if p.discovery.RevocationEndpoint == "" {
+		return auth.ErrNotSupported
+	}
+
+	data := url.Values{
+		"token":     {token},
+		"client_id": {p.clientID},
+	}
+	if tokenTypeHint != "" {
+		data.Set("token_type_hint", tokenTypeHint)
+	}
+	if p.clientSecret != "" {
+		data.Set("client_secret", p.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.RevocationEndpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create revocation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("revocation request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (p *Provider) tokenRequest(ctx context.Context, data url.Values) (*auth.TokenSet, error) {
+	data.Set("client_id", p.clientID)
+	if p.clientSecret != "" {
+		data.Set("client_secret", p.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	return &auth.TokenSet{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		IDToken:      result.IDToken,
+		ExpiresIn:    result.ExpiresIn,
+	}, nil
+}
+
+// withQuery appends params to endpoint, preserving any query string the
+// provider already put on it.
+func withQuery(endpoint string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + params.Encode()
+}
+
+func getString(m map[string]interface{}, key string) string {
+	if s, ok := m[key].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// getBool reads a boolean claim. Some providers (e.g. Cognito) send
+// email_verified as the string "true".
+func getBool(m map[string]interface{}, key string) bool {
+	switch v := m[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,278 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth/oidc"
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+)
+
+// fakeIssuer is a minimal OIDC provider whose endpoints deliberately do not
+// follow Keycloak's path layout.
+type fakeIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	tokenForm url.Values
+	// idNonce is the nonce claim placed in issued ID tokens.
+	idNonce string
+	revoked []string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	f := &fakeIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL + "/",
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/oauth/token",
+			"userinfo_endpoint":      f.URL + "/userinfo",
+			"jwks_uri":               f.URL + "/.well-known/jwks.json",
+			"end_session_endpoint":   f.URL + "/v2/logout",
+			"revocation_endpoint":    f.URL + "/oauth/revoke",
+		})
+	})
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "k1",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.tokenForm = r.PostForm
+		now := time.Now()
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   f.URL + "/",
+			"sub":   "auth0|abc",
+			"aud":   "sitesecurity-api",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Minute).Unix(),
+			"nonce": f.idNonce,
+		})
+		idToken.Header["kid"] = "k1"
+		signed, _ := idToken.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"id_token":      signed,
+			"expires_in":    300,
+		})
+	})
+	mux.HandleFunc("/oauth/revoke", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.revoked = append(f.revoked, r.PostForm.Get("token"))
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"sub":         "auth0|abc",
+			"email":       "jane.doe@sitesecurity.local",
+			"given_name":  "Jane",
+			"family_name": "Doe",
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeIssuer) provider(t *testing.T) *oidc.Provider {
+	t.Helper()
+	p, err := oidc.New(context.Background(), config.AuthConfig{
+		IssuerURL:     f.URL,
+		ClientID:      "sitesecurity-api",
+		ClientSecret:  "secret",
+		RedirectURL:   "http://localhost:3000/auth/callback",
+		Audience:      "https://api.sitesecurity.local",
+		Scopes:        "openid profile email",
+		LoginAudience: "https://api.sitesecurity.local",
+		RolesClaim:    "https://sitesecurity.local/roles",
+
+		PostLogoutRedirectURL: "http://localhost:3000",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return p
+}
+
+func TestNew_UsesDiscoveredEndpoints(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	loginURL, err := url.Parse(p.GetLoginURL(auth.LoginRequest{
+		State:         "state-1",
+		Nonce:         "nonce-1",
+		CodeChallenge: auth.CodeChallengeS256("verifier-1"),
+	}))
+	if err != nil {
+		t.Fatalf("invalid login URL: %v", err)
+	}
+	if loginURL.Path != "/authorize" {
+		t.Errorf("expected discovered authorization endpoint, got %s", loginURL.Path)
+	}
+	if loginURL.Query().Get("audience") != "https://api.sitesecurity.local" {
+		t.Errorf("expected audience parameter, got %q", loginURL.Query().Get("audience"))
+	}
+	if loginURL.Query().Get("nonce") != "nonce-1" || loginURL.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("expected nonce and PKCE parameters, got %s", loginURL.RawQuery)
+	}
+
+	tokens, err := p.ExchangeCode(context.Background(), auth.CodeExchange{Code: "code-1", CodeVerifier: "verifier-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tokens.AccessToken != "access" {
+		t.Errorf("expected access token 'access', got '%s'", tokens.AccessToken)
+	}
+	if f.tokenForm.Get("code") != "code-1" || f.tokenForm.Get("client_secret") != "secret" || f.tokenForm.Get("code_verifier") != "verifier-1" {
+		t.Errorf("unexpected token request form: %v", f.tokenForm)
+	}
+
+	info, err := p.GetUserInfo(context.Background(), "access")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.FirstName != "Jane" || info.Subject != "auth0|abc" {
+		t.Errorf("unexpected userinfo: %+v", info)
+	}
+}
+
+func TestExchangeCode_Nonce(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	f.idNonce = "nonce-1"
+	if _, err := p.ExchangeCode(context.Background(), auth.CodeExchange{Code: "code-1", Nonce: "nonce-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		idNonce string
+	}{
+		{"mismatched", "nonce-from-another-login"},
+		{"missing", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.idNonce = tt.idNonce
+			_, err := p.ExchangeCode(context.Background(), auth.CodeExchange{Code: "code-1", Nonce: "nonce-1"})
+			if !errors.Is(err, auth.ErrInvalidToken) {
+				t.Fatalf("expected auth.ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLogout_EndSessionURL(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	logoutURL, err := p.Logout(context.Background(), auth.LogoutRequest{IDTokenHint: "id-token"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u, err := url.Parse(logoutURL)
+	if err != nil {
+		t.Fatalf("invalid logout URL: %v", err)
+	}
+	if u.Path != "/v2/logout" {
+		t.Errorf("expected the discovered end-session endpoint, got %s", u.Path)
+	}
+	q := u.Query()
+	if q.Get("post_logout_redirect_uri") != "http://localhost:3000" || q.Get("id_token_hint") != "id-token" {
+		t.Errorf("unexpected logout parameters: %v", q)
+	}
+}
+
+func TestLogout_RevokesRefreshToken(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	if _, err := p.Logout(context.Background(), auth.LogoutRequest{RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(f.revoked) != 1 || f.revoked[0] != "refresh" {
+		t.Errorf("expected the refresh token to be revoked, got %v", f.revoked)
+	}
+}
+
+func TestNew_DiscoveryFailure(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := oidc.New(context.Background(), config.AuthConfig{IssuerURL: srv.URL})
+	if err == nil {
+		t.Fatal("expected error when discovery document is unavailable")
+	}
+}
+
+func TestReady(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	if err := p.Ready(context.Background()); err != nil {
+		t.Fatalf("expected issuer to be ready, got %v", err)
+	}
+
+	f.Close()
+	if err := p.Ready(context.Background()); err == nil {
+		t.Fatal("expected error once the issuer is unreachable")
+	}
+}
+
+func TestValidateToken_NamespacedRolesClaim(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                              f.URL + "/",
+		"sub":                              "auth0|abc",
+		"aud":                              []string{"https://api.sitesecurity.local"},
+		"iat":                              now.Unix(),
+		"exp":                              now.Add(time.Minute).Unix(),
+		"https://sitesecurity.local/roles": []string{"site_admin"},
+	})
+	token.Header["kid"] = "k1"
+	signed, _ := token.SignedString(f.key)
+
+	claims, err := p.ValidateToken(context.Background(), signed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(claims.Roles, ",") != "site_admin" {
+		t.Errorf("expected roles [site_admin], got %v", claims.Roles)
+	}
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// NewRandomString returns n random bytes encoded as unpadded base64url,
+// suitable for state, nonce and PKCE code verifier values.
+func NewRandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewCodeVerifier returns a PKCE code verifier (RFC 7636). 32 random bytes
+// encode to the recommended 43 characters.
+func NewCodeVerifier() (string, error) {
+	return NewRandomString(32)
+}
+
+// CodeChallengeS256 derives the S256 code challenge for a code verifier.
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
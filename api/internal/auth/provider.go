@@ -8,33 +8,90 @@ import (
 // ErrInvalidToken is returned when a token is invalid or expired.
 var ErrInvalidToken = errors.New("invalid or expired token")
 
+// ErrNotSupported is returned when the identity provider does not offer an
+// operation, e.g. it publishes no revocation endpoint.
+var ErrNotSupported = errors.New("operation not supported by identity provider")
+
 // Claims represents the verified claims from an access token.
 type Claims struct {
-	Subject string
-	Email   string
-	Name    string
-	Roles   []string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	FamilyName    string
+	Roles         []string
+	// CompanyRoles are roles the provider grants within a single company,
+	// derived by claim mapping rules.
+	CompanyRoles []CompanyRole
+	// APIKeyID is set when the caller authenticated with an API key rather
+	// than a user token. Scopes then lists the only actions it may take.
+	APIKeyID string
+	Scopes   []string
 }
 
 // UserInfo represents user profile information from the identity provider.
 type UserInfo struct {
-	Subject   string
-	Email     string
-	FirstName string
-	LastName  string
-	Roles     []string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Roles         []string
 }
 
 // TokenSet represents a set of tokens returned by the identity provider.
 type TokenSet struct {
-	AccessToken  string
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	IDToken      string `json:"idToken,omitempty"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+// LoginRequest carries the per-login values bound to an authorization
+// request.
+type LoginRequest struct {
+	// State is echoed back on the callback and checked against the value
+	// stored in the browser to prevent CSRF.
+	State string
+	// Nonce is embedded in the ID token so it can be tied to this login.
+	Nonce string
+	// CodeChallenge is the PKCE S256 challenge derived from the verifier
+	// later sent with the code exchange.
+	CodeChallenge string
+}
+
+// CodeExchange carries an authorization code and the values needed to
+// prove it was issued for this client's login request.
+type CodeExchange struct {
+	Code string
+	// CodeVerifier is the PKCE verifier matching LoginRequest.CodeChallenge.
+	CodeVerifier string
+	// Nonce, when set, must match the "nonce" claim of the returned ID
+	// token.
+	Nonce string
+}
+
+// LogoutRequest identifies the session to end at the identity provider.
+type LogoutRequest struct {
+	// RefreshToken lets providers that support it end the session
+	// server-side.
 	RefreshToken string
-	IDToken      string
-	ExpiresIn    int
+	// IDTokenHint is passed to the end-session endpoint so the provider
+	// can log the user out without prompting.
+	IDTokenHint string
+}
+
+// ReadinessChecker is implemented by providers that can report whether
+// their identity provider is reachable, for the API's readiness probe.
+type ReadinessChecker interface {
+	// Ready fetches the provider's discovery document, failing if it
+	// cannot be read.
+	Ready(ctx context.Context) error
 }
 
 // Provider defines the interface for authentication providers.
-// Implementations can be swapped (Keycloak, Auth0, Google, etc.)
+// Implementations can be swapped (Keycloak, Auth0, Entra ID, etc.)
 // by changing the AUTH_PROVIDER environment variable.
 type Provider interface {
 	// ValidateToken verifies an access token and returns its claims.
@@ -44,8 +101,22 @@ type Provider interface {
 	GetUserInfo(ctx context.Context, token string) (*UserInfo, error)
 
 	// GetLoginURL returns the URL to redirect users to for login.
-	GetLoginURL(state string) string
+	GetLoginURL(req LoginRequest) string
+
+	// ExchangeCode exchanges an authorization code for a token set. When
+	// req.Nonce is set the returned ID token is verified and its nonce
+	// checked; failures wrap ErrInvalidToken.
+	ExchangeCode(ctx context.Context, req CodeExchange) (*TokenSet, error)
+
+	// RefreshToken exchanges a refresh token for a new token set.
+	RefreshToken(ctx context.Context, refreshToken string) (*TokenSet, error)
+
+	// Logout ends the user's session at the identity provider (RP-initiated
+	// logout). It returns the end-session URL the browser should visit so
+	// the provider can clear its own session cookie, or "" if there is none.
+	Logout(ctx context.Context, req LogoutRequest) (string, error)
 
-	// ExchangeCode exchanges an authorization code for a token set.
-	ExchangeCode(ctx context.Context, code string) (*TokenSet, error)
+	// RevokeToken revokes an access or refresh token. tokenTypeHint is
+	// "access_token" or "refresh_token" and may be empty.
+	RevokeToken(ctx context.Context, token, tokenTypeHint string) error
 }
@@ -1,19 +1,54 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
+	"log/slog"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Auth     AuthConfig
-	CORS     CORSConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Auth        AuthConfig
+	CORS        CORSConfig
+	Log         LogConfig
+	Tracing     TracingConfig
+	RateLimit   RateLimitConfig
+	Idempotency IdempotencyConfig
 }
 
 type ServerConfig struct {
 	Port string
+
+	// Timeouts bound how long a client may take to send a request and to
+	// read the response, and how long an idle keep-alive connection stays
+	// open.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// DrainDelay is how long the server keeps serving after SIGTERM while
+	// reporting itself unready, so load balancers stop sending it new
+	// requests. ShutdownTimeout then bounds how long in-flight requests
+	// are given to finish.
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+
+	// ValidateRequests checks request bodies against the OpenAPI document
+	// before they reach the handlers.
+	ValidateRequests bool
+
+	// TrustedProxies are the addresses of the proxies in front of the
+	// API, whose X-Forwarded-For headers give the client's address. The
+	// header is ignored from any other peer.
+	TrustedProxies []netip.Prefix
 }
 
 type DatabaseConfig struct {
@@ -23,6 +58,10 @@ type DatabaseConfig struct {
 	Password string
 	Name     string
 	SSLMode  string
+
+	// MigrateOnStart applies pending migrations before the server starts
+	// listening.
+	MigrateOnStart bool
 }
 
 func (c DatabaseConfig) DSN() string {
@@ -38,16 +77,145 @@ type AuthConfig struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURL  string
+
+	// PostLogoutRedirectURL is where the provider sends the browser after
+	// RP-initiated logout.
+	PostLogoutRedirectURL string
+
+	// TokenIssuer is the "iss" value expected in tokens. It differs from
+	// IssuerURL when the API reaches the provider on an internal hostname
+	// but browsers obtain tokens through a public one.
+	TokenIssuer string
+	// Audience is a comma-separated list of client IDs accepted in a
+	// token's "aud" or "azp" claim.
+	Audience  string
+	ClockSkew time.Duration
+
+	// Scopes requested at login.
+	Scopes string
+	// LoginAudience is sent as the "audience" authorization parameter,
+	// which Auth0 requires to issue JWT access tokens for an API.
+	LoginAudience string
+	// StateSecret signs the login state cookie. It must be shared by all
+	// API replicas; when empty each instance generates its own.
+	StateSecret string
+	// RolesClaim names the claim roles are read from by the generic OIDC
+	// provider. Dot-separated paths reach into nested objects.
+	RolesClaim string
+	// ClaimMappings turn further token claims, such as Keycloak client
+	// roles or groups, into roles and company-scoped roles.
+	ClaimMappings []ClaimMapping
+}
+
+// ClaimMapping is a rule applied to each string value of a token claim.
+// For example, with Claim "groups", Match "/companies/([^/]+)/admins",
+// Company "$1" and Role "company_admin", membership of the group
+// /companies/<company ID>/admins makes the caller an admin of that company.
+type ClaimMapping struct {
+	// Claim is the claim to read. Dot-separated paths reach into nested
+	// objects and "{clientId}" is replaced by the configured client ID,
+	// e.g. "resource_access.{clientId}.roles".
+	Claim string `json:"claim"`
+	// Match is a regular expression the whole value must match. Empty
+	// matches every value.
+	Match string `json:"match,omitempty"`
+	// Role is the role granted, with $1-style references to groups in
+	// Match. Empty grants the value itself.
+	Role string `json:"role,omitempty"`
+	// Company, when set, expands to the ID of the company the role is
+	// scoped to. Without it the role applies globally.
+	Company string `json:"company,omitempty"`
 }
 
 type CORSConfig struct {
 	Origins string
 }
 
+type LogConfig struct {
+	// Level is the least severe level logged: debug, info, warn or error.
+	Level slog.Level
+}
+
+type TracingConfig struct {
+	// Endpoint is the base URL of the OTLP/HTTP collector spans are sent
+	// to, such as http://otel-collector:4318. Empty disables tracing.
+	Endpoint    string
+	ServiceName string
+	// SampleRatio is the share of traces started here that are recorded,
+	// from 0 to 1. Traces started by a caller follow the caller's choice.
+	SampleRatio float64
+}
+
+type RateLimitConfig struct {
+	// Store keeps the token buckets: "memory", per replica, or "postgres",
+	// shared by every replica.
+	Store string
+
+	// Limits per caller for each route group, keyed by the caller's subject
+	// or, before sign-in, their IP address. Alarms is the priority lane for
+	// raising alarms, which draws on no other group's buckets.
+	Default  Limit
+	CheckIns Limit
+	Alarms   Limit
+	Auth     Limit
+	// PerIP additionally limits every request by client IP, before the
+	// caller is authenticated. Alarms have a bucket per IP of their own.
+	PerIP Limit
+
+	// MaxInFlight caps the requests served at once outside the priority
+	// lane, keeping database connections free for alarms. Zero disables it.
+	MaxInFlight int
+	// AlarmsMaxInFlight caps the alarms served at once. With MaxInFlight
+	// it must stay below the database pool. Zero disables it.
+	AlarmsMaxInFlight int
+}
+
+type IdempotencyConfig struct {
+	// TTL is how long a response is kept for replay to retries sent with
+	// the same Idempotency-Key.
+	TTL time.Duration
+}
+
+// Limit allows Requests per Period, and bursts of up to Requests. The zero
+// Limit allows everything.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit reads a limit written as requests per unit, such as "120/m";
+// the unit is s, m or h. "0" and "" give the zero Limit.
+func ParseLimit(value string) (Limit, error) {
+	if value == "" || value == "0" {
+		return Limit{}, nil
+	}
+	count, unit, ok := strings.Cut(value, "/")
+	requests, err := strconv.Atoi(count)
+	if !ok || err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: want requests/unit, such as 120/m", value)
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[unit]
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q: unit must be s, m or h", value)
+	}
+	return Limit{Requests: requests, Period: period}, nil
+}
+
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
 			Port: getEnv("SERVER_PORT", "8080"),
+
+			ReadTimeout:       getDurationEnv("SERVER_READ_TIMEOUT", 15*time.Second),
+			ReadHeaderTimeout: getDurationEnv("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+			WriteTimeout:      getDurationEnv("SERVER_WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:       getDurationEnv("SERVER_IDLE_TIMEOUT", 120*time.Second),
+			DrainDelay:        getDurationEnv("SERVER_DRAIN_DELAY", 5*time.Second),
+			ShutdownTimeout:   getDurationEnv("SERVER_SHUTDOWN_TIMEOUT", 20*time.Second),
+
+			ValidateRequests: getBoolEnv("SERVER_VALIDATE_REQUESTS", false),
+			TrustedProxies:   getPrefixesEnv("SERVER_TRUSTED_PROXIES"),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -56,17 +224,49 @@ func Load() *Config {
 			Password: getEnv("DB_PASSWORD", "sitesecurity_dev"),
 			Name:     getEnv("DB_NAME", "sitesecurity"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			MigrateOnStart: getBoolEnv("DB_MIGRATE_ON_START", false),
 		},
 		Auth: AuthConfig{
-			Provider:     getEnv("AUTH_PROVIDER", "keycloak"),
-			IssuerURL:    getEnv("AUTH_ISSUER_URL", "http://localhost:8180/realms/sitesecurity"),
-			ClientID:     getEnv("AUTH_CLIENT_ID", "sitesecurity-api"),
-			ClientSecret: getEnv("AUTH_CLIENT_SECRET", "sitesecurity-api-secret"),
-			RedirectURL:  getEnv("AUTH_REDIRECT_URL", "http://localhost:3000/auth/callback"),
+			Provider:              getEnv("AUTH_PROVIDER", "keycloak"),
+			IssuerURL:             getEnv("AUTH_ISSUER_URL", "http://localhost:8180/realms/sitesecurity"),
+			ClientID:              getEnv("AUTH_CLIENT_ID", "sitesecurity-api"),
+			ClientSecret:          getEnv("AUTH_CLIENT_SECRET", "sitesecurity-api-secret"),
+			RedirectURL:           getEnv("AUTH_REDIRECT_URL", "http://localhost:3000/auth/callback"),
+			PostLogoutRedirectURL: getEnv("AUTH_POST_LOGOUT_REDIRECT_URL", "http://localhost:3000"),
+			TokenIssuer:           getEnv("AUTH_TOKEN_ISSUER", ""),
+			Audience:              getEnv("AUTH_AUDIENCE", ""),
+			ClockSkew:             getDurationEnv("AUTH_CLOCK_SKEW", 30*time.Second),
+			Scopes:                getEnv("AUTH_SCOPES", "openid profile email"),
+			LoginAudience:         getEnv("AUTH_LOGIN_AUDIENCE", ""),
+			RolesClaim:            getEnv("AUTH_ROLES_CLAIM", "roles"),
+			StateSecret:           getEnv("AUTH_STATE_SECRET", ""),
+			ClaimMappings:         getClaimMappingsEnv("AUTH_CLAIM_MAPPINGS"),
 		},
 		CORS: CORSConfig{
 			Origins: getEnv("CORS_ORIGINS", "http://localhost:3000"),
 		},
+		Log: LogConfig{
+			Level: getLevelEnv("LOG_LEVEL", slog.LevelInfo),
+		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("TRACING_OTLP_ENDPOINT", ""),
+			ServiceName: getEnv("TRACING_SERVICE_NAME", "sitesecurity-api"),
+			SampleRatio: getFloatEnv("TRACING_SAMPLE_RATIO", 1),
+		},
+		RateLimit: RateLimitConfig{
+			Store:             getEnv("RATE_LIMIT_STORE", "memory"),
+			Default:           getLimitEnv("RATE_LIMIT_DEFAULT", "120/m"),
+			CheckIns:          getLimitEnv("RATE_LIMIT_CHECK_INS", "30/m"),
+			Alarms:            getLimitEnv("RATE_LIMIT_ALARMS", "30/m"),
+			Auth:              getLimitEnv("RATE_LIMIT_AUTH", "30/m"),
+			PerIP:             getLimitEnv("RATE_LIMIT_PER_IP", "600/m"),
+			MaxInFlight:       getIntEnv("RATE_LIMIT_MAX_IN_FLIGHT", 20),
+			AlarmsMaxInFlight: getIntEnv("RATE_LIMIT_ALARMS_MAX_IN_FLIGHT", 4),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: getDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour),
+		},
 	}
 }
 
@@ -76,3 +276,96 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+func getBoolEnv(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func getFloatEnv(key string, fallback float64) float64 {
+	if value, ok := os.LookupEnv(key); ok {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+func getIntEnv(key string, fallback int) int {
+	if value, ok := os.LookupEnv(key); ok {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+// getLimitEnv reads a rate limit. An invalid value is fatal rather than
+// silently lifting the limit.
+func getLimitEnv(key, fallback string) Limit {
+	limit, err := ParseLimit(getEnv(key, fallback))
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return limit
+}
+
+func getLevelEnv(key string, fallback slog.Level) slog.Level {
+	if value, ok := os.LookupEnv(key); ok {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err == nil {
+			return level
+		}
+	}
+	return fallback
+}
+
+// getPrefixesEnv reads a comma-separated list of CIDR ranges, a bare
+// address standing for itself. An invalid value is fatal rather than
+// silently trusting fewer proxies than intended.
+func getPrefixesEnv(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				log.Fatalf("Invalid %s: %v", key, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// getClaimMappingsEnv reads a JSON array of claim mapping rules. An invalid
+// value is fatal rather than silently dropping authorization rules.
+func getClaimMappingsEnv(key string) []ClaimMapping {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return nil
+	}
+	var mappings []ClaimMapping
+	if err := json.Unmarshal([]byte(value), &mappings); err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return mappings
+}
@@ -0,0 +1,33 @@
+package config_test
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+)
+
+func TestLoad_PostLogoutRedirectURL(t *testing.T) {
+	if got := config.Load().Auth.PostLogoutRedirectURL; got != "http://localhost:3000" {
+		t.Errorf("expected the default redirect, got %q", got)
+	}
+
+	t.Setenv("AUTH_POST_LOGOUT_REDIRECT_URL", "https://app.sitesecurity.example")
+	if got := config.Load().Auth.PostLogoutRedirectURL; got != "https://app.sitesecurity.example" {
+		t.Errorf("expected the redirect from the environment, got %q", got)
+	}
+}
+
+func TestLoad_TrustedProxies(t *testing.T) {
+	t.Setenv("SERVER_TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.10,fd00::/8")
+	got := config.Load().Server.TrustedProxies
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.10/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// authorize checks the caller may act on the resource named in the URL,
+// writing a 403 or 404 and returning false if not. With no roles any active
+// membership of the owning company is enough.
+func authorize(w http.ResponseWriter, r *http.Request, access *service.AccessService, scope service.Scope, roles ...model.WorkerRole) bool {
+	if err := access.Authorize(r.Context(), caller(r), scope, roles...); err != nil {
+		ServiceError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// authorizeRef is authorize for a resource referenced from the request
+// body, such as the worksite of a new shift, where a missing resource is a
+// validation failure of the referencing field rather than a 404.
+func authorizeRef(w http.ResponseWriter, r *http.Request, access *service.AccessService, scope service.Scope, roles ...model.WorkerRole) bool {
+	err := access.Authorize(r.Context(), caller(r), scope, roles...)
+	if errors.Is(err, service.ErrScopeNotFound) {
+		err = &service.ValidationError{Fields: []service.FieldError{{Field: refFields[scope.Kind], Message: "does not exist"}}}
+	}
+	if err != nil {
+		ServiceError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// refFields names the body field that references each kind of resource.
+var refFields = map[service.ScopeKind]string{
+	service.ScopeCompany:        "companyId",
+	service.ScopeWorksite:       "worksiteId",
+	service.ScopeShift:          "shiftId",
+	service.ScopeReportTemplate: "templateId",
+	service.ScopeShiftReport:    "reportId",
+	service.ScopeAlarm:          "alarmId",
+	service.ScopeWorker:         "workerId",
+	service.ScopeAPIKey:         "apiKeyId",
+}
+
+// actingWorker returns the worker a worker action, such as raising an
+// alarm, is recorded against: the caller. A different workerId in the body
+// is rejected unless the request opts in with ?backfill=true and the caller
+// is a company_admin or site_admin of one of that worker's companies.
+func actingWorker(w http.ResponseWriter, r *http.Request, access *service.AccessService, claimed string) (string, bool) {
+	caller := middleware.GetWorker(r.Context())
+	if caller == nil {
+		Error(w, http.StatusUnauthorized, "no worker for the authenticated user")
+		return "", false
+	}
+	if claimed == "" || claimed == caller.ID {
+		return caller.ID, true
+	}
+	if r.URL.Query().Get("backfill") != "true" {
+		Error(w, http.StatusForbidden, "workerId does not match the authenticated worker")
+		return "", false
+	}
+	if !authorizeRef(w, r, access, service.Scope{Kind: service.ScopeWorker, ID: claimed}, service.AdminRoles...) {
+		return "", false
+	}
+	return claimed, true
+}
+
+// caller returns the authenticated worker together with the company roles
+// their token grants through claim mapping rules.
+func caller(r *http.Request) service.Caller {
+	c := service.Caller{Worker: middleware.GetWorker(r.Context())}
+	claims := middleware.GetClaims(r.Context())
+	if c.Worker == nil || claims == nil {
+		return c
+	}
+	for _, cr := range claims.CompanyRoles {
+		c.Grants = append(c.Grants, model.WorkerCompany{
+			WorkerID:  c.Worker.ID,
+			CompanyID: cr.CompanyID,
+			Role:      model.WorkerRole(cr.Role),
+			Status:    model.MembershipActive,
+		})
+	}
+	return c
+}
@@ -0,0 +1,364 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// testAccess backs an AccessService with in-memory resource ownership and
+// memberships. It implements both repository.ScopeRepository and
+// repository.WorkerCompanyRepository.
+type testAccess struct {
+	owners      map[string]string // resource ID -> company ID
+	memberships []model.WorkerCompany
+}
+
+func newTestAccess(memberships ...model.WorkerCompany) *testAccess {
+	return &testAccess{owners: make(map[string]string), memberships: memberships}
+}
+
+func (a *testAccess) service() *service.AccessService {
+	return service.NewAccessService(a, a, nil)
+}
+
+func (a *testAccess) membership(workerID, companyID string) *model.WorkerCompany {
+	for _, m := range a.memberships {
+		if m.WorkerID == workerID && m.CompanyID == companyID {
+			return &m
+		}
+	}
+	return nil
+}
+
+func (a *testAccess) CompanyExists(ctx context.Context, companyID string) (bool, error) {
+	for _, c := range a.owners {
+		if c == companyID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (a *testAccess) CompanyOfWorksite(ctx context.Context, id string) (string, error) {
+	return a.owners[id], nil
+}
+func (a *testAccess) CompanyOfShift(ctx context.Context, id string) (string, error) {
+	return a.owners[id], nil
+}
+func (a *testAccess) CompanyOfTemplate(ctx context.Context, id string) (string, error) {
+	return a.owners[id], nil
+}
+func (a *testAccess) CompanyOfShiftReport(ctx context.Context, id string) (string, error) {
+	return a.owners[id], nil
+}
+func (a *testAccess) CompaniesOfAlarm(ctx context.Context, id string) ([]string, error) {
+	if c, ok := a.owners[id]; ok {
+		return []string{c}, nil
+	}
+	return nil, nil
+}
+func (a *testAccess) CompaniesOfWorker(ctx context.Context, workerID string) ([]string, error) {
+	var result []string
+	for _, m := range a.memberships {
+		if m.WorkerID == workerID && m.Status == model.MembershipActive {
+			result = append(result, m.CompanyID)
+		}
+	}
+	return result, nil
+}
+func (a *testAccess) CompanyOfAPIKey(ctx context.Context, id string) (string, error) {
+	return a.owners[id], nil
+}
+
+func (a *testAccess) ListByWorker(ctx context.Context, workerID string) ([]model.WorkerCompany, error) {
+	var result []model.WorkerCompany
+	for _, m := range a.memberships {
+		if m.WorkerID == workerID {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+func (a *testAccess) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.WorkerCompany], error) {
+	return pageOf(a.ListByWorker(ctx, workerID))
+}
+
+// pageOf returns a mock's rows as a single page.
+func pageOf[T any](items []T, err error) (*pagination.Page[T], error) {
+	if err != nil {
+		return nil, err
+	}
+	return &pagination.Page[T]{Items: items}, nil
+}
+func (a *testAccess) ListByCompany(ctx context.Context, companyID string) ([]model.WorkerCompany, error) {
+	return nil, nil
+}
+func (a *testAccess) Get(ctx context.Context, workerID, companyID string) (*model.WorkerCompany, error) {
+	return a.membership(workerID, companyID), nil
+}
+func (a *testAccess) Create(ctx context.Context, wc *model.WorkerCompany) error {
+	a.memberships = append(a.memberships, *wc)
+	return nil
+}
+func (a *testAccess) UpdateRole(ctx context.Context, wc *model.WorkerCompany) error {
+	for i, m := range a.memberships {
+		if m.WorkerID == wc.WorkerID && m.CompanyID == wc.CompanyID && (wc.Version == 0 || wc.Version == m.Version) {
+			wc.Version = m.Version + 1
+			a.memberships[i] = *wc
+			return nil
+		}
+	}
+	return repository.ErrVersionMismatch
+}
+func (a *testAccess) UpdateStatus(ctx context.Context, workerID, companyID string, status model.MembershipStatus) error {
+	return nil
+}
+func (a *testAccess) Delete(ctx context.Context, workerID, companyID string, version int) error {
+	for i, m := range a.memberships {
+		if m.WorkerID == workerID && m.CompanyID == companyID && (version == 0 || version == m.Version) {
+			a.memberships = append(a.memberships[:i], a.memberships[i+1:]...)
+			return nil
+		}
+	}
+	return repository.ErrVersionMismatch
+}
+
+// withWorker puts the resolved worker for the caller into the request
+// context, as middleware.Worker does.
+func withWorker(r *http.Request, workerID string) *http.Request {
+	ctx := context.WithValue(r.Context(), middleware.WorkerContextKey, &model.Worker{ID: workerID})
+	return r.WithContext(ctx)
+}
+
+func member(workerID, companyID string, role model.WorkerRole) model.WorkerCompany {
+	return model.WorkerCompany{WorkerID: workerID, CompanyID: companyID, Role: role, Status: model.MembershipActive}
+}
+
+func serve(routes chi.Router, method, path, body, workerID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = withWorker(req, workerID)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCompanyScopedAccess(t *testing.T) {
+	access := newTestAccess(
+		member("sentinel-admin", "sentinel", model.RoleCompanyAdmin),
+		member("sentinel-site", "sentinel", model.RoleSiteAdmin),
+		member("sentinel-guard", "sentinel", model.RoleWorker),
+		member("guardian-admin", "guardian", model.RoleCompanyAdmin),
+		model.WorkerCompany{WorkerID: "former-admin", CompanyID: "sentinel", Role: model.RoleCompanyAdmin, Status: model.MembershipInactive},
+	)
+	access.owners["site-1"] = "sentinel"
+	access.owners["shift-1"] = "sentinel"
+	access.owners["alarm-1"] = "sentinel"
+	access.owners["guardian-site"] = "guardian"
+	svc := access.service()
+
+	worksites := handler.NewWorksiteHandler(nil, svc).Routes()
+	shifts := handler.NewShiftHandler(nil, svc, nil).Routes()
+	alarms := handler.NewAlarmHandler(nil, svc, nil).Routes()
+	companies := handler.NewCompanyHandler(nil, svc).Routes()
+	workers := handler.NewWorkerHandler(nil, svc).Routes()
+	reports := handler.NewShiftReportHandler(nil, svc, nil).Routes()
+
+	tests := []struct {
+		name   string
+		routes chi.Router
+		method string
+		path   string
+		body   string
+		worker string
+	}{
+		{"other company's admin edits worksite", worksites, http.MethodPut, "/site-1", `{"name":"x"}`, "guardian-admin"},
+		{"worker deletes worksite", worksites, http.MethodDelete, "/site-1", "", "sentinel-guard"},
+		{"inactive admin deletes worksite", worksites, http.MethodDelete, "/site-1", "", "former-admin"},
+		{"non-member reads worksite", worksites, http.MethodGet, "/site-1", "", "guardian-admin"},
+		{"worksite created in another company", worksites, http.MethodPost, "/", `{"companyId":"guardian","name":"x"}`, "sentinel-admin"},
+		{"shift moved to another company's worksite", shifts, http.MethodPut, "/shift-1", `{"worksiteId":"guardian-site"}`, "sentinel-admin"},
+		{"other company's admin cancels shift", shifts, http.MethodPatch, "/shift-1/status", `{"status":"cancelled"}`, "guardian-admin"},
+		{"other company's admin resolves alarm", alarms, http.MethodPatch, "/alarm-1/resolve", "", "guardian-admin"},
+		{"site admin deletes company", companies, http.MethodDelete, "/sentinel", "", "sentinel-site"},
+		{"other company's admin edits worker", workers, http.MethodPut, "/sentinel-guard", `{}`, "guardian-admin"},
+		{"admin grants membership of another company", workers, http.MethodPost, "/sentinel-guard/memberships", `{"companyId":"guardian"}`, "sentinel-admin"},
+		{"site admin creates worker", workers, http.MethodPost, "/", `{}`, "sentinel-site"},
+		{"non-member lists workers", workers, http.MethodGet, "/?company_id=sentinel", "", "guardian-admin"},
+		{"non-member lists worksites", worksites, http.MethodGet, "/?company_id=sentinel", "", "guardian-admin"},
+		{"non-member lists templates", reports, http.MethodGet, "/templates?company_id=sentinel", "", "guardian-admin"},
+		{"non-member lists shifts", shifts, http.MethodGet, "/?company_id=sentinel", "", "guardian-admin"},
+		{"non-member lists alarms", alarms, http.MethodGet, "/?company_id=sentinel&status=raised", "", "guardian-admin"},
+		{"non-member lists a shift's alarms", alarms, http.MethodGet, "/?shift_id=shift-1", "", "guardian-admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(tt.routes, tt.method, tt.path, tt.body, tt.worker)
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("expected status %d, got %d: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if rr := serve(worksites, http.MethodGet, "/missing", "", "sentinel-admin"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for unknown worksite, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+// Lists name the company, worksite, shift or worker they are scoped to, so
+// none spans tenants.
+func TestUnscopedListsRejected(t *testing.T) {
+	access := newTestAccess(member("sentinel-admin", "sentinel", model.RoleCompanyAdmin))
+	svc := access.service()
+
+	tests := []struct {
+		name   string
+		routes chi.Router
+		path   string
+	}{
+		{"workers", handler.NewWorkerHandler(nil, svc).Routes(), "/"},
+		{"worksites", handler.NewWorksiteHandler(nil, svc).Routes(), "/"},
+		{"templates", handler.NewShiftReportHandler(nil, svc, nil).Routes(), "/templates"},
+		{"shifts by status", handler.NewShiftHandler(nil, svc, nil).Routes(), "/?status=open"},
+		{"alarms by status", handler.NewAlarmHandler(nil, svc, nil).Routes(), "/?status=raised"},
+		{"every alarm", handler.NewAlarmHandler(nil, svc, nil).Routes(), "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := serve(tt.routes, http.MethodGet, tt.path, "", "sentinel-admin"); rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompanyScopedAccess_AdminOfOwnCompany(t *testing.T) {
+	repo := &inMemoryCompanyRepo{companies: map[string]model.Company{
+		"sentinel": {ID: "sentinel", Name: "Sentinel"},
+	}}
+	access := newTestAccess(member("sentinel-admin", "sentinel", model.RoleCompanyAdmin))
+	access.owners["sentinel"] = "sentinel"
+	routes := handler.NewCompanyHandler(service.NewCompanyService(repo, nil), access.service()).Routes()
+
+	rr := serve(routes, http.MethodPut, "/sentinel", `{"name":"Sentinel Security"}`, "sentinel-admin")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if repo.companies["sentinel"].Name != "Sentinel Security" {
+		t.Errorf("expected company to be renamed, got %q", repo.companies["sentinel"].Name)
+	}
+}
+
+func TestCompanyScopedAccess_GrantedByToken(t *testing.T) {
+	repo := &inMemoryCompanyRepo{companies: map[string]model.Company{
+		"sentinel": {ID: "sentinel", Name: "Sentinel"},
+		"guardian": {ID: "guardian", Name: "Guardian"},
+	}}
+	access := newTestAccess()
+	access.owners["sentinel"] = "sentinel"
+	access.owners["guardian"] = "guardian"
+	routes := handler.NewCompanyHandler(service.NewCompanyService(repo, nil), access.service()).Routes()
+
+	// The worker has no stored membership; a /companies/sentinel/admins
+	// group mapped by the provider makes them an admin of Sentinel only.
+	request := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewBufferString(`{"name":"Renamed"}`))
+		claims := &auth.Claims{
+			Subject:      "sso-admin",
+			CompanyRoles: []auth.CompanyRole{{CompanyID: "sentinel", Role: "company_admin"}},
+		}
+		req = withWorker(req.WithContext(context.WithValue(req.Context(), middleware.ClaimsContextKey, claims)), "sso-admin")
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request("/sentinel"); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := request("/guardian"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+	}
+}
+
+// recordingCheckInRepo implements repository.LocationCheckInRepository and
+// keeps the check-ins it is asked to create.
+type recordingCheckInRepo struct {
+	created []model.LocationCheckIn
+}
+
+func (r *recordingCheckInRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.LocationCheckIn], error) {
+	return &pagination.Page[model.LocationCheckIn]{}, nil
+}
+func (r *recordingCheckInRepo) ListByShift(ctx context.Context, shiftID string) ([]model.LocationCheckIn, error) {
+	return nil, nil
+}
+func (r *recordingCheckInRepo) Create(ctx context.Context, checkIn *model.LocationCheckIn) error {
+	r.created = append(r.created, *checkIn)
+	return nil
+}
+
+func TestWorkerActions_BoundToCaller(t *testing.T) {
+	access := newTestAccess(
+		member("guard", "sentinel", model.RoleWorker),
+		member("other-guard", "sentinel", model.RoleWorker),
+		member("sentinel-site", "sentinel", model.RoleSiteAdmin),
+		member("guardian-admin", "guardian", model.RoleCompanyAdmin),
+	)
+	repo := &recordingCheckInRepo{}
+	routes := handler.NewLocationHandler(service.NewLocationService(repo, nil), access.service(), nil).Routes()
+	body := func(workerID string) string {
+		return `{"workerId":"` + workerID + `","latitude":51.5,"longitude":-0.1}`
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		caller     string
+		wantStatus int
+		wantWorker string
+	}{
+		{"worker from token", "/", `{"latitude":51.5,"longitude":-0.1}`, "guard", http.StatusCreated, "guard"},
+		{"matching workerId", "/", body("guard"), "guard", http.StatusCreated, "guard"},
+		{"someone else's workerId", "/", body("other-guard"), "guard", http.StatusForbidden, ""},
+		{"admin without backfill", "/", body("guard"), "sentinel-site", http.StatusForbidden, ""},
+		{"admin backfill", "/?backfill=true", body("guard"), "sentinel-site", http.StatusCreated, "guard"},
+		{"worker cannot backfill", "/?backfill=true", body("other-guard"), "guard", http.StatusForbidden, ""},
+		{"other company's admin cannot backfill", "/?backfill=true", body("guard"), "guardian-admin", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.created = nil
+			rr := serve(routes, http.MethodPost, tt.path, tt.body, tt.caller)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantWorker == "" {
+				if len(repo.created) != 0 {
+					t.Errorf("expected no check-in, got %+v", repo.created)
+				}
+				return
+			}
+			if len(repo.created) != 1 || repo.created[0].WorkerID != tt.wantWorker {
+				t.Errorf("expected check-in for %s, got %+v", tt.wantWorker, repo.created)
+			}
+		})
+	}
+}
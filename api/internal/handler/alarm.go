@@ -3,72 +3,79 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
 
-	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
 // AlarmHandler handles HTTP requests for alarms.
 type AlarmHandler struct {
-	service *service.AlarmService
+	service    *service.AlarmService
+	access     *service.AccessService
+	idempotent func(http.Handler) http.Handler
 }
 
-// NewAlarmHandler creates a new AlarmHandler.
-func NewAlarmHandler(s *service.AlarmService) *AlarmHandler {
-	return &AlarmHandler{service: s}
+// NewAlarmHandler creates a new AlarmHandler. Raising an alarm is wrapped
+// in idempotent, which may be nil.
+func NewAlarmHandler(s *service.AlarmService, access *service.AccessService, idempotent func(http.Handler) http.Handler) *AlarmHandler {
+	return &AlarmHandler{service: s, access: access, idempotent: orPassThrough(idempotent)}
 }
 
 // Routes returns the alarm routes.
 func (h *AlarmHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	// Read-only: accessible to all authenticated users
+	// Read-only: accessible to members of the alarm's company
 	r.Get("/", h.List)
 	r.Get("/{id}", h.GetByID)
 
-	// Worker-specific actions: accessible to all authenticated users
-	r.Post("/", h.Raise)
+	// Worker-specific actions: accessible to all authenticated users, or
+	// members of the shift's company when raised during a shift. Recorded
+	// against the caller; admins can backfill for others.
+	r.With(h.idempotent).Post("/", h.Raise)
 
-	// Admin actions: require company_admin or site_admin role
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.RequireRole("company_admin", "site_admin"))
-		r.Patch("/{id}/acknowledge", h.Acknowledge)
-		r.Patch("/{id}/resolve", h.Resolve)
-	})
+	// Admin actions: require company_admin or site_admin membership
+	r.Patch("/{id}/acknowledge", h.Acknowledge)
+	r.Patch("/{id}/resolve", h.Resolve)
 
 	return r
 }
 
+// List returns the alarms of ?company_id=, or of the ?worker_id= or
+// ?shift_id= filter; one of them is required.
 func (h *AlarmHandler) List(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
-	status := r.URL.Query().Get("status")
-	workerID := r.URL.Query().Get("worker_id")
-
-	var alarms []model.Alarm
-	var err error
-
-	if workerID != "" {
-		alarms, err = h.service.ListByWorker(r.Context(), workerID)
-	} else if status != "" {
-		alarms, err = h.service.ListByStatus(r.Context(), model.AlarmStatus(status), page, perPage)
-	} else {
-		alarms, err = h.service.List(r.Context(), page, perPage)
+	spec, p, ok := listRequest(w, r, repository.AlarmQuery)
+	if !ok {
+		return
 	}
-
-	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+	companyID, workerIDs, shiftIDs := r.URL.Query().Get("company_id"), spec.Equal("worker_id"), spec.Equal("shift_id")
+	if companyID == "" && len(workerIDs) == 0 && len(shiftIDs) == 0 {
+		Error(w, http.StatusBadRequest, "company_id, worker_id or shift_id query parameter is required")
 		return
 	}
+	if companyID != "" && !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: companyID}) {
+		return
+	}
+	for _, workerID := range workerIDs {
+		if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorker, ID: workerID}) {
+			return
+		}
+	}
+	for _, shiftID := range shiftIDs {
+		if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: shiftID}) {
+			return
+		}
+	}
 
-	if alarms == nil {
-		alarms = []model.Alarm{}
+	alarms, err := h.service.List(r.Context(), companyID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
 	}
-	JSON(w, http.StatusOK, alarms)
+	writePage(w, r, p, alarms)
 }
 
 func (h *AlarmHandler) Raise(w http.ResponseWriter, r *http.Request) {
@@ -77,9 +84,17 @@ func (h *AlarmHandler) Raise(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if alarm.ShiftID != nil && !authorizeRef(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: *alarm.ShiftID}) {
+		return
+	}
+	workerID, ok := actingWorker(w, r, h.access, alarm.WorkerID)
+	if !ok {
+		return
+	}
+	alarm.WorkerID = workerID
 
 	if err := h.service.Raise(r.Context(), &alarm); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -88,21 +103,31 @@ func (h *AlarmHandler) Raise(w http.ResponseWriter, r *http.Request) {
 
 func (h *AlarmHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeAlarm, ID: id}) {
+		return
+	}
 
 	alarm, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, alarm.Version)
 	JSON(w, http.StatusOK, alarm)
 }
 
 func (h *AlarmHandler) Acknowledge(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeAlarm, ID: id}, service.AdminRoles...) {
+		return
+	}
 
-	if err := h.service.Acknowledge(r.Context(), id); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	err := conditionally(r, func(version int) error {
+		return h.service.Acknowledge(r.Context(), id, version)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -111,9 +136,15 @@ func (h *AlarmHandler) Acknowledge(w http.ResponseWriter, r *http.Request) {
 
 func (h *AlarmHandler) Resolve(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeAlarm, ID: id}, service.AdminRoles...) {
+		return
+	}
 
-	if err := h.service.Resolve(r.Context(), id); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	err := conditionally(r, func(version int) error {
+		return h.service.Resolve(r.Context(), id, version)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+type APIKeyHandler struct {
+	service *service.APIKeyService
+	access  *service.AccessService
+}
+
+func NewAPIKeyHandler(s *service.APIKeyService, access *service.AccessService) *APIKeyHandler {
+	return &APIKeyHandler{service: s, access: access}
+}
+
+// createdAPIKey is returned once, when a key is issued; later reads only
+// show its prefix.
+type createdAPIKey struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+func (h *APIKeyHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	// All operations: require company_admin membership of the key's company
+	r.Get("/", h.List)
+	r.Post("/", h.Create)
+	r.Delete("/{id}", h.Revoke)
+
+	return r
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	companyID := r.URL.Query().Get("company_id")
+	if companyID == "" {
+		Error(w, http.StatusBadRequest, "company_id is required")
+		return
+	}
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: companyID}, model.RoleCompanyAdmin) {
+		return
+	}
+	spec, p, ok := listRequest(w, r, repository.APIKeyQuery)
+	if !ok {
+		return
+	}
+
+	keys, err := h.service.List(r.Context(), companyID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	writePage(w, r, p, keys)
+}
+
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var key model.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !authorizeRef(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: key.CompanyID}, model.RoleCompanyAdmin) {
+		return
+	}
+	secret, err := h.service.Create(r.Context(), &key, middleware.GetWorker(r.Context()).ID)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	JSON(w, http.StatusCreated, createdAPIKey{APIKey: key, Key: secret})
+}
+
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeAPIKey, ID: id}, model.RoleCompanyAdmin) {
+		return
+	}
+	if err := h.service.Revoke(r.Context(), id); err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
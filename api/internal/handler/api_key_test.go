@@ -0,0 +1,86 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// inMemoryAPIKeyRepo implements repository.APIKeyRepository.
+type inMemoryAPIKeyRepo struct {
+	keys []model.APIKey
+}
+
+func (r *inMemoryAPIKeyRepo) ListByCompany(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.APIKey], error) {
+	var result []model.APIKey
+	for _, k := range r.keys {
+		if k.CompanyID == companyID {
+			result = append(result, k)
+		}
+	}
+	return &pagination.Page[model.APIKey]{Items: result}, nil
+}
+func (r *inMemoryAPIKeyRepo) GetByID(ctx context.Context, id string) (*model.APIKey, error) {
+	for _, k := range r.keys {
+		if k.ID == id {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+func (r *inMemoryAPIKeyRepo) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	return nil, nil
+}
+func (r *inMemoryAPIKeyRepo) Create(ctx context.Context, key *model.APIKey, account *model.Worker) error {
+	key.WorkerID = "service-account-1"
+	r.keys = append(r.keys, *key)
+	return nil
+}
+func (r *inMemoryAPIKeyRepo) Revoke(ctx context.Context, id string) error        { return nil }
+func (r *inMemoryAPIKeyRepo) TouchLastUsed(ctx context.Context, id string) error { return nil }
+
+func TestAPIKeyHandler(t *testing.T) {
+	access := newTestAccess(
+		member("sentinel-admin", "sentinel", model.RoleCompanyAdmin),
+		member("sentinel-site", "sentinel", model.RoleSiteAdmin),
+	)
+	access.owners["sentinel"] = "sentinel"
+	access.owners["guardian-key"] = "guardian"
+	repo := &inMemoryAPIKeyRepo{}
+	routes := handler.NewAPIKeyHandler(service.NewAPIKeyService(repo, nil), access.service()).Routes()
+	body := `{"companyId":"sentinel","name":"Gate panel","scopes":["alarms:write"]}`
+
+	if rr := serve(routes, http.MethodPost, "/", body, "sentinel-site"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected site admin to get status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	rr := serve(routes, http.MethodPost, "/", body, "sentinel-admin")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var created map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&created)
+	if key, _ := created["key"].(string); !strings.HasPrefix(key, service.APIKeyPrefix) {
+		t.Errorf("expected the new key in the response, got %v", created)
+	}
+	if _, ok := created["keyHash"]; ok {
+		t.Error("expected the key hash not to be returned")
+	}
+
+	rr = serve(routes, http.MethodGet, "/?company_id=sentinel", "", "sentinel-admin")
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), `"key"`) {
+		t.Errorf("expected listing without secrets, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := serve(routes, http.MethodDelete, "/guardian-key", "", "sentinel-admin"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected revoking another company's key to get status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
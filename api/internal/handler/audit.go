@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+type AuditHandler struct {
+	service *service.AuditService
+	access  *service.AccessService
+}
+
+func NewAuditHandler(s *service.AuditService, access *service.AccessService) *AuditHandler {
+	return &AuditHandler{service: s, access: access}
+}
+
+func (h *AuditHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	// Read-only: require company_admin membership of ?company_id=
+	r.Get("/", h.List)
+
+	return r
+}
+
+// List returns a company's audit events, newest first, filterable by
+// ?action=, ?resource_type=, ?resource_id=, ?actor_id=, ?api_key_id= and a
+// ?since=/?until= window.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	companyID := r.URL.Query().Get("company_id")
+	if companyID == "" {
+		Error(w, http.StatusBadRequest, "company_id is required")
+		return
+	}
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: companyID}, model.RoleCompanyAdmin) {
+		return
+	}
+	spec, p, ok := listRequest(w, r, repository.AuditEventQuery)
+	if !ok {
+		return
+	}
+
+	events, err := h.service.List(r.Context(), companyID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	writePage(w, r, p, events)
+}
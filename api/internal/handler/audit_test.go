@@ -0,0 +1,76 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// inMemoryAuditRepo implements repository.AuditEventRepository.
+type inMemoryAuditRepo struct {
+	events    []model.AuditEvent
+	companyID string
+	spec      query.Spec
+}
+
+func (r *inMemoryAuditRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.AuditEvent], error) {
+	r.companyID, r.spec = companyID, spec
+	return &pagination.Page[model.AuditEvent]{Items: r.events}, nil
+}
+func (r *inMemoryAuditRepo) Create(ctx context.Context, event *model.AuditEvent) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func TestAuditHandler_List(t *testing.T) {
+	access := newTestAccess(
+		member("sentinel-admin", "sentinel", model.RoleCompanyAdmin),
+		member("sentinel-site", "sentinel", model.RoleSiteAdmin),
+	)
+	access.owners["sentinel"] = "sentinel"
+	access.owners["guardian"] = "guardian"
+	repo := &inMemoryAuditRepo{}
+	routes := handler.NewAuditHandler(service.NewAuditService(repo, access), access.service()).Routes()
+
+	if rr := serve(routes, http.MethodGet, "/", "", "sentinel-admin"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d without company_id, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := serve(routes, http.MethodGet, "/?company_id=sentinel", "", "sentinel-site"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected site admin to get status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+	if rr := serve(routes, http.MethodGet, "/?company_id=guardian", "", "sentinel-admin"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected another company's log to get status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+	if rr := serve(routes, http.MethodGet, "/?company_id=sentinel&since=yesterday", "", "sentinel-admin"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid since to get status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr := serve(routes, http.MethodGet,
+		"/?company_id=sentinel&resource_type=shift&resource_id=s1&actor_id=w1&since=2026-01-01T00:00:00Z", "", "sentinel-admin")
+	if rr.Code != http.StatusOK || rr.Body.String() != "[]\n" {
+		t.Fatalf("expected an empty list, got %d: %s", rr.Code, rr.Body.String())
+	}
+	spec := repo.spec
+	if repo.companyID != "sentinel" || len(spec.Filters) != 4 {
+		t.Fatalf("expected the company and four filters, got %q %+v", repo.companyID, spec.Filters)
+	}
+	if got := spec.Equal("resource_type"); len(got) != 1 || got[0] != "shift" {
+		t.Errorf("expected resource_type shift, got %v", got)
+	}
+	if got := spec.Equal("actor_id"); len(got) != 1 || got[0] != "w1" {
+		t.Errorf("expected actor_id w1, got %v", got)
+	}
+	if f := spec.Filters[3]; f.Field != "occurred_at" || f.Op != query.Gte {
+		t.Errorf("expected since to bound occurred_at, got %+v", f)
+	}
+
+	if rr := serve(routes, http.MethodGet, "/?company_id=sentinel&sort=action", "", "sentinel-admin"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an unsortable field to get status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -2,7 +2,8 @@ package handler
 
 import (
 	"crypto/rand"
-	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -13,11 +14,18 @@ import (
 // AuthHandler handles authentication routes.
 type AuthHandler struct {
 	provider auth.Provider
+	states   *stateCodec
 }
 
-// NewAuthHandler creates a new AuthHandler.
-func NewAuthHandler(provider auth.Provider) *AuthHandler {
-	return &AuthHandler{provider: provider}
+// NewAuthHandler creates a new AuthHandler. stateKey signs the login state
+// cookie; if empty a random key is generated, which only works while a
+// single API instance serves both the login and the callback.
+func NewAuthHandler(provider auth.Provider, stateKey []byte) *AuthHandler {
+	if len(stateKey) == 0 {
+		stateKey = make([]byte, 32)
+		rand.Read(stateKey)
+	}
+	return &AuthHandler{provider: provider, states: newStateCodec(stateKey)}
 }
 
 // Routes returns the auth routes.
@@ -25,23 +33,62 @@ func (h *AuthHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Get("/login", h.Login)
 	r.Get("/callback", h.Callback)
+	r.Post("/refresh", h.Refresh)
+	r.Post("/logout", h.Logout)
 	return r
 }
 
+// Login starts the authorization code flow. The state, nonce and PKCE
+// verifier are kept in a signed cookie for Callback to check.
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	state := generateState()
-	loginURL := h.provider.GetLoginURL(state)
+	ls, err := newLoginState()
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+	if err := h.states.set(w, r, ls); err != nil {
+		Error(w, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+
+	loginURL := h.provider.GetLoginURL(auth.LoginRequest{
+		State:         ls.State,
+		Nonce:         ls.Nonce,
+		CodeChallenge: auth.CodeChallengeS256(ls.CodeVerifier),
+	})
 	http.Redirect(w, r, loginURL, http.StatusTemporaryRedirect)
 }
 
+// Callback completes the authorization code flow after checking the
+// returned state against the login cookie.
 func (h *AuthHandler) Callback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		Error(w, http.StatusBadRequest, "authorization failed: "+errCode)
+		return
+	}
+
+	ls, err := h.states.consume(w, r, query.Get("state"))
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	code := query.Get("code")
 	if code == "" {
 		Error(w, http.StatusBadRequest, "missing authorization code")
 		return
 	}
 
-	tokenSet, err := h.provider.ExchangeCode(r.Context(), code)
+	tokenSet, err := h.provider.ExchangeCode(r.Context(), auth.CodeExchange{
+		Code:         code,
+		CodeVerifier: ls.CodeVerifier,
+		Nonce:        ls.Nonce,
+	})
+	if errors.Is(err, auth.ErrInvalidToken) {
+		Error(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
 	if err != nil {
 		Error(w, http.StatusInternalServerError, "failed to exchange authorization code")
 		return
@@ -50,8 +97,65 @@ func (h *AuthHandler) Callback(w http.ResponseWriter, r *http.Request) {
 	JSON(w, http.StatusOK, tokenSet)
 }
 
-func generateState() string {
-	b := make([]byte, 16)
-	rand.Read(b)
-	return hex.EncodeToString(b)
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if body.RefreshToken == "" {
+		Error(w, http.StatusBadRequest, "refreshToken is required")
+		return
+	}
+
+	tokenSet, err := h.provider.RefreshToken(r.Context(), body.RefreshToken)
+	if err != nil {
+		Error(w, http.StatusUnauthorized, "failed to refresh token")
+		return
+	}
+
+	JSON(w, http.StatusOK, tokenSet)
+}
+
+// Logout ends the caller's session at the identity provider and revokes
+// their refresh token. The response carries the end-session URL the client
+// should navigate to so the provider's SSO cookie is cleared too.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+		IDToken      string `json:"idToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	logoutURL, err := h.provider.Logout(r.Context(), auth.LogoutRequest{
+		RefreshToken: body.RefreshToken,
+		IDTokenHint:  body.IDToken,
+	})
+	if err != nil {
+		Error(w, http.StatusBadGateway, "failed to end session")
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]string{"logoutUrl": logoutURL})
+}
+
+func newLoginState() (loginState, error) {
+	state, err := auth.NewRandomString(16)
+	if err != nil {
+		return loginState{}, err
+	}
+	nonce, err := auth.NewRandomString(16)
+	if err != nil {
+		return loginState{}, err
+	}
+	verifier, err := auth.NewCodeVerifier()
+	if err != nil {
+		return loginState{}, err
+	}
+	return loginState{State: state, Nonce: nonce, CodeVerifier: verifier}, nil
 }
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stateCookieName = "sitesecurity_auth_state"
+	stateTTL        = 10 * time.Minute
+)
+
+var (
+	errStateMissing  = errors.New("missing login state")
+	errStateInvalid  = errors.New("invalid login state")
+	errStateExpired  = errors.New("login state expired")
+	errStateMismatch = errors.New("state does not match")
+	errStateReplayed = errors.New("login state already used")
+)
+
+// loginState is what Login remembers about an authorization request so
+// Callback can check the response belongs to it.
+type loginState struct {
+	State        string `json:"s"`
+	Nonce        string `json:"n"`
+	CodeVerifier string `json:"v"`
+	ExpiresAt    int64  `json:"e"`
+}
+
+// stateCodec stores loginState in an HMAC-signed cookie and remembers
+// consumed states until they expire so a callback cannot be replayed.
+type stateCodec struct {
+	key []byte
+
+	mu   sync.Mutex
+	used map[string]time.Time
+	now  func() time.Time
+}
+
+func newStateCodec(key []byte) *stateCodec {
+	return &stateCodec{key: key, used: make(map[string]time.Time), now: time.Now}
+}
+
+// set writes ls to a short-lived cookie scoped to the auth routes.
+func (c *stateCodec) set(w http.ResponseWriter, r *http.Request, ls loginState) error {
+	ls.ExpiresAt = c.now().Add(stateTTL).Unix()
+	payload, err := json.Marshal(ls)
+	if err != nil {
+		return err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Value:    encoded + "." + c.sign(encoded),
+		Path:     cookiePath(r),
+		MaxAge:   int(stateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		// Lax so the cookie is sent on the top-level redirect back from
+		// the identity provider.
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// consume reads and clears the state cookie, verifies its signature and
+// expiry, checks it against the state echoed on the callback, and marks it
+// used.
+func (c *stateCodec) consume(w http.ResponseWriter, r *http.Request, state string) (*loginState, error) {
+	cookie, err := r.Cookie(stateCookieName)
+	if err != nil {
+		return nil, errStateMissing
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Path:     cookiePath(r),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	encoded, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(c.sign(encoded))) {
+		return nil, errStateInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errStateInvalid
+	}
+	var ls loginState
+	if err := json.Unmarshal(payload, &ls); err != nil {
+		return nil, errStateInvalid
+	}
+
+	now := c.now()
+	if now.Unix() > ls.ExpiresAt {
+		return nil, errStateExpired
+	}
+	if state == "" || !hmac.Equal([]byte(state), []byte(ls.State)) {
+		return nil, errStateMismatch
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for s, exp := range c.used {
+		if now.After(exp) {
+			delete(c.used, s)
+		}
+	}
+	if _, seen := c.used[ls.State]; seen {
+		return nil, errStateReplayed
+	}
+	c.used[ls.State] = time.Unix(ls.ExpiresAt, 0)
+
+	return &ls, nil
+}
+
+func (c *stateCodec) sign(value string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// cookiePath scopes the cookie to the directory the auth routes are
+// mounted under, e.g. /api/v1/auth.
+func cookiePath(r *http.Request) string {
+	return path.Dir(r.URL.Path)
+}
+
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,251 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+)
+
+// stubProvider is a test double for auth.Provider that records the session
+// calls the auth handler makes.
+type stubProvider struct {
+	exchanged   *auth.CodeExchange
+	refreshFunc func(ctx context.Context, refreshToken string) (*auth.TokenSet, error)
+	logoutFunc  func(ctx context.Context, req auth.LogoutRequest) (string, error)
+	revoked     []string
+}
+
+func (s *stubProvider) ValidateToken(ctx context.Context, token string) (*auth.Claims, error) {
+	return nil, auth.ErrInvalidToken
+}
+
+func (s *stubProvider) GetUserInfo(ctx context.Context, token string) (*auth.UserInfo, error) {
+	return nil, nil
+}
+
+func (s *stubProvider) GetLoginURL(req auth.LoginRequest) string {
+	return "https://idp.example.com/authorize?" + url.Values{
+		"state":          {req.State},
+		"nonce":          {req.Nonce},
+		"code_challenge": {req.CodeChallenge},
+	}.Encode()
+}
+
+func (s *stubProvider) ExchangeCode(ctx context.Context, req auth.CodeExchange) (*auth.TokenSet, error) {
+	s.exchanged = &req
+	return &auth.TokenSet{AccessToken: "access"}, nil
+}
+
+func (s *stubProvider) RefreshToken(ctx context.Context, refreshToken string) (*auth.TokenSet, error) {
+	return s.refreshFunc(ctx, refreshToken)
+}
+
+func (s *stubProvider) Logout(ctx context.Context, req auth.LogoutRequest) (string, error) {
+	return s.logoutFunc(ctx, req)
+}
+
+func (s *stubProvider) RevokeToken(ctx context.Context, token, tokenTypeHint string) error {
+	s.revoked = append(s.revoked, token)
+	return nil
+}
+
+func postAuth(h *handler.AuthHandler, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAuthHandler_Refresh(t *testing.T) {
+	provider := &stubProvider{
+		refreshFunc: func(ctx context.Context, refreshToken string) (*auth.TokenSet, error) {
+			if refreshToken != "refresh-1" {
+				return nil, errors.New("invalid_grant")
+			}
+			return &auth.TokenSet{AccessToken: "access-2", RefreshToken: "refresh-2", ExpiresIn: 300}, nil
+		},
+	}
+	h := handler.NewAuthHandler(provider, []byte("test-key"))
+
+	rr := postAuth(h, "/refresh", `{"refreshToken":"refresh-1"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var tokens auth.TokenSet
+	json.NewDecoder(rr.Body).Decode(&tokens)
+	if tokens.AccessToken != "access-2" || tokens.RefreshToken != "refresh-2" {
+		t.Errorf("unexpected token set: %+v", tokens)
+	}
+
+	if rr := postAuth(h, "/refresh", `{}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for missing token, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := postAuth(h, "/refresh", `{"refreshToken":"expired"}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d for rejected token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	var got auth.LogoutRequest
+	provider := &stubProvider{
+		logoutFunc: func(ctx context.Context, req auth.LogoutRequest) (string, error) {
+			got = req
+			return "https://idp.example.com/logout?id_token_hint=id-1", nil
+		},
+	}
+	h := handler.NewAuthHandler(provider, []byte("test-key"))
+
+	rr := postAuth(h, "/logout", `{"refreshToken":"refresh-1","idToken":"id-1"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if got.RefreshToken != "refresh-1" || got.IDTokenHint != "id-1" {
+		t.Errorf("unexpected logout request: %+v", got)
+	}
+	if len(provider.revoked) != 0 {
+		t.Errorf("expected the provider's logout alone to end the session, got revocations %v", provider.revoked)
+	}
+
+	var result map[string]string
+	json.NewDecoder(rr.Body).Decode(&result)
+	if result["logoutUrl"] != "https://idp.example.com/logout?id_token_hint=id-1" {
+		t.Errorf("unexpected logoutUrl %q", result["logoutUrl"])
+	}
+}
+
+func TestAuthHandler_Logout_ProviderError(t *testing.T) {
+	provider := &stubProvider{
+		logoutFunc: func(ctx context.Context, req auth.LogoutRequest) (string, error) {
+			return "", errors.New("connection refused")
+		},
+	}
+	h := handler.NewAuthHandler(provider, []byte("test-key"))
+
+	if rr := postAuth(h, "/logout", `{"refreshToken":"refresh-1"}`); rr.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d", http.StatusBadGateway, rr.Code)
+	}
+}
+
+// startLogin runs /login and returns the redirect URL and state cookie.
+func startLogin(t *testing.T, h *handler.AuthHandler) (*url.URL, *http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/login", nil)
+	rr := httptest.NewRecorder()
+	router := chi.NewRouter()
+	router.Mount("/api/v1/auth", h.Routes())
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("expected status %d, got %d", http.StatusTemporaryRedirect, rr.Code)
+	}
+	loc, _ := url.Parse(rr.Header().Get("Location"))
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one state cookie, got %d", len(cookies))
+	}
+	return loc, cookies[0]
+}
+
+func callback(h *handler.AuthHandler, query string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/callback?"+query, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAuthHandler_LoginCallback(t *testing.T) {
+	provider := &stubProvider{}
+	h := handler.NewAuthHandler(provider, []byte("test-key"))
+
+	loc, cookie := startLogin(t, h)
+	if !cookie.HttpOnly || cookie.Path != "/api/v1/auth" || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("unexpected cookie attributes: %+v", cookie)
+	}
+	state := loc.Query().Get("state")
+
+	rr := callback(h, "code=code-1&state="+url.QueryEscape(state), cookie)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if provider.exchanged == nil || provider.exchanged.Code != "code-1" {
+		t.Fatalf("expected code to be exchanged, got %+v", provider.exchanged)
+	}
+	if auth.CodeChallengeS256(provider.exchanged.CodeVerifier) != loc.Query().Get("code_challenge") {
+		t.Error("code verifier does not match the challenge sent at login")
+	}
+	if provider.exchanged.Nonce != loc.Query().Get("nonce") {
+		t.Errorf("expected nonce %q, got %q", loc.Query().Get("nonce"), provider.exchanged.Nonce)
+	}
+}
+
+func TestAuthHandler_Callback_RejectsState(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, h *handler.AuthHandler) (string, *http.Cookie)
+	}{
+		{"missing cookie", func(t *testing.T, h *handler.AuthHandler) (string, *http.Cookie) {
+			loc, _ := startLogin(t, h)
+			return loc.Query().Get("state"), nil
+		}},
+		{"missing state", func(t *testing.T, h *handler.AuthHandler) (string, *http.Cookie) {
+			_, cookie := startLogin(t, h)
+			return "", cookie
+		}},
+		{"mismatched state", func(t *testing.T, h *handler.AuthHandler) (string, *http.Cookie) {
+			_, cookie := startLogin(t, h)
+			other, _ := startLogin(t, h)
+			return other.Query().Get("state"), cookie
+		}},
+		{"tampered cookie", func(t *testing.T, h *handler.AuthHandler) (string, *http.Cookie) {
+			loc, cookie := startLogin(t, h)
+			payload, sig, _ := strings.Cut(cookie.Value, ".")
+			cookie.Value = payload + "x." + sig
+			return loc.Query().Get("state"), cookie
+		}},
+		{"cookie signed with another key", func(t *testing.T, h *handler.AuthHandler) (string, *http.Cookie) {
+			other := handler.NewAuthHandler(&stubProvider{}, []byte("other-key"))
+			loc, cookie := startLogin(t, other)
+			return loc.Query().Get("state"), cookie
+		}},
+		{"replayed", func(t *testing.T, h *handler.AuthHandler) (string, *http.Cookie) {
+			loc, cookie := startLogin(t, h)
+			state := loc.Query().Get("state")
+			if rr := callback(h, "code=code-1&state="+url.QueryEscape(state), cookie); rr.Code != http.StatusOK {
+				t.Fatalf("expected first callback to succeed, got %d", rr.Code)
+			}
+			return state, cookie
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &stubProvider{}
+			h := handler.NewAuthHandler(provider, []byte("test-key"))
+			state, cookie := tt.setup(t, h)
+			provider.exchanged = nil
+
+			rr := callback(h, "code=code-2&state="+url.QueryEscape(state), cookie)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+			if provider.exchanged != nil {
+				t.Error("code should not be exchanged")
+			}
+		})
+	}
+}
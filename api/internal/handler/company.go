@@ -2,70 +2,81 @@ package handler
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
 	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
 // CompanyHandler handles HTTP requests for companies.
 type CompanyHandler struct {
 	service *service.CompanyService
+	access  *service.AccessService
 }
 
 // NewCompanyHandler creates a new CompanyHandler.
-func NewCompanyHandler(s *service.CompanyService) *CompanyHandler {
-	return &CompanyHandler{service: s}
+func NewCompanyHandler(s *service.CompanyService, access *service.AccessService) *CompanyHandler {
+	return &CompanyHandler{service: s, access: access}
 }
 
 // Routes returns the company routes.
 func (h *CompanyHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	// Read-only: accessible to all authenticated users
+	// Read-only: a worker lists and reads the companies they are a member
+	// of
 	r.Get("/", h.List)
 	r.Get("/{id}", h.GetByID)
 
-	// Write operations: require company_admin role
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.RequireRole("company_admin"))
-		r.Post("/", h.Create)
-		r.Put("/{id}", h.Update)
-		r.Delete("/{id}", h.Delete)
-	})
+	// Onboarding a company: requires the company_admin realm role. The
+	// creator becomes the new company's first admin.
+	r.With(middleware.RequireRole("company_admin")).Post("/", h.Create)
+
+	// Write operations: require company_admin membership of the company
+	r.Put("/{id}", h.Update)
+	r.Delete("/{id}", h.Delete)
 
 	return r
 }
 
 func (h *CompanyHandler) List(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	spec, p, ok := listRequest(w, r, repository.CompanyQuery)
+	if !ok {
+		return
+	}
 
-	companies, err := h.service.List(r.Context(), page, perPage)
+	companyIDs, err := h.access.Companies(r.Context(), caller(r))
 	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
-
-	if companies == nil {
-		companies = []model.Company{}
+	companies, err := h.service.List(r.Context(), companyIDs, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
 	}
-	JSON(w, http.StatusOK, companies)
+	writePage(w, r, p, companies)
 }
 
 func (h *CompanyHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: id}) {
+		return
+	}
 
 	company, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, company.Version)
 	JSON(w, http.StatusOK, company)
 }
 
@@ -77,15 +88,26 @@ func (h *CompanyHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.service.Create(r.Context(), &company); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
+	if worker := middleware.GetWorker(r.Context()); worker != nil {
+		if err := h.access.GrantCompanyAdmin(r.Context(), worker.ID, company.ID); err != nil {
+			logging.FromContext(r.Context()).Error("failed to make creator admin of new company",
+				slog.String("company_id", company.ID), logging.Error(err))
+			Error(w, http.StatusInternalServerError, "failed to create company")
+			return
+		}
+	}
 
 	JSON(w, http.StatusCreated, company)
 }
 
 func (h *CompanyHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: id}, model.RoleCompanyAdmin) {
+		return
+	}
 
 	var company model.Company
 	if err := json.NewDecoder(r.Body).Decode(&company); err != nil {
@@ -94,19 +116,30 @@ func (h *CompanyHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 	company.ID = id
 
-	if err := h.service.Update(r.Context(), &company); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	err := conditionally(r, func(version int) error {
+		company.Version = version
+		return h.service.Update(r.Context(), &company)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, company.Version)
 	JSON(w, http.StatusOK, company)
 }
 
 func (h *CompanyHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: id}, model.RoleCompanyAdmin) {
+		return
+	}
 
-	if err := h.service.Delete(r.Context(), id); err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+	err := conditionally(r, func(version int) error {
+		return h.service.Delete(r.Context(), id, version)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
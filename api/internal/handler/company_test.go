@@ -15,10 +15,14 @@ import (
 	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
 	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
-// withAdminClaims adds company_admin auth claims to the request context.
+// withAdminClaims adds company_admin auth claims, and the matching worker,
+// to the request context.
 func withAdminClaims(r *http.Request) *http.Request {
 	claims := &auth.Claims{
 		Subject: "test-admin",
@@ -26,7 +30,7 @@ func withAdminClaims(r *http.Request) *http.Request {
 		Roles:   []string{"company_admin"},
 	}
 	ctx := context.WithValue(r.Context(), middleware.ClaimsContextKey, claims)
-	return r.WithContext(ctx)
+	return withWorker(r.WithContext(ctx), "admin-worker")
 }
 
 func TestHealthEndpoint(t *testing.T) {
@@ -48,8 +52,9 @@ func TestHealthEndpoint(t *testing.T) {
 
 func TestCompanyHandler_Create(t *testing.T) {
 	repo := &inMemoryCompanyRepo{companies: make(map[string]model.Company)}
-	svc := service.NewCompanyService(repo)
-	h := handler.NewCompanyHandler(svc)
+	svc := service.NewCompanyService(repo, nil)
+	access := newTestAccess()
+	h := handler.NewCompanyHandler(svc, access.service())
 
 	body := `{"name":"Test Security Ltd"}`
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
@@ -73,12 +78,15 @@ func TestCompanyHandler_Create(t *testing.T) {
 	if company.ID == "" {
 		t.Error("expected ID to be set")
 	}
+	if m := access.membership("admin-worker", company.ID); m == nil || m.Role != model.RoleCompanyAdmin {
+		t.Errorf("expected creator to be made company admin, got %+v", m)
+	}
 }
 
 func TestCompanyHandler_Create_InvalidBody(t *testing.T) {
 	repo := &inMemoryCompanyRepo{companies: make(map[string]model.Company)}
-	svc := service.NewCompanyService(repo)
-	h := handler.NewCompanyHandler(svc)
+	svc := service.NewCompanyService(repo, nil)
+	h := handler.NewCompanyHandler(svc, newTestAccess().service())
 
 	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("not json"))
 	req.Header.Set("Content-Type", "application/json")
@@ -99,10 +107,10 @@ func TestCompanyHandler_List(t *testing.T) {
 	repo.companies["1"] = model.Company{ID: "1", Name: "Alpha"}
 	repo.companies["2"] = model.Company{ID: "2", Name: "Beta"}
 
-	svc := service.NewCompanyService(repo)
-	h := handler.NewCompanyHandler(svc)
+	svc := service.NewCompanyService(repo, nil)
+	h := handler.NewCompanyHandler(svc, newTestAccess(member("w1", "2", model.RoleWorker)).service())
 
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req := withWorker(httptest.NewRequest(http.MethodGet, "/", nil), "w1")
 	rr := httptest.NewRecorder()
 
 	router := chi.NewRouter()
@@ -115,17 +123,18 @@ func TestCompanyHandler_List(t *testing.T) {
 
 	var companies []model.Company
 	json.NewDecoder(rr.Body).Decode(&companies)
-	if len(companies) != 2 {
-		t.Errorf("expected 2 companies, got %d", len(companies))
+	if len(companies) != 1 || companies[0].ID != "2" {
+		t.Errorf("expected only the worker's own company, got %v", companies)
 	}
 }
 
 func TestCompanyHandler_GetByID_NotFound(t *testing.T) {
 	repo := &inMemoryCompanyRepo{companies: make(map[string]model.Company)}
-	svc := service.NewCompanyService(repo)
-	h := handler.NewCompanyHandler(svc)
+	svc := service.NewCompanyService(repo, nil)
+	h := handler.NewCompanyHandler(svc, newTestAccess().service())
 
 	req := httptest.NewRequest(http.MethodGet, "/missing-id", nil)
+	req = withAdminClaims(req)
 	rr := httptest.NewRecorder()
 
 	router := chi.NewRouter()
@@ -143,12 +152,14 @@ type inMemoryCompanyRepo struct {
 	nextID    int
 }
 
-func (r *inMemoryCompanyRepo) List(ctx context.Context, limit, offset int) ([]model.Company, error) {
+func (r *inMemoryCompanyRepo) List(ctx context.Context, companyIDs []string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Company], error) {
 	var result []model.Company
-	for _, c := range r.companies {
-		result = append(result, c)
+	for _, id := range companyIDs {
+		if c, ok := r.companies[id]; ok {
+			result = append(result, c)
+		}
 	}
-	return result, nil
+	return &pagination.Page[model.Company]{Items: result}, nil
 }
 
 func (r *inMemoryCompanyRepo) GetByID(ctx context.Context, id string) (*model.Company, error) {
@@ -162,16 +173,26 @@ func (r *inMemoryCompanyRepo) GetByID(ctx context.Context, id string) (*model.Co
 func (r *inMemoryCompanyRepo) Create(ctx context.Context, company *model.Company) error {
 	r.nextID++
 	company.ID = fmt.Sprintf("test-%d", r.nextID)
+	company.Version = 1
 	r.companies[company.ID] = *company
 	return nil
 }
 
 func (r *inMemoryCompanyRepo) Update(ctx context.Context, company *model.Company) error {
+	current, ok := r.companies[company.ID]
+	if !ok || (company.Version != 0 && company.Version != current.Version) {
+		return repository.ErrVersionMismatch
+	}
+	company.Version = current.Version + 1
 	r.companies[company.ID] = *company
 	return nil
 }
 
-func (r *inMemoryCompanyRepo) Delete(ctx context.Context, id string) error {
+func (r *inMemoryCompanyRepo) Delete(ctx context.Context, id string, version int) error {
+	current, ok := r.companies[id]
+	if !ok || (version != 0 && version != current.Version) {
+		return repository.ErrVersionMismatch
+	}
 	delete(r.companies, id)
 	return nil
 }
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// setETag sets the ETag of a single resource to its version.
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(version)+`"`)
+}
+
+// ifMatch returns the versions a PUT, PATCH or DELETE may apply to from its
+// If-Match header, which RFC 9110 allows to list several tags. It is [0],
+// making the write unconditional, when the header is absent or "*". Tags
+// this API did not issue are dropped, as are weak ones, which If-Match's
+// strong comparison never matches; a header left with none is [-1], which
+// no version matches, so the write fails its precondition.
+func ifMatch(r *http.Request) []int {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return []int{0}
+	}
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 3 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		version, err := strconv.Atoi(tag[1 : len(tag)-1])
+		if err != nil || version < 1 || slices.Contains(versions, version) {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		return []int{-1}
+	}
+	return versions
+}
+
+// conditionally runs a conditional write once for each version the request's
+// If-Match header lists, stopping at the first attempt not refused with
+// service.ErrPreconditionFailed, so the write applies when any listed version
+// is current. A refused attempt changes nothing, so trying the next is safe.
+func conditionally(r *http.Request, write func(version int) error) error {
+	var err error
+	for _, version := range ifMatch(r) {
+		if err = write(version); !errors.Is(err, service.ErrPreconditionFailed) {
+			return err
+		}
+	}
+	return err
+}
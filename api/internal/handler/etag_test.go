@@ -0,0 +1,95 @@
+package handler_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+func TestCompanyHandler_IfMatch(t *testing.T) {
+	repo := &inMemoryCompanyRepo{companies: map[string]model.Company{
+		"c1": {ID: "c1", Name: "Sentinel", Version: 3},
+	}}
+	admin := model.WorkerCompany{WorkerID: "admin-worker", CompanyID: "c1", Role: model.RoleCompanyAdmin, Status: model.MembershipActive}
+	access := newTestAccess(admin)
+	access.owners["w1"] = "c1"
+	router := chi.NewRouter()
+	router.Mount("/", handler.NewCompanyHandler(service.NewCompanyService(repo, nil), access.service()).Routes())
+
+	serve := func(method, ifMatch, body string) *httptest.ResponseRecorder {
+		req := withAdminClaims(httptest.NewRequest(method, "/c1", bytes.NewBufferString(body)))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(http.MethodGet, "", ""); rr.Header().Get("ETag") != `"3"` {
+		t.Errorf(`expected ETag "3", got %q`, rr.Header().Get("ETag"))
+	}
+
+	for _, stale := range []string{`"2"`, `W/"3"`, `"abc"`, `"1", "2"`, `W/"3", "2"`} {
+		if rr := serve(http.MethodPut, stale, `{"name":"Renamed"}`); rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status %d for If-Match %s, got %d", http.StatusPreconditionFailed, stale, rr.Code)
+		}
+	}
+	if rr := serve(http.MethodDelete, `"2"`, ""); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected status %d for a stale delete, got %d", http.StatusPreconditionFailed, rr.Code)
+	}
+	if repo.companies["c1"].Name != "Sentinel" {
+		t.Errorf("expected stale writes to leave the company alone, got %+v", repo.companies["c1"])
+	}
+
+	rr := serve(http.MethodPut, `"2", "3"`, `{"name":"Renamed"}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"4"` {
+		t.Errorf(`expected status 200 with ETag "4", got %d %q`, rr.Code, rr.Header().Get("ETag"))
+	}
+	if rr := serve(http.MethodPut, "", `{"name":"Unconditional"}`); rr.Code != http.StatusOK {
+		t.Errorf("expected a write without If-Match to succeed, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodDelete, `"5"`, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d for a current delete, got %d", http.StatusNoContent, rr.Code)
+	}
+}
+
+func TestWorkerHandler_MembershipIfMatch(t *testing.T) {
+	access := newTestAccess(
+		member("admin-worker", "c1", model.RoleCompanyAdmin),
+		model.WorkerCompany{WorkerID: "w1", CompanyID: "c1", Role: model.RoleWorker, Status: model.MembershipActive, Version: 2},
+	)
+	access.owners["w1"] = "c1"
+	routes := handler.NewWorkerHandler(service.NewWorkerService(nil, nil, access, nil, nil), access.service()).Routes()
+
+	serve := func(method, ifMatch, body string) *httptest.ResponseRecorder {
+		req := withWorker(httptest.NewRequest(method, "/w1/memberships/c1", bytes.NewBufferString(body)), "admin-worker")
+		req.Header.Set("If-Match", ifMatch)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(http.MethodPut, `"1"`, `{"role":"site_admin"}`); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected status %d for a stale role change, got %d", http.StatusPreconditionFailed, rr.Code)
+	}
+	rr := serve(http.MethodPut, `"2"`, `{"role":"site_admin"}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"3"` {
+		t.Errorf(`expected status 200 with ETag "3", got %d %q`, rr.Code, rr.Header().Get("ETag"))
+	}
+	for _, stale := range []string{`"2"`, `W/"3"`, `"1", "2"`} {
+		if rr := serve(http.MethodDelete, stale, ""); rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status %d for If-Match %s, got %d", http.StatusPreconditionFailed, stale, rr.Code)
+		}
+	}
+	if rr := serve(http.MethodDelete, `"1", "3"`, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d for a current removal, got %d", http.StatusNoContent, rr.Code)
+	}
+}
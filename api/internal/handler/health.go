@@ -1,8 +1,88 @@
 package handler
 
-import "net/http"
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
-// Health returns a simple health check handler.
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+)
+
+// readinessTimeout bounds each readiness check, well inside the probe's
+// own timeout.
+const readinessTimeout = 2 * time.Second
+
+// Health reports that the process is alive. It checks no dependencies, so
+// an outage of the database or identity provider never gets the API
+// restarted; Readiness takes it out of service instead.
 func Health(w http.ResponseWriter, r *http.Request) {
 	JSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
+
+// Check reports whether a dependency the API needs is available.
+type Check func(ctx context.Context) error
+
+// Readiness reports whether the API can serve requests: every check must
+// pass, and the server must not be draining for shutdown. Failing checks
+// are named in the response and logged with their error, which the
+// response leaves out.
+type Readiness struct {
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+// NewReadiness creates a readiness handler running checks, keyed by the
+// name they are reported under.
+func NewReadiness(checks map[string]Check) *Readiness {
+	return &Readiness{checks: checks}
+}
+
+// Drain makes every later request report the API unready, so load
+// balancers stop routing to it before the server shuts down.
+func (h *Readiness) Drain() {
+	h.draining.Store(true)
+}
+
+func (h *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		JSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]string, len(h.checks))
+		ready   = true
+	)
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := check(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				results[name] = "unavailable"
+				ready = false
+				logging.FromContext(r.Context()).Warn("readiness check failed",
+					slog.String("check", name), logging.Error(err))
+				return
+			}
+			results[name] = "ok"
+		}()
+	}
+	wg.Wait()
+
+	if !ready {
+		JSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "unavailable", "checks": results})
+		return
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"status": "ready", "checks": results})
+}
@@ -0,0 +1,100 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+)
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func probe(t *testing.T, h http.Handler) (int, readinessResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var result readinessResponse
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return rr.Code, result
+}
+
+func TestReadiness_Ready(t *testing.T) {
+	h := handler.NewReadiness(map[string]handler.Check{
+		"database":          func(context.Context) error { return nil },
+		"identity_provider": func(context.Context) error { return nil },
+	})
+
+	code, result := probe(t, h)
+	if code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if result.Status != "ready" || result.Checks["database"] != "ok" || result.Checks["identity_provider"] != "ok" {
+		t.Errorf("unexpected response %+v", result)
+	}
+}
+
+func TestReadiness_FailingCheck(t *testing.T) {
+	h := handler.NewReadiness(map[string]handler.Check{
+		"database":          func(context.Context) error { return errors.New("dial tcp 10.0.0.5:5432: connection refused") },
+		"identity_provider": func(context.Context) error { return nil },
+	})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	body := rr.Body.String()
+
+	var result readinessResponse
+	json.Unmarshal([]byte(body), &result)
+	if result.Status != "unavailable" || result.Checks["database"] != "unavailable" || result.Checks["identity_provider"] != "ok" {
+		t.Errorf("unexpected response %+v", result)
+	}
+	if strings.Contains(body, "10.0.0.5") {
+		t.Errorf("expected the check's error to be left out of the response, got %s", body)
+	}
+}
+
+func TestReadiness_CheckTimesOut(t *testing.T) {
+	h := handler.NewReadiness(map[string]handler.Check{
+		"database": func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	// The probe's own deadline bounds the checks as well as the handler's.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil).WithContext(ctx))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a hung check to fail, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestReadiness_Drain(t *testing.T) {
+	h := handler.NewReadiness(map[string]handler.Check{
+		"database": func(context.Context) error { return nil },
+	})
+	h.Drain()
+
+	code, result := probe(t, h)
+	if code != http.StatusServiceUnavailable || result.Status != "draining" {
+		t.Errorf("expected a draining server to be unready, got %d %+v", code, result)
+	}
+}
@@ -0,0 +1,12 @@
+package handler
+
+import "net/http"
+
+// orPassThrough returns mw, or middleware that changes nothing if it is
+// nil.
+func orPassThrough(mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	if mw == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return mw
+}
@@ -3,28 +3,32 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
 // LocationHandler handles HTTP requests for location check-ins.
 type LocationHandler struct {
-	service *service.LocationService
+	service    *service.LocationService
+	access     *service.AccessService
+	idempotent func(http.Handler) http.Handler
 }
 
-// NewLocationHandler creates a new LocationHandler.
-func NewLocationHandler(s *service.LocationService) *LocationHandler {
-	return &LocationHandler{service: s}
+// NewLocationHandler creates a new LocationHandler. Recording a check-in is
+// wrapped in idempotent, which may be nil.
+func NewLocationHandler(s *service.LocationService, access *service.AccessService, idempotent func(http.Handler) http.Handler) *LocationHandler {
+	return &LocationHandler{service: s, access: access, idempotent: orPassThrough(idempotent)}
 }
 
 // Routes returns the location check-in routes.
 func (h *LocationHandler) Routes() chi.Router {
 	r := chi.NewRouter()
-	r.Post("/", h.Create)
+	// Check-ins are recorded as the caller; admins can backfill for others
+	r.With(h.idempotent).Post("/", h.Create)
 	r.Get("/", h.List)
 	return r
 }
@@ -35,9 +39,17 @@ func (h *LocationHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if checkIn.ShiftID != nil && !authorizeRef(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: *checkIn.ShiftID}) {
+		return
+	}
+	workerID, ok := actingWorker(w, r, h.access, checkIn.WorkerID)
+	if !ok {
+		return
+	}
+	checkIn.WorkerID = workerID
 
 	if err := h.service.Create(r.Context(), &checkIn); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -48,22 +60,27 @@ func (h *LocationHandler) List(w http.ResponseWriter, r *http.Request) {
 	workerID := r.URL.Query().Get("worker_id")
 	shiftID := r.URL.Query().Get("shift_id")
 
-	var checkIns []model.LocationCheckIn
-	var err error
-
 	if workerID != "" {
-		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
-		checkIns, err = h.service.ListByWorker(r.Context(), workerID, page, perPage)
-	} else if shiftID != "" {
-		checkIns, err = h.service.ListByShift(r.Context(), shiftID)
-	} else {
+		spec, p, ok := listRequest(w, r, repository.CheckInQuery)
+		if !ok {
+			return
+		}
+		checkIns, err := h.service.ListWorkerCheckIns(r.Context(), workerID, spec, p)
+		if err != nil {
+			ServiceError(w, r, err)
+			return
+		}
+		writePage(w, r, p, checkIns)
+		return
+	}
+	if shiftID == "" {
 		Error(w, http.StatusBadRequest, "worker_id or shift_id query parameter is required")
 		return
 	}
 
+	checkIns, err := h.service.ListByShift(r.Context(), shiftID)
 	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
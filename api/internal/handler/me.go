@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// MeHandler serves the logged-in worker's own profile and activity. The
+// worker is resolved from the token by middleware.Worker.
+type MeHandler struct {
+	workers   *service.WorkerService
+	shifts    *service.ShiftService
+	reports   *service.ShiftReportService
+	alarms    *service.AlarmService
+	locations *service.LocationService
+}
+
+// NewMeHandler creates a new MeHandler.
+func NewMeHandler(
+	workers *service.WorkerService,
+	shifts *service.ShiftService,
+	reports *service.ShiftReportService,
+	alarms *service.AlarmService,
+	locations *service.LocationService,
+) *MeHandler {
+	return &MeHandler{
+		workers:   workers,
+		shifts:    shifts,
+		reports:   reports,
+		alarms:    alarms,
+		locations: locations,
+	}
+}
+
+// Routes returns the /me routes.
+func (h *MeHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", h.Profile)
+	r.Get("/certificates", h.Certificates)
+	r.Get("/memberships", h.Memberships)
+	r.Get("/assignments", h.Assignments)
+	r.Get("/shift-reports", h.ShiftReports)
+	r.Get("/alarms", h.Alarms)
+	r.Get("/check-ins", h.CheckIns)
+	return r
+}
+
+func (h *MeHandler) Profile(w http.ResponseWriter, r *http.Request) {
+	worker := middleware.GetWorker(r.Context())
+	if worker == nil {
+		Error(w, http.StatusUnauthorized, "no worker for the authenticated user")
+		return
+	}
+	JSON(w, http.StatusOK, worker)
+}
+
+// Certificates lists my certificates. ?expired=true|false filters on the
+// expiry date.
+func (h *MeHandler) Certificates(w http.ResponseWriter, r *http.Request) {
+	worker, spec, p, ok := h.listParams(w, r, repository.CertificateQuery)
+	if !ok {
+		return
+	}
+	expired, err := queryBool(r, "expired")
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	certs, err := h.workers.ListWorkerCertificates(r.Context(), worker.ID, repository.CertificateFilter{Expired: expired}, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	writePage(w, r, p, certs)
+}
+
+// Memberships lists my company memberships, filterable by ?status= and
+// ?role=.
+func (h *MeHandler) Memberships(w http.ResponseWriter, r *http.Request) {
+	worker, spec, p, ok := h.listParams(w, r, repository.MembershipQuery)
+	if !ok {
+		return
+	}
+
+	memberships, err := h.workers.ListWorkerMemberships(r.Context(), worker.ID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	writePage(w, r, p, memberships)
+}
+
+// Assignments lists my shift assignments with their shifts.
+// ?when=upcoming|past splits them on the shift end time and ?status=
+// filters on the assignment status.
+func (h *MeHandler) Assignments(w http.ResponseWriter, r *http.Request) {
+	worker, spec, p, ok := h.listParams(w, r, repository.AssignmentQuery)
+	if !ok {
+		return
+	}
+	var filter repository.AssignmentFilter
+	switch when := r.URL.Query().Get("when"); when {
+	case "":
+	case "upcoming", "past":
+		upcoming := when == "upcoming"
+		filter.Upcoming = &upcoming
+	default:
+		Error(w, http.StatusBadRequest, "when must be 'upcoming' or 'past'")
+		return
+	}
+
+	assignments, err := h.shifts.ListWorkerAssignments(r.Context(), worker.ID, filter, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	writePage(w, r, p, assignments)
+}
+
+// ShiftReports lists the reports I have submitted, filterable by
+// ?shift_id= and a ?since=/?until= submission window.
+func (h *MeHandler) ShiftReports(w http.ResponseWriter, r *http.Request) {
+	worker, spec, p, ok := h.listParams(w, r, repository.ShiftReportQuery)
+	if !ok {
+		return
+	}
+
+	reports, err := h.reports.ListWorkerReports(r.Context(), worker.ID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	writePage(w, r, p, reports)
+}
+
+// Alarms lists the alarms I have raised, filterable by ?status=,
+// ?shift_id= and a ?since=/?until= window.
+func (h *MeHandler) Alarms(w http.ResponseWriter, r *http.Request) {
+	worker, spec, p, ok := h.listParams(w, r, repository.AlarmQuery)
+	if !ok {
+		return
+	}
+
+	alarms, err := h.alarms.ListWorkerAlarms(r.Context(), worker.ID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	writePage(w, r, p, alarms)
+}
+
+// CheckIns lists my location check-ins, filterable by ?shift_id= and a
+// ?since=/?until= window.
+func (h *MeHandler) CheckIns(w http.ResponseWriter, r *http.Request) {
+	worker, spec, p, ok := h.listParams(w, r, repository.CheckInQuery)
+	if !ok {
+		return
+	}
+
+	checkIns, err := h.locations.ListWorkerCheckIns(r.Context(), worker.ID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
+	}
+	writePage(w, r, p, checkIns)
+}
+
+// listParams resolves the current worker, and the filters, sort order and
+// page shared by every /me list, writing an error response if there is no
+// worker or the query string is invalid.
+func (h *MeHandler) listParams(w http.ResponseWriter, r *http.Request, schema query.Schema) (*model.Worker, query.Spec, pagination.Request, bool) {
+	worker := middleware.GetWorker(r.Context())
+	if worker == nil {
+		Error(w, http.StatusUnauthorized, "no worker for the authenticated user")
+		return nil, query.Spec{}, pagination.Request{}, false
+	}
+	spec, p, ok := listRequest(w, r, schema)
+	return worker, spec, p, ok
+}
+
+// queryBool parses an optional boolean query parameter.
+func queryBool(r *http.Request, key string) (*bool, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", key)
+	}
+	return &v, nil
+}
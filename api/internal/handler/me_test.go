@@ -0,0 +1,174 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+func getMe(h *handler.MeHandler, path string, worker *model.Worker) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if worker != nil {
+		req = req.WithContext(context.WithValue(req.Context(), middleware.WorkerContextKey, worker))
+	}
+	rr := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMeHandler_Profile(t *testing.T) {
+	h := handler.NewMeHandler(nil, nil, nil, nil, nil)
+	worker := &model.Worker{ID: "w1", AuthSubject: "sub-1", FirstName: "John", LastName: "Smith", Email: "john@example.com"}
+
+	rr := getMe(h, "/", worker)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var got model.Worker
+	json.NewDecoder(rr.Body).Decode(&got)
+	if got.ID != "w1" || got.Email != "john@example.com" {
+		t.Errorf("unexpected worker: %+v", got)
+	}
+
+	if rr := getMe(h, "/", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without a worker, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestMeHandler_InvalidFilters(t *testing.T) {
+	h := handler.NewMeHandler(nil, nil, nil, nil, nil)
+	worker := &model.Worker{ID: "w1"}
+
+	for _, path := range []string{
+		"/certificates?expired=maybe",
+		"/assignments?when=tomorrow",
+		"/shift-reports?since=yesterday",
+		"/alarms?until=2024-01-01",
+		"/check-ins?since=not-a-time",
+		"/alarms?status=lost",
+		"/assignments?sort=title",
+	} {
+		if rr := getMe(h, path, worker); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+// The /me fakes hold rows of two workers and implement only ListForWorker;
+// the interface they embed is nil.
+type meCertificateRepo struct {
+	repository.CertificateRepository
+	rows []model.Certificate
+}
+
+func (r *meCertificateRepo) ListForWorker(ctx context.Context, workerID string, filter repository.CertificateFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.Certificate], error) {
+	return ownedBy(r.rows, workerID, func(c model.Certificate) string { return c.WorkerID }), nil
+}
+
+type meMembershipRepo struct {
+	repository.WorkerCompanyRepository
+	rows []model.WorkerCompany
+}
+
+func (r *meMembershipRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.WorkerCompany], error) {
+	return ownedBy(r.rows, workerID, func(wc model.WorkerCompany) string { return wc.WorkerID }), nil
+}
+
+type meAssignmentRepo struct {
+	repository.ShiftAssignmentRepository
+	rows []model.AssignmentWithShift
+}
+
+func (r *meAssignmentRepo) ListForWorker(ctx context.Context, workerID string, filter repository.AssignmentFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.AssignmentWithShift], error) {
+	return ownedBy(r.rows, workerID, func(a model.AssignmentWithShift) string { return a.WorkerID }), nil
+}
+
+type meReportRepo struct {
+	repository.ShiftReportRepository
+	rows []model.ShiftReport
+}
+
+func (r *meReportRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReport], error) {
+	return ownedBy(r.rows, workerID, func(sr model.ShiftReport) string { return sr.WorkerID }), nil
+}
+
+type meAlarmRepo struct {
+	repository.AlarmRepository
+	rows []model.Alarm
+}
+
+func (r *meAlarmRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Alarm], error) {
+	return ownedBy(r.rows, workerID, func(a model.Alarm) string { return a.WorkerID }), nil
+}
+
+type meCheckInRepo struct {
+	repository.LocationCheckInRepository
+	rows []model.LocationCheckIn
+}
+
+func (r *meCheckInRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.LocationCheckIn], error) {
+	return ownedBy(r.rows, workerID, func(c model.LocationCheckIn) string { return c.WorkerID }), nil
+}
+
+// ownedBy pages the rows whose owner is workerID, as the repositories'
+// worker_id filter does.
+func ownedBy[T any](rows []T, workerID string, owner func(T) string) *pagination.Page[T] {
+	page := &pagination.Page[T]{Items: []T{}}
+	for _, row := range rows {
+		if owner(row) == workerID {
+			page.Items = append(page.Items, row)
+		}
+	}
+	return page
+}
+
+func TestMeHandler_ListsOnlyOwnRows(t *testing.T) {
+	certs := &meCertificateRepo{rows: []model.Certificate{{ID: "c1", WorkerID: "w1"}, {ID: "c2", WorkerID: "w2"}}}
+	memberships := &meMembershipRepo{rows: []model.WorkerCompany{
+		{WorkerID: "w1", CompanyID: "sentinel"},
+		{WorkerID: "w2", CompanyID: "guardian"},
+	}}
+	assignments := &meAssignmentRepo{rows: []model.AssignmentWithShift{
+		{ShiftAssignment: model.ShiftAssignment{ID: "a1", WorkerID: "w1"}},
+		{ShiftAssignment: model.ShiftAssignment{ID: "a2", WorkerID: "w2"}},
+	}}
+	reports := &meReportRepo{rows: []model.ShiftReport{{ID: "r1", WorkerID: "w1"}, {ID: "r2", WorkerID: "w2"}}}
+	alarms := &meAlarmRepo{rows: []model.Alarm{{ID: "al1", WorkerID: "w1"}, {ID: "al2", WorkerID: "w2"}}}
+	checkIns := &meCheckInRepo{rows: []model.LocationCheckIn{{ID: "l1", WorkerID: "w1"}, {ID: "l2", WorkerID: "w2"}}}
+
+	h := handler.NewMeHandler(
+		service.NewWorkerService(nil, certs, memberships, nil, nil),
+		service.NewShiftService(nil, assignments, nil, nil),
+		service.NewShiftReportService(nil, reports, nil),
+		service.NewAlarmService(alarms, nil),
+		service.NewLocationService(checkIns, nil),
+	)
+
+	for _, path := range []string{"/certificates", "/memberships", "/assignments", "/shift-reports", "/alarms", "/check-ins"} {
+		t.Run(path, func(t *testing.T) {
+			rr := getMe(h, path, &model.Worker{ID: "w1"})
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			var rows []struct {
+				WorkerID string `json:"workerId"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&rows); err != nil {
+				t.Fatalf("failed to decode list: %v", err)
+			}
+			if len(rows) != 1 || rows[0].WorkerID != "w1" {
+				t.Errorf("expected only w1's row, got %+v", rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+)
+
+// pageRequest reads the page of a list the query string asks for, writing
+// an error response if its cursor is malformed.
+func pageRequest(w http.ResponseWriter, r *http.Request) (pagination.Request, bool) {
+	p, err := pagination.FromQuery(r.URL.Query())
+	if err != nil {
+		ServiceError(w, r, err)
+		return p, false
+	}
+	return p, true
+}
+
+// listRequest reads the filters and sort order of a list with the given
+// schema, and the page asked for, writing an error response if any of them
+// is invalid.
+func listRequest(w http.ResponseWriter, r *http.Request, schema query.Schema) (query.Spec, pagination.Request, bool) {
+	spec, err := query.Parse(r.URL.Query(), schema)
+	if err != nil {
+		ServiceError(w, r, err)
+		return spec, pagination.Request{}, false
+	}
+	p, ok := pageRequest(w, r)
+	return spec, p, ok
+}
+
+// writePage writes a page of a list as a JSON array. The Link header points
+// at the first and next pages, and X-Total-Count carries the total when the
+// request asked for one.
+func writePage[T any](w http.ResponseWriter, r *http.Request, p pagination.Request, page *pagination.Page[T]) {
+	w.Header().Set("Link", pagination.Links(r.URL, p, page.Next))
+	if page.Total != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(*page.Total))
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	JSON(w, http.StatusOK, page.Items)
+}
@@ -0,0 +1,104 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// pagedCompanyRepo serves a fixed page and records the page it was asked
+// for.
+type pagedCompanyRepo struct {
+	inMemoryCompanyRepo
+	page *pagination.Page[model.Company]
+	got  pagination.Request
+}
+
+func (r *pagedCompanyRepo) List(ctx context.Context, companyIDs []string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Company], error) {
+	r.got = p
+	return r.page, nil
+}
+
+func listCompanies(t *testing.T, repo *pagedCompanyRepo, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	h := handler.NewCompanyHandler(service.NewCompanyService(repo, nil), newTestAccess().service())
+	router := chi.NewRouter()
+	router.Mount("/api/v1/companies", h.Routes())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, withAdminClaims(httptest.NewRequest(http.MethodGet, target, nil)))
+	return rr
+}
+
+func TestCompanyHandler_List_Page(t *testing.T) {
+	total := 3
+	repo := &pagedCompanyRepo{page: &pagination.Page[model.Company]{
+		Items: []model.Company{{ID: "c1", Name: "Alpha"}, {ID: "c2", Name: "Beta"}},
+		Next:  []string{"Beta", "c2"},
+		Total: &total,
+	}}
+	after := pagination.EncodeCursor([]string{"Aardvark", "c0"})
+
+	rr := listCompanies(t, repo, "/api/v1/companies/?limit=2&total=true&cursor="+after)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	want := pagination.Request{Limit: 2, After: []string{"Aardvark", "c0"}, Total: true}
+	if !reflect.DeepEqual(repo.got, want) {
+		t.Errorf("expected request %+v, got %+v", want, repo.got)
+	}
+
+	var companies []model.Company
+	json.NewDecoder(rr.Body).Decode(&companies)
+	if len(companies) != 2 {
+		t.Errorf("expected the body to be the page's 2 companies, got %d", len(companies))
+	}
+	if got := rr.Header().Get("X-Total-Count"); got != "3" {
+		t.Errorf("expected X-Total-Count 3, got %q", got)
+	}
+	next := `</api/v1/companies/?cursor=` + pagination.EncodeCursor([]string{"Beta", "c2"}) + `&limit=2&total=true>; rel="next"`
+	if link := rr.Header().Get("Link"); !strings.Contains(link, next) {
+		t.Errorf("expected Link to contain %s, got %s", next, link)
+	}
+}
+
+func TestCompanyHandler_List_PageNumber(t *testing.T) {
+	repo := &pagedCompanyRepo{page: &pagination.Page[model.Company]{}}
+
+	rr := listCompanies(t, repo, "/api/v1/companies/?page=3&per_page=10")
+	if rr.Code != http.StatusOK || rr.Body.String() != "[]\n" {
+		t.Fatalf("expected an empty list, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if want := (pagination.Request{Limit: 10, Offset: 20}); !reflect.DeepEqual(repo.got, want) {
+		t.Errorf("expected request %+v, got %+v", want, repo.got)
+	}
+	if rr.Header().Get("X-Total-Count") != "" {
+		t.Error("expected no X-Total-Count unless asked for")
+	}
+	if link := rr.Header().Get("Link"); strings.Contains(link, `rel="next"`) {
+		t.Errorf("expected no next link on the last page, got %s", link)
+	}
+}
+
+func TestCompanyHandler_List_InvalidCursor(t *testing.T) {
+	rr := listCompanies(t, &pagedCompanyRepo{}, "/api/v1/companies/?cursor=garbage!")
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	var problem handler.ErrorResponse
+	json.NewDecoder(rr.Body).Decode(&problem)
+	if problem.Type != handler.ProblemValidation || len(problem.Errors) != 1 || problem.Errors[0].Field != "cursor" {
+		t.Errorf("expected a validation problem for cursor, got %+v", problem)
+	}
+}
@@ -2,7 +2,27 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// Problem types identify each kind of error the API reports, so clients can
+// branch on the type rather than on the detail text.
+const (
+	ProblemValidation         = "urn:sitesecurity:problem:validation"
+	ProblemNotFound           = "urn:sitesecurity:problem:not-found"
+	ProblemConflict           = "urn:sitesecurity:problem:conflict"
+	ProblemInvalidTransition  = "urn:sitesecurity:problem:invalid-transition"
+	ProblemForbidden          = "urn:sitesecurity:problem:forbidden"
+	ProblemPreconditionFailed = "urn:sitesecurity:problem:precondition-failed"
+	ProblemInternal           = "urn:sitesecurity:problem:internal"
 )
 
 // JSON writes a JSON response with the given status code.
@@ -14,20 +34,70 @@ func JSON(w http.ResponseWriter, status int, data interface{}) {
 	}
 }
 
-// ErrorResponse represents an API error following RFC 7807.
+// ErrorResponse represents an API error following RFC 7807. Errors lists
+// the invalid fields of a validation problem.
 type ErrorResponse struct {
-	Type   string `json:"type"`
-	Title  string `json:"title"`
-	Status int    `json:"status"`
-	Detail string `json:"detail,omitempty"`
+	Type   string               `json:"type"`
+	Title  string               `json:"title"`
+	Status int                  `json:"status"`
+	Detail string               `json:"detail,omitempty"`
+	Errors []service.FieldError `json:"errors,omitempty"`
 }
 
-// Error writes an error response.
+// Error writes an error response for a problem with the request itself,
+// such as a malformed body, that has no more specific type.
 func Error(w http.ResponseWriter, status int, message string) {
-	JSON(w, status, ErrorResponse{
-		Type:   "about:blank",
+	problem(w, status, "about:blank", message, nil)
+}
+
+// ServiceError writes the problem for an error returned by the service
+// layer. Errors of no known type are logged and reported as a 500 without
+// their detail; the others are added to the request's log line.
+func ServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		invalid    *service.ValidationError
+		notFound   *service.NotFoundError
+		transition *service.InvalidTransitionError
+		conflict   *service.ConflictError
+		badQuery   *query.Error
+	)
+	logging.Add(r.Context(), logging.Error(err))
+	switch {
+	case errors.As(err, &invalid):
+		problem(w, http.StatusUnprocessableEntity, ProblemValidation, err.Error(), invalid.Fields)
+	case errors.Is(err, pagination.ErrInvalidCursor):
+		problem(w, http.StatusBadRequest, ProblemValidation, pagination.ErrInvalidCursor.Error(),
+			[]service.FieldError{{Field: "cursor", Message: "is not valid for this list"}})
+	case errors.As(err, &badQuery):
+		problem(w, http.StatusBadRequest, ProblemValidation, badQuery.Error(),
+			[]service.FieldError{{Field: badQuery.Param, Message: badQuery.Message}})
+	case errors.As(err, &notFound), errors.Is(err, service.ErrScopeNotFound):
+		problem(w, http.StatusNotFound, ProblemNotFound, err.Error(), nil)
+	case errors.As(err, &transition):
+		problem(w, http.StatusConflict, ProblemInvalidTransition, err.Error(), nil)
+	case errors.As(err, &conflict):
+		problem(w, http.StatusConflict, ProblemConflict, err.Error(), nil)
+	case errors.Is(err, service.ErrPreconditionFailed):
+		problem(w, http.StatusPreconditionFailed, ProblemPreconditionFailed, err.Error(), nil)
+	case err == service.ErrForbidden:
+		problem(w, http.StatusForbidden, ProblemForbidden, "you do not have access to this company's resources", nil)
+	case errors.Is(err, service.ErrForbidden):
+		problem(w, http.StatusForbidden, ProblemForbidden, err.Error(), nil)
+	default:
+		logging.FromContext(r.Context()).Error("internal error", logging.Error(err))
+		trace.SpanFromContext(r.Context()).RecordError(err)
+		problem(w, http.StatusInternalServerError, ProblemInternal, "an unexpected error occurred", nil)
+	}
+}
+
+func problem(w http.ResponseWriter, status int, typ, detail string, fields []service.FieldError) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Type:   typ,
 		Title:  http.StatusText(status),
 		Status: status,
-		Detail: message,
+		Detail: detail,
+		Errors: fields,
 	})
 }
@@ -0,0 +1,144 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+func TestServiceError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		typ    string
+	}{
+		{"validation", &service.ValidationError{Fields: []service.FieldError{{Field: "name", Message: "is required"}}},
+			http.StatusUnprocessableEntity, handler.ProblemValidation},
+		{"not found", &service.NotFoundError{Resource: "shift"}, http.StatusNotFound, handler.ProblemNotFound},
+		{"wrapped not found", fmt.Errorf("loading: %w", &service.NotFoundError{Resource: "shift"}),
+			http.StatusNotFound, handler.ProblemNotFound},
+		{"unknown scope", service.ErrScopeNotFound, http.StatusNotFound, handler.ProblemNotFound},
+		{"conflict", &service.ConflictError{Message: "membership already exists"}, http.StatusConflict, handler.ProblemConflict},
+		{"transition", &service.InvalidTransitionError{Resource: "alarm", From: "resolved", To: "acknowledged"},
+			http.StatusConflict, handler.ProblemInvalidTransition},
+		{"invalid cursor", fmt.Errorf("failed to list alarms: %w", pagination.ErrInvalidCursor),
+			http.StatusBadRequest, handler.ProblemValidation},
+		{"invalid query", &query.Error{Param: "sort", Message: "must be one of title"},
+			http.StatusBadRequest, handler.ProblemValidation},
+		{"forbidden", service.ErrForbidden, http.StatusForbidden, handler.ProblemForbidden},
+		{"database down", errors.New("failed to get company: dial tcp: connection refused"),
+			http.StatusInternalServerError, handler.ProblemInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServiceError(rr, httptest.NewRequest(http.MethodGet, "/", nil), tt.err)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("expected problem content type, got %q", ct)
+			}
+			var problem handler.ErrorResponse
+			json.NewDecoder(rr.Body).Decode(&problem)
+			if problem.Type != tt.typ || problem.Status != tt.status {
+				t.Errorf("expected type %s status %d, got %+v", tt.typ, tt.status, problem)
+			}
+		})
+	}
+}
+
+func TestServiceError_HidesInternalDetail(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handler.ServiceError(rr, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("pq: password authentication failed"))
+
+	if bytes.Contains(rr.Body.Bytes(), []byte("pq:")) {
+		t.Errorf("expected the internal error to be withheld, got %s", rr.Body.String())
+	}
+}
+
+func TestCompanyHandler_Create_FieldErrors(t *testing.T) {
+	svc := service.NewCompanyService(&inMemoryCompanyRepo{companies: make(map[string]model.Company)}, nil)
+	h := handler.NewCompanyHandler(svc, newTestAccess().service())
+
+	req := withAdminClaims(httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{}`)))
+	rr := httptest.NewRecorder()
+	router := chi.NewRouter()
+	router.Mount("/", h.Routes())
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	var problem handler.ErrorResponse
+	json.NewDecoder(rr.Body).Decode(&problem)
+	want := []service.FieldError{{Field: "name", Message: "is required"}}
+	if !reflect.DeepEqual(problem.Errors, want) {
+		t.Errorf("expected field errors %+v, got %+v", want, problem.Errors)
+	}
+}
+
+// failingCompanyRepo fails every lookup, as when the database is down.
+type failingCompanyRepo struct {
+	inMemoryCompanyRepo
+}
+
+func (r *failingCompanyRepo) GetByID(ctx context.Context, id string) (*model.Company, error) {
+	return nil, errors.New("failed to get company: connection refused")
+}
+
+// downScopes is a testAccess whose ownership lookups fail, as when the
+// database is down.
+type downScopes struct {
+	*testAccess
+}
+
+func (a downScopes) CompanyExists(ctx context.Context, companyID string) (bool, error) {
+	return false, errors.New("failed to check company: connection refused")
+}
+
+func TestCompanyHandler_GetByID_DatabaseDown(t *testing.T) {
+	admin := model.WorkerCompany{WorkerID: "admin-worker", CompanyID: "c1", Role: model.RoleCompanyAdmin, Status: model.MembershipActive}
+	access := newTestAccess(admin)
+	access.owners["w1"] = "c1"
+
+	tests := []struct {
+		name   string
+		access *service.AccessService
+		repo   *failingCompanyRepo
+	}{
+		{"access check", service.NewAccessService(downScopes{access}, access, nil), &failingCompanyRepo{}},
+		{"lookup", access.service(), &failingCompanyRepo{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handler.NewCompanyHandler(service.NewCompanyService(tt.repo, nil), tt.access)
+
+			req := withAdminClaims(httptest.NewRequest(http.MethodGet, "/c1", nil))
+			rr := httptest.NewRecorder()
+			router := chi.NewRouter()
+			router.Mount("/", h.Routes())
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusInternalServerError {
+				t.Errorf("expected status %d when the database is down, got %d", http.StatusInternalServerError, rr.Code)
+			}
+		})
+	}
+}
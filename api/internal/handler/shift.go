@@ -3,88 +3,93 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
 // ShiftHandler handles HTTP requests for shifts.
 type ShiftHandler struct {
-	service *service.ShiftService
+	service    *service.ShiftService
+	access     *service.AccessService
+	idempotent func(http.Handler) http.Handler
 }
 
-// NewShiftHandler creates a new ShiftHandler.
-func NewShiftHandler(s *service.ShiftService) *ShiftHandler {
-	return &ShiftHandler{service: s}
+// NewShiftHandler creates a new ShiftHandler. Assigning a worker is wrapped in
+// idempotent, which may be nil.
+func NewShiftHandler(s *service.ShiftService, access *service.AccessService, idempotent func(http.Handler) http.Handler) *ShiftHandler {
+	return &ShiftHandler{service: s, access: access, idempotent: orPassThrough(idempotent)}
 }
 
 // Routes returns the shift routes.
 func (h *ShiftHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	// Read-only: accessible to all authenticated users
+	// Read-only: accessible to members of the shift's company
 	r.Get("/", h.List)
 	r.Get("/{id}", h.GetByID)
 	r.Get("/{id}/assignments", h.ListAssignments)
 
-	// Worker-specific actions: accessible to all authenticated users
+	// Worker-specific actions: accessible to members of the shift's company
 	r.Patch("/{id}/assignments/{assignmentId}/accept", h.AcceptAssignment)
 	r.Patch("/{id}/assignments/{assignmentId}/decline", h.DeclineAssignment)
 
-	// Write operations: require company_admin or site_admin role
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.RequireRole("company_admin", "site_admin"))
-		r.Post("/", h.Create)
-		r.Put("/{id}", h.Update)
-		r.Patch("/{id}/status", h.UpdateStatus)
-		r.Delete("/{id}", h.Delete)
-		r.Post("/{id}/assignments", h.CreateAssignment)
-	})
+	// Write operations: require company_admin or site_admin membership
+	r.Post("/", h.Create)
+	r.Put("/{id}", h.Update)
+	r.Patch("/{id}/status", h.UpdateStatus)
+	r.Delete("/{id}", h.Delete)
+	r.With(h.idempotent).Post("/{id}/assignments", h.CreateAssignment)
 
 	return r
 }
 
+// List returns the shifts of ?company_id= or of the ?worksite_id= filter,
+// one of which is required.
 func (h *ShiftHandler) List(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
-	worksiteID := r.URL.Query().Get("worksite_id")
-	status := r.URL.Query().Get("status")
-
-	var shifts []model.Shift
-	var err error
-
-	if worksiteID != "" {
-		shifts, err = h.service.ListByWorksite(r.Context(), worksiteID, page, perPage)
-	} else if status != "" {
-		shifts, err = h.service.ListByStatus(r.Context(), model.ShiftStatus(status), page, perPage)
-	} else {
-		shifts, err = h.service.List(r.Context(), page, perPage)
+	spec, p, ok := listRequest(w, r, repository.ShiftQuery)
+	if !ok {
+		return
 	}
-
-	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+	companyID, worksiteIDs := r.URL.Query().Get("company_id"), spec.Equal("worksite_id")
+	if companyID == "" && len(worksiteIDs) == 0 {
+		Error(w, http.StatusBadRequest, "company_id or worksite_id query parameter is required")
 		return
 	}
+	if companyID != "" && !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: companyID}) {
+		return
+	}
+	for _, worksiteID := range worksiteIDs {
+		if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorksite, ID: worksiteID}) {
+			return
+		}
+	}
 
-	if shifts == nil {
-		shifts = []model.Shift{}
+	shifts, err := h.service.List(r.Context(), companyID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
 	}
-	JSON(w, http.StatusOK, shifts)
+	writePage(w, r, p, shifts)
 }
 
 func (h *ShiftHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: id}) {
+		return
+	}
 
 	shift, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, shift.Version)
 	JSON(w, http.StatusOK, shift)
 }
 
@@ -94,9 +99,12 @@ func (h *ShiftHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if !authorizeRef(w, r, h.access, service.Scope{Kind: service.ScopeWorksite, ID: shift.WorksiteID}, service.AdminRoles...) {
+		return
+	}
 
 	if err := h.service.Create(r.Context(), &shift); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -105,6 +113,9 @@ func (h *ShiftHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 func (h *ShiftHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: id}, service.AdminRoles...) {
+		return
+	}
 
 	var shift model.Shift
 	if err := json.NewDecoder(r.Body).Decode(&shift); err != nil {
@@ -112,17 +123,29 @@ func (h *ShiftHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	shift.ID = id
+	// Moving the shift needs admin rights at the destination too.
+	if !authorizeRef(w, r, h.access, service.Scope{Kind: service.ScopeWorksite, ID: shift.WorksiteID}, service.AdminRoles...) {
+		return
+	}
 
-	if err := h.service.Update(r.Context(), &shift); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	err := conditionally(r, func(version int) error {
+		shift.Version = version
+		return h.service.Update(r.Context(), &shift)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, shift.Version)
 	JSON(w, http.StatusOK, shift)
 }
 
 func (h *ShiftHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: id}, service.AdminRoles...) {
+		return
+	}
 
 	var body struct {
 		Status model.ShiftStatus `json:"status"`
@@ -132,8 +155,11 @@ func (h *ShiftHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.UpdateStatus(r.Context(), id, body.Status); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	err := conditionally(r, func(version int) error {
+		return h.service.UpdateStatus(r.Context(), id, body.Status, version)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -142,9 +168,15 @@ func (h *ShiftHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 
 func (h *ShiftHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: id}, service.AdminRoles...) {
+		return
+	}
 
-	if err := h.service.Delete(r.Context(), id); err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+	err := conditionally(r, func(version int) error {
+		return h.service.Delete(r.Context(), id, version)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -153,10 +185,13 @@ func (h *ShiftHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 func (h *ShiftHandler) ListAssignments(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: id}) {
+		return
+	}
 
 	assignments, err := h.service.ListAssignmentsByShift(r.Context(), id)
 	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -168,6 +203,9 @@ func (h *ShiftHandler) ListAssignments(w http.ResponseWriter, r *http.Request) {
 
 func (h *ShiftHandler) CreateAssignment(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: id}, service.AdminRoles...) {
+		return
+	}
 
 	var assignment model.ShiftAssignment
 	if err := json.NewDecoder(r.Body).Decode(&assignment); err != nil {
@@ -177,7 +215,7 @@ func (h *ShiftHandler) CreateAssignment(w http.ResponseWriter, r *http.Request)
 	assignment.ShiftID = id
 
 	if err := h.service.CreateAssignment(r.Context(), &assignment); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -185,23 +223,47 @@ func (h *ShiftHandler) CreateAssignment(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *ShiftHandler) AcceptAssignment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: id}) {
+		return
+	}
 	assignmentID := chi.URLParam(r, "assignmentId")
+	worker := middleware.GetWorker(r.Context())
 
-	if err := h.service.AcceptAssignment(r.Context(), assignmentID); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	var assignment *model.ShiftAssignment
+	err := conditionally(r, func(version int) error {
+		var err error
+		assignment, err = h.service.AcceptAssignment(r.Context(), id, assignmentID, worker.ID, version)
+		return err
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	setETag(w, assignment.Version)
+	JSON(w, http.StatusOK, assignment)
 }
 
 func (h *ShiftHandler) DeclineAssignment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: id}) {
+		return
+	}
 	assignmentID := chi.URLParam(r, "assignmentId")
+	worker := middleware.GetWorker(r.Context())
 
-	if err := h.service.DeclineAssignment(r.Context(), assignmentID); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	var assignment *model.ShiftAssignment
+	err := conditionally(r, func(version int) error {
+		var err error
+		assignment, err = h.service.DeclineAssignment(r.Context(), id, assignmentID, worker.ID, version)
+		return err
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	setETag(w, assignment.Version)
+	JSON(w, http.StatusOK, assignment)
 }
@@ -3,23 +3,25 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
 
-	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
 // ShiftReportHandler handles HTTP requests for shift reports and templates.
 type ShiftReportHandler struct {
-	service *service.ShiftReportService
+	service    *service.ShiftReportService
+	access     *service.AccessService
+	idempotent func(http.Handler) http.Handler
 }
 
-// NewShiftReportHandler creates a new ShiftReportHandler.
-func NewShiftReportHandler(s *service.ShiftReportService) *ShiftReportHandler {
-	return &ShiftReportHandler{service: s}
+// NewShiftReportHandler creates a new ShiftReportHandler. Submitting a report is
+// wrapped in idempotent, which may be nil.
+func NewShiftReportHandler(s *service.ShiftReportService, access *service.AccessService, idempotent func(http.Handler) http.Handler) *ShiftReportHandler {
+	return &ShiftReportHandler{service: s, access: access, idempotent: orPassThrough(idempotent)}
 }
 
 // Routes returns the shift report routes.
@@ -27,53 +29,60 @@ func (h *ShiftReportHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
 	r.Route("/templates", func(r chi.Router) {
-		// Read-only: accessible to all authenticated users
+		// Read-only: accessible to members of the template's company
 		r.Get("/", h.ListTemplates)
 		r.Get("/{id}", h.GetTemplateByID)
 
-		// Write operations: require company_admin or site_admin role
-		r.Group(func(r chi.Router) {
-			r.Use(middleware.RequireRole("company_admin", "site_admin"))
-			r.Post("/", h.CreateTemplate)
-			r.Put("/{id}", h.UpdateTemplate)
-			r.Delete("/{id}", h.DeleteTemplate)
-		})
+		// Write operations: require company_admin or site_admin membership
+		r.Post("/", h.CreateTemplate)
+		r.Put("/{id}", h.UpdateTemplate)
+		r.Delete("/{id}", h.DeleteTemplate)
 	})
 
-	// Reports: read accessible to all, create is a worker action
+	// Reports: read and create are open to members of the shift's company.
+	// Reports are submitted as the caller; admins can backfill for others.
 	r.Get("/", h.ListReports)
 	r.Get("/{id}", h.GetReportByID)
-	r.Post("/", h.CreateReport)
+	r.With(h.idempotent).Post("/", h.CreateReport)
 
 	return r
 }
 
 func (h *ShiftReportHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
 	companyID := r.URL.Query().Get("company_id")
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
-
-	templates, err := h.service.ListTemplates(r.Context(), companyID, page, perPage)
-	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+	if companyID == "" {
+		Error(w, http.StatusBadRequest, "company_id is required")
+		return
+	}
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: companyID}) {
+		return
+	}
+	spec, p, ok := listRequest(w, r, repository.ShiftReportTemplateQuery)
+	if !ok {
 		return
 	}
 
-	if templates == nil {
-		templates = []model.ShiftReportTemplate{}
+	templates, err := h.service.ListTemplates(r.Context(), companyID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
 	}
-	JSON(w, http.StatusOK, templates)
+	writePage(w, r, p, templates)
 }
 
 func (h *ShiftReportHandler) GetTemplateByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeReportTemplate, ID: id}) {
+		return
+	}
 
 	template, err := h.service.GetTemplateByID(r.Context(), id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, template.Version)
 	JSON(w, http.StatusOK, template)
 }
 
@@ -83,9 +92,12 @@ func (h *ShiftReportHandler) CreateTemplate(w http.ResponseWriter, r *http.Reque
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if !authorizeRef(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: template.CompanyID}, service.AdminRoles...) {
+		return
+	}
 
 	if err := h.service.CreateTemplate(r.Context(), &template); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -94,6 +106,9 @@ func (h *ShiftReportHandler) CreateTemplate(w http.ResponseWriter, r *http.Reque
 
 func (h *ShiftReportHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeReportTemplate, ID: id}, service.AdminRoles...) {
+		return
+	}
 
 	var template model.ShiftReportTemplate
 	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
@@ -102,19 +117,30 @@ func (h *ShiftReportHandler) UpdateTemplate(w http.ResponseWriter, r *http.Reque
 	}
 	template.ID = id
 
-	if err := h.service.UpdateTemplate(r.Context(), &template); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	err := conditionally(r, func(version int) error {
+		template.Version = version
+		return h.service.UpdateTemplate(r.Context(), &template)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, template.Version)
 	JSON(w, http.StatusOK, template)
 }
 
 func (h *ShiftReportHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeReportTemplate, ID: id}, service.AdminRoles...) {
+		return
+	}
 
-	if err := h.service.DeleteTemplate(r.Context(), id); err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+	err := conditionally(r, func(version int) error {
+		return h.service.DeleteTemplate(r.Context(), id, version)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 
@@ -122,43 +148,47 @@ func (h *ShiftReportHandler) DeleteTemplate(w http.ResponseWriter, r *http.Reque
 }
 
 func (h *ShiftReportHandler) ListReports(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
-	shiftID := r.URL.Query().Get("shift_id")
-	workerID := r.URL.Query().Get("worker_id")
-
-	var reports []model.ShiftReport
-	var err error
-
-	if shiftID != "" {
-		reports, err = h.service.ListReportsByShift(r.Context(), shiftID, page, perPage)
-	} else if workerID != "" {
-		reports, err = h.service.ListReportsByWorker(r.Context(), workerID, page, perPage)
-	} else {
+	spec, p, ok := listRequest(w, r, repository.ShiftReportQuery)
+	if !ok {
+		return
+	}
+	shiftIDs, workerIDs := spec.Equal("shift_id"), spec.Equal("worker_id")
+	if len(shiftIDs) == 0 && len(workerIDs) == 0 {
 		Error(w, http.StatusBadRequest, "shift_id or worker_id query parameter is required")
 		return
 	}
+	for _, shiftID := range shiftIDs {
+		if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: shiftID}) {
+			return
+		}
+	}
+	for _, workerID := range workerIDs {
+		if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorker, ID: workerID}) {
+			return
+		}
+	}
 
+	reports, err := h.service.ListReports(r.Context(), spec, p)
 	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
-
-	if reports == nil {
-		reports = []model.ShiftReport{}
-	}
-	JSON(w, http.StatusOK, reports)
+	writePage(w, r, p, reports)
 }
 
 func (h *ShiftReportHandler) GetReportByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeShiftReport, ID: id}) {
+		return
+	}
 
 	report, err := h.service.GetReportByID(r.Context(), id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, report.Version)
 	JSON(w, http.StatusOK, report)
 }
 
@@ -168,9 +198,17 @@ func (h *ShiftReportHandler) CreateReport(w http.ResponseWriter, r *http.Request
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if !authorizeRef(w, r, h.access, service.Scope{Kind: service.ScopeShift, ID: report.ShiftID}) {
+		return
+	}
+	workerID, ok := actingWorker(w, r, h.access, report.WorkerID)
+	if !ok {
+		return
+	}
+	report.WorkerID = workerID
 
 	if err := h.service.CreateReport(r.Context(), &report); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 
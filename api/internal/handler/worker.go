@@ -3,75 +3,86 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
 
-	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
 type WorkerHandler struct {
 	service *service.WorkerService
+	access  *service.AccessService
 }
 
-func NewWorkerHandler(s *service.WorkerService) *WorkerHandler {
-	return &WorkerHandler{service: s}
+func NewWorkerHandler(s *service.WorkerService, access *service.AccessService) *WorkerHandler {
+	return &WorkerHandler{service: s, access: access}
 }
 
 func (h *WorkerHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	// Read-only: accessible to all authenticated users
+	// Read-only: accessible to the worker and to members of their companies;
+	// the list requires membership of ?company_id=
 	r.Get("/", h.List)
 	r.Get("/{id}", h.GetByID)
 	r.Get("/{id}/certificates", h.ListCertificates)
 	r.Get("/{id}/certificates/{certId}", h.GetCertificate)
 	r.Get("/{id}/memberships", h.ListMemberships)
 
-	// Write operations: require company_admin role
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.RequireRole("company_admin"))
-		r.Post("/", h.Create)
-		r.Put("/{id}", h.Update)
-
-		// Certificates
-		r.Post("/{id}/certificates", h.CreateCertificate)
-		r.Put("/{id}/certificates/{certId}", h.UpdateCertificate)
-		r.Delete("/{id}/certificates/{certId}", h.DeleteCertificate)
-
-		// Memberships
-		r.Post("/{id}/memberships", h.AddMembership)
-		r.Put("/{id}/memberships/{companyId}", h.UpdateMembershipRole)
-		r.Delete("/{id}/memberships/{companyId}", h.RemoveMembership)
-	})
+	// Write operations: require company_admin membership of one of the
+	// worker's companies
+	r.Post("/", h.Create)
+	r.Put("/{id}", h.Update)
+
+	// Certificates
+	r.Post("/{id}/certificates", h.CreateCertificate)
+	r.Put("/{id}/certificates/{certId}", h.UpdateCertificate)
+	r.Delete("/{id}/certificates/{certId}", h.DeleteCertificate)
+
+	// Memberships: require company_admin membership of the company joined
+	r.Post("/{id}/memberships", h.AddMembership)
+	r.Put("/{id}/memberships/{companyId}", h.UpdateMembershipRole)
+	r.Delete("/{id}/memberships/{companyId}", h.RemoveMembership)
 
 	return r
 }
 
+// List returns the workers with a membership of ?company_id=.
 func (h *WorkerHandler) List(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	companyID := r.URL.Query().Get("company_id")
+	if companyID == "" {
+		Error(w, http.StatusBadRequest, "company_id is required")
+		return
+	}
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: companyID}) {
+		return
+	}
+	spec, p, ok := listRequest(w, r, repository.WorkerQuery)
+	if !ok {
+		return
+	}
 
-	workers, err := h.service.List(r.Context(), page, perPage)
+	workers, err := h.service.List(r.Context(), companyID, spec, p)
 	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
-	if workers == nil {
-		workers = []model.Worker{}
-	}
-	JSON(w, http.StatusOK, workers)
+	writePage(w, r, p, workers)
 }
 
 func (h *WorkerHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorker, ID: id}) {
+		return
+	}
 	worker, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
+	setETag(w, worker.Version)
 	JSON(w, http.StatusOK, worker)
 }
 
@@ -81,8 +92,12 @@ func (h *WorkerHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if err := h.access.AuthorizeAnyCompany(r.Context(), caller(r), model.RoleCompanyAdmin); err != nil {
+		ServiceError(w, r, err)
+		return
+	}
 	if err := h.service.Create(r.Context(), &worker); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 	JSON(w, http.StatusCreated, worker)
@@ -90,16 +105,24 @@ func (h *WorkerHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 func (h *WorkerHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorker, ID: id}, model.RoleCompanyAdmin) {
+		return
+	}
 	var worker model.Worker
 	if err := json.NewDecoder(r.Body).Decode(&worker); err != nil {
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 	worker.ID = id
-	if err := h.service.Update(r.Context(), &worker); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	err := conditionally(r, func(version int) error {
+		worker.Version = version
+		return h.service.Update(r.Context(), &worker)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
+	setETag(w, worker.Version)
 	JSON(w, http.StatusOK, worker)
 }
 
@@ -107,9 +130,12 @@ func (h *WorkerHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 func (h *WorkerHandler) ListCertificates(w http.ResponseWriter, r *http.Request) {
 	workerID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorker, ID: workerID}) {
+		return
+	}
 	certs, err := h.service.ListCertificates(r.Context(), workerID)
 	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 	if certs == nil {
@@ -119,17 +145,19 @@ func (h *WorkerHandler) ListCertificates(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *WorkerHandler) GetCertificate(w http.ResponseWriter, r *http.Request) {
-	certID := chi.URLParam(r, "certId")
-	cert, err := h.service.GetCertificate(r.Context(), certID)
-	if err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+	cert, ok := h.certificate(w, r)
+	if !ok {
 		return
 	}
+	setETag(w, cert.Version)
 	JSON(w, http.StatusOK, cert)
 }
 
 func (h *WorkerHandler) CreateCertificate(w http.ResponseWriter, r *http.Request) {
 	workerID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorker, ID: workerID}, model.RoleCompanyAdmin) {
+		return
+	}
 	var cert model.Certificate
 	if err := json.NewDecoder(r.Body).Decode(&cert); err != nil {
 		Error(w, http.StatusBadRequest, "invalid request body")
@@ -137,43 +165,81 @@ func (h *WorkerHandler) CreateCertificate(w http.ResponseWriter, r *http.Request
 	}
 	cert.WorkerID = workerID
 	if err := h.service.CreateCertificate(r.Context(), &cert); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 	JSON(w, http.StatusCreated, cert)
 }
 
 func (h *WorkerHandler) UpdateCertificate(w http.ResponseWriter, r *http.Request) {
-	certID := chi.URLParam(r, "certId")
+	existing, ok := h.certificate(w, r, model.RoleCompanyAdmin)
+	if !ok {
+		return
+	}
 	var cert model.Certificate
 	if err := json.NewDecoder(r.Body).Decode(&cert); err != nil {
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
-	cert.ID = certID
-	if err := h.service.UpdateCertificate(r.Context(), &cert); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	cert.ID = existing.ID
+	cert.WorkerID = existing.WorkerID
+	err := conditionally(r, func(version int) error {
+		cert.Version = version
+		return h.service.UpdateCertificate(r.Context(), &cert)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
+	setETag(w, cert.Version)
 	JSON(w, http.StatusOK, cert)
 }
 
 func (h *WorkerHandler) DeleteCertificate(w http.ResponseWriter, r *http.Request) {
-	certID := chi.URLParam(r, "certId")
-	if err := h.service.DeleteCertificate(r.Context(), certID); err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+	cert, ok := h.certificate(w, r, model.RoleCompanyAdmin)
+	if !ok {
+		return
+	}
+	err := conditionally(r, func(version int) error {
+		return h.service.DeleteCertificate(r.Context(), cert.ID, version)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// certificate authorises access to the worker in the URL and loads their
+// certificate, answering 404 for a certificate that belongs to someone
+// else.
+func (h *WorkerHandler) certificate(w http.ResponseWriter, r *http.Request, roles ...model.WorkerRole) (*model.Certificate, bool) {
+	workerID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorker, ID: workerID}, roles...) {
+		return nil, false
+	}
+	cert, err := h.service.GetCertificate(r.Context(), chi.URLParam(r, "certId"))
+	if err != nil {
+		ServiceError(w, r, err)
+		return nil, false
+	}
+	if cert.WorkerID != workerID {
+		ServiceError(w, r, &service.NotFoundError{Resource: "certificate"})
+		return nil, false
+	}
+	return cert, true
+}
+
 // Memberships
 
 func (h *WorkerHandler) ListMemberships(w http.ResponseWriter, r *http.Request) {
 	workerID := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorker, ID: workerID}) {
+		return
+	}
 	memberships, err := h.service.ListMemberships(r.Context(), workerID)
 	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 	if memberships == nil {
@@ -190,8 +256,11 @@ func (h *WorkerHandler) AddMembership(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	wc.WorkerID = workerID
+	if !authorizeRef(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: wc.CompanyID}, model.RoleCompanyAdmin) {
+		return
+	}
 	if err := h.service.AddMembership(r.Context(), &wc); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 	JSON(w, http.StatusCreated, wc)
@@ -200,6 +269,9 @@ func (h *WorkerHandler) AddMembership(w http.ResponseWriter, r *http.Request) {
 func (h *WorkerHandler) UpdateMembershipRole(w http.ResponseWriter, r *http.Request) {
 	workerID := chi.URLParam(r, "id")
 	companyID := chi.URLParam(r, "companyId")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: companyID}, model.RoleCompanyAdmin) {
+		return
+	}
 
 	var body struct {
 		Role model.WorkerRole `json:"role"`
@@ -208,18 +280,31 @@ func (h *WorkerHandler) UpdateMembershipRole(w http.ResponseWriter, r *http.Requ
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
-	if err := h.service.UpdateMembershipRole(r.Context(), workerID, companyID, body.Role); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	var membership *model.WorkerCompany
+	err := conditionally(r, func(version int) error {
+		var err error
+		membership, err = h.service.UpdateMembershipRole(r.Context(), workerID, companyID, body.Role, version)
+		return err
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
+	setETag(w, membership.Version)
+	JSON(w, http.StatusOK, membership)
 }
 
 func (h *WorkerHandler) RemoveMembership(w http.ResponseWriter, r *http.Request) {
 	workerID := chi.URLParam(r, "id")
 	companyID := chi.URLParam(r, "companyId")
-	if err := h.service.RemoveMembership(r.Context(), workerID, companyID); err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: companyID}, model.RoleCompanyAdmin) {
+		return
+	}
+	err := conditionally(r, func(version int) error {
+		return h.service.RemoveMembership(r.Context(), workerID, companyID, version)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -3,65 +3,71 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
 
-	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
 type WorksiteHandler struct {
 	service *service.WorksiteService
+	access  *service.AccessService
 }
 
-func NewWorksiteHandler(s *service.WorksiteService) *WorksiteHandler {
-	return &WorksiteHandler{service: s}
+func NewWorksiteHandler(s *service.WorksiteService, access *service.AccessService) *WorksiteHandler {
+	return &WorksiteHandler{service: s, access: access}
 }
 
 func (h *WorksiteHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 
-	// Read-only: accessible to all authenticated users
+	// Read-only: accessible to members of the worksite's company
 	r.Get("/", h.List)
 	r.Get("/{id}", h.GetByID)
 
-	// Write operations: require company_admin or site_admin role
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.RequireRole("company_admin", "site_admin"))
-		r.Post("/", h.Create)
-		r.Put("/{id}", h.Update)
-		r.Delete("/{id}", h.Delete)
-	})
+	// Write operations: require company_admin or site_admin membership
+	r.Post("/", h.Create)
+	r.Put("/{id}", h.Update)
+	r.Delete("/{id}", h.Delete)
 
 	return r
 }
 
 func (h *WorksiteHandler) List(w http.ResponseWriter, r *http.Request) {
 	companyID := r.URL.Query().Get("company_id")
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
-
-	worksites, err := h.service.List(r.Context(), companyID, page, perPage)
-	if err != nil {
-		Error(w, http.StatusBadRequest, err.Error())
+	if companyID == "" {
+		Error(w, http.StatusBadRequest, "company_id is required")
+		return
+	}
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: companyID}) {
+		return
+	}
+	spec, p, ok := listRequest(w, r, repository.WorksiteQuery)
+	if !ok {
 		return
 	}
 
-	if worksites == nil {
-		worksites = []model.Worksite{}
+	worksites, err := h.service.List(r.Context(), companyID, spec, p)
+	if err != nil {
+		ServiceError(w, r, err)
+		return
 	}
-	JSON(w, http.StatusOK, worksites)
+	writePage(w, r, p, worksites)
 }
 
 func (h *WorksiteHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorksite, ID: id}) {
+		return
+	}
 	worksite, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
+	setETag(w, worksite.Version)
 	JSON(w, http.StatusOK, worksite)
 }
 
@@ -71,8 +77,11 @@ func (h *WorksiteHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if !authorizeRef(w, r, h.access, service.Scope{Kind: service.ScopeCompany, ID: worksite.CompanyID}, service.AdminRoles...) {
+		return
+	}
 	if err := h.service.Create(r.Context(), &worksite); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+		ServiceError(w, r, err)
 		return
 	}
 	JSON(w, http.StatusCreated, worksite)
@@ -80,23 +89,37 @@ func (h *WorksiteHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 func (h *WorksiteHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorksite, ID: id}, service.AdminRoles...) {
+		return
+	}
 	var worksite model.Worksite
 	if err := json.NewDecoder(r.Body).Decode(&worksite); err != nil {
 		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 	worksite.ID = id
-	if err := h.service.Update(r.Context(), &worksite); err != nil {
-		Error(w, http.StatusUnprocessableEntity, err.Error())
+	err := conditionally(r, func(version int) error {
+		worksite.Version = version
+		return h.service.Update(r.Context(), &worksite)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
+	setETag(w, worksite.Version)
 	JSON(w, http.StatusOK, worksite)
 }
 
 func (h *WorksiteHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if err := h.service.Delete(r.Context(), id); err != nil {
-		Error(w, http.StatusNotFound, err.Error())
+	if !authorize(w, r, h.access, service.Scope{Kind: service.ScopeWorksite, ID: id}, service.AdminRoles...) {
+		return
+	}
+	err := conditionally(r, func(version int) error {
+		return h.service.Delete(r.Context(), id, version)
+	})
+	if err != nil {
+		ServiceError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,136 @@
+// Package logging builds the API's structured logger and carries it, with
+// the attributes of the request being served, through context.Context.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the value of a sensitive attribute.
+const Redacted = "[REDACTED]"
+
+// sensitive lists attribute keys whose values never reach the log: secrets
+// that grant access, and personal data such as phone numbers and where a
+// worker was. Keys match case-insensitively, and "token" also covers
+// "access_token", "id_token" and the like.
+var sensitive = []string{
+	"token", "authorization", "cookie", "password", "secret", "api_key",
+	"phone", "latitude", "longitude",
+}
+
+// New returns a logger writing JSON lines to w at level and above, with
+// sensitive attributes redacted.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}))
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if isSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	return slices.ContainsFunc(sensitive, func(s string) bool {
+		return key == s || strings.HasSuffix(key, "_"+s)
+	})
+}
+
+type loggerKey struct{}
+
+type scopeKey struct{}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger,
+// with the attributes added to the request so far.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+	if !ok {
+		logger = slog.Default()
+	}
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		return slog.New(&scopedHandler{Handler: logger.Handler(), scope: s})
+	}
+	return logger
+}
+
+// Begin returns a copy of ctx that collects attributes for one request.
+// Attributes added anywhere below it with Add appear on every line logged
+// through FromContext for the rest of the request, including by callers
+// that began it, so the line summing up a request can name the caller an
+// inner middleware authenticated.
+func Begin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scope{})
+}
+
+// Add adds attributes to the request begun in ctx. It does nothing outside
+// a request.
+func Add(ctx context.Context, attrs ...slog.Attr) {
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		s.add(attrs)
+	}
+}
+
+type scope struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+func (s *scope) add(attrs []slog.Attr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range attrs {
+		i := slices.IndexFunc(s.attrs, func(b slog.Attr) bool { return b.Key == a.Key })
+		if i >= 0 {
+			s.attrs[i] = a
+		} else {
+			s.attrs = append(s.attrs, a)
+		}
+	}
+}
+
+func (s *scope) list() []slog.Attr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.attrs)
+}
+
+// scopedHandler adds a request's attributes as each line is logged, so
+// attributes added after the logger was taken from the context still appear.
+type scopedHandler struct {
+	slog.Handler
+	scope *scope
+}
+
+func (h *scopedHandler) Handle(ctx context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.scope.list()...)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *scopedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &scopedHandler{Handler: h.Handler.WithAttrs(attrs), scope: h.scope}
+}
+
+func (h *scopedHandler) WithGroup(name string) slog.Handler {
+	return &scopedHandler{Handler: h.Handler.WithGroup(name), scope: h.scope}
+}
+
+// Error returns an attribute for err under the conventional "error" key.
+func Error(err error) slog.Attr {
+	return slog.Any("error", err)
+}
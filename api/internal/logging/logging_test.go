@@ -0,0 +1,73 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+)
+
+func decode(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	return line
+}
+
+func TestNew_RedactsSensitiveAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelInfo)
+
+	logger.Info("check-in",
+		slog.String("access_token", "eyJhbGciOi"),
+		slog.String("Authorization", "Bearer eyJhbGciOi"),
+		slog.String("phone", "+44 7700 900123"),
+		slog.Group("location", slog.Float64("latitude", 51.5), slog.Float64("longitude", -0.12)),
+		slog.String("worker_id", "w1"),
+		slog.String("token_type", "Bearer"),
+	)
+
+	line := decode(t, &buf)
+	for _, key := range []string{"access_token", "Authorization", "phone"} {
+		if line[key] != logging.Redacted {
+			t.Errorf("expected %s to be redacted, got %v", key, line[key])
+		}
+	}
+	location, _ := line["location"].(map[string]any)
+	if location["latitude"] != logging.Redacted || location["longitude"] != logging.Redacted {
+		t.Errorf("expected coordinates to be redacted, got %v", location)
+	}
+	if line["worker_id"] != "w1" || line["token_type"] != "Bearer" {
+		t.Errorf("expected other attributes to be kept, got %v", line)
+	}
+}
+
+func TestFromContext_AddsRequestAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logging.Begin(logging.NewContext(context.Background(), logging.New(&buf, slog.LevelInfo)))
+
+	// The logger is taken before the attribute is added, as by a
+	// middleware that logs once the rest of the request has run.
+	logger := logging.FromContext(ctx)
+	logging.Add(ctx, slog.String("subject", "user-1"))
+	logging.Add(ctx, slog.String("subject", "user-2"))
+	logger.Info("request served")
+
+	line := decode(t, &buf)
+	if line["subject"] != "user-2" {
+		t.Errorf("expected the latest subject, got %v", line["subject"])
+	}
+}
+
+func TestFromContext_DefaultsOutsideRequest(t *testing.T) {
+	if logging.FromContext(context.Background()) != slog.Default() {
+		t.Error("expected the default logger")
+	}
+	// Adding outside a request is a no-op rather than a panic.
+	logging.Add(context.Background(), slog.String("subject", "user-1"))
+}
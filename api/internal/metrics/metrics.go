@@ -0,0 +1,156 @@
+// Package metrics defines the API's Prometheus metrics and serves them for
+// scraping.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+)
+
+const namespace = "sitesecurity"
+
+var (
+	// HTTPRequests counts requests served, by route pattern, method and
+	// status.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests served, by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+
+	// HTTPDuration observes how long requests took to serve, by route
+	// pattern, method and status.
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by route pattern, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// AlarmsRaised counts alarms raised by workers.
+	AlarmsRaised = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alarms_raised_total",
+		Help:      "Alarms raised by workers.",
+	})
+
+	// CheckIns counts location check-ins recorded.
+	CheckIns = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "check_ins_total",
+		Help:      "Location check-ins recorded.",
+	})
+
+	// AuthFailures counts requests rejected for their credentials, by
+	// reason: missing, invalid_token, invalid_api_key or api_key_rejected.
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Requests rejected for missing or invalid credentials, by reason.",
+	}, []string{"reason"})
+
+	// RateLimited counts requests turned away by the rate limiter, by route
+	// group and the limit they hit: caller, ip or in_flight.
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused by the rate limiter, by route group and limit.",
+	}, []string{"group", "limit"})
+)
+
+// Stats reads the current state of the records the domain gauges report
+// across every company.
+type Stats interface {
+	CountOpenAlarms(ctx context.Context) (map[model.AlarmStatus]int, error)
+	CountShiftsInProgress(ctx context.Context) (int, error)
+}
+
+// NewRegistry returns a registry of the API's metrics: the HTTP and domain
+// counters above, gauges read from stats at each scrape, the database
+// connection pool of db, and the Go runtime and process.
+func NewRegistry(db *sql.DB, stats Stats) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, namespace),
+		HTTPRequests, HTTPDuration, AlarmsRaised, CheckIns, AuthFailures, RateLimited,
+		NewDomainCollector(stats),
+	)
+	return reg
+}
+
+// Handler serves the metrics of reg in the Prometheus exposition format. A
+// gauge that cannot be read is logged and left out rather than failing the
+// whole scrape.
+func Handler(reg *prometheus.Registry, logger *slog.Logger) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		ErrorLog:      slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// scrapeTimeout bounds the queries behind the domain gauges.
+const scrapeTimeout = 5 * time.Second
+
+var (
+	openAlarmsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "open_alarms"),
+		"Alarms not yet resolved, by status.",
+		[]string{"status"}, nil,
+	)
+	shiftsInProgressDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "shifts_in_progress"),
+		"Shifts currently in progress.",
+		nil, nil,
+	)
+)
+
+// DomainCollector reports gauges that describe the records themselves
+// rather than the API's activity, read from the database at each scrape so
+// every replica reports the same values.
+type DomainCollector struct {
+	stats Stats
+}
+
+// NewDomainCollector creates a DomainCollector reading from stats.
+func NewDomainCollector(stats Stats) *DomainCollector {
+	return &DomainCollector{stats: stats}
+}
+
+func (c *DomainCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- openAlarmsDesc
+	ch <- shiftsInProgressDesc
+}
+
+func (c *DomainCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	if counts, err := c.stats.CountOpenAlarms(ctx); err != nil {
+		ch <- prometheus.NewInvalidMetric(openAlarmsDesc, err)
+	} else {
+		// Both open statuses are always reported, so a quiet period reads
+		// as zero rather than as a missing series.
+		for _, status := range []model.AlarmStatus{model.AlarmRaised, model.AlarmAcknowledged} {
+			ch <- prometheus.MustNewConstMetric(openAlarmsDesc, prometheus.GaugeValue, float64(counts[status]), string(status))
+		}
+	}
+
+	if n, err := c.stats.CountShiftsInProgress(ctx); err != nil {
+		ch <- prometheus.NewInvalidMetric(shiftsInProgressDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(shiftsInProgressDesc, prometheus.GaugeValue, float64(n))
+	}
+}
@@ -0,0 +1,57 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/metrics"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+)
+
+type stubStats struct {
+	alarms map[model.AlarmStatus]int
+	shifts int
+	err    error
+}
+
+func (s stubStats) CountOpenAlarms(ctx context.Context) (map[model.AlarmStatus]int, error) {
+	return s.alarms, s.err
+}
+
+func (s stubStats) CountShiftsInProgress(ctx context.Context) (int, error) {
+	return s.shifts, s.err
+}
+
+func TestDomainCollector(t *testing.T) {
+	c := metrics.NewDomainCollector(stubStats{
+		alarms: map[model.AlarmStatus]int{model.AlarmRaised: 3},
+		shifts: 7,
+	})
+
+	want := `
+# HELP sitesecurity_open_alarms Alarms not yet resolved, by status.
+# TYPE sitesecurity_open_alarms gauge
+sitesecurity_open_alarms{status="acknowledged"} 0
+sitesecurity_open_alarms{status="raised"} 3
+# HELP sitesecurity_shifts_in_progress Shifts currently in progress.
+# TYPE sitesecurity_shifts_in_progress gauge
+sitesecurity_shifts_in_progress 7
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDomainCollector_DatabaseDown(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(metrics.NewDomainCollector(stubStats{err: errors.New("connection refused")}))
+
+	if _, err := reg.Gather(); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("expected the failed query to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// Actor returns middleware that records who is calling, and from where, in
+// the request context for the audit log. It must run after Auth, and
+// after RealIP for the client's address behind a proxy; Worker
+// adds the caller's worker ID once it is resolved. The caller's subject is
+// added to the request's log lines.
+func Actor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := GetClaims(r.Context())
+		if claims == nil {
+			http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		logging.Add(r.Context(), slog.String("subject", claims.Subject))
+		if claims.APIKeyID != "" {
+			logging.Add(r.Context(), slog.String("api_key_id", claims.APIKeyID))
+		}
+
+		ctx := service.WithActor(r.Context(), service.Actor{
+			Subject:   claims.Subject,
+			APIKeyID:  claims.APIKeyID,
+			IP:        GetClientIP(r),
+			RequestID: chimw.GetReqID(r.Context()),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,49 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+func TestActorMiddleware(t *testing.T) {
+	var got service.Actor
+	handler := chimw.RequestID(middleware.Actor(
+		middleware.Worker(&stubProvisioner{worker: &model.Worker{ID: "w1"}}, &mockProvider{})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = service.ActorFrom(r.Context())
+			}))))
+
+	req := withClaims(httptest.NewRequest(http.MethodPost, "/test", nil), &auth.Claims{
+		Subject:  "api-key:ssk_1234",
+		APIKeyID: "key-1",
+	})
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.Header.Set("X-Request-Id", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := service.Actor{WorkerID: "w1", Subject: "api-key:ssk_1234", APIKeyID: "key-1", IP: "203.0.113.7", RequestID: "req-1"}
+	if got != want {
+		t.Errorf("expected actor %+v, got %+v", want, got)
+	}
+}
+
+func TestActorMiddleware_NoClaims(t *testing.T) {
+	handler := middleware.Actor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
@@ -2,29 +2,65 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/metrics"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
 type contextKey string
 
 const ClaimsContextKey contextKey = "auth_claims"
 
-// Auth returns middleware that validates the Authorization header
-// and injects claims into the request context.
-func Auth(provider auth.Provider) func(http.Handler) http.Handler {
+// APIKeyAuthenticator resolves an API key to the claims of the service
+// account it acts as.
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (*auth.Claims, error)
+}
+
+// Auth returns middleware that validates the caller's credentials and
+// injects claims into the request context. A bearer JWT is checked by
+// provider; an API key, sent as an X-API-Key header or a bearer token, is
+// checked by keys. A nil keys rejects API keys.
+func Auth(provider auth.Provider, keys APIKeyAuthenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			token := extractBearerToken(r)
+			token := r.Header.Get("X-API-Key")
+			if token == "" {
+				token = extractBearerToken(r)
+			}
 			if token == "" {
+				metrics.AuthFailures.WithLabelValues("missing").Inc()
 				http.Error(w, `{"error": "missing or invalid authorization header"}`, http.StatusUnauthorized)
 				return
 			}
 
-			claims, err := provider.ValidateToken(r.Context(), token)
+			var claims *auth.Claims
+			var err error
+			reason := "invalid_token"
+			if strings.HasPrefix(token, service.APIKeyPrefix) {
+				reason = "invalid_api_key"
+				if keys == nil {
+					metrics.AuthFailures.WithLabelValues("api_key_rejected").Inc()
+					http.Error(w, `{"error": "api keys are not accepted"}`, http.StatusUnauthorized)
+					return
+				}
+				claims, err = keys.Authenticate(r.Context(), token)
+				if err != nil && !errors.Is(err, service.ErrInvalidAPIKey) {
+					logging.FromContext(r.Context()).Error("failed to authenticate api key", logging.Error(err))
+					http.Error(w, `{"error": "failed to check api key"}`, http.StatusInternalServerError)
+					return
+				}
+			} else {
+				claims, err = provider.ValidateToken(r.Context(), token)
+			}
 			if err != nil {
+				metrics.AuthFailures.WithLabelValues(reason).Inc()
+				logging.Add(r.Context(), logging.Error(err))
 				http.Error(w, `{"error": "invalid token"}`, http.StatusUnauthorized)
 				return
 			}
@@ -69,6 +105,38 @@ func RequireRole(roles ...string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireScope returns middleware that limits API keys to the routes of
+// resource their scopes allow: "<resource>:read" for GET and HEAD, and
+// "<resource>:write" otherwise. User tokens are not restricted.
+func RequireScope(resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetClaims(r.Context())
+			if claims == nil {
+				http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+			if claims.APIKeyID == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scope := resource + ":write"
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = resource + ":read"
+			}
+			for _, granted := range claims.Scopes {
+				if granted == scope {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			http.Error(w, `{"error": "api key lacks the `+scope+` scope"}`, http.StatusForbidden)
+		})
+	}
+}
+
 func extractBearerToken(r *http.Request) string {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
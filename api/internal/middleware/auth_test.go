@@ -4,10 +4,16 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
 	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/metrics"
 	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
 // mockProvider is a test double for auth.Provider.
@@ -23,17 +29,29 @@ func (m *mockProvider) GetUserInfo(ctx context.Context, token string) (*auth.Use
 	return nil, nil
 }
 
-func (m *mockProvider) GetLoginURL(state string) string {
+func (m *mockProvider) GetLoginURL(req auth.LoginRequest) string {
 	return ""
 }
 
-func (m *mockProvider) ExchangeCode(ctx context.Context, code string) (*auth.TokenSet, error) {
+func (m *mockProvider) ExchangeCode(ctx context.Context, req auth.CodeExchange) (*auth.TokenSet, error) {
 	return nil, nil
 }
 
+func (m *mockProvider) RefreshToken(ctx context.Context, refreshToken string) (*auth.TokenSet, error) {
+	return nil, nil
+}
+
+func (m *mockProvider) Logout(ctx context.Context, req auth.LogoutRequest) (string, error) {
+	return "", nil
+}
+
+func (m *mockProvider) RevokeToken(ctx context.Context, token, tokenTypeHint string) error {
+	return nil
+}
+
 func TestAuthMiddleware_MissingHeader(t *testing.T) {
 	provider := &mockProvider{}
-	mw := middleware.Auth(provider)
+	mw := middleware.Auth(provider, nil)
 
 	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t.Error("handler should not be called")
@@ -55,12 +73,15 @@ func TestAuthMiddleware_InvalidToken(t *testing.T) {
 			return nil, auth.ErrInvalidToken
 		},
 	}
-	mw := middleware.Auth(provider)
+	mw := middleware.Auth(provider, nil)
 
 	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t.Error("handler should not be called")
 	}))
 
+	failures := metrics.AuthFailures.WithLabelValues("invalid_token")
+	before := testutil.ToFloat64(failures)
+
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
 	req.Header.Set("Authorization", "Bearer invalid-token")
 	rr := httptest.NewRecorder()
@@ -70,6 +91,9 @@ func TestAuthMiddleware_InvalidToken(t *testing.T) {
 	if rr.Code != http.StatusUnauthorized {
 		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
 	}
+	if got := testutil.ToFloat64(failures) - before; got != 1 {
+		t.Errorf("expected the failure to be counted once, got %v", got)
+	}
 }
 
 func TestAuthMiddleware_ValidToken(t *testing.T) {
@@ -85,7 +109,7 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 			return claims, nil
 		},
 	}
-	mw := middleware.Auth(provider)
+	mw := middleware.Auth(provider, nil)
 
 	called := false
 	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -139,6 +163,72 @@ func TestRequireRole_HasRole(t *testing.T) {
 	}
 }
 
+func TestRequireRole_MappedClientRoleAndGroup(t *testing.T) {
+	mapper, err := auth.NewClaimMapper([]config.ClaimMapping{
+		{Claim: "resource_access.{clientId}.roles", Match: "site_admin"},
+		{Claim: "groups", Match: "/companies/([^/]+)/admins", Company: "$1", Role: "company_admin"},
+	}, "sitesecurity-api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	provider := &mockProvider{
+		validateFunc: func(ctx context.Context, token string) (*auth.Claims, error) {
+			claims := &auth.Claims{Subject: "user-123"}
+			mapper.Apply(ctx, map[string]interface{}{
+				"resource_access": map[string]interface{}{
+					"sitesecurity-api": map[string]interface{}{"roles": []interface{}{"site_admin"}},
+				},
+				"groups": []interface{}{"/companies/6f1c2a9e-3b4d-4e5f-8a7b-9c0d1e2f3a4b/admins"},
+			}, claims)
+			return claims, nil
+		},
+	}
+
+	called := false
+	handler := middleware.Auth(provider, nil)(middleware.RequireRole("site_admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		claims := middleware.GetClaims(r.Context())
+		want := []auth.CompanyRole{{CompanyID: "6f1c2a9e-3b4d-4e5f-8a7b-9c0d1e2f3a4b", Role: "company_admin"}}
+		if !reflect.DeepEqual(claims.CompanyRoles, want) {
+			t.Errorf("expected company roles %v, got %v", want, claims.CompanyRoles)
+		}
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer valid-token")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if !called {
+		t.Errorf("handler was not called, got status %d", rr.Code)
+	}
+}
+
+// A group naming its company by slug cannot scope a tenant session, so
+// the grant is dropped rather than failing every query the caller makes.
+func TestClaimMapper_DropsNonUUIDCompany(t *testing.T) {
+	mapper, err := auth.NewClaimMapper([]config.ClaimMapping{
+		{Claim: "groups", Match: "/companies/([^/]+)/admins", Company: "$1", Role: "company_admin"},
+	}, "sitesecurity-api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims := &auth.Claims{Subject: "user-123"}
+	mapper.Apply(context.Background(), map[string]interface{}{
+		"groups": []interface{}{
+			"/companies/sentinel/admins",
+			"/companies/6f1c2a9e-3b4d-4e5f-8a7b-9c0d1e2f3a4b/admins",
+		},
+	}, claims)
+
+	want := []auth.CompanyRole{{CompanyID: "6f1c2a9e-3b4d-4e5f-8a7b-9c0d1e2f3a4b", Role: "company_admin"}}
+	if !reflect.DeepEqual(claims.CompanyRoles, want) {
+		t.Errorf("expected company roles %v, got %v", want, claims.CompanyRoles)
+	}
+}
+
 func TestRequireRole_MissingRole(t *testing.T) {
 	claims := &auth.Claims{
 		Subject: "user-123",
@@ -179,3 +269,97 @@ func TestRequireRole_NoClaims(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
 	}
 }
+
+// mockKeys is a test double for middleware.APIKeyAuthenticator accepting a
+// single key.
+type mockKeys struct {
+	key    string
+	claims *auth.Claims
+}
+
+func (m *mockKeys) Authenticate(ctx context.Context, key string) (*auth.Claims, error) {
+	if key != m.key {
+		return nil, service.ErrInvalidAPIKey
+	}
+	return m.claims, nil
+}
+
+func TestAuthMiddleware_APIKey(t *testing.T) {
+	provider := &mockProvider{
+		validateFunc: func(ctx context.Context, token string) (*auth.Claims, error) {
+			t.Error("api keys should not reach the token provider")
+			return nil, auth.ErrInvalidToken
+		},
+	}
+	keys := &mockKeys{
+		key:    "ssk_panel",
+		claims: &auth.Claims{Subject: "api-key:ssk_pane", APIKeyID: "key-1", Scopes: []string{"alarms:write"}},
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"X-API-Key header", "X-API-Key", "ssk_panel", http.StatusOK},
+		{"bearer API key", "Authorization", "Bearer ssk_panel", http.StatusOK},
+		{"unknown key", "X-API-Key", "ssk_other", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := middleware.Auth(provider, keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if claims := middleware.GetClaims(r.Context()); claims == nil || claims.APIKeyID != "key-1" {
+					t.Errorf("expected api key claims in context, got %+v", claims)
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/test", nil)
+			req.Header.Set(tt.header, tt.value)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	key := &auth.Claims{Subject: "api-key:ssk_pane", APIKeyID: "key-1", Scopes: []string{"alarms:write", "reports:read"}}
+	user := &auth.Claims{Subject: "user-123"}
+
+	tests := []struct {
+		name       string
+		claims     *auth.Claims
+		resource   string
+		method     string
+		wantStatus int
+	}{
+		{"key with write scope", key, "alarms", http.MethodPost, http.StatusOK},
+		{"key without read scope", key, "alarms", http.MethodGet, http.StatusForbidden},
+		{"key with read scope", key, "reports", http.MethodGet, http.StatusOK},
+		{"key without write scope", key, "reports", http.MethodPut, http.StatusForbidden},
+		{"key on unscoped resource", key, "api-keys", http.MethodPost, http.StatusForbidden},
+		{"user token", user, "api-keys", http.MethodPost, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := middleware.RequireScope(tt.resource)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(tt.method, "/test", nil)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.ClaimsContextKey, tt.claims))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -24,7 +24,8 @@ func CORS(allowedOrigins string) func(http.Handler) http.Handler {
 			}
 
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, X-Request-ID, Idempotency-Key")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Link, X-Total-Count, X-Request-ID, Idempotent-Replayed")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 			w.Header().Set("Access-Control-Max-Age", "86400")
 
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+const (
+	// IdempotencyKeyHeader names the header a client sends to make a POST
+	// safe to retry.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response replayed for a retry.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBody bounds the request bodies read to fingerprint them.
+	maxIdempotentBody = 1 << 20
+)
+
+// replayedHeaders are the response headers kept for replay.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// IdempotencyStore keeps the requests sent with an Idempotency-Key.
+type IdempotencyStore interface {
+	Claim(ctx context.Context, k repository.IdempotencyKey) (*repository.IdempotencyKey, error)
+	Complete(ctx context.Context, k repository.IdempotencyKey) error
+}
+
+// Idempotency returns middleware that makes a request sent with an
+// Idempotency-Key header happen at most once per key and caller. The first
+// successful response is kept for ttl and replayed to retries; a retry
+// while the first request is still running gets a 409, and the key reused
+// for a different request a 422. It must run inside Tenant: the key is
+// claimed and the response saved in its session, so a failed request,
+// which Tenant rolls back, keeps nothing and can be retried. Requests
+// without the header are served as they are.
+func Idempotency(store IdempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validIdempotencyKey(key) {
+				http.Error(w, `{"error": "invalid idempotency key"}`, http.StatusBadRequest)
+				return
+			}
+			claims, worker := GetClaims(r.Context()), GetWorker(r.Context())
+			if claims == nil || worker == nil {
+				http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, `{"error": "request body too large"}`, http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, `{"error": "failed to read request body"}`, http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			logger := logging.FromContext(r.Context())
+			claim := repository.IdempotencyKey{
+				Subject:     claims.Subject,
+				Key:         key,
+				WorkerID:    worker.ID,
+				RequestHash: requestHash(r, body),
+				ExpiresAt:   time.Now().Add(ttl),
+			}
+			existing, err := store.Claim(r.Context(), claim)
+			if err != nil {
+				logger.Error("failed to claim idempotency key", logging.Error(err))
+				http.Error(w, `{"error": "failed to start request"}`, http.StatusInternalServerError)
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.StatusCode == 0:
+					http.Error(w, `{"error": "a request with this idempotency key is in progress"}`, http.StatusConflict)
+				case existing.RequestHash != claim.RequestHash:
+					http.Error(w, `{"error": "idempotency key was used for a different request"}`, http.StatusUnprocessableEntity)
+				default:
+					logging.Add(r.Context(), slog.Bool("idempotent_replay", true))
+					for name, value := range existing.Headers {
+						w.Header().Set(name, value)
+					}
+					w.Header().Set(IdempotentReplayedHeader, "true")
+					w.WriteHeader(existing.StatusCode)
+					w.Write(existing.Body)
+				}
+				return
+			}
+
+			captured := &bufferedResponse{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(captured, r)
+
+			if captured.statusCode < http.StatusBadRequest {
+				claim.StatusCode = captured.statusCode
+				claim.Body = captured.body.Bytes()
+				claim.Headers = make(map[string]string)
+				for _, name := range replayedHeaders {
+					if value := w.Header().Get(name); value != "" {
+						claim.Headers[name] = value
+					}
+				}
+				if err := store.Complete(r.Context(), claim); err != nil {
+					// Failing the request rolls its changes back with the
+					// response that was not saved.
+					logger.Error("failed to save idempotent response", logging.Error(err))
+					w.Header().Del("Location")
+					w.Header().Del("ETag")
+					http.Error(w, `{"error": "failed to save changes"}`, http.StatusInternalServerError)
+					return
+				}
+			}
+			captured.flush()
+		})
+	}
+}
+
+// validIdempotencyKey accepts keys of printable ASCII, such as UUIDs.
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHash fingerprints a request by its method, path and body, so a
+// key can only be replayed for the request it was first sent with.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
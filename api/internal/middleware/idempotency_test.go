@@ -0,0 +1,226 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+// memoryIdempotencyStore keeps keys the way the repository does, without
+// expiry: a claim is undone when the request's session, started by
+// session, rolls back.
+type memoryIdempotencyStore struct {
+	mu          sync.Mutex
+	keys        map[string]repository.IdempotencyKey
+	completeErr error
+}
+
+type sessionClaimsKey struct{}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{keys: make(map[string]repository.IdempotencyKey)}
+}
+
+func (s *memoryIdempotencyStore) Claim(ctx context.Context, k repository.IdempotencyKey) (*repository.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.keys[k.Subject+"|"+k.Key]; ok {
+		return &existing, nil
+	}
+	s.keys[k.Subject+"|"+k.Key] = k
+	if claimed, ok := ctx.Value(sessionClaimsKey{}).(*[]string); ok {
+		*claimed = append(*claimed, k.Subject+"|"+k.Key)
+	}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, k repository.IdempotencyKey) error {
+	if s.completeErr != nil {
+		return s.completeErr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.Subject+"|"+k.Key] = k
+	return nil
+}
+
+// session serves h as Tenant would, rolling back the keys claimed for a
+// request that fails.
+func (s *memoryIdempotencyStore) session(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var claimed []string
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r.WithContext(context.WithValue(r.Context(), sessionClaimsKey{}, &claimed)))
+		if rr.Code >= http.StatusBadRequest {
+			s.mu.Lock()
+			for _, k := range claimed {
+				delete(s.keys, k)
+			}
+			s.mu.Unlock()
+		}
+		for name, values := range rr.Header() {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(rr.Code)
+		w.Write(rr.Body.Bytes())
+	})
+}
+
+func idempotentRequest(subject, key, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/alarms/", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(middleware.IdempotencyKeyHeader, key)
+	}
+	ctx := context.WithValue(r.Context(), middleware.ClaimsContextKey, &auth.Claims{Subject: subject})
+	ctx = context.WithValue(ctx, middleware.WorkerContextKey, &model.Worker{ID: "worker-" + subject})
+	return r.WithContext(ctx)
+}
+
+// countingHandler creates an alarm per request it serves, answering with
+// status.
+func countingHandler(status int) (http.Handler, *int) {
+	calls := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/v1/alarms/a1")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"id":"a1"}`))
+	}), &calls
+}
+
+func TestIdempotency_ReplaysResponse(t *testing.T) {
+	next, calls := countingHandler(http.StatusCreated)
+	h := middleware.Idempotency(newMemoryIdempotencyStore(), time.Hour)(next)
+
+	first := httptest.NewRecorder()
+	h.ServeHTTP(first, idempotentRequest("guard", "k1", `{"type":"panic"}`))
+	retry := httptest.NewRecorder()
+	h.ServeHTTP(retry, idempotentRequest("guard", "k1", `{"type":"panic"}`))
+
+	if *calls != 1 {
+		t.Fatalf("expected the alarm to be raised once, got %d", *calls)
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the first response replayed, got %d %s", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Location") != "/api/v1/alarms/a1" || retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected the replay to carry the stored headers, got %v", retry.Header())
+	}
+	if first.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Error("expected the first response not to be marked as replayed")
+	}
+
+	// Keys belong to their caller.
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("other", "k1", `{"type":"panic"}`))
+	if *calls != 2 {
+		t.Errorf("expected another caller's key to raise an alarm, got %d calls", *calls)
+	}
+}
+
+func TestIdempotency_DifferentPayload(t *testing.T) {
+	next, calls := countingHandler(http.StatusCreated)
+	h := middleware.Idempotency(newMemoryIdempotencyStore(), time.Hour)(next)
+
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("guard", "k1", `{"type":"panic"}`))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, idempotentRequest("guard", "k1", `{"type":"medical"}`))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	if *calls != 1 {
+		t.Errorf("expected one alarm, got %d", *calls)
+	}
+}
+
+func TestIdempotency_ConcurrentDuplicate(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	entered, done := make(chan struct{}), make(chan struct{})
+	h := middleware.Idempotency(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-done
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	finished := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("guard", "k1", `{}`))
+		close(finished)
+	}()
+	<-entered
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, idempotentRequest("guard", "k1", `{}`))
+	close(done)
+	<-finished
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, rr.Code)
+	}
+}
+
+func TestIdempotency_FailureReleasesKey(t *testing.T) {
+	next, calls := countingHandler(http.StatusBadRequest)
+	store := newMemoryIdempotencyStore()
+	h := store.session(middleware.Idempotency(store, time.Hour)(next))
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, idempotentRequest("guard", "k1", `{}`))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	}
+	if *calls != 2 {
+		t.Errorf("expected a failed request to be retried, got %d calls", *calls)
+	}
+}
+
+func TestIdempotency_SaveFailureFailsRequest(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	store.completeErr = errors.New("connection reset")
+	next, _ := countingHandler(http.StatusCreated)
+	h := store.session(middleware.Idempotency(store, time.Hour)(next))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, idempotentRequest("guard", "k1", `{}`))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if rr.Header().Get("Location") != "" {
+		t.Error("expected the unsaved record's location to be dropped")
+	}
+	if len(store.keys) != 0 {
+		t.Errorf("expected the claim to be rolled back, got %v", store.keys)
+	}
+}
+
+func TestIdempotency_WithoutKey(t *testing.T) {
+	next, calls := countingHandler(http.StatusCreated)
+	h := middleware.Idempotency(newMemoryIdempotencyStore(), time.Hour)(next)
+
+	for i := 0; i < 2; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("guard", "", `{}`))
+	}
+	if *calls != 2 {
+		t.Errorf("expected requests without a key to be served each time, got %d calls", *calls)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, idempotentRequest("guard", "bad\x01key", `{}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid key to be rejected, got %d", rr.Code)
+	}
+}
@@ -1,9 +1,14 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
 )
 
 type responseWriter struct {
@@ -16,14 +21,50 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// Logging returns middleware that logs HTTP requests.
-func Logging(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+// Logging returns middleware that carries logger in the request context,
+// tagged with the request ID and method, and logs one line for each
+// request once it is served. The route is logged as its pattern, such as
+// /api/v1/shifts/{id}, rather than the path, and the caller and company
+// appear once Actor and authorization have named them. Server errors are
+// logged at error level and client errors at warning level. It must run
+// after RequestID.
+func Logging(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+			ctx := logging.Begin(logging.NewContext(r.Context(), logger.With(
+				slog.String("request_id", chimw.GetReqID(r.Context())),
+				slog.String("method", r.Method),
+			)))
+			if rctx := chi.RouteContext(ctx); rctx != nil {
+				logging.Add(ctx, slog.Any("route", routePattern{rctx}))
+			}
+
+			next.ServeHTTP(wrapped, r.WithContext(ctx))
 
-		next.ServeHTTP(wrapped, r)
+			level := slog.LevelInfo
+			switch {
+			case wrapped.statusCode >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case wrapped.statusCode >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			}
+			logging.FromContext(ctx).LogAttrs(ctx, level, "request served",
+				slog.Int("status", wrapped.statusCode),
+				slog.Duration("duration", time.Since(start)),
+			)
+		})
+	}
+}
+
+// routePattern resolves to the pattern of the route chi matched, which is
+// only complete once routing has finished.
+type routePattern struct {
+	rctx *chi.Context
+}
 
-		log.Printf("%s %s %d %s", r.Method, r.URL.Path, wrapped.statusCode, time.Since(start))
-	})
+func (p routePattern) LogValue() slog.Value {
+	return slog.StringValue(p.rctx.RoutePattern())
 }
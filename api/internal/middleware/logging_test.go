@@ -0,0 +1,94 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"honoured", "lb-7f3a9c", true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("a", 200), false},
+		{"unprintable", "id\nforged: line", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = chimw.GetReqID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.header != "" {
+				req.Header.Set(middleware.RequestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			got := rr.Header().Get(middleware.RequestIDHeader)
+			if got == "" || got != seen {
+				t.Fatalf("expected the response to echo the request's ID %q, got %q", seen, got)
+			}
+			if (got == tt.header) != tt.keep {
+				t.Errorf("expected keep=%v for %q, got ID %q", tt.keep, tt.header, got)
+			}
+		})
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.Logging(logging.New(&buf, slog.LevelInfo)))
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Actor)
+		r.Get("/shifts/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+	})
+
+	req := withClaims(httptest.NewRequest(http.MethodGet, "/shifts/5b0c2f7e-1d2a-4f7b-9c55-3e1d8a6b9f10", nil),
+		&auth.Claims{Subject: "user-1"})
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"level":      "WARN",
+		"msg":        "request served",
+		"request_id": "req-1",
+		"method":     http.MethodGet,
+		"route":      "/shifts/{id}",
+		"subject":    "user-1",
+		"status":     float64(http.StatusNotFound),
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("expected %s %v, got %v", key, value, line[key])
+		}
+	}
+	if strings.Contains(buf.String(), "5b0c2f7e") {
+		t.Errorf("expected the raw path to be left out, got %s", buf.String())
+	}
+}
@@ -0,0 +1,38 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/metrics"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+)
+
+func TestMetrics(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(middleware.Metrics)
+	r.Route("/metrics-test", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	requests := metrics.HTTPRequests.WithLabelValues("/metrics-test/{id}", http.MethodGet, "204")
+	unmatched := metrics.HTTPRequests.WithLabelValues("unmatched", http.MethodGet, "404")
+	before, beforeUnmatched := testutil.ToFloat64(requests), testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/metrics-test/a1", "/metrics-test/b2", "/nowhere/c3"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(requests) - before; got != 2 {
+		t.Errorf("expected 2 requests under the route pattern, got %v", got)
+	}
+	if got := testutil.ToFloat64(unmatched) - beforeUnmatched; got != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", got)
+	}
+}
@@ -0,0 +1,213 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/metrics"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/ratelimit"
+)
+
+func limitedRequest(method, path, subject string) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+	if subject == "" {
+		return r
+	}
+	claims := &auth.Claims{Subject: subject}
+	return r.WithContext(context.WithValue(r.Context(), middleware.ClaimsContextKey, claims))
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), config.RateLimitConfig{
+		CheckIns: config.Limit{Requests: 1, Period: time.Hour},
+		Alarms:   config.Limit{Requests: 1, Period: time.Hour},
+	})
+	h := middleware.RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	limited := metrics.RateLimited.WithLabelValues("check-ins", "caller")
+	before := testutil.ToFloat64(limited)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, limitedRequest(http.MethodPost, "/api/v1/check-ins/", "worker-1"))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected the first check-in to be served, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, limitedRequest(http.MethodPost, "/api/v1/check-ins/", "worker-1"))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("expected Retry-After 3600, got %q", got)
+	}
+	if got := testutil.ToFloat64(limited) - before; got != 1 {
+		t.Errorf("expected 1 rate limited request counted, got %v", got)
+	}
+
+	// The same caller can still raise an alarm, and another caller check in.
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, limitedRequest(http.MethodPost, "/api/v1/alarms/", "worker-1"))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected the alarm to be served, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, limitedRequest(http.MethodPost, "/api/v1/check-ins/", "worker-2"))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected another caller's check-in to be served, got %d", rr.Code)
+	}
+}
+
+func TestRateLimit_AnonymousByIP(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), config.RateLimitConfig{
+		Auth: config.Limit{Requests: 1, Period: time.Minute},
+	})
+	h := middleware.RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(ip string) int {
+		r := limitedRequest(http.MethodGet, "/api/v1/auth/login", "")
+		r.RemoteAddr = ip + ":4321"
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr.Code
+	}
+	if code := serve("10.0.0.1"); code != http.StatusOK {
+		t.Fatalf("expected the first login to be served, got %d", code)
+	}
+	if code := serve("10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the address to be limited, got %d", code)
+	}
+	if code := serve("10.0.0.2"); code != http.StatusOK {
+		t.Errorf("expected another address to be served, got %d", code)
+	}
+}
+
+func TestRateLimit_ForwardedFor(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), config.RateLimitConfig{
+		Auth: config.Limit{Requests: 1, Period: time.Minute},
+	})
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	h := middleware.RealIP(trusted)(middleware.RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	serve := func(peer, forwardedFor string) int {
+		r := limitedRequest(http.MethodGet, "/api/v1/auth/login", "")
+		r.RemoteAddr = peer + ":4321"
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	// A client sending its own header shares its address's bucket, whatever
+	// the header says.
+	if code := serve("203.0.113.7", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("expected the first login to be served, got %d", code)
+	}
+	if code := serve("203.0.113.7", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("expected a forged X-Forwarded-For to be ignored, got %d", code)
+	}
+
+	// Clients behind a trusted proxy each have their own.
+	if code := serve("10.0.0.5", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("expected the first client behind the proxy to be served, got %d", code)
+	}
+	if code := serve("10.0.0.5", "198.51.100.2"); code != http.StatusOK {
+		t.Errorf("expected another client behind the proxy to be served, got %d", code)
+	}
+	if code := serve("10.0.0.5", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the client behind the proxy to be limited, got %d", code)
+	}
+}
+
+func TestRateLimit_InFlight(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), config.RateLimitConfig{MaxInFlight: 1})
+	entered, done := make(chan struct{}), make(chan struct{})
+	h := middleware.RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/shifts/" {
+			close(entered)
+			<-done
+		}
+	}))
+
+	go h.ServeHTTP(httptest.NewRecorder(), limitedRequest(http.MethodGet, "/api/v1/shifts/", "worker-1"))
+	<-entered
+	defer close(done)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, limitedRequest(http.MethodGet, "/api/v1/workers/", "worker-2"))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a 503 with Retry-After past the in-flight cap, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, limitedRequest(http.MethodPost, "/api/v1/alarms/", "worker-2"))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the alarm to be served past the in-flight cap, got %d", rr.Code)
+	}
+}
+
+// Requests are limited by address before their credentials are checked,
+// so a flood of invalid tokens is refused without reaching Auth.
+func TestRateLimitIP_BeforeAuth(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), config.RateLimitConfig{
+		PerIP: config.Limit{Requests: 1, Period: time.Minute},
+	})
+	authenticated := 0
+	h := middleware.RateLimitIP(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticated++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	serve := func(ip string) int {
+		r := limitedRequest(http.MethodGet, "/api/v1/shifts/", "")
+		r.RemoteAddr = ip + ":4321"
+		r.Header.Set("Authorization", "Bearer invalid")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr.Code
+	}
+	if code := serve("10.0.0.1"); code != http.StatusUnauthorized {
+		t.Fatalf("expected the first request to reach auth, got %d", code)
+	}
+	if code := serve("10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the address to be limited, got %d", code)
+	}
+	if code := serve("10.0.0.2"); code != http.StatusUnauthorized {
+		t.Errorf("expected another address to reach auth, got %d", code)
+	}
+	if authenticated != 2 {
+		t.Errorf("expected 2 requests to reach auth, got %d", authenticated)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, config.Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestRateLimit_StoreFailureAllows(t *testing.T) {
+	limiter := ratelimit.New(failingStore{}, config.RateLimitConfig{
+		Alarms: config.Limit{Requests: 1, Period: time.Minute},
+	})
+	h := middleware.RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, limitedRequest(http.MethodPost, "/api/v1/alarms/", "worker-1"))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected the alarm to be served when the store fails, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const clientIPContextKey contextKey = "client_ip"
+
+// RealIP returns middleware that records the address of the client a
+// request came from, for the audit log and the rate limiter. It is the
+// peer's address unless the peer is one of the trusted proxies; then
+// X-Forwarded-For is read from the right, past any further trusted
+// proxies, to the first address they did not add. Forwarding headers from
+// any other peer are ignored, as a client may put anything in them.
+// r.RemoteAddr is left as received.
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPContextKey, clientIP(r, trusted))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetClientIP returns the client address RealIP recorded, or the peer's
+// address if it has not run.
+func GetClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	ip := peerIP(r)
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !isTrusted(addr, trusted) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// Nothing left of a malformed hop can be relied on; the last
+			// trusted proxy is the best known address.
+			break
+		}
+		ip = hop.Unmap().String()
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIP is the host of r.RemoteAddr, the address the connection came
+// from.
+func peerIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
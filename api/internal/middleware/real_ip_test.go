@@ -0,0 +1,51 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name    string
+		trusted []netip.Prefix
+		peer    string
+		xff     string
+		want    string
+	}{
+		{"no proxies trusted", nil, "203.0.113.7:51234", "198.51.100.9", "203.0.113.7"},
+		{"untrusted peer", trusted, "203.0.113.7:51234", "198.51.100.9", "203.0.113.7"},
+		{"trusted proxy", trusted, "10.0.0.5:443", "198.51.100.9", "198.51.100.9"},
+		{"chain of trusted proxies", trusted, "10.0.0.5:443", "198.51.100.9, 10.1.2.3", "198.51.100.9"},
+		{"client-supplied entries skipped", trusted, "10.0.0.5:443", "192.0.2.1, 198.51.100.9", "198.51.100.9"},
+		{"trusted proxy without header", trusted, "10.0.0.5:443", "", "10.0.0.5"},
+		{"malformed hop", trusted, "10.0.0.5:443", "198.51.100.9, not-an-ip, 10.1.2.3", "10.1.2.3"},
+		{"mapped address", trusted, "[::ffff:10.0.0.5]:443", "::ffff:198.51.100.9", "198.51.100.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := middleware.RealIP(tt.trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = middleware.GetClientIP(r)
+				if r.RemoteAddr != tt.peer {
+					t.Errorf("expected RemoteAddr to be left as %q, got %q", tt.peer, r.RemoteAddr)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("expected client %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+// TenantBeginner starts the database session whose row-level security
+// policies limit a request to its tenant's rows.
+type TenantBeginner interface {
+	Begin(ctx context.Context, tenant repository.Tenant) (context.Context, repository.Tx, error)
+}
+
+// MembershipLister lists a worker's company memberships.
+type MembershipLister interface {
+	ListByWorker(ctx context.Context, workerID string) ([]model.WorkerCompany, error)
+}
+
+// Tenant returns middleware that runs the rest of the request in a tenant
+// session covering the caller's active memberships and the company roles
+// their token grants. The session is committed before the response is
+// sent, or rolled back if the handler fails. It must run after Worker.
+func Tenant(tenants TenantBeginner, memberships MembershipLister) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			worker := GetWorker(r.Context())
+			if worker == nil {
+				http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+
+			companyIDs, err := tenantCompanies(r.Context(), memberships, worker.ID)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to list memberships", logging.Error(err))
+				http.Error(w, `{"error": "failed to start request"}`, http.StatusInternalServerError)
+				return
+			}
+
+			ctx, tx, err := tenants.Begin(r.Context(), repository.Tenant{WorkerID: worker.ID, CompanyIDs: companyIDs})
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to begin tenant session", logging.Error(err))
+				http.Error(w, `{"error": "failed to start request"}`, http.StatusInternalServerError)
+				return
+			}
+			defer tx.Rollback()
+
+			buffered := &bufferedResponse{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(buffered, r.WithContext(ctx))
+
+			if buffered.statusCode < http.StatusBadRequest {
+				if err := tx.Commit(); err != nil {
+					logging.FromContext(r.Context()).Error("failed to commit request", logging.Error(err))
+					http.Error(w, `{"error": "failed to save changes"}`, http.StatusInternalServerError)
+					return
+				}
+			}
+			buffered.flush()
+		})
+	}
+}
+
+func tenantCompanies(ctx context.Context, memberships MembershipLister, workerID string) ([]string, error) {
+	list, err := memberships.ListByWorker(ctx, workerID)
+	if err != nil {
+		return nil, err
+	}
+	var companyIDs []string
+	for _, m := range list {
+		if m.Status == model.MembershipActive && !slices.Contains(companyIDs, m.CompanyID) {
+			companyIDs = append(companyIDs, m.CompanyID)
+		}
+	}
+	if claims := GetClaims(ctx); claims != nil {
+		for _, cr := range claims.CompanyRoles {
+			if !slices.Contains(companyIDs, cr.CompanyID) {
+				companyIDs = append(companyIDs, cr.CompanyID)
+			}
+		}
+	}
+	return companyIDs, nil
+}
+
+// bufferedResponse holds a response back until the tenant session has been
+// committed, or an idempotent response saved, so a failure can still be
+// reported.
+type bufferedResponse struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if !b.wroteHeader {
+		b.statusCode = code
+		b.wroteHeader = true
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) flush() {
+	b.ResponseWriter.WriteHeader(b.statusCode)
+	b.ResponseWriter.Write(b.body.Bytes())
+}
@@ -0,0 +1,112 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+// fakeTenants records the tenant session a request begins and how it ends.
+type fakeTenants struct {
+	tenant    repository.Tenant
+	commitErr error
+	committed bool
+	rolled    bool
+}
+
+func (f *fakeTenants) Begin(ctx context.Context, tenant repository.Tenant) (context.Context, repository.Tx, error) {
+	f.tenant = tenant
+	return ctx, f, nil
+}
+
+func (f *fakeTenants) Commit() error {
+	if f.commitErr != nil {
+		return f.commitErr
+	}
+	f.committed = true
+	return nil
+}
+
+func (f *fakeTenants) Rollback() error {
+	if !f.committed {
+		f.rolled = true
+	}
+	return nil
+}
+
+type stubMemberships []model.WorkerCompany
+
+func (s stubMemberships) ListByWorker(ctx context.Context, workerID string) ([]model.WorkerCompany, error) {
+	return s, nil
+}
+
+func tenantRequest(workerID string, claims *auth.Claims) *http.Request {
+	req := withClaims(httptest.NewRequest(http.MethodPost, "/test", nil), claims)
+	return req.WithContext(context.WithValue(req.Context(), middleware.WorkerContextKey, &model.Worker{ID: workerID}))
+}
+
+func TestTenantMiddleware_ScopesSessionToMemberships(t *testing.T) {
+	tenants := &fakeTenants{}
+	memberships := stubMemberships{
+		{WorkerID: "w1", CompanyID: "sentinel", Status: model.MembershipActive},
+		{WorkerID: "w1", CompanyID: "former", Status: model.MembershipInactive},
+	}
+	handler := middleware.Tenant(tenants, memberships)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"x"}`))
+	}))
+
+	claims := &auth.Claims{CompanyRoles: []auth.CompanyRole{{CompanyID: "apex", Role: "site_admin"}}}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, tenantRequest("w1", claims))
+
+	want := repository.Tenant{WorkerID: "w1", CompanyIDs: []string{"sentinel", "apex"}}
+	if !reflect.DeepEqual(tenants.tenant, want) {
+		t.Errorf("expected tenant %+v, got %+v", want, tenants.tenant)
+	}
+	if !tenants.committed {
+		t.Error("expected the session to be committed")
+	}
+	if rr.Code != http.StatusCreated || rr.Body.String() != `{"id":"x"}` {
+		t.Errorf("expected the handler's response, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestTenantMiddleware_RollsBackFailedRequests(t *testing.T) {
+	tenants := &fakeTenants{}
+	handler := middleware.Tenant(tenants, stubMemberships{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusUnprocessableEntity)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, tenantRequest("w1", &auth.Claims{}))
+
+	if tenants.committed || !tenants.rolled {
+		t.Errorf("expected rollback, got committed=%v rolled=%v", tenants.committed, tenants.rolled)
+	}
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func TestTenantMiddleware_CommitFailure(t *testing.T) {
+	tenants := &fakeTenants{commitErr: errors.New("serialization failure")}
+	handler := middleware.Tenant(tenants, stubMemberships{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, tenantRequest("w1", &auth.Claims{}))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d when the commit fails, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
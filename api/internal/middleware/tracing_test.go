@@ -0,0 +1,51 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/tracing/tracingtest"
+)
+
+func TestTracing(t *testing.T) {
+	spans := tracingtest.Record(t)
+	r := chi.NewRouter()
+	r.Use(middleware.Tracing)
+	r.Route("/shifts", func(r chi.Router) {
+		r.Post("/{id}/check-ins", func(w http.ResponseWriter, r *http.Request) {
+			if !trace.SpanFromContext(r.Context()).SpanContext().IsValid() {
+				t.Error("expected the handler's context to carry the request's span")
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/shifts/s-1/check-ins", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	span := tracingtest.Find(t, spans, "POST /shifts/{id}/check-ins")
+	if span.SpanKind != trace.SpanKindServer {
+		t.Errorf("expected a server span, got %v", span.SpanKind)
+	}
+	if got := span.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the caller's trace to be continued, got trace %s", got)
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("expected a server error to mark the span, got %v", span.Status)
+	}
+	attrs := attribute.NewSet(span.Attributes...)
+	if v, _ := attrs.Value("http.route"); v.AsString() != "/shifts/{id}/check-ins" {
+		t.Errorf("expected the route pattern, got %q", v.AsString())
+	}
+	if v, _ := attrs.Value("http.response.status_code"); v.AsInt64() != http.StatusServiceUnavailable {
+		t.Errorf("expected the status code, got %d", v.AsInt64())
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+const WorkerContextKey contextKey = "auth_worker"
+
+// WorkerProvisioner resolves, and on first login links or creates, the
+// worker for an authenticated identity.
+type WorkerProvisioner interface {
+	Provision(ctx context.Context, claimed service.Identity, loadProfile service.ProfileLoader) (*model.Worker, error)
+}
+
+// Worker returns middleware that resolves the caller's worker record and
+// injects it into the request context. It must run after Auth.
+func Worker(workers WorkerProvisioner, provider auth.Provider) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetClaims(r.Context())
+			if claims == nil {
+				http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+
+			token := extractBearerToken(r)
+			loadProfile := func(ctx context.Context) (*service.Identity, error) {
+				info, err := provider.GetUserInfo(ctx, token)
+				if err != nil {
+					return nil, err
+				}
+				return &service.Identity{
+					Subject:       info.Subject,
+					Email:         info.Email,
+					EmailVerified: info.EmailVerified,
+					FirstName:     info.FirstName,
+					LastName:      info.LastName,
+				}, nil
+			}
+
+			worker, err := workers.Provision(r.Context(), service.Identity{
+				Subject:       claims.Subject,
+				Email:         claims.Email,
+				EmailVerified: claims.EmailVerified,
+				FirstName:     claims.GivenName,
+				LastName:      claims.FamilyName,
+			}, loadProfile)
+			switch {
+			case errors.Is(err, service.ErrEmailConflict):
+				http.Error(w, `{"error": "email is already linked to another account"}`, http.StatusConflict)
+				return
+			case errors.Is(err, service.ErrEmailUnverified):
+				http.Error(w, `{"error": "email address has not been verified"}`, http.StatusForbidden)
+				return
+			case err != nil:
+				logging.FromContext(r.Context()).Error("failed to provision worker", logging.Error(err))
+				http.Error(w, `{"error": "failed to resolve worker"}`, http.StatusInternalServerError)
+				return
+			}
+
+			logging.Add(r.Context(), slog.String("worker_id", worker.ID))
+
+			actor := service.ActorFrom(r.Context())
+			actor.WorkerID = worker.ID
+			ctx := context.WithValue(service.WithActor(r.Context(), actor), WorkerContextKey, worker)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetWorker extracts the caller's worker from the request context.
+func GetWorker(ctx context.Context) *model.Worker {
+	worker, ok := ctx.Value(WorkerContextKey).(*model.Worker)
+	if !ok {
+		return nil
+	}
+	return worker
+}
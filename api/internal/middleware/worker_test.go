@@ -0,0 +1,86 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/middleware"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+type stubProvisioner struct {
+	claimed service.Identity
+	worker  *model.Worker
+	err     error
+}
+
+func (s *stubProvisioner) Provision(ctx context.Context, claimed service.Identity, loadProfile service.ProfileLoader) (*model.Worker, error) {
+	s.claimed = claimed
+	return s.worker, s.err
+}
+
+func withClaims(r *http.Request, claims *auth.Claims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), middleware.ClaimsContextKey, claims))
+}
+
+func TestWorkerMiddleware_InjectsWorker(t *testing.T) {
+	provisioner := &stubProvisioner{worker: &model.Worker{ID: "w1"}}
+	mw := middleware.Worker(provisioner, &mockProvider{})
+
+	var got *model.Worker
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = middleware.GetWorker(r.Context())
+	}))
+
+	req := withClaims(httptest.NewRequest(http.MethodGet, "/test", nil), &auth.Claims{
+		Subject:       "kc-uuid-1",
+		Email:         "john@example.com",
+		EmailVerified: true,
+		GivenName:     "John",
+		FamilyName:    "Smith",
+	})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if got == nil || got.ID != "w1" {
+		t.Errorf("expected worker w1 in context, got %+v", got)
+	}
+	if provisioner.claimed.FirstName != "John" || !provisioner.claimed.EmailVerified {
+		t.Errorf("expected claims to be passed through, got %+v", provisioner.claimed)
+	}
+}
+
+func TestWorkerMiddleware_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"email conflict", service.ErrEmailConflict, http.StatusConflict},
+		{"unverified email", service.ErrEmailUnverified, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := middleware.Worker(&stubProvisioner{err: tt.err}, &mockProvider{})
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("handler should not be called")
+			}))
+
+			req := withClaims(httptest.NewRequest(http.MethodGet, "/test", nil), &auth.Claims{Subject: "kc-uuid-1"})
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+// Package migrate applies versioned schema migrations and records them in
+// the schema_migrations table.
+//
+// Each migration runs in its own transaction together with its
+// schema_migrations row, so a failed migration leaves no trace. Runs hold a
+// Postgres advisory lock, so API replicas starting together, or a
+// migration job racing them, apply each migration once. The checksum of
+// every applied migration is kept, and a migration edited after it was
+// applied stops further runs rather than leaving the schema to drift.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockKey identifies the advisory lock migration runs hold.
+const lockKey = 7_317_845_019
+
+// Migration is one version of the schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the SHA-256 of Up, hex encoded.
+	Checksum string
+}
+
+// String returns the migration's file name stem, e.g. "001_create_companies".
+func (m Migration) String() string {
+	return fmt.Sprintf("%03d_%s", m.Version, m.Name)
+}
+
+// Status is a migration and whether it has been applied.
+type Status struct {
+	Migration
+	// AppliedAt is nil while the migration is pending.
+	AppliedAt *time.Time
+	// Modified is set when the migration no longer matches the checksum it
+	// was applied with.
+	Modified bool
+}
+
+// ModifiedError is returned when an applied migration has been edited.
+type ModifiedError struct {
+	Migration Migration
+}
+
+func (e *ModifiedError) Error() string {
+	return fmt.Sprintf("migration %s was modified after it was applied", e.Migration)
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the migrations in fsys, ordered by version. Every version
+// needs both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %03d has two names, %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New returns a Migrator for the migrations in fsys.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// applied is a schema_migrations row.
+type applied struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// Status reports every migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			s := Status{Migration: mig}
+			if a, ok := done[mig.Version]; ok {
+				s.AppliedAt = &a.appliedAt
+				s.Modified = a.checksum != mig.Checksum
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Up applies every pending migration and returns those it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var ran []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		ran, err = m.up(ctx, conn, -1)
+		return err
+	})
+	return ran, err
+}
+
+// Down rolls back the n most recently applied migrations and returns those
+// it rolled back.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var ran []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		ran, err = m.down(ctx, conn, n)
+		return err
+	})
+	return ran, err
+}
+
+// Redo rolls back the most recently applied migration and applies it again,
+// and returns it.
+func (m *Migrator) Redo(ctx context.Context) (*Migration, error) {
+	var redone *Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		ran, err := m.down(ctx, conn, 1)
+		if err != nil || len(ran) == 0 {
+			return err
+		}
+		if _, err := m.up(ctx, conn, ran[0].Version); err != nil {
+			return err
+		}
+		redone = &ran[0]
+		return nil
+	})
+	return redone, err
+}
+
+// Baseline records the migrations up to version as applied without running
+// them, for a database whose schema was created before schema_migrations
+// existed. It refuses a database that already records migrations, and a
+// version the schema does not match: migration version must no longer
+// apply, because its objects exist, and the one after it must still apply.
+// Both are tried in transactions that are rolled back.
+func (m *Migrator) Baseline(ctx context.Context, version int) error {
+	last, ok := m.find(version)
+	if !ok {
+		return fmt.Errorf("no migration has version %03d", version)
+	}
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(done) > 0 {
+			return errors.New("schema_migrations already records applied migrations")
+		}
+		if err := try(ctx, conn, last); err == nil {
+			return fmt.Errorf("migration %s has not been applied; baseline an earlier version", last)
+		}
+		for _, mig := range m.migrations {
+			if mig.Version <= version {
+				continue
+			}
+			if err := try(ctx, conn, mig); err != nil {
+				return fmt.Errorf("migration %s does not apply (%v); baseline a later version if it has been applied", mig, err)
+			}
+			break
+		}
+		return inTx(ctx, conn, func(tx *sql.Tx) error {
+			for _, mig := range m.migrations {
+				if mig.Version > version {
+					break
+				}
+				if err := record(ctx, tx, mig); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// up applies pending migrations in order, stopping after version to when it
+// is not negative.
+func (m *Migrator) up(ctx context.Context, conn *sql.Conn, to int) ([]Migration, error) {
+	done, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, mig := range m.migrations {
+		if a, ok := done[mig.Version]; ok && a.checksum != mig.Checksum {
+			return nil, &ModifiedError{Migration: mig}
+		}
+	}
+
+	var ran []Migration
+	for _, mig := range m.migrations {
+		if to >= 0 && mig.Version > to {
+			break
+		}
+		if _, ok := done[mig.Version]; ok {
+			continue
+		}
+		err := inTx(ctx, conn, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+				return err
+			}
+			return record(ctx, tx, mig)
+		})
+		if err != nil {
+			return ran, fmt.Errorf("failed to apply migration %s: %w", mig, err)
+		}
+		ran = append(ran, mig)
+	}
+	return ran, nil
+}
+
+// down rolls back the n most recently applied migrations.
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, n int) ([]Migration, error) {
+	done, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int, 0, len(done))
+	for v := range done {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if n < len(versions) {
+		versions = versions[:n]
+	}
+
+	var ran []Migration
+	for _, v := range versions {
+		mig, ok := m.find(v)
+		if !ok {
+			return ran, fmt.Errorf("migration %03d is applied but unknown to this build", v)
+		}
+		err := inTx(ctx, conn, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+			return err
+		})
+		if err != nil {
+			return ran, fmt.Errorf("failed to roll back migration %s: %w", mig, err)
+		}
+		ran = append(ran, mig)
+	}
+	return ran, nil
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// locked runs fn on one connection holding the migration lock, creating
+// schema_migrations first if needed.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	_, err = conn.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// applied returns the schema_migrations rows by version.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]applied, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := map[int]applied{}
+	for rows.Next() {
+		var v int
+		var a applied
+		if err := rows.Scan(&v, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		done[v] = a
+	}
+	return done, rows.Err()
+}
+
+func record(ctx context.Context, tx *sql.Tx, mig Migration) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+		mig.Version, mig.Name, mig.Checksum)
+	if err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", mig, err)
+	}
+	return nil
+}
+
+// try runs mig's up migration in a transaction it always rolls back, to
+// see whether it applies to the schema as it stands.
+func try(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, mig.Up)
+	return err
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,69 @@
+package migrate_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/migrate"
+	"github.com/chrishaylesai/sitesecurity/api/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_create_worksites.up.sql":   {Data: []byte("CREATE TABLE worksites ();")},
+		"002_create_worksites.down.sql": {Data: []byte("DROP TABLE worksites;")},
+		"001_create_companies.up.sql":   {Data: []byte("CREATE TABLE companies ();")},
+		"001_create_companies.down.sql": {Data: []byte("DROP TABLE companies;")},
+		"README.md":                     {Data: []byte("not a migration")},
+	}
+	got, err := migrate.Load(fsys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Version != 1 || got[1].Version != 2 {
+		t.Fatalf("expected versions 1 and 2 in order, got %+v", got)
+	}
+	if got[0].String() != "001_create_companies" || got[0].Down != "DROP TABLE companies;" {
+		t.Errorf("unexpected migration %+v", got[0])
+	}
+	if len(got[0].Checksum) != 64 || got[0].Checksum == got[1].Checksum {
+		t.Errorf("expected distinct SHA-256 checksums, got %q and %q", got[0].Checksum, got[1].Checksum)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{"missing down", fstest.MapFS{
+			"001_create_companies.up.sql": {Data: []byte("CREATE TABLE companies ();")},
+		}, "needs both"},
+		{"two names", fstest.MapFS{
+			"001_create_companies.up.sql": {Data: []byte("CREATE TABLE companies ();")},
+			"001_create_firms.down.sql":   {Data: []byte("DROP TABLE companies;")},
+		}, "two names"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrate.Load(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	got, err := migrate.Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("failed to load the embedded migrations: %v", err)
+	}
+	for i, m := range got {
+		if m.Version != i+1 {
+			t.Errorf("expected version %d, got %s", i+1, m)
+		}
+	}
+}
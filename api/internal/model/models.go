@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Company struct {
 	ID        string    `json:"id" db:"id"`
@@ -8,6 +11,7 @@ type Company struct {
 	Address   *string   `json:"address,omitempty" db:"address"`
 	Phone     *string   `json:"phone,omitempty" db:"phone"`
 	Email     *string   `json:"email,omitempty" db:"email"`
+	Version   int       `json:"version" db:"version"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
 }
@@ -19,19 +23,24 @@ type Worksite struct {
 	Address   *string  `json:"address,omitempty" db:"address"`
 	Latitude  *float64 `json:"latitude,omitempty" db:"latitude"`
 	Longitude *float64 `json:"longitude,omitempty" db:"longitude"`
+	Version   int      `json:"version" db:"version"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
 }
 
 type Worker struct {
-	ID          string    `json:"id" db:"id"`
-	AuthSubject string    `json:"authSubject" db:"auth_subject"`
-	FirstName   string    `json:"firstName" db:"first_name"`
-	LastName    string    `json:"lastName" db:"last_name"`
-	Email       string    `json:"email" db:"email"`
-	Phone       *string   `json:"phone,omitempty" db:"phone"`
-	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
+	ID          string  `json:"id" db:"id"`
+	AuthSubject string  `json:"authSubject" db:"auth_subject"`
+	FirstName   string  `json:"firstName" db:"first_name"`
+	LastName    string  `json:"lastName" db:"last_name"`
+	Email       string  `json:"email" db:"email"`
+	Phone       *string `json:"phone,omitempty" db:"phone"`
+	// AuthLinkedAt is set once AuthSubject refers to a real identity; nil
+	// for workers invited by an admin who have not logged in yet.
+	AuthLinkedAt *time.Time `json:"authLinkedAt,omitempty" db:"auth_linked_at"`
+	Version      int        `json:"version" db:"version"`
+	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updatedAt" db:"updated_at"`
 }
 
 type WorkerRole string
@@ -54,6 +63,7 @@ type WorkerCompany struct {
 	CompanyID string           `json:"companyId" db:"company_id"`
 	Role      WorkerRole       `json:"role" db:"role"`
 	Status    MembershipStatus `json:"status" db:"status"`
+	Version   int              `json:"version" db:"version"`
 	JoinedAt  time.Time        `json:"joinedAt" db:"joined_at"`
 }
 
@@ -65,6 +75,7 @@ type Certificate struct {
 	CertificateNumber *string    `json:"certificateNumber,omitempty" db:"certificate_number"`
 	IssuedDate        *string    `json:"issuedDate,omitempty" db:"issued_date"`
 	ExpiryDate        *string    `json:"expiryDate,omitempty" db:"expiry_date"`
+	Version           int        `json:"version" db:"version"`
 	CreatedAt         time.Time  `json:"createdAt" db:"created_at"`
 	UpdatedAt         time.Time  `json:"updatedAt" db:"updated_at"`
 }
@@ -88,6 +99,7 @@ type Shift struct {
 	StartTime   time.Time   `json:"startTime" db:"start_time"`
 	EndTime     time.Time   `json:"endTime" db:"end_time"`
 	Status      ShiftStatus `json:"status" db:"status"`
+	Version     int         `json:"version" db:"version"`
 	CreatedAt   time.Time   `json:"createdAt" db:"created_at"`
 	UpdatedAt   time.Time   `json:"updatedAt" db:"updated_at"`
 }
@@ -106,15 +118,24 @@ type ShiftAssignment struct {
 	ShiftID     string           `json:"shiftId" db:"shift_id"`
 	WorkerID    string           `json:"workerId" db:"worker_id"`
 	Status      AssignmentStatus `json:"status" db:"status"`
+	Version     int              `json:"version" db:"version"`
 	AssignedAt  time.Time        `json:"assignedAt" db:"assigned_at"`
 	RespondedAt *time.Time       `json:"respondedAt,omitempty" db:"responded_at"`
 }
 
+// AssignmentWithShift is a shift assignment together with the shift it is
+// for, as listed on a worker's schedule.
+type AssignmentWithShift struct {
+	ShiftAssignment
+	Shift Shift `json:"shift"`
+}
+
 type ShiftReportTemplate struct {
 	ID        string    `json:"id" db:"id"`
 	CompanyID string    `json:"companyId" db:"company_id"`
 	Name      string    `json:"name" db:"name"`
 	Fields    string    `json:"fields" db:"fields"` // JSONB stored as string
+	Version   int       `json:"version" db:"version"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
 }
@@ -125,6 +146,7 @@ type ShiftReport struct {
 	WorkerID    string    `json:"workerId" db:"worker_id"`
 	TemplateID  *string   `json:"templateId,omitempty" db:"template_id"`
 	Data        string    `json:"data" db:"data"` // JSONB stored as string
+	Version     int       `json:"version" db:"version"`
 	SubmittedAt time.Time `json:"submittedAt" db:"submitted_at"`
 }
 
@@ -153,7 +175,45 @@ type Alarm struct {
 	Longitude      *float64    `json:"longitude,omitempty" db:"longitude"`
 	Message        *string     `json:"message,omitempty" db:"message"`
 	Status         AlarmStatus `json:"status" db:"status"`
+	Version        int         `json:"version" db:"version"`
 	RaisedAt       time.Time   `json:"raisedAt" db:"raised_at"`
 	AcknowledgedAt *time.Time  `json:"acknowledgedAt,omitempty" db:"acknowledged_at"`
 	ResolvedAt     *time.Time  `json:"resolvedAt,omitempty" db:"resolved_at"`
 }
+
+// APIKey is a credential for a machine client, such as an alarm panel,
+// which acts as the service-account worker WorkerID within one company.
+type APIKey struct {
+	ID         string     `json:"id" db:"id"`
+	CompanyID  string     `json:"companyId" db:"company_id"`
+	WorkerID   string     `json:"workerId" db:"worker_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	Role       WorkerRole `json:"role" db:"role"`
+	CreatedBy  *string    `json:"createdBy,omitempty" db:"created_by"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// AuditEvent records one change made through the API: who made it, from
+// where, and the resource before and after. CompanyIDs are the companies
+// whose auditors can see it.
+type AuditEvent struct {
+	ID            string          `json:"id" db:"id"`
+	OccurredAt    time.Time       `json:"occurredAt" db:"occurred_at"`
+	ActorWorkerID *string         `json:"actorWorkerId,omitempty" db:"actor_worker_id"`
+	ActorSubject  *string         `json:"actorSubject,omitempty" db:"actor_subject"`
+	APIKeyID      *string         `json:"apiKeyId,omitempty" db:"api_key_id"`
+	Action        string          `json:"action" db:"action"`
+	ResourceType  string          `json:"resourceType" db:"resource_type"`
+	ResourceID    string          `json:"resourceId" db:"resource_id"`
+	CompanyIDs    []string        `json:"companyIds" db:"company_ids"`
+	Before        json.RawMessage `json:"before,omitempty" db:"before"`
+	After         json.RawMessage `json:"after,omitempty" db:"after"`
+	IP            *string         `json:"ip,omitempty" db:"ip"`
+	RequestID     *string         `json:"requestId,omitempty" db:"request_id"`
+}
@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+const (
+	// documentURL names the document to the schema compiler, which
+	// resolves the request bodies' $refs within it.
+	documentURL = "file:///openapi.json"
+	// maxBody bounds the request bodies read to validate them.
+	maxBody = 1 << 20
+)
+
+var methods = []string{"get", "put", "post", "patch", "delete"}
+
+var printer = message.NewPrinter(language.English)
+
+// Validator checks request bodies against the schemas the OpenAPI document
+// gives them.
+type Validator struct {
+	operations []operation
+}
+
+// operation is a request body the document describes.
+type operation struct {
+	method string
+	// segments is the operation's path split on "/"; "{...}" segments
+	// match any value.
+	segments []string
+	required bool
+	schema   *jsonschema.Schema
+}
+
+// NewValidator compiles the request body schemas of the document.
+func NewValidator() (*Validator, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(spec))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse openapi document: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	c.DefaultDraft(jsonschema.Draft2020)
+	c.AssertFormat()
+	if err := c.AddResource(documentURL, doc); err != nil {
+		return nil, fmt.Errorf("failed to load openapi document: %w", err)
+	}
+
+	var parsed struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse openapi paths: %w", err)
+	}
+	v := &Validator{}
+	for path, item := range parsed.Paths {
+		for _, method := range methods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op struct {
+				RequestBody *struct {
+					Required bool                       `json:"required"`
+					Content  map[string]json.RawMessage `json:"content"`
+				} `json:"requestBody"`
+			}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("failed to parse %s %s: %w", method, path, err)
+			}
+			if op.RequestBody == nil || op.RequestBody.Content["application/json"] == nil {
+				continue
+			}
+			loc := documentURL + "#" + pointer("paths", path, method, "requestBody", "content", "application/json", "schema")
+			schema, err := c.Compile(loc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile the request body of %s %s: %w", method, path, err)
+			}
+			v.operations = append(v.operations, operation{
+				method:   strings.ToUpper(method),
+				segments: strings.Split(path, "/"),
+				required: op.RequestBody.Required,
+				schema:   schema,
+			})
+		}
+	}
+	return v, nil
+}
+
+// Middleware rejects a request whose body does not match its operation's
+// schema, answering as the handler would: 400 for a body that is not JSON
+// and 422 listing the invalid fields of one that does not match. Requests
+// the document gives no body are passed on as they are.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := v.match(r.Method, r.URL.Path)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				handler.Error(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			handler.Error(w, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if len(bytes.TrimSpace(body)) == 0 && !op.required {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+		if err != nil {
+			handler.Error(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := op.schema.Validate(doc); err != nil {
+			var invalid *jsonschema.ValidationError
+			if !errors.As(err, &invalid) {
+				handler.ServiceError(w, r, err)
+				return
+			}
+			handler.ServiceError(w, r, &service.ValidationError{Fields: fieldErrors(invalid)})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// match finds the operation for a request, preferring the one with the
+// most literal segments, as the router does: /shift-reports/templates
+// rather than /shift-reports/{id}.
+func (v *Validator) match(method, path string) *operation {
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	segments := strings.Split(path, "/")
+	var best *operation
+	bestLiterals := -1
+	for i := range v.operations {
+		op := &v.operations[i]
+		if op.method != method || len(op.segments) != len(segments) {
+			continue
+		}
+		literals := 0
+		matched := true
+		for j, seg := range op.segments {
+			if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+				continue
+			}
+			if seg != segments[j] {
+				matched = false
+				break
+			}
+			literals++
+		}
+		if matched && literals > bestLiterals {
+			best, bestLiterals = op, literals
+		}
+	}
+	return best
+}
+
+// fieldErrors flattens a validation error into the fields it names, in the
+// form the service layer reports them.
+func fieldErrors(err *jsonschema.ValidationError) []service.FieldError {
+	if len(err.Causes) > 0 {
+		var fields []service.FieldError
+		for _, cause := range err.Causes {
+			fields = append(fields, fieldErrors(cause)...)
+		}
+		return fields
+	}
+	if required, ok := err.ErrorKind.(*kind.Required); ok {
+		fields := make([]service.FieldError, len(required.Missing))
+		for i, name := range required.Missing {
+			fields[i] = service.FieldError{Field: field(append(slices.Clone(err.InstanceLocation), name)), Message: "is required"}
+		}
+		return fields
+	}
+	return []service.FieldError{{Field: field(err.InstanceLocation), Message: err.ErrorKind.LocalizedString(printer)}}
+}
+
+// field names a value of the body the way FieldError does, such as
+// "scopes.0"; the body itself is "body".
+func field(location []string) string {
+	if len(location) == 0 {
+		return "body"
+	}
+	return strings.Join(location, ".")
+}
+
+// pointer builds a JSON pointer from its tokens.
+func pointer(tokens ...string) string {
+	var sb strings.Builder
+	for _, tok := range tokens {
+		sb.WriteByte('/')
+		sb.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(tok))
+	}
+	return sb.String()
+}
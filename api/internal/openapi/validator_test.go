@@ -0,0 +1,122 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/handler"
+	"github.com/chrishaylesai/sitesecurity/api/internal/openapi"
+)
+
+// validate sends a request through the validator, returning the response
+// and whether the handler was reached with the body intact.
+func validate(t *testing.T, method, path, body string) (*httptest.ResponseRecorder, bool) {
+	t.Helper()
+	v, err := openapi.NewValidator()
+	if err != nil {
+		t.Fatalf("failed to load validator: %v", err)
+	}
+	reached := false
+	h := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		if string(got) != body {
+			t.Errorf("expected the handler to read %q, got %q", body, got)
+		}
+		reached = true
+	}))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rr, reached
+}
+
+func TestValidator_ValidBody(t *testing.T) {
+	tests := []struct {
+		name, method, path, body string
+	}{
+		{"alarm", http.MethodPost, "/api/v1/alarms/", `{"latitude": 51.5, "longitude": -0.12, "message": "intruder"}`},
+		{"shift", http.MethodPut, "/api/v1/shifts/s1", `{"worksiteId": "w1", "title": "Nights", "startTime": "2026-01-01T22:00:00Z", "endTime": "2026-01-02T06:00:00Z", "id": "s1"}`},
+		{"template, not report", http.MethodPost, "/api/v1/shift-reports/templates", `{"companyId": "c1", "name": "Patrol", "fields": "[]"}`},
+		{"no body in the document", http.MethodPatch, "/api/v1/alarms/a1/acknowledge", `not json`},
+		{"read", http.MethodGet, "/api/v1/alarms", ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, reached := validate(t, tt.method, tt.path, tt.body)
+			if !reached {
+				t.Errorf("expected the request to reach the handler, got %d %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestValidator_InvalidBody(t *testing.T) {
+	rr, reached := validate(t, http.MethodPost, "/api/v1/api-keys", `{"companyId": "c1", "scopes": ["alarms:write", "api-keys:write"], "expiresAt": "tomorrow"}`)
+	if reached {
+		t.Fatal("expected the request to be rejected")
+	}
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	var problem handler.ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+		t.Fatalf("failed to decode problem: %v", err)
+	}
+	if problem.Type != handler.ProblemValidation {
+		t.Errorf("expected a validation problem, got %q", problem.Type)
+	}
+	fields := make(map[string]string)
+	for _, f := range problem.Errors {
+		fields[f.Field] = f.Message
+	}
+	for _, name := range []string{"name", "scopes.1", "expiresAt"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("expected %s to be reported invalid, got %v", name, problem.Errors)
+		}
+	}
+	if fields["name"] != "is required" {
+		t.Errorf("expected name to be reported as required, got %q", fields["name"])
+	}
+}
+
+func TestValidator_MalformedBody(t *testing.T) {
+	for _, body := range []string{`{"type": `, ``} {
+		rr, reached := validate(t, http.MethodPost, "/api/v1/check-ins", body)
+		if reached || rr.Code != http.StatusBadRequest {
+			t.Errorf("expected %q to be rejected with %d, got %d", body, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+func TestValidator_WrongType(t *testing.T) {
+	rr, reached := validate(t, http.MethodPost, "/api/v1/check-ins/", `{"latitude": "51.5", "longitude": -0.12}`)
+	if reached || rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"field":"latitude"`) {
+		t.Errorf("expected latitude to be reported invalid, got %s", rr.Body.String())
+	}
+}
+
+func TestDocument(t *testing.T) {
+	rr := httptest.NewRecorder()
+	openapi.Document(rr, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.1") || len(doc.Paths) == 0 {
+		t.Errorf("expected an OpenAPI 3.1 document with paths, got %s with %d paths", doc.OpenAPI, len(doc.Paths))
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON content type, got %q", ct)
+	}
+}
@@ -0,0 +1,140 @@
+// Package pagination pages through lists with keyset cursors.
+//
+// A cursor is the sort key of the last row of a page, so the next page
+// starts strictly after it no matter how many rows were added or removed in
+// the meantime. Older clients may still ask for a 1-based page number,
+// which is served with an offset.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultLimit is the page size when none, or an out of range one, is
+	// asked for.
+	DefaultLimit = 25
+	// MaxLimit is the largest page size served.
+	MaxLimit = 100
+)
+
+// ErrInvalidCursor is returned for a cursor this API did not issue, or one
+// issued for a different list.
+var ErrInvalidCursor = errors.New("cursor is not valid for this list")
+
+// Request is the page of a list a client asked for.
+type Request struct {
+	// Limit is the page size.
+	Limit int
+	// After is the sort key of the last row of the previous page, decoded
+	// from the cursor. Nil for the first page.
+	After []string
+	// Offset skips rows for clients paging by page number.
+	Offset int
+	// Total asks for the number of rows in the whole list.
+	Total bool
+}
+
+// Size returns the page size, applying the default and the maximum.
+func (r Request) Size() int {
+	if r.Limit < 1 || r.Limit > MaxLimit {
+		return DefaultLimit
+	}
+	return r.Limit
+}
+
+// FromQuery reads a Request from ?cursor=, ?limit= (or ?per_page=),
+// ?page= and ?total=true. A cursor takes precedence over a page number.
+func FromQuery(q url.Values) (Request, error) {
+	var r Request
+	limit := q.Get("limit")
+	if limit == "" {
+		limit = q.Get("per_page")
+	}
+	r.Limit, _ = strconv.Atoi(limit)
+	r.Limit = r.Size()
+	r.Total = q.Get("total") == "true"
+
+	if cursor := q.Get("cursor"); cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			return Request{}, err
+		}
+		r.After = after
+		return r, nil
+	}
+	if page, _ := strconv.Atoi(q.Get("page")); page > 1 {
+		r.Offset = (page - 1) * r.Limit
+	}
+	return r, nil
+}
+
+// EncodeCursor encodes a sort key as an opaque cursor.
+func EncodeCursor(key []string) string {
+	doc, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(doc)
+}
+
+// DecodeCursor decodes a cursor made by EncodeCursor.
+func DecodeCursor(cursor string) ([]string, error) {
+	doc, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var key []string
+	if err := json.Unmarshal(doc, &key); err != nil || len(key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return key, nil
+}
+
+// Page is one page of a list.
+type Page[T any] struct {
+	Items []T
+	// Next is the sort key of the last item when more rows follow, and nil
+	// on the last page.
+	Next []string
+	// Total is the number of rows in the whole list, if it was asked for.
+	Total *int
+}
+
+// Slice makes a page from rows fetched with a limit of one more than the
+// page size. The extra row is dropped; it only shows another page follows.
+func Slice[T any](rows []T, r Request, key func(T) []string) *Page[T] {
+	page := &Page[T]{Items: rows}
+	if size := r.Size(); len(rows) > size {
+		page.Items = rows[:size]
+		page.Next = key(page.Items[size-1])
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	return page
+}
+
+// Links renders an RFC 8288 Link header for a page of the list at u: the
+// first page and, unless this is the last, the next one.
+func Links(u *url.URL, r Request, next []string) string {
+	q := u.Query()
+	q.Del("cursor")
+	q.Del("page")
+	q.Del("per_page")
+	q.Set("limit", strconv.Itoa(r.Size()))
+
+	links := []string{link(u.Path, q, "first")}
+	if next != nil {
+		q.Set("cursor", EncodeCursor(next))
+		links = append(links, link(u.Path, q, "next"))
+	}
+	return strings.Join(links, ", ")
+}
+
+func link(path string, q url.Values, rel string) string {
+	return fmt.Sprintf(`<%s?%s>; rel="%s"`, path, q.Encode(), rel)
+}
@@ -0,0 +1,94 @@
+package pagination_test
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+)
+
+func TestFromQuery(t *testing.T) {
+	cursor := pagination.EncodeCursor([]string{"2026-05-01T08:00:00Z", "a1"})
+	tests := []struct {
+		query string
+		want  pagination.Request
+	}{
+		{"", pagination.Request{Limit: 25}},
+		{"limit=10", pagination.Request{Limit: 10}},
+		{"limit=500", pagination.Request{Limit: 25}},
+		{"page=3&per_page=10", pagination.Request{Limit: 10, Offset: 20}},
+		{"page=2&per_page=500", pagination.Request{Limit: 25, Offset: 25}},
+		{"page=0", pagination.Request{Limit: 25}},
+		{"total=true", pagination.Request{Limit: 25, Total: true}},
+		{"cursor=" + cursor + "&page=4", pagination.Request{Limit: 25, After: []string{"2026-05-01T08:00:00Z", "a1"}}},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		got, err := pagination.FromQuery(q)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.query, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %+v, got %+v", tt.query, tt.want, got)
+		}
+	}
+}
+
+func TestFromQuery_InvalidCursor(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24", "W10"} {
+		_, err := pagination.FromQuery(url.Values{"cursor": {cursor}})
+		if !errors.Is(err, pagination.ErrInvalidCursor) {
+			t.Errorf("cursor %q: expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	key := []string{"O'Brien", "Mary, Jane", "c1"}
+	got, err := pagination.DecodeCursor(pagination.EncodeCursor(key))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, key) {
+		t.Errorf("expected %v, got %v", key, got)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	key := func(s string) []string { return []string{s} }
+	r := pagination.Request{Limit: 2}
+
+	page := pagination.Slice([]string{"a", "b", "c"}, r, key)
+	if !reflect.DeepEqual(page.Items, []string{"a", "b"}) || !reflect.DeepEqual(page.Next, []string{"b"}) {
+		t.Errorf("expected items [a b] next [b], got %v next %v", page.Items, page.Next)
+	}
+
+	page = pagination.Slice([]string{"a", "b"}, r, key)
+	if len(page.Items) != 2 || page.Next != nil {
+		t.Errorf("expected the last page to have no next, got %v next %v", page.Items, page.Next)
+	}
+
+	page = pagination.Slice[string](nil, r, key)
+	if page.Items == nil || len(page.Items) != 0 {
+		t.Errorf("expected an empty, non-nil page, got %#v", page.Items)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	u, _ := url.Parse("/api/v1/alarms?status=raised&page=2&per_page=10")
+	r := pagination.Request{Limit: 10, Offset: 10}
+
+	links := pagination.Links(u, r, []string{"2026-05-01T08:00:00Z", "a1"})
+	first := `</api/v1/alarms?limit=10&status=raised>; rel="first"`
+	next := `</api/v1/alarms?cursor=` + pagination.EncodeCursor([]string{"2026-05-01T08:00:00Z", "a1"}) + `&limit=10&status=raised>; rel="next"`
+	if links != first+", "+next {
+		t.Errorf("unexpected links: %s", links)
+	}
+
+	if links := pagination.Links(u, r, nil); strings.Contains(links, `rel="next"`) {
+		t.Errorf("expected no next link on the last page, got %s", links)
+	}
+}
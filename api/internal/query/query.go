@@ -0,0 +1,231 @@
+// Package query reads the filters and sort order of a list request.
+//
+// Filters combine with AND: ?field=value matches a value, repeating the
+// field or writing ?field[in]=a,b matches any of several, and
+// ?field[gte]=, [gt]=, [lte]= and [lt]= bound a timestamp. ?sort=field
+// sorts ascending and ?sort=-field descending. Only the fields a list's
+// Schema names are accepted; parameters it does not name, such as the
+// page size, are left to other readers.
+package query
+
+import (
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Type is how a field may be filtered.
+type Type int
+
+const (
+	// Text fields match a value or, with [in], any of several.
+	Text Type = iota + 1
+	// Time fields are bounded by RFC 3339 timestamps.
+	Time
+)
+
+// Op compares a field with the values of a filter.
+type Op string
+
+const (
+	Eq  Op = "eq"
+	In  Op = "in"
+	Gte Op = "gte"
+	Gt  Op = "gt"
+	Lte Op = "lte"
+	Lt  Op = "lt"
+)
+
+// Field is a filterable or sortable field of a list.
+type Field struct {
+	// Column is the SQL the field maps to.
+	Column string
+	// Type is how the field may be filtered. The zero Type cannot be.
+	Type Type
+	// Values, if set, are the only values a Text field may take.
+	Values []string
+	// Sortable allows ?sort= on the field. Its column must not be NULL.
+	Sortable bool
+	// Order is the SQL the list is sorted by when it is not Column alone,
+	// such as a COALESCE placing NULLs or a tie-breaking second column.
+	Order []string
+}
+
+// Schema names the fields of a list a client may filter and sort on.
+type Schema struct {
+	Fields map[string]Field
+	// Sort is the order of the list when none is asked for.
+	Sort Sort
+	// Aliases maps shorthand parameters to the filters they stand for,
+	// such as "since" to "raised_at[gte]".
+	Aliases map[string]string
+}
+
+// Filter narrows a list to the rows whose field compares with Values.
+// Eq and the range operators take one value, In any number.
+type Filter struct {
+	Field  string
+	Op     Op
+	Values []string
+}
+
+// Sort orders a list on one field.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Spec is the filters and sort order of a list request.
+type Spec struct {
+	Filters []Filter
+	// Sort is the order asked for, or zero for the list's default.
+	Sort Sort
+}
+
+// Equal returns the values an Eq or In filter restricts field to.
+func (s Spec) Equal(field string) []string {
+	var values []string
+	for _, f := range s.Filters {
+		if f.Field == field && (f.Op == Eq || f.Op == In) {
+			values = append(values, f.Values...)
+		}
+	}
+	return values
+}
+
+// Error describes a query parameter that is not valid for the list.
+type Error struct {
+	Param   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Param + " " + e.Message
+}
+
+func invalid(param, message string) error {
+	return &Error{Param: param, Message: message}
+}
+
+// Parse reads the filters and sort order of a list with schema s from q.
+// Empty values are ignored, so ?status= matches every status.
+func Parse(q url.Values, s Schema) (Spec, error) {
+	var spec Spec
+	params := make([]string, 0, len(q))
+	for param := range q {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	for _, param := range params {
+		if param == "sort" {
+			order, err := parseSort(q.Get(param), s)
+			if err != nil {
+				return Spec{}, err
+			}
+			spec.Sort = order
+			continue
+		}
+
+		key := param
+		if alias, ok := s.Aliases[param]; ok {
+			key = alias
+		}
+		name, op := key, Eq
+		if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+			name, op = key[:i], Op(key[i+1:len(key)-1])
+		}
+		field, ok := s.Fields[name]
+		if !ok || field.Type == 0 {
+			if name != key {
+				return Spec{}, invalid(param, "is not a filter of this list")
+			}
+			continue
+		}
+
+		values := nonEmpty(q[param])
+		if len(values) == 0 {
+			continue
+		}
+		filters, err := field.filters(param, name, op, values)
+		if err != nil {
+			return Spec{}, err
+		}
+		spec.Filters = append(spec.Filters, filters...)
+	}
+	return spec, nil
+}
+
+// filters checks the values given for a field with op and returns the
+// filters they make.
+func (f Field) filters(param, name string, op Op, values []string) ([]Filter, error) {
+	switch f.Type {
+	case Text:
+		switch op {
+		case Eq:
+			if len(values) > 1 {
+				op = In
+			}
+		case In:
+			var split []string
+			for _, v := range values {
+				split = append(split, nonEmpty(strings.Split(v, ","))...)
+			}
+			values = split
+		default:
+			return nil, invalid(param, "can only be matched by value or with [in]")
+		}
+		for _, v := range values {
+			if f.Values != nil && !slices.Contains(f.Values, v) {
+				return nil, invalid(param, "must be one of "+strings.Join(f.Values, ", "))
+			}
+		}
+		return []Filter{{Field: name, Op: op, Values: values}}, nil
+
+	case Time:
+		switch op {
+		case Gte, Gt, Lte, Lt:
+		default:
+			return nil, invalid(param, "must be bounded with [gte], [gt], [lte] or [lt]")
+		}
+		filters := make([]Filter, len(values))
+		for i, v := range values {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				return nil, invalid(param, "must be an RFC 3339 timestamp")
+			}
+			filters[i] = Filter{Field: name, Op: op, Values: []string{v}}
+		}
+		return filters, nil
+	}
+	return nil, invalid(param, "is not a filter of this list")
+}
+
+func parseSort(raw string, s Schema) (Sort, error) {
+	if raw == "" {
+		return Sort{}, nil
+	}
+	order := Sort{Field: strings.TrimPrefix(raw, "-"), Desc: strings.HasPrefix(raw, "-")}
+	if field, ok := s.Fields[order.Field]; !ok || !field.Sortable {
+		var sortable []string
+		for name, field := range s.Fields {
+			if field.Sortable {
+				sortable = append(sortable, name)
+			}
+		}
+		sort.Strings(sortable)
+		return Sort{}, invalid("sort", "must be one of "+strings.Join(sortable, ", ")+", optionally prefixed with -")
+	}
+	return order, nil
+}
+
+func nonEmpty(values []string) []string {
+	var kept []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,104 @@
+package query_test
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+)
+
+var shifts = query.Schema{
+	Fields: map[string]query.Field{
+		"worksite_id": {Column: "worksite_id", Type: query.Text},
+		"status":      {Column: "status", Type: query.Text, Values: []string{"open", "filled"}},
+		"title":       {Column: "title", Sortable: true},
+		"start_time":  {Column: "start_time", Type: query.Time, Sortable: true},
+	},
+	Sort:    query.Sort{Field: "start_time", Desc: true},
+	Aliases: map[string]string{"since": "start_time[gte]"},
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  query.Spec
+	}{
+		{"", query.Spec{}},
+		{"limit=10&status=", query.Spec{}},
+		{"worksite_id=w1", query.Spec{Filters: []query.Filter{
+			{Field: "worksite_id", Op: query.Eq, Values: []string{"w1"}},
+		}}},
+		{"worksite_id=w1&worksite_id=w2", query.Spec{Filters: []query.Filter{
+			{Field: "worksite_id", Op: query.In, Values: []string{"w1", "w2"}},
+		}}},
+		{"status[in]=open,filled&worksite_id=w1", query.Spec{Filters: []query.Filter{
+			{Field: "status", Op: query.In, Values: []string{"open", "filled"}},
+			{Field: "worksite_id", Op: query.Eq, Values: []string{"w1"}},
+		}}},
+		{"start_time[gte]=2026-05-01T00:00:00Z&start_time[lt]=2026-06-01T00:00:00Z", query.Spec{Filters: []query.Filter{
+			{Field: "start_time", Op: query.Gte, Values: []string{"2026-05-01T00:00:00Z"}},
+			{Field: "start_time", Op: query.Lt, Values: []string{"2026-06-01T00:00:00Z"}},
+		}}},
+		{"since=2026-05-01T00:00:00Z", query.Spec{Filters: []query.Filter{
+			{Field: "start_time", Op: query.Gte, Values: []string{"2026-05-01T00:00:00Z"}},
+		}}},
+		{"sort=title", query.Spec{Sort: query.Sort{Field: "title"}}},
+		{"sort=-start_time", query.Spec{Sort: query.Sort{Field: "start_time", Desc: true}}},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		got, err := query.Parse(q, shifts)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.query, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %+v, got %+v", tt.query, tt.want, got)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		query string
+		param string
+	}{
+		{"status=closed", "status"},
+		{"status[in]=open,closed", "status[in]"},
+		{"status[gte]=open", "status[gte]"},
+		{"start_time=2026-05-01T00:00:00Z", "start_time"},
+		{"start_time[gte]=yesterday", "start_time[gte]"},
+		{"since=yesterday", "since"},
+		{"title[in]=a", "title[in]"},
+		{"created_by[in]=a", "created_by[in]"},
+		{"sort=status", "sort"},
+		{"sort=-", "sort"},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		_, err := query.Parse(q, shifts)
+		var qerr *query.Error
+		if !errors.As(err, &qerr) {
+			t.Errorf("%q: expected a query error, got %v", tt.query, err)
+			continue
+		}
+		if qerr.Param != tt.param {
+			t.Errorf("%q: expected the error on %q, got %q", tt.query, tt.param, qerr.Param)
+		}
+	}
+}
+
+func TestSpec_Equal(t *testing.T) {
+	spec := query.Spec{Filters: []query.Filter{
+		{Field: "worksite_id", Op: query.Eq, Values: []string{"w1"}},
+		{Field: "worksite_id", Op: query.In, Values: []string{"w2", "w3"}},
+		{Field: "start_time", Op: query.Gte, Values: []string{"2026-05-01T00:00:00Z"}},
+	}}
+	if got := spec.Equal("worksite_id"); !reflect.DeepEqual(got, []string{"w1", "w2", "w3"}) {
+		t.Errorf("expected every matched worksite, got %v", got)
+	}
+	if got := spec.Equal("start_time"); got != nil {
+		t.Errorf("expected a range not to count as equality, got %v", got)
+	}
+}
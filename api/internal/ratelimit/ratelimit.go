@@ -0,0 +1,147 @@
+// Package ratelimit throttles callers with token buckets, each route group
+// drawing on buckets of its own, and keeps a priority lane that no other
+// traffic can exhaust.
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+)
+
+// Store keeps token buckets. Take removes a token from key's bucket, which
+// holds up to limit.Requests tokens and refills at that rate each
+// limit.Period, reporting whether one was available and, when not, how long
+// until one will be.
+type Store interface {
+	Take(ctx context.Context, key string, limit config.Limit) (bool, time.Duration, error)
+}
+
+// Group is a set of routes sharing a limit. Requests match a group by
+// method, when it names one, and by path prefix.
+type Group struct {
+	Name   string
+	Method string
+	Prefix string
+	Limit  config.Limit
+	// Priority groups draw only on their own buckets and have an in-flight
+	// budget of their own, so no other traffic can exhaust either.
+	Priority bool
+}
+
+func (g Group) matches(r *http.Request) bool {
+	if g.Method != "" && r.Method != g.Method {
+		return false
+	}
+	return r.URL.Path == g.Prefix || strings.HasPrefix(r.URL.Path, g.Prefix+"/")
+}
+
+// Decision is the outcome of Limiter.Allow. When a request is refused,
+// Limit names the limit it hit: "caller" or "ip".
+type Decision struct {
+	Allowed    bool
+	Limit      string
+	RetryAfter time.Duration
+}
+
+// Limiter applies the API's rate limits.
+type Limiter struct {
+	store    Store
+	groups   []Group
+	fallback Group
+	perIP    config.Limit
+	inFlight chan struct{}
+	// priorityInFlight is the priority lane's own in-flight budget.
+	priorityInFlight chan struct{}
+}
+
+// New creates a limiter keeping its buckets in store. Raising an alarm is
+// the priority lane, with buckets and an in-flight budget of its own; check-ins and the sign-in routes have limits of their
+// own, and every other route shares the default one.
+func New(store Store, cfg config.RateLimitConfig) *Limiter {
+	l := &Limiter{
+		store: store,
+		groups: []Group{
+			{Name: "alarms", Method: http.MethodPost, Prefix: "/api/v1/alarms", Limit: cfg.Alarms, Priority: true},
+			{Name: "check-ins", Method: http.MethodPost, Prefix: "/api/v1/check-ins", Limit: cfg.CheckIns},
+			{Name: "auth", Prefix: "/api/v1/auth", Limit: cfg.Auth},
+		},
+		fallback: Group{Name: "default", Limit: cfg.Default},
+		perIP:    cfg.PerIP,
+	}
+	if cfg.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, cfg.MaxInFlight)
+	}
+	if cfg.AlarmsMaxInFlight > 0 {
+		l.priorityInFlight = make(chan struct{}, cfg.AlarmsMaxInFlight)
+	}
+	return l
+}
+
+// Group returns the group r belongs to.
+func (l *Limiter) Group(r *http.Request) Group {
+	for _, g := range l.groups {
+		if g.matches(r) {
+			return g
+		}
+	}
+	return l.fallback
+}
+
+// AllowIP takes a token for a request in g from ip's bucket, shared by
+// every caller behind that address, before the caller is authenticated so
+// that requests with invalid credentials are limited too. The priority lane
+// has a bucket per address of its own.
+func (l *Limiter) AllowIP(ctx context.Context, g Group, ip string) (Decision, error) {
+	key := "ip|" + ip
+	if g.Priority {
+		key = g.Name + "|" + key
+	}
+	return l.take(ctx, key, l.perIP, "ip")
+}
+
+// Allow takes a token for a request in g from its caller's bucket, keyed by
+// subject or, for an anonymous caller, by ip.
+func (l *Limiter) Allow(ctx context.Context, g Group, subject, ip string) (Decision, error) {
+	caller := "ip:" + ip
+	if subject != "" {
+		caller = "sub:" + subject
+	}
+	return l.take(ctx, g.Name+"|"+caller, g.Limit, "caller")
+}
+
+func (l *Limiter) take(ctx context.Context, key string, limit config.Limit, name string) (Decision, error) {
+	if limit.Requests == 0 {
+		return Decision{Allowed: true}, nil
+	}
+	ok, retryAfter, err := l.store.Take(ctx, key, limit)
+	if err != nil {
+		return Decision{}, err
+	}
+	if !ok {
+		return Decision{Limit: name, RetryAfter: retryAfter}, nil
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// Enter admits a request in g unless the most allowed for its lane are
+// already in flight. The returned function must be called when the request
+// is done.
+func (l *Limiter) Enter(g Group) (func(), bool) {
+	inFlight := l.inFlight
+	if g.Priority {
+		inFlight = l.priorityInFlight
+	}
+	if inFlight == nil {
+		return func() {}, true
+	}
+	select {
+	case inFlight <- struct{}{}:
+		return func() { <-inFlight }, true
+	default:
+		return nil, false
+	}
+}
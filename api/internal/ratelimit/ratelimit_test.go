@@ -0,0 +1,163 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/ratelimit"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := config.Limit{Requests: 2, Period: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := store.Take(context.Background(), "k", limit); !ok {
+			t.Fatalf("expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	ok, retryAfter, err := store.Take(context.Background(), "k", limit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Fatal("expected the empty bucket to refuse")
+	}
+	// One token refills every half hour.
+	if retryAfter < 29*time.Minute || retryAfter > 30*time.Minute {
+		t.Errorf("expected retry after about 30m, got %v", retryAfter)
+	}
+
+	if ok, _, _ := store.Take(context.Background(), "other", limit); !ok {
+		t.Error("expected another key's bucket to be full")
+	}
+}
+
+func TestMemoryStore_Refills(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := config.Limit{Requests: 1, Period: 20 * time.Millisecond}
+
+	store.Take(context.Background(), "k", limit)
+	if ok, _, _ := store.Take(context.Background(), "k", limit); ok {
+		t.Fatal("expected the empty bucket to refuse")
+	}
+	time.Sleep(25 * time.Millisecond)
+	if ok, _, _ := store.Take(context.Background(), "k", limit); !ok {
+		t.Error("expected the bucket to have refilled")
+	}
+}
+
+func testConfig() config.RateLimitConfig {
+	return config.RateLimitConfig{
+		Default:           config.Limit{Requests: 100, Period: time.Minute},
+		CheckIns:          config.Limit{Requests: 2, Period: time.Minute},
+		Alarms:            config.Limit{Requests: 5, Period: time.Minute},
+		Auth:              config.Limit{Requests: 100, Period: time.Minute},
+		PerIP:             config.Limit{Requests: 3, Period: time.Minute},
+		MaxInFlight:       1,
+		AlarmsMaxInFlight: 1,
+	}
+}
+
+func TestLimiter_Group(t *testing.T) {
+	l := ratelimit.New(ratelimit.NewMemoryStore(), testConfig())
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodPost, "/api/v1/alarms/", "alarms"},
+		{http.MethodPost, "/api/v1/alarms", "alarms"},
+		{http.MethodGet, "/api/v1/alarms/", "default"},
+		{http.MethodPatch, "/api/v1/alarms/a1/acknowledge", "default"},
+		{http.MethodPost, "/api/v1/check-ins/", "check-ins"},
+		{http.MethodGet, "/api/v1/auth/login", "auth"},
+		{http.MethodPost, "/api/v1/alarmsx", "default"},
+		{http.MethodGet, "/api/v1/shifts/", "default"},
+	}
+	for _, tt := range tests {
+		got := l.Group(httptest.NewRequest(tt.method, tt.path, nil)).Name
+		if got != tt.want {
+			t.Errorf("%s %s: expected group %q, got %q", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestLimiter_PriorityLane(t *testing.T) {
+	l := ratelimit.New(ratelimit.NewMemoryStore(), testConfig())
+	checkIns := l.Group(httptest.NewRequest(http.MethodPost, "/api/v1/check-ins/", nil))
+	alarms := l.Group(httptest.NewRequest(http.MethodPost, "/api/v1/alarms/", nil))
+	ctx := context.Background()
+
+	// A caller flooding check-ins exhausts their own check-in bucket.
+	for i := 0; i < 2; i++ {
+		if d, _ := l.Allow(ctx, checkIns, "worker-1", "10.0.0.1"); !d.Allowed {
+			t.Fatalf("expected check-in %d to be allowed", i+1)
+		}
+	}
+	d, _ := l.Allow(ctx, checkIns, "worker-1", "10.0.0.1")
+	if d.Allowed || d.Limit != "caller" {
+		t.Fatalf("expected the third check-in to hit the caller limit, got %+v", d)
+	}
+
+	// The per-IP bucket is shared by every request from the address.
+	for i := 0; i < 3; i++ {
+		l.AllowIP(ctx, checkIns, "10.0.0.1")
+	}
+	d, _ = l.AllowIP(ctx, checkIns, "10.0.0.1")
+	if d.Allowed || d.Limit != "ip" {
+		t.Fatalf("expected the shared address to hit the IP limit, got %+v", d)
+	}
+
+	// Alarms draw on neither, but on buckets of their own.
+	for _, worker := range []string{"worker-1", "worker-2"} {
+		if d, _ := l.AllowIP(ctx, alarms, "10.0.0.1"); !d.Allowed {
+			t.Errorf("expected %s's alarm to pass the IP limit, got %+v", worker, d)
+		}
+		if d, _ := l.Allow(ctx, alarms, worker, "10.0.0.1"); !d.Allowed {
+			t.Errorf("expected %s's alarm to be allowed, got %+v", worker, d)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		l.Allow(ctx, alarms, "worker-1", "10.0.0.1")
+	}
+	d, _ = l.Allow(ctx, alarms, "worker-1", "10.0.0.1")
+	if d.Allowed || d.Limit != "caller" {
+		t.Errorf("expected a caller flooding alarms to hit their alarm limit, got %+v", d)
+	}
+
+	// Nor do they count against the in-flight cap, only their own budget.
+	release, ok := l.Enter(checkIns)
+	if !ok {
+		t.Fatal("expected the first request to be admitted")
+	}
+	if _, ok := l.Enter(checkIns); ok {
+		t.Error("expected a second check-in to exceed the in-flight cap")
+	}
+	releaseAlarm, ok := l.Enter(alarms)
+	if !ok {
+		t.Error("expected an alarm to be admitted past the in-flight cap")
+	}
+	if _, ok := l.Enter(alarms); ok {
+		t.Error("expected a second alarm to exceed the alarms' in-flight budget")
+	}
+	release()
+	releaseAlarm()
+	if _, ok := l.Enter(checkIns); !ok {
+		t.Error("expected a check-in to be admitted once the first finished")
+	}
+}
+
+func TestLimiter_ZeroLimitAllows(t *testing.T) {
+	l := ratelimit.New(ratelimit.NewMemoryStore(), config.RateLimitConfig{})
+	g := l.Group(httptest.NewRequest(http.MethodGet, "/api/v1/shifts/", nil))
+
+	for i := 0; i < 10; i++ {
+		if d, _ := l.Allow(context.Background(), g, "", "10.0.0.1"); !d.Allowed {
+			t.Fatalf("expected an unset limit to allow everything, got %+v", d)
+		}
+	}
+}
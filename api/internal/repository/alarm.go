@@ -7,71 +7,91 @@ import (
 	"time"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 // AlarmRepository defines the interface for alarm data access.
 type AlarmRepository interface {
-	List(ctx context.Context, limit, offset int) ([]model.Alarm, error)
-	ListByStatus(ctx context.Context, status model.AlarmStatus, limit, offset int) ([]model.Alarm, error)
+	List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Alarm], error)
 	ListByWorker(ctx context.Context, workerID string) ([]model.Alarm, error)
+	ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Alarm], error)
 	GetByID(ctx context.Context, id string) (*model.Alarm, error)
 	Create(ctx context.Context, alarm *model.Alarm) error
-	UpdateStatus(ctx context.Context, id string, status model.AlarmStatus) error
+	UpdateStatus(ctx context.Context, id string, status model.AlarmStatus, version int) error
 }
 
 type alarmRepo struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewAlarmRepository creates a new AlarmRepository.
-func NewAlarmRepository(db *sql.DB) AlarmRepository {
+func NewAlarmRepository(db Querier) AlarmRepository {
 	return &alarmRepo{db: db}
 }
 
-func (r *alarmRepo) List(ctx context.Context, limit, offset int) ([]model.Alarm, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, worker_id, shift_id, latitude, longitude, message, status, raised_at, acknowledged_at, resolved_at
-		 FROM alarms ORDER BY raised_at DESC LIMIT $1 OFFSET $2`, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list alarms: %w", err)
-	}
-	defer rows.Close()
+// alarmColumns are the columns scanAlarm reads.
+const alarmColumns = `id, worker_id, shift_id, latitude, longitude, message, status, version, raised_at, acknowledged_at, resolved_at`
 
-	var alarms []model.Alarm
-	for rows.Next() {
-		var a model.Alarm
-		if err := rows.Scan(&a.ID, &a.WorkerID, &a.ShiftID, &a.Latitude, &a.Longitude, &a.Message, &a.Status, &a.RaisedAt, &a.AcknowledgedAt, &a.ResolvedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan alarm: %w", err)
-		}
-		alarms = append(alarms, a)
-	}
-	return alarms, rows.Err()
+// AlarmQuery is the filters and sort orders of alarm lists, newest first by
+// default. ?since= and ?until= bound the time an alarm was raised.
+var AlarmQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"worker_id": {Column: "worker_id", Type: query.Text},
+		"shift_id":  {Column: "shift_id", Type: query.Text},
+		"status": {Column: "status", Type: query.Text, Values: []string{
+			string(model.AlarmRaised), string(model.AlarmAcknowledged), string(model.AlarmResolved)}},
+		"raised_at":       {Column: "raised_at", Type: query.Time, Sortable: true},
+		"acknowledged_at": {Column: "acknowledged_at", Type: query.Time},
+		"resolved_at":     {Column: "resolved_at", Type: query.Time},
+	},
+	Sort:    query.Sort{Field: "raised_at", Desc: true},
+	Aliases: map[string]string{"since": "raised_at[gte]", "until": "raised_at[lt]"},
 }
 
-func (r *alarmRepo) ListByStatus(ctx context.Context, status model.AlarmStatus, limit, offset int) ([]model.Alarm, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, worker_id, shift_id, latitude, longitude, message, status, raised_at, acknowledged_at, resolved_at
-		 FROM alarms WHERE status = $1 ORDER BY raised_at DESC LIMIT $2 OFFSET $3`,
-		status, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list alarms by status: %w", err)
+func scanAlarm(row rowScanner) (model.Alarm, error) {
+	var a model.Alarm
+	if err := row.Scan(&a.ID, &a.WorkerID, &a.ShiftID, &a.Latitude, &a.Longitude, &a.Message, &a.Status, &a.Version, &a.RaisedAt, &a.AcknowledgedAt, &a.ResolvedAt); err != nil {
+		return a, fmt.Errorf("failed to scan alarm: %w", err)
 	}
-	defer rows.Close()
+	return a, nil
+}
 
-	var alarms []model.Alarm
-	for rows.Next() {
-		var a model.Alarm
-		if err := rows.Scan(&a.ID, &a.WorkerID, &a.ShiftID, &a.Latitude, &a.Longitude, &a.Message, &a.Status, &a.RaisedAt, &a.AcknowledgedAt, &a.ResolvedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan alarm: %w", err)
-		}
-		alarms = append(alarms, a)
+var alarmListing = listing[model.Alarm]{
+	columns: alarmColumns,
+	from:    "alarms",
+	schema:  AlarmQuery,
+	scan:    scanAlarm,
+	keys: map[string]func(model.Alarm) []string{
+		"raised_at": func(a model.Alarm) []string { return []string{timeKey(a.RaisedAt)} },
+	},
+	unique: "id",
+	id:     func(a model.Alarm) string { return a.ID },
+}
+
+// List returns a page of alarms matching spec, limited to companyID's when
+// it is set: those on its shifts, and those outside a shift raised by its
+// active members.
+func (r *alarmRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Alarm], error) {
+	var cond conditions
+	if companyID != "" {
+		cond.add(`? IN (
+			SELECT ws.company_id FROM shifts s JOIN worksites ws ON ws.id = s.worksite_id
+			WHERE s.id = alarms.shift_id
+			UNION ALL
+			SELECT wc.company_id FROM worker_companies wc
+			WHERE alarms.shift_id IS NULL AND wc.worker_id = alarms.worker_id AND wc.status = 'active')`, companyID)
 	}
-	return alarms, rows.Err()
+	page, err := alarmListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alarms: %w", err)
+	}
+	return page, nil
 }
 
 func (r *alarmRepo) ListByWorker(ctx context.Context, workerID string) ([]model.Alarm, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, worker_id, shift_id, latitude, longitude, message, status, raised_at, acknowledged_at, resolved_at
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, worker_id, shift_id, latitude, longitude, message, status, version, raised_at, acknowledged_at, resolved_at
 		 FROM alarms WHERE worker_id = $1 ORDER BY raised_at DESC`,
 		workerID)
 	if err != nil {
@@ -82,7 +102,7 @@ func (r *alarmRepo) ListByWorker(ctx context.Context, workerID string) ([]model.
 	var alarms []model.Alarm
 	for rows.Next() {
 		var a model.Alarm
-		if err := rows.Scan(&a.ID, &a.WorkerID, &a.ShiftID, &a.Latitude, &a.Longitude, &a.Message, &a.Status, &a.RaisedAt, &a.AcknowledgedAt, &a.ResolvedAt); err != nil {
+		if err := rows.Scan(&a.ID, &a.WorkerID, &a.ShiftID, &a.Latitude, &a.Longitude, &a.Message, &a.Status, &a.Version, &a.RaisedAt, &a.AcknowledgedAt, &a.ResolvedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan alarm: %w", err)
 		}
 		alarms = append(alarms, a)
@@ -92,10 +112,10 @@ func (r *alarmRepo) ListByWorker(ctx context.Context, workerID string) ([]model.
 
 func (r *alarmRepo) GetByID(ctx context.Context, id string) (*model.Alarm, error) {
 	var a model.Alarm
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, worker_id, shift_id, latitude, longitude, message, status, raised_at, acknowledged_at, resolved_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, worker_id, shift_id, latitude, longitude, message, status, version, raised_at, acknowledged_at, resolved_at
 		 FROM alarms WHERE id = $1`, id).
-		Scan(&a.ID, &a.WorkerID, &a.ShiftID, &a.Latitude, &a.Longitude, &a.Message, &a.Status, &a.RaisedAt, &a.AcknowledgedAt, &a.ResolvedAt)
+		Scan(&a.ID, &a.WorkerID, &a.ShiftID, &a.Latitude, &a.Longitude, &a.Message, &a.Status, &a.Version, &a.RaisedAt, &a.AcknowledgedAt, &a.ResolvedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -106,12 +126,12 @@ func (r *alarmRepo) GetByID(ctx context.Context, id string) (*model.Alarm, error
 }
 
 func (r *alarmRepo) Create(ctx context.Context, alarm *model.Alarm) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO alarms (worker_id, shift_id, latitude, longitude, message, status)
 		 VALUES ($1, $2, $3, $4, $5, 'raised')
-		 RETURNING id, raised_at`,
+		 RETURNING id, version, raised_at`,
 		alarm.WorkerID, alarm.ShiftID, alarm.Latitude, alarm.Longitude, alarm.Message).
-		Scan(&alarm.ID, &alarm.RaisedAt)
+		Scan(&alarm.ID, &alarm.Version, &alarm.RaisedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create alarm: %w", err)
 	}
@@ -119,20 +139,32 @@ func (r *alarmRepo) Create(ctx context.Context, alarm *model.Alarm) error {
 	return nil
 }
 
-func (r *alarmRepo) UpdateStatus(ctx context.Context, id string, status model.AlarmStatus) error {
+func (r *alarmRepo) UpdateStatus(ctx context.Context, id string, status model.AlarmStatus, version int) error {
 	var query string
 	switch status {
 	case model.AlarmAcknowledged:
-		query = `UPDATE alarms SET status = $1, acknowledged_at = $2 WHERE id = $3`
+		query = `UPDATE alarms SET status = $1, acknowledged_at = $2, version = version + 1
+			WHERE id = $3 AND ($4 = 0 OR version = $4)`
 	case model.AlarmResolved:
-		query = `UPDATE alarms SET status = $1, resolved_at = $2 WHERE id = $3`
+		query = `UPDATE alarms SET status = $1, resolved_at = $2, version = version + 1
+			WHERE id = $3 AND ($4 = 0 OR version = $4)`
 	default:
 		return fmt.Errorf("unsupported status transition: %s", status)
 	}
 
-	_, err := r.db.ExecContext(ctx, query, status, time.Now(), id)
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, status, time.Now(), id, version)
 	if err != nil {
 		return fmt.Errorf("failed to update alarm status: %w", err)
 	}
-	return nil
+	return matched(res)
+}
+
+func (r *alarmRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Alarm], error) {
+	var cond conditions
+	cond.add("worker_id = ?", workerID)
+	page, err := alarmListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alarms by worker: %w", err)
+	}
+	return page, nil
 }
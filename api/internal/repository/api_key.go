@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+)
+
+type APIKeyRepository interface {
+	ListByCompany(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.APIKey], error)
+	GetByID(ctx context.Context, id string) (*model.APIKey, error)
+	GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	// Create inserts key, with the ID already assigned, together with the
+	// service-account worker it acts as and that worker's membership of
+	// key.CompanyID in key.Role.
+	Create(ctx context.Context, key *model.APIKey, account *model.Worker) error
+	// Revoke marks the key revoked. The service account and its membership
+	// are kept so alarms and check-ins it recorded stay visible.
+	Revoke(ctx context.Context, id string) error
+	TouchLastUsed(ctx context.Context, id string) error
+}
+
+type apiKeyRepo struct {
+	db Querier
+}
+
+func NewAPIKeyRepository(db Querier) APIKeyRepository {
+	return &apiKeyRepo{db: db}
+}
+
+const apiKeyColumns = `id, company_id, worker_id, name, prefix, key_hash, scopes, role, created_by,
+	expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row rowScanner, k *model.APIKey) error {
+	return row.Scan(&k.ID, &k.CompanyID, &k.WorkerID, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&k.Scopes), &k.Role, &k.CreatedBy,
+		&k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt)
+}
+
+// APIKeyQuery is the filters and sort orders of the API key list, newest
+// first by default.
+var APIKeyQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"worker_id":  {Column: "worker_id", Type: query.Text},
+		"name":       {Column: "name", Sortable: true},
+		"created_at": {Column: "created_at", Type: query.Time, Sortable: true},
+		"expires_at": {Column: "expires_at", Type: query.Time},
+		"revoked_at": {Column: "revoked_at", Type: query.Time},
+	},
+	Sort: query.Sort{Field: "created_at", Desc: true},
+}
+
+var apiKeyListing = listing[model.APIKey]{
+	columns: apiKeyColumns,
+	from:    "api_keys",
+	schema:  APIKeyQuery,
+	scan: func(row rowScanner) (model.APIKey, error) {
+		var k model.APIKey
+		if err := scanAPIKey(row, &k); err != nil {
+			return k, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		return k, nil
+	},
+	keys: map[string]func(model.APIKey) []string{
+		"name":       func(k model.APIKey) []string { return []string{k.Name} },
+		"created_at": func(k model.APIKey) []string { return []string{timeKey(k.CreatedAt)} },
+	},
+	unique: "id",
+	id:     func(k model.APIKey) string { return k.ID },
+}
+
+func (r *apiKeyRepo) ListByCompany(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.APIKey], error) {
+	var cond conditions
+	cond.add("company_id = ?", companyID)
+	page, err := apiKeyListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return page, nil
+}
+
+func (r *apiKeyRepo) GetByID(ctx context.Context, id string) (*model.APIKey, error) {
+	return r.get(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id)
+}
+
+func (r *apiKeyRepo) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	return r.get(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, keyHash)
+}
+
+func (r *apiKeyRepo) get(ctx context.Context, query, arg string) (*model.APIKey, error) {
+	var k model.APIKey
+	err := scanAPIKey(conn(ctx, r.db).QueryRowContext(ctx, query, arg), &k)
+	if err == sql.ErrNoRows || isInvalidID(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return &k, nil
+}
+
+func (r *apiKeyRepo) Create(ctx context.Context, key *model.APIKey, account *model.Worker) error {
+	return inTx(ctx, r.db, func(q Querier) error {
+		if err := insertWorker(ctx, q, account); err != nil {
+			return fmt.Errorf("failed to create service account: %w", err)
+		}
+
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO worker_companies (worker_id, company_id, role, status)
+			VALUES ($1, $2, $3, $4)`,
+			account.ID, key.CompanyID, key.Role, model.MembershipActive)
+		if err != nil {
+			return fmt.Errorf("failed to create service account membership: %w", err)
+		}
+
+		key.WorkerID = account.ID
+		err = q.QueryRowContext(ctx,
+			`INSERT INTO api_keys (id, company_id, worker_id, name, prefix, key_hash, scopes, role, created_by, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING created_at`,
+			key.ID, key.CompanyID, key.WorkerID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.Role,
+			key.CreatedBy, key.ExpiresAt).
+			Scan(&key.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create api key: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *apiKeyRepo) Revoke(ctx context.Context, id string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	return nil
+}
+
+func (r *apiKeyRepo) TouchLastUsed(ctx context.Context, id string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to record api key use: %w", err)
+	}
+	return nil
+}
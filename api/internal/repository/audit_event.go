@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+)
+
+// AuditEventRepository stores the audit log. Events can only be added and
+// read; the table rejects updates and deletes.
+type AuditEventRepository interface {
+	List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.AuditEvent], error)
+	Create(ctx context.Context, event *model.AuditEvent) error
+}
+
+type auditEventRepo struct {
+	db Querier
+}
+
+// NewAuditEventRepository creates a new AuditEventRepository.
+func NewAuditEventRepository(db Querier) AuditEventRepository {
+	return &auditEventRepo{db: db}
+}
+
+// AuditEventQuery is the filters and sort order of the audit log, newest
+// first by default. ?since= and ?until= bound the time of the change.
+var AuditEventQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"action":        {Column: "action", Type: query.Text},
+		"resource_type": {Column: "resource_type", Type: query.Text},
+		"resource_id":   {Column: "resource_id", Type: query.Text},
+		"actor_id":      {Column: "actor_worker_id", Type: query.Text},
+		"api_key_id":    {Column: "api_key_id", Type: query.Text},
+		"occurred_at":   {Column: "occurred_at", Type: query.Time, Sortable: true},
+	},
+	Sort:    query.Sort{Field: "occurred_at", Desc: true},
+	Aliases: map[string]string{"since": "occurred_at[gte]", "until": "occurred_at[lt]"},
+}
+
+var auditEventListing = listing[model.AuditEvent]{
+	columns: auditEventColumns,
+	from:    "audit_events",
+	schema:  AuditEventQuery,
+	scan:    scanAuditEvent,
+	keys: map[string]func(model.AuditEvent) []string{
+		"occurred_at": func(e model.AuditEvent) []string { return []string{timeKey(e.OccurredAt)} },
+	},
+	unique: "id",
+	id:     func(e model.AuditEvent) string { return e.ID },
+}
+
+// List returns a page of the events filed under companyID.
+func (r *auditEventRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.AuditEvent], error) {
+	var cond conditions
+	cond.add("? = ANY (company_ids)", companyID)
+	page, err := auditEventListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return page, nil
+}
+
+const auditEventColumns = `id, occurred_at, actor_worker_id, actor_subject, api_key_id, action, resource_type,
+	resource_id, company_ids, before, after, ip, request_id`
+
+func scanAuditEvent(row rowScanner) (model.AuditEvent, error) {
+	var e model.AuditEvent
+	var before, after []byte
+	if err := row.Scan(&e.ID, &e.OccurredAt, &e.ActorWorkerID, &e.ActorSubject, &e.APIKeyID, &e.Action,
+		&e.ResourceType, &e.ResourceID, pq.Array(&e.CompanyIDs), &before, &after, &e.IP, &e.RequestID); err != nil {
+		return e, fmt.Errorf("failed to scan audit event: %w", err)
+	}
+	e.Before, e.After = before, after
+	return e, nil
+}
+
+func (r *auditEventRepo) Create(ctx context.Context, e *model.AuditEvent) error {
+	companyIDs := e.CompanyIDs
+	if companyIDs == nil {
+		companyIDs = []string{}
+	}
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`INSERT INTO audit_events (actor_worker_id, actor_subject, api_key_id, action, resource_type,
+			resource_id, company_ids, before, after, ip, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, occurred_at`,
+		e.ActorWorkerID, e.ActorSubject, e.APIKeyID, e.Action, e.ResourceType,
+		e.ResourceID, pq.Array(companyIDs), nullJSON(e.Before), nullJSON(e.After), e.IP, e.RequestID,
+	).Scan(&e.ID, &e.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+	return nil
+}
+
+// nullJSON passes an empty document as SQL NULL rather than invalid JSON.
+func nullJSON(doc []byte) interface{} {
+	if len(doc) == 0 {
+		return nil
+	}
+	return string(doc)
+}
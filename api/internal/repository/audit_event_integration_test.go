@@ -0,0 +1,81 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+func TestAuditEvents_AreImmutable(t *testing.T) {
+	db := openTestDB(t)
+	sentinel := newTenantFixture(t, db, "sentinel")
+
+	event := model.AuditEvent{
+		ActorWorkerID: &sentinel.worker.ID,
+		Action:        "update",
+		ResourceType:  "worksite",
+		ResourceID:    sentinel.worksite.ID,
+		CompanyIDs:    []string{sentinel.company.ID},
+		After:         []byte(`{"name":"HQ"}`),
+	}
+	if err := repository.NewAuditEventRepository(db).Create(context.Background(), &event); err != nil {
+		t.Fatalf("failed to record event: %v", err)
+	}
+
+	// Not even the owning role can rewrite history.
+	if _, err := db.Exec(`UPDATE audit_events SET action = 'delete' WHERE id = $1`, event.ID); err == nil {
+		t.Error("expected updating an audit event to fail")
+	}
+	if _, err := db.Exec(`DELETE FROM audit_events WHERE id = $1`, event.ID); err == nil {
+		t.Error("expected deleting an audit event to fail")
+	}
+}
+
+func TestAuditEvents_TenantIsolation(t *testing.T) {
+	db := openTestDB(t)
+	sentinel := newTenantFixture(t, db, "sentinel")
+	guardian := newTenantFixture(t, db, "guardian")
+	events := repository.NewAuditEventRepository(db)
+
+	guardianEvent := model.AuditEvent{
+		ActorWorkerID: &guardian.worker.ID,
+		Action:        "delete",
+		ResourceType:  "shift",
+		ResourceID:    guardian.shift.ID,
+		CompanyIDs:    []string{guardian.company.ID},
+	}
+	if err := events.Create(context.Background(), &guardianEvent); err != nil {
+		t.Fatalf("failed to record event: %v", err)
+	}
+
+	ctx, tx, err := repository.NewTenants(db).Begin(context.Background(), repository.Tenant{
+		WorkerID:   sentinel.worker.ID,
+		CompanyIDs: []string{sentinel.company.ID},
+	})
+	if err != nil {
+		t.Fatalf("failed to begin tenant session: %v", err)
+	}
+	defer tx.Rollback()
+
+	got, err := events.List(ctx, guardian.company.ID, query.Spec{}, pagination.Request{})
+	if err != nil || len(got.Items) != 0 {
+		t.Errorf("expected no guardian audit events, got %v (err %v)", got, err)
+	}
+
+	forged := model.AuditEvent{
+		ActorWorkerID: &guardian.worker.ID,
+		Action:        "update",
+		ResourceType:  "worksite",
+		ResourceID:    sentinel.worksite.ID,
+		CompanyIDs:    []string{sentinel.company.ID},
+	}
+	if err := events.Create(ctx, &forged); err == nil {
+		t.Error("expected recording an event as another worker to violate row-level security")
+	}
+}
@@ -6,27 +6,30 @@ import (
 	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 type CertificateRepository interface {
 	ListByWorker(ctx context.Context, workerID string) ([]model.Certificate, error)
+	ListForWorker(ctx context.Context, workerID string, filter CertificateFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.Certificate], error)
 	GetByID(ctx context.Context, id string) (*model.Certificate, error)
 	Create(ctx context.Context, cert *model.Certificate) error
 	Update(ctx context.Context, cert *model.Certificate) error
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string, version int) error
 }
 
 type certificateRepo struct {
-	db *sql.DB
+	db Querier
 }
 
-func NewCertificateRepository(db *sql.DB) CertificateRepository {
+func NewCertificateRepository(db Querier) CertificateRepository {
 	return &certificateRepo{db: db}
 }
 
 func (r *certificateRepo) ListByWorker(ctx context.Context, workerID string) ([]model.Certificate, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, worker_id, name, issuing_body, certificate_number, issued_date, expiry_date, created_at, updated_at
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, worker_id, name, issuing_body, certificate_number, issued_date, expiry_date, version, created_at, updated_at
 		FROM certificates WHERE worker_id = $1 ORDER BY expiry_date DESC`, workerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list certificates: %w", err)
@@ -36,7 +39,7 @@ func (r *certificateRepo) ListByWorker(ctx context.Context, workerID string) ([]
 	var certs []model.Certificate
 	for rows.Next() {
 		var c model.Certificate
-		if err := rows.Scan(&c.ID, &c.WorkerID, &c.Name, &c.IssuingBody, &c.CertificateNumber, &c.IssuedDate, &c.ExpiryDate, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		if err := rows.Scan(&c.ID, &c.WorkerID, &c.Name, &c.IssuingBody, &c.CertificateNumber, &c.IssuedDate, &c.ExpiryDate, &c.Version, &c.CreatedAt, &c.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan certificate: %w", err)
 		}
 		certs = append(certs, c)
@@ -46,10 +49,10 @@ func (r *certificateRepo) ListByWorker(ctx context.Context, workerID string) ([]
 
 func (r *certificateRepo) GetByID(ctx context.Context, id string) (*model.Certificate, error) {
 	var c model.Certificate
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, worker_id, name, issuing_body, certificate_number, issued_date, expiry_date, created_at, updated_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, worker_id, name, issuing_body, certificate_number, issued_date, expiry_date, version, created_at, updated_at
 		FROM certificates WHERE id = $1`, id).
-		Scan(&c.ID, &c.WorkerID, &c.Name, &c.IssuingBody, &c.CertificateNumber, &c.IssuedDate, &c.ExpiryDate, &c.CreatedAt, &c.UpdatedAt)
+		Scan(&c.ID, &c.WorkerID, &c.Name, &c.IssuingBody, &c.CertificateNumber, &c.IssuedDate, &c.ExpiryDate, &c.Version, &c.CreatedAt, &c.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -60,12 +63,12 @@ func (r *certificateRepo) GetByID(ctx context.Context, id string) (*model.Certif
 }
 
 func (r *certificateRepo) Create(ctx context.Context, cert *model.Certificate) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO certificates (worker_id, name, issuing_body, certificate_number, issued_date, expiry_date)
 		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at`,
+		RETURNING id, version, created_at, updated_at`,
 		cert.WorkerID, cert.Name, cert.IssuingBody, cert.CertificateNumber, cert.IssuedDate, cert.ExpiryDate).
-		Scan(&cert.ID, &cert.CreatedAt, &cert.UpdatedAt)
+		Scan(&cert.ID, &cert.Version, &cert.CreatedAt, &cert.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create certificate: %w", err)
 	}
@@ -73,20 +76,92 @@ func (r *certificateRepo) Create(ctx context.Context, cert *model.Certificate) e
 }
 
 func (r *certificateRepo) Update(ctx context.Context, cert *model.Certificate) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE certificates SET name = $1, issuing_body = $2, certificate_number = $3, issued_date = $4, expiry_date = $5, updated_at = NOW()
-		WHERE id = $6`,
-		cert.Name, cert.IssuingBody, cert.CertificateNumber, cert.IssuedDate, cert.ExpiryDate, cert.ID)
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE certificates SET name = $1, issuing_body = $2, certificate_number = $3, issued_date = $4, expiry_date = $5,
+			version = version + 1, updated_at = NOW()
+		WHERE id = $6 AND ($7 = 0 OR version = $7)
+		RETURNING worker_id, version, created_at, updated_at`,
+		cert.Name, cert.IssuingBody, cert.CertificateNumber, cert.IssuedDate, cert.ExpiryDate, cert.ID, cert.Version).
+		Scan(&cert.WorkerID, &cert.Version, &cert.CreatedAt, &cert.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrVersionMismatch
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update certificate: %w", err)
 	}
 	return nil
 }
 
-func (r *certificateRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM certificates WHERE id = $1`, id)
+func (r *certificateRepo) Delete(ctx context.Context, id string, version int) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM certificates WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
 	if err != nil {
 		return fmt.Errorf("failed to delete certificate: %w", err)
 	}
-	return nil
+	return matched(res)
+}
+
+// CertificateFilter narrows a worker's certificates. A nil Expired matches
+// all of them.
+type CertificateFilter struct {
+	Expired *bool
+}
+
+func (r *certificateRepo) ListForWorker(ctx context.Context, workerID string, filter CertificateFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.Certificate], error) {
+	var cond conditions
+	cond.add("worker_id = ?", workerID)
+	if filter.Expired != nil {
+		if *filter.Expired {
+			cond.addRaw("expiry_date < CURRENT_DATE")
+		} else {
+			cond.addRaw("(expiry_date IS NULL OR expiry_date >= CURRENT_DATE)")
+		}
+	}
+
+	page, err := certificateListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %w", err)
+	}
+	return page, nil
+}
+
+const certificateColumns = `id, worker_id, name, issuing_body, certificate_number, issued_date, expiry_date, version, created_at, updated_at`
+
+// CertificateQuery is the filters and sort orders of a worker's
+// certificates, latest expiry first by default, with those that never
+// expire last.
+var CertificateQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"name":        {Column: "name", Sortable: true},
+		"issued_date": {Column: "issued_date", Type: query.Time},
+		"expiry_date": {Column: "expiry_date", Type: query.Time, Sortable: true,
+			Order: []string{"COALESCE(expiry_date, '-infinity'::date)"}},
+	},
+	Sort: query.Sort{Field: "expiry_date", Desc: true},
+}
+
+func scanCertificate(row rowScanner) (model.Certificate, error) {
+	var c model.Certificate
+	if err := row.Scan(&c.ID, &c.WorkerID, &c.Name, &c.IssuingBody, &c.CertificateNumber, &c.IssuedDate, &c.ExpiryDate, &c.Version, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return c, fmt.Errorf("failed to scan certificate: %w", err)
+	}
+	return c, nil
+}
+
+var certificateListing = listing[model.Certificate]{
+	columns: certificateColumns,
+	from:    "certificates",
+	schema:  CertificateQuery,
+	scan:    scanCertificate,
+	keys: map[string]func(model.Certificate) []string{
+		"name": func(c model.Certificate) []string { return []string{c.Name} },
+		"expiry_date": func(c model.Certificate) []string {
+			if c.ExpiryDate == nil {
+				return []string{"-infinity"}
+			}
+			return []string{*c.ExpiryDate}
+		},
+	},
+	unique: "id",
+	id:     func(c model.Certificate) string { return c.ID },
 }
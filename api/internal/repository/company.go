@@ -5,53 +5,76 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/lib/pq"
+
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 // CompanyRepository defines the interface for company data access.
 type CompanyRepository interface {
-	List(ctx context.Context, limit, offset int) ([]model.Company, error)
+	List(ctx context.Context, companyIDs []string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Company], error)
 	GetByID(ctx context.Context, id string) (*model.Company, error)
 	Create(ctx context.Context, company *model.Company) error
 	Update(ctx context.Context, company *model.Company) error
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string, version int) error
 }
 
 type companyRepo struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewCompanyRepository creates a new CompanyRepository.
-func NewCompanyRepository(db *sql.DB) CompanyRepository {
+func NewCompanyRepository(db Querier) CompanyRepository {
 	return &companyRepo{db: db}
 }
 
-func (r *companyRepo) List(ctx context.Context, limit, offset int) ([]model.Company, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, name, address, phone, email, created_at, updated_at
-		 FROM companies ORDER BY name LIMIT $1 OFFSET $2`, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list companies: %w", err)
-	}
-	defer rows.Close()
+// CompanyQuery is the sort orders of the company list, by name by default.
+var CompanyQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"name":       {Column: "name", Sortable: true},
+		"created_at": {Column: "created_at", Type: query.Time, Sortable: true},
+	},
+	Sort: query.Sort{Field: "name"},
+}
 
-	var companies []model.Company
-	for rows.Next() {
+var companyListing = listing[model.Company]{
+	columns: `id, name, address, phone, email, version, created_at, updated_at`,
+	from:    "companies",
+	schema:  CompanyQuery,
+	scan: func(row rowScanner) (model.Company, error) {
 		var c model.Company
-		if err := rows.Scan(&c.ID, &c.Name, &c.Address, &c.Phone, &c.Email, &c.CreatedAt, &c.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan company: %w", err)
+		if err := row.Scan(&c.ID, &c.Name, &c.Address, &c.Phone, &c.Email, &c.Version, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return c, fmt.Errorf("failed to scan company: %w", err)
 		}
-		companies = append(companies, c)
+		return c, nil
+	},
+	keys: map[string]func(model.Company) []string{
+		"name":       func(c model.Company) []string { return []string{c.Name} },
+		"created_at": func(c model.Company) []string { return []string{timeKey(c.CreatedAt)} },
+	},
+	unique: "id",
+	id:     func(c model.Company) string { return c.ID },
+}
+
+// List returns a page of the companies in companyIDs.
+func (r *companyRepo) List(ctx context.Context, companyIDs []string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Company], error) {
+	var cond conditions
+	cond.add("id = ANY (?)", pq.Array(companyIDs))
+	page, err := companyListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list companies: %w", err)
 	}
-	return companies, rows.Err()
+	return page, nil
 }
 
 func (r *companyRepo) GetByID(ctx context.Context, id string) (*model.Company, error) {
 	var c model.Company
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, name, address, phone, email, created_at, updated_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, name, address, phone, email, version, created_at, updated_at
 		 FROM companies WHERE id = $1`, id).
-		Scan(&c.ID, &c.Name, &c.Address, &c.Phone, &c.Email, &c.CreatedAt, &c.UpdatedAt)
+		Scan(&c.ID, &c.Name, &c.Address, &c.Phone, &c.Email, &c.Version, &c.CreatedAt, &c.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -62,33 +85,39 @@ func (r *companyRepo) GetByID(ctx context.Context, id string) (*model.Company, e
 }
 
 func (r *companyRepo) Create(ctx context.Context, company *model.Company) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO companies (name, address, phone, email)
 		 VALUES ($1, $2, $3, $4)
-		 RETURNING id, created_at, updated_at`,
+		 RETURNING id, version, created_at, updated_at`,
 		company.Name, company.Address, company.Phone, company.Email).
-		Scan(&company.ID, &company.CreatedAt, &company.UpdatedAt)
+		Scan(&company.ID, &company.Version, &company.CreatedAt, &company.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create company: %w", err)
 	}
-	return nil
+	return addTenantCompany(ctx, company.ID)
 }
 
 func (r *companyRepo) Update(ctx context.Context, company *model.Company) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE companies SET name = $1, address = $2, phone = $3, email = $4, updated_at = NOW()
-		 WHERE id = $5`,
-		company.Name, company.Address, company.Phone, company.Email, company.ID)
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE companies SET name = $1, address = $2, phone = $3, email = $4, version = version + 1, updated_at = NOW()
+		 WHERE id = $5 AND ($6 = 0 OR version = $6)
+		 RETURNING version, created_at, updated_at`,
+		company.Name, company.Address, company.Phone, company.Email, company.ID, company.Version).
+		Scan(&company.Version, &company.CreatedAt, &company.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrVersionMismatch
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update company: %w", err)
 	}
 	return nil
 }
 
-func (r *companyRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM companies WHERE id = $1`, id)
+func (r *companyRepo) Delete(ctx context.Context, id string, version int) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM companies WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
 	if err != nil {
 		return fmt.Errorf("failed to delete company: %w", err)
 	}
-	return nil
+	return matched(res)
 }
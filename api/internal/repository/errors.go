@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ErrDuplicate is returned when a write would break a unique constraint,
+// such as a second worker with the same email.
+var ErrDuplicate = errors.New("duplicate")
+
+// isDuplicate reports whether err is Postgres rejecting a unique violation.
+func isDuplicate(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isInvalidText reports whether err is Postgres rejecting a value that does
+// not parse as its column's type, such as a malformed timestamp or UUID.
+func isInvalidText(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "22P02" || pqErr.Code == "22007" || pqErr.Code == "22008")
+}
+
+// isRetryable reports whether err is Postgres aborting a transaction that
+// conflicted with a concurrent one, which succeeds if run again: a
+// serialization failure or a deadlock.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+// ErrVersionMismatch is returned when a conditional write names a version
+// other than the row's current one, or the row is gone. A version of 0
+// makes the write unconditional.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// matched returns ErrVersionMismatch if a conditional write touched no row.
+func matched(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVersionMismatch
+	}
+	return nil
+}
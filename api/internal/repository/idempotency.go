@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// idempotencySweepInterval is how often expired keys are deleted.
+const idempotencySweepInterval = time.Minute
+
+// IdempotencyKey is a request a caller sent with an Idempotency-Key and,
+// once it has succeeded, its response. StatusCode is 0 while the request
+// is in progress.
+type IdempotencyKey struct {
+	Subject     string
+	Key         string
+	WorkerID    string
+	RequestHash string
+	StatusCode  int
+	Headers     map[string]string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// IdempotencyRepository stores idempotency keys. Claim and Complete run in
+// the request's tenant session, so a request never waits on the pool for a
+// second connection, and a claim is kept only if the request's changes
+// are: one that fails rolls back with them, leaving the key free for a
+// retry.
+type IdempotencyRepository interface {
+	// Claim records k as in progress and returns nil, unless its caller
+	// already holds the key: then it returns the existing key, with a
+	// StatusCode of 0 while another session is still running the request
+	// it was claimed for. An expired key is claimed afresh.
+	Claim(ctx context.Context, k IdempotencyKey) (*IdempotencyKey, error)
+	Complete(ctx context.Context, k IdempotencyKey) error
+}
+
+type idempotencyRepo struct {
+	db        Querier
+	lastSweep atomic.Int64
+}
+
+func NewIdempotencyRepository(db Querier) IdempotencyRepository {
+	r := &idempotencyRepo{db: db}
+	r.lastSweep.Store(time.Now().UnixNano())
+	return r
+}
+
+func (r *idempotencyRepo) Claim(ctx context.Context, k IdempotencyKey) (*IdempotencyKey, error) {
+	r.sweep(ctx)
+	q := conn(ctx, r.db)
+
+	// A claim is not visible to other sessions until it commits, so the
+	// session running the request holds a lock on the key until then, and
+	// a retry that cannot take it finds the request in progress.
+	var locked bool
+	err := q.QueryRowContext(ctx,
+		`SELECT pg_try_advisory_xact_lock(hashtextextended($1 || ' ' || $2, 0))`, k.Subject, k.Key,
+	).Scan(&locked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock idempotency key: %w", err)
+	}
+	if !locked {
+		return &IdempotencyKey{Subject: k.Subject, Key: k.Key, WorkerID: k.WorkerID}, nil
+	}
+
+	// The existing key may expire and be swept between the two
+	// statements; claiming once more settles it.
+	for attempt := 0; attempt < 2; attempt++ {
+		var claimed bool
+		err := q.QueryRowContext(ctx,
+			`INSERT INTO idempotency_keys (subject, key, worker_id, request_hash, locked_at, expires_at)
+			 VALUES ($1, $2, $3, $4, NOW(), $5)
+			 ON CONFLICT (subject, key) DO UPDATE SET
+			     worker_id = EXCLUDED.worker_id, request_hash = EXCLUDED.request_hash,
+			     status_code = NULL, headers = NULL, body = NULL,
+			     locked_at = NOW(), expires_at = EXCLUDED.expires_at
+			 WHERE idempotency_keys.expires_at <= NOW()
+			 RETURNING true`,
+			k.Subject, k.Key, k.WorkerID, k.RequestHash, k.ExpiresAt,
+		).Scan(&claimed)
+		if err == nil {
+			return nil, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+		}
+
+		existing, err := r.get(ctx, k.Subject, k.Key)
+		if err == nil {
+			return existing, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("failed to claim idempotency key: contended")
+}
+
+func (r *idempotencyRepo) get(ctx context.Context, subject, key string) (*IdempotencyKey, error) {
+	var k IdempotencyKey
+	var status sql.NullInt64
+	var headers []byte
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT subject, key, worker_id, request_hash, status_code, headers, body, expires_at
+		 FROM idempotency_keys WHERE subject = $1 AND key = $2`, subject, key,
+	).Scan(&k.Subject, &k.Key, &k.WorkerID, &k.RequestHash, &status, &headers, &k.Body, &k.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	k.StatusCode = int(status.Int64)
+	if headers != nil {
+		if err := json.Unmarshal(headers, &k.Headers); err != nil {
+			return nil, fmt.Errorf("failed to decode stored headers: %w", err)
+		}
+	}
+	return &k, nil
+}
+
+func (r *idempotencyRepo) Complete(ctx context.Context, k IdempotencyKey) error {
+	headers, err := json.Marshal(k.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode headers: %w", err)
+	}
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE idempotency_keys SET status_code = $3, headers = $4, body = $5
+		 WHERE subject = $1 AND key = $2 AND status_code IS NULL`,
+		k.Subject, k.Key, k.StatusCode, headers, k.Body,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to complete idempotency key: claim lost")
+	}
+	return nil
+}
+
+// sweep deletes expired keys, at most once an interval per replica. It
+// runs on the pool in the background rather than in the caller's session,
+// which only reaches the caller's own keys. Failures are left for the next
+// sweep.
+func (r *idempotencyRepo) sweep(ctx context.Context) {
+	last := r.lastSweep.Load()
+	now := time.Now().UnixNano()
+	if time.Duration(now-last) < idempotencySweepInterval || !r.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		_, _ = traced(r.db).ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	}()
+}
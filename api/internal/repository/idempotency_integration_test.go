@@ -0,0 +1,167 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+// beginSession starts a tenant session for the fixture's worker.
+func beginSession(t *testing.T, db *sql.DB, f *tenantFixture) (context.Context, repository.Tx) {
+	t.Helper()
+	ctx, tx, err := repository.NewTenants(db).Begin(context.Background(), repository.Tenant{
+		WorkerID:   f.worker.ID,
+		CompanyIDs: []string{f.company.ID},
+	})
+	if err != nil {
+		t.Fatalf("failed to begin tenant session: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return ctx, tx
+}
+
+func newIdempotencyKey(f *tenantFixture) repository.IdempotencyKey {
+	return repository.IdempotencyKey{
+		Subject:     "subject-" + f.worker.ID,
+		Key:         fmt.Sprintf("key-%d", time.Now().UnixNano()),
+		WorkerID:    f.worker.ID,
+		RequestHash: fmt.Sprintf("%064d", 1),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+}
+
+func TestIdempotency_CompleteInTenantSession(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	repo := repository.NewIdempotencyRepository(db)
+	k := newIdempotencyKey(f)
+
+	ctx, tx := beginSession(t, db, f)
+	if existing, err := repo.Claim(ctx, k); err != nil || existing != nil {
+		t.Fatalf("expected the key to be claimed, got %v (err %v)", existing, err)
+	}
+	k.StatusCode = 201
+	k.Headers = map[string]string{"Location": "/api/v1/alarms/a1"}
+	k.Body = []byte(`{"id":"a1"}`)
+	if err := repo.Complete(ctx, k); err != nil {
+		t.Fatalf("failed to complete key: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	ctx, _ = beginSession(t, db, f)
+	existing, err := repo.Claim(ctx, k)
+	if err != nil || existing == nil {
+		t.Fatalf("expected the completed key, got %v (err %v)", existing, err)
+	}
+	if existing.StatusCode != 201 || string(existing.Body) != `{"id":"a1"}` || existing.Headers["Location"] != "/api/v1/alarms/a1" {
+		t.Errorf("unexpected stored response %+v", existing)
+	}
+}
+
+// A retry while the first request's session is open finds the key in
+// progress at once, rather than waiting on the uncommitted claim.
+func TestIdempotency_ClaimInProgress(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	repo := repository.NewIdempotencyRepository(db)
+	k := newIdempotencyKey(f)
+
+	first, _ := beginSession(t, db, f)
+	if existing, err := repo.Claim(first, k); err != nil || existing != nil {
+		t.Fatalf("expected the key to be claimed, got %v (err %v)", existing, err)
+	}
+	retry, _ := beginSession(t, db, f)
+	existing, err := repo.Claim(retry, k)
+	if err != nil || existing == nil || existing.StatusCode != 0 {
+		t.Fatalf("expected the claim to be in progress, got %+v (err %v)", existing, err)
+	}
+}
+
+// A claim whose session rolls back is not kept, so the key is free for a
+// retry.
+func TestIdempotency_RolledBackClaim(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	repo := repository.NewIdempotencyRepository(db)
+	k := newIdempotencyKey(f)
+
+	ctx, tx := beginSession(t, db, f)
+	if _, err := repo.Claim(ctx, k); err != nil {
+		t.Fatalf("failed to claim key: %v", err)
+	}
+	k.StatusCode = 201
+	if err := repo.Complete(ctx, k); err != nil {
+		t.Fatalf("failed to complete key: %v", err)
+	}
+	tx.Rollback()
+
+	ctx, _ = beginSession(t, db, f)
+	if existing, err := repo.Claim(ctx, k); err != nil || existing != nil {
+		t.Errorf("expected the rolled back key to be claimed again, got %+v (err %v)", existing, err)
+	}
+}
+
+func TestIdempotency_ExpiredKeyClaimedAgain(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	repo := repository.NewIdempotencyRepository(db)
+	k := newIdempotencyKey(f)
+	k.ExpiresAt = time.Now().Add(-time.Minute)
+
+	ctx, tx := beginSession(t, db, f)
+	repo.Claim(ctx, k)
+	k.StatusCode = 201
+	repo.Complete(ctx, k)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	ctx, _ = beginSession(t, db, f)
+	if existing, err := repo.Claim(ctx, k); err != nil || existing != nil {
+		t.Errorf("expected an expired key to be claimed afresh, got %+v (err %v)", existing, err)
+	}
+}
+
+func TestIdempotency_OtherWorkersKeysHidden(t *testing.T) {
+	db := openTestDB(t)
+	sentinel := newTenantFixture(t, db, "sentinel")
+	guardian := newTenantFixture(t, db, "guardian")
+	repo := repository.NewIdempotencyRepository(db)
+	k := newIdempotencyKey(guardian)
+
+	ctx, tx := beginSession(t, db, guardian)
+	repo.Claim(ctx, k)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	ctx, _ = beginSession(t, db, sentinel)
+	k.StatusCode = 201
+	if err := repo.Complete(ctx, k); err == nil {
+		t.Error("expected another worker's key to be out of reach")
+	}
+}
+
+// A request holds one connection for its session; claiming a key must not
+// wait on the pool for another, or a burst of requests exhausts it.
+func TestIdempotency_ClaimOnSessionConnection(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	repo := repository.NewIdempotencyRepository(db)
+	db.SetMaxOpenConns(1)
+
+	sessionCtx, _ := beginSession(t, db, f)
+	ctx, cancel := context.WithTimeout(sessionCtx, 5*time.Second)
+	defer cancel()
+	if existing, err := repo.Claim(ctx, newIdempotencyKey(f)); err != nil || existing != nil {
+		t.Fatalf("expected the key to be claimed in the session, got %v (err %v)", existing, err)
+	}
+}
@@ -2,51 +2,63 @@ package repository
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 // LocationCheckInRepository defines the interface for location check-in data access.
 type LocationCheckInRepository interface {
-	ListByWorker(ctx context.Context, workerID string, limit, offset int) ([]model.LocationCheckIn, error)
+	ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.LocationCheckIn], error)
 	ListByShift(ctx context.Context, shiftID string) ([]model.LocationCheckIn, error)
 	Create(ctx context.Context, checkIn *model.LocationCheckIn) error
 }
 
 type locationCheckInRepo struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewLocationCheckInRepository creates a new LocationCheckInRepository.
-func NewLocationCheckInRepository(db *sql.DB) LocationCheckInRepository {
+func NewLocationCheckInRepository(db Querier) LocationCheckInRepository {
 	return &locationCheckInRepo{db: db}
 }
 
-func (r *locationCheckInRepo) ListByWorker(ctx context.Context, workerID string, limit, offset int) ([]model.LocationCheckIn, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, worker_id, shift_id, latitude, longitude, recorded_at
-		 FROM location_check_ins WHERE worker_id = $1 ORDER BY recorded_at DESC LIMIT $2 OFFSET $3`,
-		workerID, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list location check-ins by worker: %w", err)
-	}
-	defer rows.Close()
+// checkInColumns are the columns scanCheckIn reads.
+const checkInColumns = `id, worker_id, shift_id, latitude, longitude, recorded_at`
 
-	var checkIns []model.LocationCheckIn
-	for rows.Next() {
+// CheckInQuery is the filters and sort order of check-in lists, newest first
+// by default. ?since= and ?until= bound the time a check-in was recorded.
+var CheckInQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"shift_id":    {Column: "shift_id", Type: query.Text},
+		"recorded_at": {Column: "recorded_at", Type: query.Time, Sortable: true},
+	},
+	Sort:    query.Sort{Field: "recorded_at", Desc: true},
+	Aliases: map[string]string{"since": "recorded_at[gte]", "until": "recorded_at[lt]"},
+}
+
+var checkInListing = listing[model.LocationCheckIn]{
+	columns: checkInColumns,
+	from:    "location_check_ins",
+	schema:  CheckInQuery,
+	scan: func(row rowScanner) (model.LocationCheckIn, error) {
 		var c model.LocationCheckIn
-		if err := rows.Scan(&c.ID, &c.WorkerID, &c.ShiftID, &c.Latitude, &c.Longitude, &c.RecordedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan location check-in: %w", err)
+		if err := row.Scan(&c.ID, &c.WorkerID, &c.ShiftID, &c.Latitude, &c.Longitude, &c.RecordedAt); err != nil {
+			return c, fmt.Errorf("failed to scan location check-in: %w", err)
 		}
-		checkIns = append(checkIns, c)
-	}
-	return checkIns, rows.Err()
+		return c, nil
+	},
+	keys: map[string]func(model.LocationCheckIn) []string{
+		"recorded_at": func(c model.LocationCheckIn) []string { return []string{timeKey(c.RecordedAt)} },
+	},
+	unique: "id",
+	id:     func(c model.LocationCheckIn) string { return c.ID },
 }
 
 func (r *locationCheckInRepo) ListByShift(ctx context.Context, shiftID string) ([]model.LocationCheckIn, error) {
-	rows, err := r.db.QueryContext(ctx,
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
 		`SELECT id, worker_id, shift_id, latitude, longitude, recorded_at
 		 FROM location_check_ins WHERE shift_id = $1 ORDER BY recorded_at DESC`,
 		shiftID)
@@ -67,7 +79,7 @@ func (r *locationCheckInRepo) ListByShift(ctx context.Context, shiftID string) (
 }
 
 func (r *locationCheckInRepo) Create(ctx context.Context, checkIn *model.LocationCheckIn) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO location_check_ins (worker_id, shift_id, latitude, longitude)
 		 VALUES ($1, $2, $3, $4)
 		 RETURNING id, recorded_at`,
@@ -78,3 +90,13 @@ func (r *locationCheckInRepo) Create(ctx context.Context, checkIn *model.Locatio
 	}
 	return nil
 }
+
+func (r *locationCheckInRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.LocationCheckIn], error) {
+	var cond conditions
+	cond.add("worker_id = ?", workerID)
+	page, err := checkInListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list location check-ins by worker: %w", err)
+	}
+	return page, nil
+}
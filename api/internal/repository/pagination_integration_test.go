@@ -0,0 +1,60 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+func TestListPage_WalksEveryRowOnce(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	alarms := repository.NewAlarmRepository(db)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := alarms.Create(ctx, &model.Alarm{WorkerID: f.worker.ID}); err != nil {
+			t.Fatalf("failed to create alarm: %v", err)
+		}
+	}
+
+	seen := map[string]bool{}
+	p := pagination.Request{Limit: 2, Total: true}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("expected paging to end")
+		}
+		page, err := alarms.ListForWorker(ctx, f.worker.ID, query.Spec{}, p)
+		if err != nil {
+			t.Fatalf("failed to list alarms: %v", err)
+		}
+		if page.Total == nil || *page.Total != 5 {
+			t.Errorf("expected a total of 5, got %v", page.Total)
+		}
+		for _, a := range page.Items {
+			if seen[a.ID] {
+				t.Errorf("alarm %s returned twice", a.ID)
+			}
+			seen[a.ID] = true
+		}
+		if page.Next == nil {
+			break
+		}
+		p.After = page.Next
+	}
+	if len(seen) != 5 {
+		t.Errorf("expected all 5 alarms, got %d", len(seen))
+	}
+
+	p.After = []string{"not-a-time", "not-a-uuid"}
+	if _, err := alarms.ListForWorker(ctx, f.worker.ID, query.Spec{}, p); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for a forged cursor, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+)
+
+// conditions builds a WHERE clause from optional filters, numbering the
+// positional parameters in the order they are added.
+type conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+// add appends a clause whose single "?" placeholder is bound to arg.
+func (c *conditions) add(clause string, arg interface{}) {
+	c.args = append(c.args, arg)
+	c.clauses = append(c.clauses, strings.Replace(clause, "?", fmt.Sprintf("$%d", len(c.args)), 1))
+}
+
+// addRaw appends a clause that takes no parameters.
+func (c *conditions) addRaw(clause string) {
+	c.clauses = append(c.clauses, clause)
+}
+
+// filter appends a clause for each of spec's filters. Fields are mapped to
+// columns through schema, so only values the client sent reach the query,
+// and always as parameters.
+func (c *conditions) filter(s query.Schema, spec query.Spec) error {
+	for _, f := range spec.Filters {
+		field, ok := s.Fields[f.Field]
+		if !ok || field.Type == 0 || len(f.Values) == 0 {
+			return &query.Error{Param: f.Field, Message: "is not a filter of this list"}
+		}
+		switch f.Op {
+		case query.Eq:
+			c.add(field.Column+" = ?", f.Values[0])
+		case query.In:
+			c.add(field.Column+" = ANY (?)", pq.Array(f.Values))
+		case query.Gte:
+			c.add(field.Column+" >= ?", f.Values[0])
+		case query.Gt:
+			c.add(field.Column+" > ?", f.Values[0])
+		case query.Lte:
+			c.add(field.Column+" <= ?", f.Values[0])
+		case query.Lt:
+			c.add(field.Column+" < ?", f.Values[0])
+		default:
+			return &query.Error{Param: f.Field, Message: "cannot be compared with " + string(f.Op)}
+		}
+	}
+	return nil
+}
+
+// where renders the accumulated clauses, or "" if there are none.
+func (c *conditions) where() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.clauses, " AND ")
+}
+
+// page binds limit and offset and renders the LIMIT/OFFSET clause. It must
+// be called after every filter has been added.
+func (c *conditions) page(limit, offset int) string {
+	c.args = append(c.args, limit, offset)
+	return fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(c.args)-1, len(c.args))
+}
+
+// keyset is the ordering of a paged list. The last column must be unique so
+// every row has a distinct position, and all run in one direction so the
+// position after a row can be compared as a single row value.
+type keyset struct {
+	columns []string
+	desc    bool
+}
+
+func (k keyset) orderBy() string {
+	dir := " ASC"
+	if k.desc {
+		dir = " DESC"
+	}
+	return " ORDER BY " + strings.Join(k.columns, dir+", ") + dir
+}
+
+// after appends the clause selecting the rows that sort after key.
+func (c *conditions) after(k keyset, key []string) {
+	placeholders := make([]string, len(key))
+	for i, v := range key {
+		c.args = append(c.args, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(c.args))
+	}
+	op := " > "
+	if k.desc {
+		op = " < "
+	}
+	c.clauses = append(c.clauses, "("+strings.Join(k.columns, ", ")+")"+op+"("+strings.Join(placeholders, ", ")+")")
+}
+
+// listing describes a list clients can filter and sort: the columns read
+// from which tables, the fields its schema offers, and for each sortable
+// field the cursor key of a row, one value per column it sorts on. Rows
+// with equal keys are ordered by the unique column, whose value for a row
+// id returns.
+type listing[T any] struct {
+	columns string
+	from    string
+	schema  query.Schema
+	scan    func(rowScanner) (T, error)
+	keys    map[string]func(T) []string
+	unique  string
+	id      func(T) string
+}
+
+// order returns the keyset sort asks for, or the schema's default, and the
+// cursor key of a row in it.
+func (l listing[T]) order(sort query.Sort) (keyset, func(T) []string, error) {
+	if sort.Field == "" {
+		sort = l.schema.Sort
+	}
+	field, ok := l.schema.Fields[sort.Field]
+	key, hasKey := l.keys[sort.Field]
+	if !ok || !field.Sortable || !hasKey {
+		return keyset{}, nil, &query.Error{Param: "sort", Message: "cannot be by " + sort.Field}
+	}
+	columns := field.Order
+	if columns == nil {
+		columns = []string{field.Column}
+	}
+	return keyset{columns: append(slices.Clip(columns), l.unique), desc: sort.Desc},
+		func(row T) []string { return append(key(row), l.id(row)) }, nil
+}
+
+// page selects one page of the list, narrowed by the conditions the
+// repository sets in cond and then by spec's filters, in spec's order.
+func (l listing[T]) page(ctx context.Context, db Querier, cond conditions, spec query.Spec, p pagination.Request) (*pagination.Page[T], error) {
+	if err := cond.filter(l.schema, spec); err != nil {
+		return nil, err
+	}
+	keys, key, err := l.order(spec.Sort)
+	if err != nil {
+		return nil, err
+	}
+	return listPage(ctx, db, l.columns, l.from, cond, keys, p, l.scan, key)
+}
+
+// rowScanner is the subset of *sql.Rows a scan function needs.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// listPage selects one page of columns from from, filtered by cond and
+// ordered by keys, with scan reading a row and key returning its position.
+// Asked for a total, it also counts every row cond matches.
+func listPage[T any](ctx context.Context, db Querier, columns, from string, cond conditions, keys keyset,
+	p pagination.Request, scan func(rowScanner) (T, error), key func(T) []string) (*pagination.Page[T], error) {
+	var total *int
+	if p.Total {
+		var n int
+		err := conn(ctx, db).QueryRowContext(ctx, `SELECT COUNT(*) FROM `+from+cond.where(), cond.args...).Scan(&n)
+		if isInvalidID(err) {
+			return &pagination.Page[T]{Items: []T{}, Total: &n}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		total = &n
+	}
+	if p.After != nil {
+		if len(p.After) != len(keys.columns) {
+			return nil, pagination.ErrInvalidCursor
+		}
+		cond.after(keys, p.After)
+	}
+
+	query := `SELECT ` + columns + ` FROM ` + from + cond.where() + keys.orderBy() + cond.page(p.Size()+1, p.Offset)
+	rows, err := conn(ctx, db).QueryContext(ctx, query, cond.args...)
+	if p.After != nil && isInvalidText(err) {
+		return nil, pagination.ErrInvalidCursor
+	}
+	if isInvalidID(err) {
+		// A malformed ID in a filter matches no rows.
+		return &pagination.Page[T]{Items: []T{}, Total: total}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	page := pagination.Slice(items, p, key)
+	page.Total = total
+	return page, nil
+}
+
+// timeKey formats a timestamp sort key without losing precision.
+func timeKey(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,65 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+func TestListing_FiltersAndSorts(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	alarms := repository.NewAlarmRepository(db)
+	ctx := context.Background()
+
+	var created []model.Alarm
+	for i := 0; i < 3; i++ {
+		a := model.Alarm{WorkerID: f.worker.ID}
+		if err := alarms.Create(ctx, &a); err != nil {
+			t.Fatalf("failed to create alarm: %v", err)
+		}
+		created = append(created, a)
+	}
+	if err := alarms.UpdateStatus(ctx, created[0].ID, model.AlarmAcknowledged, 0); err != nil {
+		t.Fatalf("failed to acknowledge alarm: %v", err)
+	}
+
+	spec, err := query.Parse(url.Values{
+		"status[in]":     {"raised,resolved"},
+		"raised_at[gte]": {created[0].RaisedAt.Format(time.RFC3339Nano)},
+		"sort":           {"raised_at"},
+	}, repository.AlarmQuery)
+	if err != nil {
+		t.Fatalf("failed to parse query: %v", err)
+	}
+	page, err := alarms.ListForWorker(ctx, f.worker.ID, spec, pagination.Request{Total: true})
+	if err != nil {
+		t.Fatalf("failed to list alarms: %v", err)
+	}
+	if page.Total == nil || *page.Total != 2 {
+		t.Errorf("expected a total of 2, got %v", page.Total)
+	}
+	for i, a := range page.Items {
+		if a.Status != model.AlarmRaised {
+			t.Errorf("expected only raised alarms, got %s", a.Status)
+		}
+		if i > 0 && a.RaisedAt.Before(page.Items[i-1].RaisedAt) {
+			t.Error("expected alarms in ascending raised_at order")
+		}
+	}
+
+	var qerr *query.Error
+	_, err = alarms.ListForWorker(ctx, f.worker.ID, query.Spec{Sort: query.Sort{Field: "worker_id"}}, pagination.Request{})
+	if !errors.As(err, &qerr) || qerr.Param != "sort" {
+		t.Errorf("expected a sort error for an unsortable field, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+)
+
+// rateLimitSweepInterval is how often refilled buckets are deleted.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitRepository keeps rate limit token buckets in Postgres, so every
+// replica draws on the same ones. It implements ratelimit.Store, and must
+// be built on the pool rather than a tenant session.
+type RateLimitRepository interface {
+	Take(ctx context.Context, key string, limit config.Limit) (bool, time.Duration, error)
+}
+
+type rateLimitRepo struct {
+	db        Querier
+	lastSweep atomic.Int64
+}
+
+func NewRateLimitRepository(db Querier) RateLimitRepository {
+	r := &rateLimitRepo{db: db}
+	r.lastSweep.Store(time.Now().UnixNano())
+	return r
+}
+
+func (r *rateLimitRepo) Take(ctx context.Context, key string, limit config.Limit) (bool, time.Duration, error) {
+	r.sweep(ctx)
+
+	var allowed bool
+	var retryAfter float64
+	err := traced(r.db).QueryRowContext(ctx,
+		`SELECT allowed, retry_after FROM rate_limit_take($1, $2, $3)`,
+		key, float64(limit.Requests), float64(limit.Requests)/limit.Period.Seconds(),
+	).Scan(&allowed, &retryAfter)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	return allowed, time.Duration(retryAfter * float64(time.Second)), nil
+}
+
+// sweep deletes buckets that have refilled, at most once an interval per
+// replica. Failures are left for the next sweep.
+func (r *rateLimitRepo) sweep(ctx context.Context) {
+	last := r.lastSweep.Load()
+	now := time.Now().UnixNano()
+	if time.Duration(now-last) < rateLimitSweepInterval || !r.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+	_, _ = traced(r.db).ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE full_at <= NOW()`)
+}
@@ -0,0 +1,80 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+func TestRateLimit_Take(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewRateLimitRepository(db)
+	ctx := context.Background()
+	key := fmt.Sprintf("test|%d", time.Now().UnixNano())
+	t.Cleanup(func() { db.Exec(`DELETE FROM rate_limit_buckets WHERE key LIKE $1`, key+"%") })
+	limit := config.Limit{Requests: 2, Period: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := repo.Take(ctx, key, limit)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !ok {
+			t.Fatalf("expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	ok, retryAfter, err := repo.Take(ctx, key, limit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Fatal("expected the empty bucket to refuse")
+	}
+	if retryAfter < 29*time.Minute || retryAfter > 30*time.Minute {
+		t.Errorf("expected retry after about 30m, got %v", retryAfter)
+	}
+
+	if ok, _, _ := repo.Take(ctx, key+"|other", limit); !ok {
+		t.Error("expected another key's bucket to be full")
+	}
+}
+
+// Replicas taking from one bucket at once must not overspend it.
+func TestRateLimit_TakeConcurrently(t *testing.T) {
+	db := openTestDB(t)
+	repo := repository.NewRateLimitRepository(db)
+	key := fmt.Sprintf("test|%d", time.Now().UnixNano())
+	t.Cleanup(func() { db.Exec(`DELETE FROM rate_limit_buckets WHERE key = $1`, key) })
+	limit := config.Limit{Requests: 5, Period: time.Hour}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := repo.Take(context.Background(), key, limit)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 5 {
+		t.Errorf("expected 5 of 20 requests allowed, got %d", allowed)
+	}
+}
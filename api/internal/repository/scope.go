@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ScopeRepository resolves which company owns a resource so access can be
+// checked against the caller's membership of that company. Single-company
+// lookups return "" when the resource does not exist.
+//
+// It queries through the request's tenant session, if any, so a check
+// never waits on a second connection. The lookups are SECURITY DEFINER
+// functions that see past row-level security, so another company's
+// resource resolves and is refused as forbidden rather than reported as
+// missing.
+type ScopeRepository interface {
+	CompanyExists(ctx context.Context, companyID string) (bool, error)
+	CompanyOfWorksite(ctx context.Context, worksiteID string) (string, error)
+	CompanyOfShift(ctx context.Context, shiftID string) (string, error)
+	CompanyOfTemplate(ctx context.Context, templateID string) (string, error)
+	CompanyOfShiftReport(ctx context.Context, reportID string) (string, error)
+	CompaniesOfAlarm(ctx context.Context, alarmID string) ([]string, error)
+	CompaniesOfWorker(ctx context.Context, workerID string) ([]string, error)
+	CompanyOfAPIKey(ctx context.Context, keyID string) (string, error)
+}
+
+type scopeRepo struct {
+	db Querier
+}
+
+func NewScopeRepository(db Querier) ScopeRepository {
+	return &scopeRepo{db: db}
+}
+
+func (r *scopeRepo) CompanyExists(ctx context.Context, companyID string) (bool, error) {
+	var exists bool
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT app_company_exists($1)`, companyID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check company: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *scopeRepo) CompanyOfWorksite(ctx context.Context, worksiteID string) (string, error) {
+	return r.company(ctx, "worksite", `SELECT app_company_of_worksite($1)`, worksiteID)
+}
+
+func (r *scopeRepo) CompanyOfShift(ctx context.Context, shiftID string) (string, error) {
+	return r.company(ctx, "shift", `SELECT app_company_of_shift($1)`, shiftID)
+}
+
+func (r *scopeRepo) CompanyOfTemplate(ctx context.Context, templateID string) (string, error) {
+	return r.company(ctx, "shift report template", `SELECT app_company_of_template($1)`, templateID)
+}
+
+func (r *scopeRepo) CompanyOfShiftReport(ctx context.Context, reportID string) (string, error) {
+	return r.company(ctx, "shift report", `SELECT app_company_of_shift_report($1)`, reportID)
+}
+
+// CompaniesOfAlarm returns the company of the alarm's shift or, for an
+// alarm raised outside a shift, every company the raising worker is an
+// active member of.
+func (r *scopeRepo) CompaniesOfAlarm(ctx context.Context, alarmID string) ([]string, error) {
+	return r.companies(ctx, "alarm", `SELECT * FROM app_companies_of_alarm($1)`, alarmID)
+}
+
+// CompaniesOfWorker returns the companies a worker is an active member of.
+func (r *scopeRepo) CompaniesOfWorker(ctx context.Context, workerID string) ([]string, error) {
+	return r.companies(ctx, "worker", `SELECT * FROM app_companies_of_worker($1)`, workerID)
+}
+
+func (r *scopeRepo) CompanyOfAPIKey(ctx context.Context, keyID string) (string, error) {
+	return r.company(ctx, "api key", `SELECT app_company_of_api_key($1)`, keyID)
+}
+
+func (r *scopeRepo) company(ctx context.Context, resource, query, id string) (string, error) {
+	var companyID sql.NullString
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(&companyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s company: %w", resource, err)
+	}
+	return companyID.String, nil
+}
+
+func (r *scopeRepo) companies(ctx context.Context, resource, query, id string) ([]string, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s companies: %w", resource, err)
+	}
+	defer rows.Close()
+
+	var companyIDs []string
+	for rows.Next() {
+		var companyID string
+		if err := rows.Scan(&companyID); err != nil {
+			return nil, fmt.Errorf("failed to scan company: %w", err)
+		}
+		companyIDs = append(companyIDs, companyID)
+	}
+	return companyIDs, rows.Err()
+}
+
+// isInvalidID reports whether err is Postgres rejecting a malformed UUID,
+// which for a lookup is the same as the row not existing.
+func isInvalidID(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "22P02"
+}
@@ -6,95 +6,95 @@ import (
 	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 // ShiftRepository defines the interface for shift data access.
 type ShiftRepository interface {
-	List(ctx context.Context, limit, offset int) ([]model.Shift, error)
-	ListByWorksite(ctx context.Context, worksiteID string, limit, offset int) ([]model.Shift, error)
-	ListByStatus(ctx context.Context, status model.ShiftStatus, limit, offset int) ([]model.Shift, error)
+	List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Shift], error)
 	GetByID(ctx context.Context, id string) (*model.Shift, error)
 	Create(ctx context.Context, shift *model.Shift) error
 	Update(ctx context.Context, shift *model.Shift) error
-	UpdateStatus(ctx context.Context, id string, status model.ShiftStatus) error
-	Delete(ctx context.Context, id string) error
+	UpdateStatus(ctx context.Context, id string, status model.ShiftStatus, version int) error
+	// Fill moves an open shift to assigned and returns its new version, or
+	// 0 if it was not open, as when another acceptance filled it first.
+	Fill(ctx context.Context, id string) (int, error)
+	Delete(ctx context.Context, id string, version int) error
 }
 
 type shiftRepo struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewShiftRepository creates a new ShiftRepository.
-func NewShiftRepository(db *sql.DB) ShiftRepository {
+func NewShiftRepository(db Querier) ShiftRepository {
 	return &shiftRepo{db: db}
 }
 
-func (r *shiftRepo) List(ctx context.Context, limit, offset int) ([]model.Shift, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, worksite_id, created_by, title, description, start_time, end_time, status, created_at, updated_at
-		 FROM shifts ORDER BY start_time DESC LIMIT $1 OFFSET $2`, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list shifts: %w", err)
-	}
-	defer rows.Close()
-
-	var shifts []model.Shift
-	for rows.Next() {
-		var s model.Shift
-		if err := rows.Scan(&s.ID, &s.WorksiteID, &s.CreatedBy, &s.Title, &s.Description, &s.StartTime, &s.EndTime, &s.Status, &s.CreatedAt, &s.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan shift: %w", err)
-		}
-		shifts = append(shifts, s)
-	}
-	return shifts, rows.Err()
+// shiftColumns are the columns scanShift reads.
+const shiftColumns = `id, worksite_id, created_by, title, description, start_time, end_time, status, version, created_at, updated_at`
+
+// ShiftQuery is the filters and sort orders of the shift list, latest start
+// first by default.
+var ShiftQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"worksite_id": {Column: "worksite_id", Type: query.Text},
+		"created_by":  {Column: "created_by", Type: query.Text},
+		"status": {Column: "status", Type: query.Text, Values: []string{
+			string(model.ShiftOpen), string(model.ShiftAssigned), string(model.ShiftInProgress),
+			string(model.ShiftCompleted), string(model.ShiftCancelled)}},
+		"title":      {Column: "title", Sortable: true},
+		"start_time": {Column: "start_time", Type: query.Time, Sortable: true},
+		"end_time":   {Column: "end_time", Type: query.Time, Sortable: true},
+		"created_at": {Column: "created_at", Type: query.Time, Sortable: true},
+	},
+	Sort: query.Sort{Field: "start_time", Desc: true},
 }
 
-func (r *shiftRepo) ListByWorksite(ctx context.Context, worksiteID string, limit, offset int) ([]model.Shift, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, worksite_id, created_by, title, description, start_time, end_time, status, created_at, updated_at
-		 FROM shifts WHERE worksite_id = $1 ORDER BY start_time DESC LIMIT $2 OFFSET $3`, worksiteID, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list shifts by worksite: %w", err)
-	}
-	defer rows.Close()
-
-	var shifts []model.Shift
-	for rows.Next() {
-		var s model.Shift
-		if err := rows.Scan(&s.ID, &s.WorksiteID, &s.CreatedBy, &s.Title, &s.Description, &s.StartTime, &s.EndTime, &s.Status, &s.CreatedAt, &s.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan shift: %w", err)
-		}
-		shifts = append(shifts, s)
+func scanShift(row rowScanner) (model.Shift, error) {
+	var s model.Shift
+	if err := row.Scan(&s.ID, &s.WorksiteID, &s.CreatedBy, &s.Title, &s.Description, &s.StartTime, &s.EndTime, &s.Status, &s.Version, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return s, fmt.Errorf("failed to scan shift: %w", err)
 	}
-	return shifts, rows.Err()
+	return s, nil
 }
 
-func (r *shiftRepo) ListByStatus(ctx context.Context, status model.ShiftStatus, limit, offset int) ([]model.Shift, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, worksite_id, created_by, title, description, start_time, end_time, status, created_at, updated_at
-		 FROM shifts WHERE status = $1 ORDER BY start_time DESC LIMIT $2 OFFSET $3`, status, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list shifts by status: %w", err)
+var shiftListing = listing[model.Shift]{
+	columns: shiftColumns,
+	from:    "shifts",
+	schema:  ShiftQuery,
+	scan:    scanShift,
+	keys: map[string]func(model.Shift) []string{
+		"title":      func(s model.Shift) []string { return []string{s.Title} },
+		"start_time": func(s model.Shift) []string { return []string{timeKey(s.StartTime)} },
+		"end_time":   func(s model.Shift) []string { return []string{timeKey(s.EndTime)} },
+		"created_at": func(s model.Shift) []string { return []string{timeKey(s.CreatedAt)} },
+	},
+	unique: "id",
+	id:     func(s model.Shift) string { return s.ID },
+}
+
+// List returns a page of shifts matching spec, limited to the worksites of
+// companyID when it is set.
+func (r *shiftRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Shift], error) {
+	var cond conditions
+	if companyID != "" {
+		cond.add("worksite_id IN (SELECT id FROM worksites WHERE company_id = ?)", companyID)
 	}
-	defer rows.Close()
-
-	var shifts []model.Shift
-	for rows.Next() {
-		var s model.Shift
-		if err := rows.Scan(&s.ID, &s.WorksiteID, &s.CreatedBy, &s.Title, &s.Description, &s.StartTime, &s.EndTime, &s.Status, &s.CreatedAt, &s.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan shift: %w", err)
-		}
-		shifts = append(shifts, s)
+	page, err := shiftListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shifts: %w", err)
 	}
-	return shifts, rows.Err()
+	return page, nil
 }
 
 func (r *shiftRepo) GetByID(ctx context.Context, id string) (*model.Shift, error) {
 	var s model.Shift
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, worksite_id, created_by, title, description, start_time, end_time, status, created_at, updated_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, worksite_id, created_by, title, description, start_time, end_time, status, version, created_at, updated_at
 		 FROM shifts WHERE id = $1`, id).
-		Scan(&s.ID, &s.WorksiteID, &s.CreatedBy, &s.Title, &s.Description, &s.StartTime, &s.EndTime, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+		Scan(&s.ID, &s.WorksiteID, &s.CreatedBy, &s.Title, &s.Description, &s.StartTime, &s.EndTime, &s.Status, &s.Version, &s.CreatedAt, &s.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -105,12 +105,12 @@ func (r *shiftRepo) GetByID(ctx context.Context, id string) (*model.Shift, error
 }
 
 func (r *shiftRepo) Create(ctx context.Context, shift *model.Shift) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO shifts (worksite_id, created_by, title, description, start_time, end_time, status)
 		 VALUES ($1, $2, $3, $4, $5, $6, $7)
-		 RETURNING id, created_at, updated_at`,
+		 RETURNING id, version, created_at, updated_at`,
 		shift.WorksiteID, shift.CreatedBy, shift.Title, shift.Description, shift.StartTime, shift.EndTime, shift.Status).
-		Scan(&shift.ID, &shift.CreatedAt, &shift.UpdatedAt)
+		Scan(&shift.ID, &shift.Version, &shift.CreatedAt, &shift.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create shift: %w", err)
 	}
@@ -118,29 +118,53 @@ func (r *shiftRepo) Create(ctx context.Context, shift *model.Shift) error {
 }
 
 func (r *shiftRepo) Update(ctx context.Context, shift *model.Shift) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE shifts SET worksite_id = $1, title = $2, description = $3, start_time = $4, end_time = $5, status = $6, updated_at = NOW()
-		 WHERE id = $7`,
-		shift.WorksiteID, shift.Title, shift.Description, shift.StartTime, shift.EndTime, shift.Status, shift.ID)
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE shifts SET worksite_id = $1, title = $2, description = $3, start_time = $4, end_time = $5, status = $6,
+			version = version + 1, updated_at = NOW()
+		 WHERE id = $7 AND ($8 = 0 OR version = $8)
+		 RETURNING created_by, version, created_at, updated_at`,
+		shift.WorksiteID, shift.Title, shift.Description, shift.StartTime, shift.EndTime, shift.Status, shift.ID, shift.Version).
+		Scan(&shift.CreatedBy, &shift.Version, &shift.CreatedAt, &shift.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrVersionMismatch
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update shift: %w", err)
 	}
 	return nil
 }
 
-func (r *shiftRepo) UpdateStatus(ctx context.Context, id string, status model.ShiftStatus) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE shifts SET status = $1, updated_at = NOW() WHERE id = $2`, status, id)
+func (r *shiftRepo) UpdateStatus(ctx context.Context, id string, status model.ShiftStatus, version int) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE shifts SET status = $1, version = version + 1, updated_at = NOW()
+		 WHERE id = $2 AND ($3 = 0 OR version = $3)`, status, id, version)
 	if err != nil {
 		return fmt.Errorf("failed to update shift status: %w", err)
 	}
-	return nil
+	return matched(res)
 }
 
-func (r *shiftRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM shifts WHERE id = $1`, id)
+func (r *shiftRepo) Fill(ctx context.Context, id string) (int, error) {
+	var version int
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE shifts SET status = $1, version = version + 1, updated_at = NOW()
+		 WHERE id = $2 AND status = $3
+		 RETURNING version`, model.ShiftAssigned, id, model.ShiftOpen,
+	).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to fill shift: %w", err)
+	}
+	return version, nil
+}
+
+func (r *shiftRepo) Delete(ctx context.Context, id string, version int) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM shifts WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
 	if err != nil {
 		return fmt.Errorf("failed to delete shift: %w", err)
 	}
-	return nil
+	return matched(res)
 }
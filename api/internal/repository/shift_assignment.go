@@ -6,31 +6,34 @@ import (
 	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 // ShiftAssignmentRepository defines the interface for shift assignment data access.
 type ShiftAssignmentRepository interface {
 	ListByShift(ctx context.Context, shiftID string) ([]model.ShiftAssignment, error)
 	ListByWorker(ctx context.Context, workerID string) ([]model.ShiftAssignment, error)
+	ListForWorker(ctx context.Context, workerID string, filter AssignmentFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.AssignmentWithShift], error)
 	GetByID(ctx context.Context, id string) (*model.ShiftAssignment, error)
 	Get(ctx context.Context, shiftID, workerID string) (*model.ShiftAssignment, error)
 	Create(ctx context.Context, assignment *model.ShiftAssignment) error
-	UpdateStatus(ctx context.Context, id string, status model.AssignmentStatus) error
+	UpdateStatus(ctx context.Context, assignment *model.ShiftAssignment) error
 	Delete(ctx context.Context, id string) error
 }
 
 type shiftAssignmentRepo struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewShiftAssignmentRepository creates a new ShiftAssignmentRepository.
-func NewShiftAssignmentRepository(db *sql.DB) ShiftAssignmentRepository {
+func NewShiftAssignmentRepository(db Querier) ShiftAssignmentRepository {
 	return &shiftAssignmentRepo{db: db}
 }
 
 func (r *shiftAssignmentRepo) ListByShift(ctx context.Context, shiftID string) ([]model.ShiftAssignment, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, shift_id, worker_id, status, assigned_at, responded_at
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, shift_id, worker_id, status, version, assigned_at, responded_at
 		 FROM shift_assignments WHERE shift_id = $1 ORDER BY assigned_at DESC`, shiftID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list assignments by shift: %w", err)
@@ -40,7 +43,7 @@ func (r *shiftAssignmentRepo) ListByShift(ctx context.Context, shiftID string) (
 	var assignments []model.ShiftAssignment
 	for rows.Next() {
 		var a model.ShiftAssignment
-		if err := rows.Scan(&a.ID, &a.ShiftID, &a.WorkerID, &a.Status, &a.AssignedAt, &a.RespondedAt); err != nil {
+		if err := rows.Scan(&a.ID, &a.ShiftID, &a.WorkerID, &a.Status, &a.Version, &a.AssignedAt, &a.RespondedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan assignment: %w", err)
 		}
 		assignments = append(assignments, a)
@@ -49,8 +52,8 @@ func (r *shiftAssignmentRepo) ListByShift(ctx context.Context, shiftID string) (
 }
 
 func (r *shiftAssignmentRepo) ListByWorker(ctx context.Context, workerID string) ([]model.ShiftAssignment, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, shift_id, worker_id, status, assigned_at, responded_at
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT id, shift_id, worker_id, status, version, assigned_at, responded_at
 		 FROM shift_assignments WHERE worker_id = $1 ORDER BY assigned_at DESC`, workerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list assignments by worker: %w", err)
@@ -60,7 +63,7 @@ func (r *shiftAssignmentRepo) ListByWorker(ctx context.Context, workerID string)
 	var assignments []model.ShiftAssignment
 	for rows.Next() {
 		var a model.ShiftAssignment
-		if err := rows.Scan(&a.ID, &a.ShiftID, &a.WorkerID, &a.Status, &a.AssignedAt, &a.RespondedAt); err != nil {
+		if err := rows.Scan(&a.ID, &a.ShiftID, &a.WorkerID, &a.Status, &a.Version, &a.AssignedAt, &a.RespondedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan assignment: %w", err)
 		}
 		assignments = append(assignments, a)
@@ -70,10 +73,10 @@ func (r *shiftAssignmentRepo) ListByWorker(ctx context.Context, workerID string)
 
 func (r *shiftAssignmentRepo) GetByID(ctx context.Context, id string) (*model.ShiftAssignment, error) {
 	var a model.ShiftAssignment
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, shift_id, worker_id, status, assigned_at, responded_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, shift_id, worker_id, status, version, assigned_at, responded_at
 		 FROM shift_assignments WHERE id = $1`, id).
-		Scan(&a.ID, &a.ShiftID, &a.WorkerID, &a.Status, &a.AssignedAt, &a.RespondedAt)
+		Scan(&a.ID, &a.ShiftID, &a.WorkerID, &a.Status, &a.Version, &a.AssignedAt, &a.RespondedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -85,10 +88,10 @@ func (r *shiftAssignmentRepo) GetByID(ctx context.Context, id string) (*model.Sh
 
 func (r *shiftAssignmentRepo) Get(ctx context.Context, shiftID, workerID string) (*model.ShiftAssignment, error) {
 	var a model.ShiftAssignment
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, shift_id, worker_id, status, assigned_at, responded_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, shift_id, worker_id, status, version, assigned_at, responded_at
 		 FROM shift_assignments WHERE shift_id = $1 AND worker_id = $2`, shiftID, workerID).
-		Scan(&a.ID, &a.ShiftID, &a.WorkerID, &a.Status, &a.AssignedAt, &a.RespondedAt)
+		Scan(&a.ID, &a.ShiftID, &a.WorkerID, &a.Status, &a.Version, &a.AssignedAt, &a.RespondedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -99,21 +102,34 @@ func (r *shiftAssignmentRepo) Get(ctx context.Context, shiftID, workerID string)
 }
 
 func (r *shiftAssignmentRepo) Create(ctx context.Context, assignment *model.ShiftAssignment) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO shift_assignments (shift_id, worker_id, status)
 		 VALUES ($1, $2, $3)
-		 RETURNING id, assigned_at`,
+		 RETURNING id, version, assigned_at`,
 		assignment.ShiftID, assignment.WorkerID, assignment.Status).
-		Scan(&assignment.ID, &assignment.AssignedAt)
+		Scan(&assignment.ID, &assignment.Version, &assignment.AssignedAt)
+	if isDuplicate(err) {
+		return ErrDuplicate
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create assignment: %w", err)
 	}
 	return nil
 }
 
-func (r *shiftAssignmentRepo) UpdateStatus(ctx context.Context, id string, status model.AssignmentStatus) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE shift_assignments SET status = $1, responded_at = NOW() WHERE id = $2`, status, id)
+// UpdateStatus records the assignment's status as its response,
+// conditional on assignment.Version unless it is 0, and sets its version
+// and response time to the new ones.
+func (r *shiftAssignmentRepo) UpdateStatus(ctx context.Context, assignment *model.ShiftAssignment) error {
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE shift_assignments SET status = $1, responded_at = NOW(), version = version + 1
+		 WHERE id = $2 AND ($3 = 0 OR version = $3)
+		 RETURNING version, responded_at`,
+		assignment.Status, assignment.ID, assignment.Version).
+		Scan(&assignment.Version, &assignment.RespondedAt)
+	if err == sql.ErrNoRows {
+		return ErrVersionMismatch
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update assignment status: %w", err)
 	}
@@ -121,9 +137,75 @@ func (r *shiftAssignmentRepo) UpdateStatus(ctx context.Context, id string, statu
 }
 
 func (r *shiftAssignmentRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM shift_assignments WHERE id = $1`, id)
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM shift_assignments WHERE id = $1`, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete assignment: %w", err)
 	}
 	return nil
 }
+
+// AssignmentFilter narrows a worker's shift assignments. Upcoming selects
+// shifts that have not ended yet (soonest first unless another order is
+// asked for) when true and finished shifts when false; nil matches both.
+type AssignmentFilter struct {
+	Upcoming *bool
+}
+
+// AssignmentQuery is the filters and sort orders of a worker's assignments,
+// latest shift first by default.
+var AssignmentQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"shift_id": {Column: "a.shift_id", Type: query.Text},
+		"status": {Column: "a.status", Type: query.Text, Values: []string{
+			string(model.AssignmentOffered), string(model.AssignmentAccepted),
+			string(model.AssignmentDeclined), string(model.AssignmentCompleted)}},
+		"assigned_at": {Column: "a.assigned_at", Type: query.Time, Sortable: true},
+		"start_time":  {Column: "s.start_time", Type: query.Time, Sortable: true},
+		"end_time":    {Column: "s.end_time", Type: query.Time, Sortable: true},
+	},
+	Sort: query.Sort{Field: "start_time", Desc: true},
+}
+
+var assignmentListing = listing[model.AssignmentWithShift]{
+	columns: `a.id, a.shift_id, a.worker_id, a.status, a.version, a.assigned_at, a.responded_at,
+		s.id, s.worksite_id, s.created_by, s.title, s.description, s.start_time, s.end_time, s.status, s.version, s.created_at, s.updated_at`,
+	from:   "shift_assignments a JOIN shifts s ON s.id = a.shift_id",
+	schema: AssignmentQuery,
+	scan: func(row rowScanner) (model.AssignmentWithShift, error) {
+		var a model.AssignmentWithShift
+		if err := row.Scan(&a.ID, &a.ShiftID, &a.WorkerID, &a.Status, &a.Version, &a.AssignedAt, &a.RespondedAt,
+			&a.Shift.ID, &a.Shift.WorksiteID, &a.Shift.CreatedBy, &a.Shift.Title, &a.Shift.Description,
+			&a.Shift.StartTime, &a.Shift.EndTime, &a.Shift.Status, &a.Shift.Version, &a.Shift.CreatedAt, &a.Shift.UpdatedAt); err != nil {
+			return a, fmt.Errorf("failed to scan assignment: %w", err)
+		}
+		return a, nil
+	},
+	keys: map[string]func(model.AssignmentWithShift) []string{
+		"assigned_at": func(a model.AssignmentWithShift) []string { return []string{timeKey(a.AssignedAt)} },
+		"start_time":  func(a model.AssignmentWithShift) []string { return []string{timeKey(a.Shift.StartTime)} },
+		"end_time":    func(a model.AssignmentWithShift) []string { return []string{timeKey(a.Shift.EndTime)} },
+	},
+	unique: "a.id",
+	id:     func(a model.AssignmentWithShift) string { return a.ID },
+}
+
+func (r *shiftAssignmentRepo) ListForWorker(ctx context.Context, workerID string, filter AssignmentFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.AssignmentWithShift], error) {
+	var cond conditions
+	cond.add("a.worker_id = ?", workerID)
+	if filter.Upcoming != nil {
+		if *filter.Upcoming {
+			cond.addRaw("s.end_time >= NOW()")
+			if spec.Sort.Field == "" {
+				spec.Sort = query.Sort{Field: "start_time"}
+			}
+		} else {
+			cond.addRaw("s.end_time < NOW()")
+		}
+	}
+
+	page, err := assignmentListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assignments by worker: %w", err)
+	}
+	return page, nil
+}
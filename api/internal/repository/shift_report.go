@@ -6,53 +6,75 @@ import (
 	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 // ShiftReportTemplateRepository defines the interface for shift report template data access.
 type ShiftReportTemplateRepository interface {
-	ListByCompany(ctx context.Context, companyID string, limit, offset int) ([]model.ShiftReportTemplate, error)
+	ListByCompany(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReportTemplate], error)
 	GetByID(ctx context.Context, id string) (*model.ShiftReportTemplate, error)
 	Create(ctx context.Context, template *model.ShiftReportTemplate) error
 	Update(ctx context.Context, template *model.ShiftReportTemplate) error
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string, version int) error
 }
 
 type shiftReportTemplateRepo struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewShiftReportTemplateRepository creates a new ShiftReportTemplateRepository.
-func NewShiftReportTemplateRepository(db *sql.DB) ShiftReportTemplateRepository {
+func NewShiftReportTemplateRepository(db Querier) ShiftReportTemplateRepository {
 	return &shiftReportTemplateRepo{db: db}
 }
 
-func (r *shiftReportTemplateRepo) ListByCompany(ctx context.Context, companyID string, limit, offset int) ([]model.ShiftReportTemplate, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, company_id, name, fields, created_at, updated_at
-		 FROM shift_report_templates WHERE company_id = $1 ORDER BY name LIMIT $2 OFFSET $3`,
-		companyID, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list shift report templates: %w", err)
-	}
-	defer rows.Close()
+// ShiftReportTemplateQuery is the filters and sort orders of the template
+// list, by name by default.
+var ShiftReportTemplateQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"name":       {Column: "name", Sortable: true},
+		"created_at": {Column: "created_at", Type: query.Time, Sortable: true},
+		"updated_at": {Column: "updated_at", Type: query.Time, Sortable: true},
+	},
+	Sort: query.Sort{Field: "name"},
+}
 
-	var templates []model.ShiftReportTemplate
-	for rows.Next() {
+var shiftReportTemplateListing = listing[model.ShiftReportTemplate]{
+	columns: `id, company_id, name, fields, version, created_at, updated_at`,
+	from:    "shift_report_templates",
+	schema:  ShiftReportTemplateQuery,
+	scan: func(row rowScanner) (model.ShiftReportTemplate, error) {
 		var t model.ShiftReportTemplate
-		if err := rows.Scan(&t.ID, &t.CompanyID, &t.Name, &t.Fields, &t.CreatedAt, &t.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan shift report template: %w", err)
+		if err := row.Scan(&t.ID, &t.CompanyID, &t.Name, &t.Fields, &t.Version, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return t, fmt.Errorf("failed to scan shift report template: %w", err)
 		}
-		templates = append(templates, t)
+		return t, nil
+	},
+	keys: map[string]func(model.ShiftReportTemplate) []string{
+		"name":       func(t model.ShiftReportTemplate) []string { return []string{t.Name} },
+		"created_at": func(t model.ShiftReportTemplate) []string { return []string{timeKey(t.CreatedAt)} },
+		"updated_at": func(t model.ShiftReportTemplate) []string { return []string{timeKey(t.UpdatedAt)} },
+	},
+	unique: "id",
+	id:     func(t model.ShiftReportTemplate) string { return t.ID },
+}
+
+func (r *shiftReportTemplateRepo) ListByCompany(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReportTemplate], error) {
+	var cond conditions
+	cond.add("company_id = ?", companyID)
+	page, err := shiftReportTemplateListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shift report templates: %w", err)
 	}
-	return templates, rows.Err()
+	return page, nil
 }
 
 func (r *shiftReportTemplateRepo) GetByID(ctx context.Context, id string) (*model.ShiftReportTemplate, error) {
 	var t model.ShiftReportTemplate
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, company_id, name, fields, created_at, updated_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, company_id, name, fields, version, created_at, updated_at
 		 FROM shift_report_templates WHERE id = $1`, id).
-		Scan(&t.ID, &t.CompanyID, &t.Name, &t.Fields, &t.CreatedAt, &t.UpdatedAt)
+		Scan(&t.ID, &t.CompanyID, &t.Name, &t.Fields, &t.Version, &t.CreatedAt, &t.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -63,12 +85,12 @@ func (r *shiftReportTemplateRepo) GetByID(ctx context.Context, id string) (*mode
 }
 
 func (r *shiftReportTemplateRepo) Create(ctx context.Context, template *model.ShiftReportTemplate) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO shift_report_templates (company_id, name, fields)
 		 VALUES ($1, $2, $3)
-		 RETURNING id, created_at, updated_at`,
+		 RETURNING id, version, created_at, updated_at`,
 		template.CompanyID, template.Name, template.Fields).
-		Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
+		Scan(&template.ID, &template.Version, &template.CreatedAt, &template.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create shift report template: %w", err)
 	}
@@ -76,89 +98,97 @@ func (r *shiftReportTemplateRepo) Create(ctx context.Context, template *model.Sh
 }
 
 func (r *shiftReportTemplateRepo) Update(ctx context.Context, template *model.ShiftReportTemplate) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE shift_report_templates SET name = $1, fields = $2, updated_at = NOW()
-		 WHERE id = $3`,
-		template.Name, template.Fields, template.ID)
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE shift_report_templates SET name = $1, fields = $2, version = version + 1, updated_at = NOW()
+		 WHERE id = $3 AND ($4 = 0 OR version = $4)
+		 RETURNING company_id, version, created_at, updated_at`,
+		template.Name, template.Fields, template.ID, template.Version).
+		Scan(&template.CompanyID, &template.Version, &template.CreatedAt, &template.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrVersionMismatch
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update shift report template: %w", err)
 	}
 	return nil
 }
 
-func (r *shiftReportTemplateRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM shift_report_templates WHERE id = $1`, id)
+func (r *shiftReportTemplateRepo) Delete(ctx context.Context, id string, version int) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM shift_report_templates WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
 	if err != nil {
 		return fmt.Errorf("failed to delete shift report template: %w", err)
 	}
-	return nil
+	return matched(res)
 }
 
 // ShiftReportRepository defines the interface for shift report data access.
 type ShiftReportRepository interface {
-	ListByShift(ctx context.Context, shiftID string, limit, offset int) ([]model.ShiftReport, error)
-	ListByWorker(ctx context.Context, workerID string, limit, offset int) ([]model.ShiftReport, error)
+	List(ctx context.Context, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReport], error)
+	ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReport], error)
 	GetByID(ctx context.Context, id string) (*model.ShiftReport, error)
 	Create(ctx context.Context, report *model.ShiftReport) error
 }
 
 type shiftReportRepo struct {
-	db *sql.DB
+	db Querier
 }
 
 // NewShiftReportRepository creates a new ShiftReportRepository.
-func NewShiftReportRepository(db *sql.DB) ShiftReportRepository {
+func NewShiftReportRepository(db Querier) ShiftReportRepository {
 	return &shiftReportRepo{db: db}
 }
 
-func (r *shiftReportRepo) ListByShift(ctx context.Context, shiftID string, limit, offset int) ([]model.ShiftReport, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, shift_id, worker_id, template_id, data, submitted_at
-		 FROM shift_reports WHERE shift_id = $1 ORDER BY submitted_at DESC LIMIT $2 OFFSET $3`,
-		shiftID, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list shift reports by shift: %w", err)
-	}
-	defer rows.Close()
+// shiftReportColumns are the columns scanShiftReport reads.
+const shiftReportColumns = `id, shift_id, worker_id, template_id, data, version, submitted_at`
+
+// ShiftReportQuery is the filters and sort orders of shift report lists,
+// newest first by default. ?since= and ?until= bound the submission time.
+var ShiftReportQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"shift_id":     {Column: "shift_id", Type: query.Text},
+		"worker_id":    {Column: "worker_id", Type: query.Text},
+		"template_id":  {Column: "template_id", Type: query.Text},
+		"submitted_at": {Column: "submitted_at", Type: query.Time, Sortable: true},
+	},
+	Sort:    query.Sort{Field: "submitted_at", Desc: true},
+	Aliases: map[string]string{"since": "submitted_at[gte]", "until": "submitted_at[lt]"},
+}
 
-	var reports []model.ShiftReport
-	for rows.Next() {
-		var sr model.ShiftReport
-		if err := rows.Scan(&sr.ID, &sr.ShiftID, &sr.WorkerID, &sr.TemplateID, &sr.Data, &sr.SubmittedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan shift report: %w", err)
-		}
-		reports = append(reports, sr)
+func scanShiftReport(row rowScanner) (model.ShiftReport, error) {
+	var sr model.ShiftReport
+	if err := row.Scan(&sr.ID, &sr.ShiftID, &sr.WorkerID, &sr.TemplateID, &sr.Data, &sr.Version, &sr.SubmittedAt); err != nil {
+		return sr, fmt.Errorf("failed to scan shift report: %w", err)
 	}
-	return reports, rows.Err()
+	return sr, nil
 }
 
-func (r *shiftReportRepo) ListByWorker(ctx context.Context, workerID string, limit, offset int) ([]model.ShiftReport, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, shift_id, worker_id, template_id, data, submitted_at
-		 FROM shift_reports WHERE worker_id = $1 ORDER BY submitted_at DESC LIMIT $2 OFFSET $3`,
-		workerID, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list shift reports by worker: %w", err)
-	}
-	defer rows.Close()
+var shiftReportListing = listing[model.ShiftReport]{
+	columns: shiftReportColumns,
+	from:    "shift_reports",
+	schema:  ShiftReportQuery,
+	scan:    scanShiftReport,
+	keys: map[string]func(model.ShiftReport) []string{
+		"submitted_at": func(sr model.ShiftReport) []string { return []string{timeKey(sr.SubmittedAt)} },
+	},
+	unique: "id",
+	id:     func(sr model.ShiftReport) string { return sr.ID },
+}
 
-	var reports []model.ShiftReport
-	for rows.Next() {
-		var sr model.ShiftReport
-		if err := rows.Scan(&sr.ID, &sr.ShiftID, &sr.WorkerID, &sr.TemplateID, &sr.Data, &sr.SubmittedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan shift report: %w", err)
-		}
-		reports = append(reports, sr)
+func (r *shiftReportRepo) List(ctx context.Context, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReport], error) {
+	page, err := shiftReportListing.page(ctx, r.db, conditions{}, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shift reports: %w", err)
 	}
-	return reports, rows.Err()
+	return page, nil
 }
 
 func (r *shiftReportRepo) GetByID(ctx context.Context, id string) (*model.ShiftReport, error) {
 	var sr model.ShiftReport
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, shift_id, worker_id, template_id, data, submitted_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, shift_id, worker_id, template_id, data, version, submitted_at
 		 FROM shift_reports WHERE id = $1`, id).
-		Scan(&sr.ID, &sr.ShiftID, &sr.WorkerID, &sr.TemplateID, &sr.Data, &sr.SubmittedAt)
+		Scan(&sr.ID, &sr.ShiftID, &sr.WorkerID, &sr.TemplateID, &sr.Data, &sr.Version, &sr.SubmittedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -169,14 +199,24 @@ func (r *shiftReportRepo) GetByID(ctx context.Context, id string) (*model.ShiftR
 }
 
 func (r *shiftReportRepo) Create(ctx context.Context, report *model.ShiftReport) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO shift_reports (shift_id, worker_id, template_id, data)
 		 VALUES ($1, $2, $3, $4)
-		 RETURNING id, submitted_at`,
+		 RETURNING id, version, submitted_at`,
 		report.ShiftID, report.WorkerID, report.TemplateID, report.Data).
-		Scan(&report.ID, &report.SubmittedAt)
+		Scan(&report.ID, &report.Version, &report.SubmittedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create shift report: %w", err)
 	}
 	return nil
 }
+
+func (r *shiftReportRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReport], error) {
+	var cond conditions
+	cond.add("worker_id = ?", workerID)
+	page, err := shiftReportListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shift reports by worker: %w", err)
+	}
+	return page, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+)
+
+// StatsRepository counts records across every company for the metrics
+// endpoint. It must be built on a connection that bypasses row-level
+// security.
+type StatsRepository interface {
+	CountOpenAlarms(ctx context.Context) (map[model.AlarmStatus]int, error)
+	CountShiftsInProgress(ctx context.Context) (int, error)
+}
+
+type statsRepo struct {
+	db Querier
+}
+
+func NewStatsRepository(db Querier) StatsRepository {
+	return &statsRepo{db: db}
+}
+
+func (r *statsRepo) CountOpenAlarms(ctx context.Context) (map[model.AlarmStatus]int, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT status, COUNT(*) FROM alarms WHERE status <> $1 GROUP BY status`, model.AlarmResolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count open alarms: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[model.AlarmStatus]int)
+	for rows.Next() {
+		var status model.AlarmStatus
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan alarm count: %w", err)
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+func (r *statsRepo) CountShiftsInProgress(ctx context.Context) (int, error) {
+	var n int
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM shifts WHERE status = $1`, model.ShiftInProgress).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count shifts in progress: %w", err)
+	}
+	return n, nil
+}
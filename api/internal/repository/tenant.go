@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// tenantRole is the database role a tenant session runs as. Row-level
+// security policies on the tenant tables apply to it; the connection's own
+// role owns the tables and bypasses them, which is what system jobs such as
+// migrations, seeding and login provisioning rely on.
+const tenantRole = "sitesecurity_tenant"
+
+// Tenant identifies whose data a request may see: rows of CompanyIDs, plus
+// the worker's own memberships, check-ins, alarms, assignments and reports.
+type Tenant struct {
+	WorkerID   string
+	CompanyIDs []string
+}
+
+// Tx is a tenant session's transaction.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+// Tenants starts tenant sessions on a database.
+type Tenants struct {
+	db *sql.DB
+}
+
+func NewTenants(db *sql.DB) *Tenants {
+	return &Tenants{db: db}
+}
+
+// Begin starts a transaction limited by row-level security to tenant's
+// rows and returns a context carrying it. Repositories called with that
+// context query through the transaction; the caller commits or rolls it
+// back. The transaction is READ COMMITTED, so a unit of work inside it is
+// a savepoint that relies on conditional writes rather than serializable
+// isolation (see Transactor.Do).
+func (t *Tenants) Begin(ctx context.Context, tenant Tenant) (context.Context, Tx, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin tenant transaction: %w", err)
+	}
+	q := traced(tx)
+	if _, err := q.ExecContext(ctx, `SET LOCAL ROLE `+tenantRole); err != nil {
+		tx.Rollback()
+		return nil, nil, fmt.Errorf("failed to assume tenant role: %w", err)
+	}
+	_, err = q.ExecContext(ctx,
+		`SELECT set_config('app.current_worker_id', $1, true), set_config('app.current_company_ids', $2, true)`,
+		tenant.WorkerID, strings.Join(tenant.CompanyIDs, ","))
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, fmt.Errorf("failed to set tenant: %w", err)
+	}
+	return withTx(ctx, tx), tx, nil
+}
+
+// addTenantCompany widens the tenant session in ctx, if any, to companyID
+// so a company's creator can act on it for the rest of the request.
+func addTenantCompany(ctx context.Context, companyID string) error {
+	tx, ok := txFrom(ctx)
+	if !ok {
+		return nil
+	}
+	_, err := traced(tx).ExecContext(ctx,
+		`SELECT set_config('app.current_company_ids',
+			concat_ws(',', NULLIF(current_setting('app.current_company_ids', true), ''), $1::text), true)`,
+		companyID)
+	if err != nil {
+		return fmt.Errorf("failed to add company to tenant: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/tracing"
+)
+
+var tracer = tracing.Tracer("repository")
+
+// tracedQuerier runs each statement in a span of its own, a child of the
+// span in the statement's context. The span carries the statement's text,
+// whose values are placeholders, never its arguments.
+type tracedQuerier struct {
+	q Querier
+}
+
+func traced(q Querier) Querier {
+	if _, ok := q.(tracedQuerier); ok {
+		return q
+	}
+	return tracedQuerier{q: q}
+}
+
+func (t tracedQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startStatement(ctx, query)
+	defer span.End()
+	res, err := t.q.ExecContext(ctx, query, args...)
+	recordError(span, err)
+	return res, err
+}
+
+func (t tracedQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startStatement(ctx, query)
+	defer span.End()
+	rows, err := t.q.QueryContext(ctx, query, args...)
+	recordError(span, err)
+	return rows, err
+}
+
+func (t tracedQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startStatement(ctx, query)
+	defer span.End()
+	row := t.q.QueryRowContext(ctx, query, args...)
+	recordError(span, row.Err())
+	return row
+}
+
+// startStatement starts a span named by the statement's operation, such as
+// "SELECT", as the Postgres semantic conventions suggest.
+func startStatement(ctx context.Context, query string) (context.Context, trace.Span) {
+	var operation string
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	return tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+func recordError(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,42 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+	"github.com/chrishaylesai/sitesecurity/api/internal/tracing/tracingtest"
+)
+
+func TestStatementsAreTraced(t *testing.T) {
+	spans := tracingtest.Record(t)
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	spans.Reset()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "GET /worksites/{id}")
+	if _, err := repository.NewWorksiteRepository(db).GetByID(ctx, f.worksite.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	span := tracingtest.Find(t, spans, "SELECT")
+	if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the statement to be a child of the caller's span")
+	}
+	attrs := attribute.NewSet(span.Attributes...)
+	if v, _ := attrs.Value("db.query.text"); !strings.Contains(v.AsString(), "FROM worksites WHERE id = $1") {
+		t.Errorf("expected the statement text, got %q", v.AsString())
+	}
+	for _, kv := range span.Attributes {
+		if strings.Contains(kv.Value.Emit(), f.worksite.ID) {
+			t.Errorf("expected the statement's arguments to be left out, got %s=%s", kv.Key, kv.Value.Emit())
+		}
+	}
+}
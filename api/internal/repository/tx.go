@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+)
+
+// Querier is what repositories run statements on: a *sql.DB, or a *sql.Tx
+// when a repository is built for one transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+func withTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+func txFrom(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// conn returns the transaction carried by ctx, a tenant session's or a
+// unit of work's, or db when there is none, tracing each statement.
+func conn(ctx context.Context, db Querier) Querier {
+	if tx, ok := txFrom(ctx); ok {
+		return traced(tx)
+	}
+	return traced(db)
+}
+
+// inTx runs fn in the transaction carried by ctx, or otherwise in a
+// transaction of its own. A repository built on a *sql.Tx uses that.
+func inTx(ctx context.Context, db Querier, fn func(q Querier) error) error {
+	if tx, ok := txFrom(ctx); ok {
+		return fn(traced(tx))
+	}
+	sqlDB, ok := db.(*sql.DB)
+	if !ok {
+		return fn(traced(db))
+	}
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(traced(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// maxAttempts is how many times a unit of work is run before a
+// serialization failure is returned to the caller.
+const maxAttempts = 3
+
+// Transactor runs units of work: functions whose repository calls share
+// one transaction.
+type Transactor struct {
+	db *sql.DB
+}
+
+func NewTransactor(db *sql.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+// Do runs fn with a context whose repository calls share a transaction,
+// committed if fn returns nil and rolled back otherwise.
+//
+// Inside a tenant session, or another unit of work, fn runs in that
+// transaction under a savepoint, so its writes are undone if it fails and
+// otherwise commit with the request. It then has the session's READ
+// COMMITTED isolation and is never retried: request writes stay correct
+// under concurrency through conditional updates on a row's version or
+// state, such as Fill, and unique constraints that turn a racing insert
+// into ErrDuplicate, not through serializable isolation.
+//
+// On its own, fn runs in a serializable transaction and is run again, up to
+// maxAttempts times, if Postgres aborts it for conflicting with a
+// concurrent one; fn must therefore not have effects outside the database.
+func (t *Transactor) Do(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	ctx, span := tracer.Start(ctx, "unit of work")
+	defer func() {
+		recordError(span, err)
+		span.End()
+	}()
+
+	if tx, ok := txFrom(ctx); ok {
+		return savepoint(ctx, tx, fn)
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = t.attempt(ctx, fn); err == nil || !isRetryable(err) {
+			return err
+		}
+		span.AddEvent("serialization failure", trace.WithAttributes(attribute.Int("attempt", attempt)))
+		logging.FromContext(ctx).Warn("retrying unit of work", slog.Int("attempt", attempt), logging.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", maxAttempts, err)
+}
+
+func (t *Transactor) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := t.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(withTx(ctx, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// savepoint runs fn within tx, rolling back only fn's writes if it fails.
+func savepoint(ctx context.Context, tx *sql.Tx, fn func(ctx context.Context) error) error {
+	q := traced(tx)
+	if _, err := q.ExecContext(ctx, `SAVEPOINT unit_of_work`); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	if err := fn(ctx); err != nil {
+		if _, rbErr := q.ExecContext(ctx, `ROLLBACK TO SAVEPOINT unit_of_work`); rbErr != nil {
+			return fmt.Errorf("failed to roll back to savepoint: %v (after %w)", rbErr, err)
+		}
+		return err
+	}
+	if _, err := q.ExecContext(ctx, `RELEASE SAVEPOINT unit_of_work`); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+func TestTransactor_RollsBackFailedWork(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	worksites := repository.NewWorksiteRepository(db)
+	uow := repository.NewTransactor(db)
+	failed := errors.New("second step failed")
+
+	ws := model.Worksite{CompanyID: f.company.ID, Name: "Rolled back"}
+	err := uow.Do(context.Background(), func(ctx context.Context) error {
+		if err := worksites.Create(ctx, &ws); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected the unit of work's error, got %v", err)
+	}
+	if got, err := worksites.GetByID(context.Background(), ws.ID); err != nil || got != nil {
+		t.Errorf("expected the worksite to be rolled back, got %v (err %v)", got, err)
+	}
+
+	err = uow.Do(context.Background(), func(ctx context.Context) error {
+		return worksites.Create(ctx, &ws)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, err := worksites.GetByID(context.Background(), ws.ID); err != nil || got == nil {
+		t.Errorf("expected the worksite to be committed, got err %v", err)
+	}
+}
+
+func TestTransactor_SavepointInTenantSession(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	other := newTenantFixture(t, db, "rival")
+	worksites := repository.NewWorksiteRepository(db)
+	uow := repository.NewTransactor(db)
+
+	ctx, tx, err := repository.NewTenants(db).Begin(context.Background(), repository.Tenant{
+		WorkerID:   f.worker.ID,
+		CompanyIDs: []string{f.company.ID},
+	})
+	if err != nil {
+		t.Fatalf("failed to begin tenant session: %v", err)
+	}
+	defer tx.Rollback()
+
+	undone := model.Worksite{CompanyID: f.company.ID, Name: "Undone"}
+	err = uow.Do(ctx, func(ctx context.Context) error {
+		if err := worksites.Create(ctx, &undone); err != nil {
+			return err
+		}
+		// Row-level security rejects the write and aborts the statement;
+		// the savepoint keeps the session usable.
+		return worksites.Create(ctx, &model.Worksite{CompanyID: other.company.ID, Name: "Trespass"})
+	})
+	if err == nil {
+		t.Fatal("expected the cross-tenant worksite to fail")
+	}
+
+	kept := model.Worksite{CompanyID: f.company.ID, Name: "Kept"}
+	if err := worksites.Create(ctx, &kept); err != nil {
+		t.Fatalf("expected the tenant session to survive a failed unit of work, got %v", err)
+	}
+	if got, err := worksites.GetByID(ctx, undone.ID); err != nil || got != nil {
+		t.Errorf("expected the failed unit's worksite to be undone, got %v (err %v)", got, err)
+	}
+}
@@ -0,0 +1,119 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+func TestConditionalUpdate_RejectsStaleVersion(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	shifts := repository.NewShiftRepository(db)
+	ctx := context.Background()
+
+	read := f.shift
+	if read.Version != 1 {
+		t.Fatalf("expected a new shift to be version 1, got %d", read.Version)
+	}
+
+	first := read
+	first.Title = "Dispatcher one"
+	if err := shifts.Update(ctx, &first); err != nil {
+		t.Fatalf("failed to update shift: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("expected the update to bump the version to 2, got %d", first.Version)
+	}
+
+	second := read
+	second.Title = "Dispatcher two"
+	if err := shifts.Update(ctx, &second); !errors.Is(err, repository.ErrVersionMismatch) {
+		t.Fatalf("expected ErrVersionMismatch for a stale update, got %v", err)
+	}
+	if err := shifts.Delete(ctx, read.ID, read.Version); !errors.Is(err, repository.ErrVersionMismatch) {
+		t.Fatalf("expected ErrVersionMismatch for a stale delete, got %v", err)
+	}
+
+	stored, err := shifts.GetByID(ctx, read.ID)
+	if err != nil {
+		t.Fatalf("failed to get shift: %v", err)
+	}
+	if stored.Title != "Dispatcher one" || stored.Version != 2 {
+		t.Errorf("expected the first edit to survive, got %q at version %d", stored.Title, stored.Version)
+	}
+
+	if err := shifts.UpdateStatus(ctx, read.ID, model.ShiftCancelled, 0); err != nil {
+		t.Errorf("expected an unconditional status change to succeed, got %v", err)
+	}
+}
+
+// Two workers accepting the same open shift both fill it; only the first
+// moves it, and the second finds it filled rather than a stale version.
+func TestFill_OnlyOnce(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	shifts := repository.NewShiftRepository(db)
+	ctx := context.Background()
+
+	version, err := shifts.Fill(ctx, f.shift.ID)
+	if err != nil || version != f.shift.Version+1 {
+		t.Fatalf("expected the open shift to be filled at version %d, got %d (err %v)", f.shift.Version+1, version, err)
+	}
+	if version, err := shifts.Fill(ctx, f.shift.ID); err != nil || version != 0 {
+		t.Errorf("expected a filled shift to be left as it is, got version %d (err %v)", version, err)
+	}
+	stored, err := shifts.GetByID(ctx, f.shift.ID)
+	if err != nil {
+		t.Fatalf("failed to get shift: %v", err)
+	}
+	if stored.Status != model.ShiftAssigned {
+		t.Errorf("expected the shift to be assigned, got %s", stored.Status)
+	}
+}
+
+func TestConditionalUpdate_MembershipAndAssignment(t *testing.T) {
+	db := openTestDB(t)
+	f := newTenantFixture(t, db, "sentinel")
+	ctx := context.Background()
+
+	memberships := repository.NewWorkerCompanyRepository(db)
+	read, err := memberships.Get(ctx, f.worker.ID, f.company.ID)
+	if err != nil || read == nil || read.Version != 1 {
+		t.Fatalf("expected a new membership at version 1, got %+v (err %v)", read, err)
+	}
+	first := *read
+	first.Role = model.RoleSiteAdmin
+	if err := memberships.UpdateRole(ctx, &first); err != nil || first.Version != 2 {
+		t.Fatalf("expected the role change to bump the version to 2, got %d (err %v)", first.Version, err)
+	}
+	second := *read
+	second.Role = model.RoleWorker
+	if err := memberships.UpdateRole(ctx, &second); !errors.Is(err, repository.ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch for a stale role change, got %v", err)
+	}
+	if err := memberships.Delete(ctx, f.worker.ID, f.company.ID, read.Version); !errors.Is(err, repository.ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch for a stale removal, got %v", err)
+	}
+
+	assignments := repository.NewShiftAssignmentRepository(db)
+	offer := model.ShiftAssignment{ShiftID: f.shift.ID, WorkerID: f.worker.ID, Status: model.AssignmentOffered}
+	if err := assignments.Create(ctx, &offer); err != nil || offer.Version != 1 {
+		t.Fatalf("expected a new assignment at version 1, got %d (err %v)", offer.Version, err)
+	}
+	accepted := offer
+	accepted.Status = model.AssignmentAccepted
+	if err := assignments.UpdateStatus(ctx, &accepted); err != nil || accepted.Version != 2 || accepted.RespondedAt == nil {
+		t.Fatalf("expected the response recorded at version 2, got %+v (err %v)", accepted, err)
+	}
+	declined := offer
+	declined.Status = model.AssignmentDeclined
+	if err := assignments.UpdateStatus(ctx, &declined); !errors.Is(err, repository.ErrVersionMismatch) {
+		t.Errorf("expected ErrVersionMismatch for a stale response, got %v", err)
+	}
+}
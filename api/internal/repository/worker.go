@@ -6,51 +6,82 @@ import (
 	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 type WorkerRepository interface {
-	List(ctx context.Context, limit, offset int) ([]model.Worker, error)
+	List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Worker], error)
 	GetByID(ctx context.Context, id string) (*model.Worker, error)
 	GetByAuthSubject(ctx context.Context, authSubject string) (*model.Worker, error)
+	GetByEmail(ctx context.Context, email string) (*model.Worker, error)
 	Create(ctx context.Context, worker *model.Worker) error
 	Update(ctx context.Context, worker *model.Worker) error
+	// Link attaches worker.AuthSubject to a worker that has not been linked
+	// yet, reporting false if it was already linked.
+	Link(ctx context.Context, worker *model.Worker) (bool, error)
 	Delete(ctx context.Context, id string) error
 }
 
 type workerRepo struct {
-	db *sql.DB
+	db Querier
 }
 
-func NewWorkerRepository(db *sql.DB) WorkerRepository {
+func NewWorkerRepository(db Querier) WorkerRepository {
 	return &workerRepo{db: db}
 }
 
-func (r *workerRepo) List(ctx context.Context, limit, offset int) ([]model.Worker, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, auth_subject, first_name, last_name, email, phone, created_at, updated_at
-		FROM workers ORDER BY last_name, first_name LIMIT $1 OFFSET $2`, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list workers: %w", err)
-	}
-	defer rows.Close()
+// WorkerQuery is the filters and sort orders of the worker list, by last
+// then first name by default.
+var WorkerQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"email":      {Column: "email", Type: query.Text, Sortable: true},
+		"last_name":  {Column: "last_name", Sortable: true, Order: []string{"last_name", "first_name"}},
+		"first_name": {Column: "first_name", Sortable: true},
+		"created_at": {Column: "created_at", Type: query.Time, Sortable: true},
+	},
+	Sort: query.Sort{Field: "last_name"},
+}
 
-	var workers []model.Worker
-	for rows.Next() {
+var workerListing = listing[model.Worker]{
+	columns: `id, auth_subject, first_name, last_name, email, phone, auth_linked_at, version, created_at, updated_at`,
+	from:    "workers",
+	schema:  WorkerQuery,
+	scan: func(row rowScanner) (model.Worker, error) {
 		var w model.Worker
-		if err := rows.Scan(&w.ID, &w.AuthSubject, &w.FirstName, &w.LastName, &w.Email, &w.Phone, &w.CreatedAt, &w.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan worker: %w", err)
+		if err := row.Scan(&w.ID, &w.AuthSubject, &w.FirstName, &w.LastName, &w.Email, &w.Phone, &w.AuthLinkedAt, &w.Version, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return w, fmt.Errorf("failed to scan worker: %w", err)
 		}
-		workers = append(workers, w)
+		return w, nil
+	},
+	keys: map[string]func(model.Worker) []string{
+		"email":      func(w model.Worker) []string { return []string{w.Email} },
+		"last_name":  func(w model.Worker) []string { return []string{w.LastName, w.FirstName} },
+		"first_name": func(w model.Worker) []string { return []string{w.FirstName} },
+		"created_at": func(w model.Worker) []string { return []string{timeKey(w.CreatedAt)} },
+	},
+	unique: "id",
+	id:     func(w model.Worker) string { return w.ID },
+}
+
+// List returns a page of the workers with a membership of companyID, in
+// any status.
+func (r *workerRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Worker], error) {
+	var cond conditions
+	cond.add("EXISTS (SELECT 1 FROM worker_companies wc WHERE wc.worker_id = workers.id AND wc.company_id = ?)", companyID)
+	page, err := workerListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
 	}
-	return workers, rows.Err()
+	return page, nil
 }
 
 func (r *workerRepo) GetByID(ctx context.Context, id string) (*model.Worker, error) {
 	var w model.Worker
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, auth_subject, first_name, last_name, email, phone, created_at, updated_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, auth_subject, first_name, last_name, email, phone, auth_linked_at, version, created_at, updated_at
 		FROM workers WHERE id = $1`, id).
-		Scan(&w.ID, &w.AuthSubject, &w.FirstName, &w.LastName, &w.Email, &w.Phone, &w.CreatedAt, &w.UpdatedAt)
+		Scan(&w.ID, &w.AuthSubject, &w.FirstName, &w.LastName, &w.Email, &w.Phone, &w.AuthLinkedAt, &w.Version, &w.CreatedAt, &w.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -62,10 +93,10 @@ func (r *workerRepo) GetByID(ctx context.Context, id string) (*model.Worker, err
 
 func (r *workerRepo) GetByAuthSubject(ctx context.Context, authSubject string) (*model.Worker, error) {
 	var w model.Worker
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, auth_subject, first_name, last_name, email, phone, created_at, updated_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, auth_subject, first_name, last_name, email, phone, auth_linked_at, version, created_at, updated_at
 		FROM workers WHERE auth_subject = $1`, authSubject).
-		Scan(&w.ID, &w.AuthSubject, &w.FirstName, &w.LastName, &w.Email, &w.Phone, &w.CreatedAt, &w.UpdatedAt)
+		Scan(&w.ID, &w.AuthSubject, &w.FirstName, &w.LastName, &w.Email, &w.Phone, &w.AuthLinkedAt, &w.Version, &w.CreatedAt, &w.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -75,32 +106,86 @@ func (r *workerRepo) GetByAuthSubject(ctx context.Context, authSubject string) (
 	return &w, nil
 }
 
+func (r *workerRepo) GetByEmail(ctx context.Context, email string) (*model.Worker, error) {
+	var w model.Worker
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, auth_subject, first_name, last_name, email, phone, auth_linked_at, version, created_at, updated_at
+		FROM workers WHERE LOWER(email) = LOWER($1)`, email).
+		Scan(&w.ID, &w.AuthSubject, &w.FirstName, &w.LastName, &w.Email, &w.Phone, &w.AuthLinkedAt, &w.Version, &w.CreatedAt, &w.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worker by email: %w", err)
+	}
+	return &w, nil
+}
+
 func (r *workerRepo) Create(ctx context.Context, worker *model.Worker) error {
-	err := r.db.QueryRowContext(ctx,
-		`INSERT INTO workers (auth_subject, first_name, last_name, email, phone)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, updated_at`,
-		worker.AuthSubject, worker.FirstName, worker.LastName, worker.Email, worker.Phone).
-		Scan(&worker.ID, &worker.CreatedAt, &worker.UpdatedAt)
+	err := insertWorker(ctx, conn(ctx, r.db), worker)
+	if isDuplicate(err) {
+		return ErrDuplicate
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create worker: %w", err)
 	}
 	return nil
 }
 
+// insertWorker adds a worker through q. A tenant session cannot read a
+// worker back before they have a membership of one of its companies, so
+// the ID and timestamps are drawn before the insert rather than returned
+// by it.
+func insertWorker(ctx context.Context, q Querier, worker *model.Worker) error {
+	if err := q.QueryRowContext(ctx, `SELECT gen_random_uuid(), NOW()`).Scan(&worker.ID, &worker.CreatedAt); err != nil {
+		return err
+	}
+	worker.UpdatedAt, worker.Version = worker.CreatedAt, 1
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO workers (id, auth_subject, first_name, last_name, email, phone, auth_linked_at, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)`,
+		worker.ID, worker.AuthSubject, worker.FirstName, worker.LastName, worker.Email, worker.Phone, worker.AuthLinkedAt,
+		worker.Version, worker.CreatedAt)
+	return err
+}
+
 func (r *workerRepo) Update(ctx context.Context, worker *model.Worker) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE workers SET first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = NOW()
-		WHERE id = $5`,
-		worker.FirstName, worker.LastName, worker.Email, worker.Phone, worker.ID)
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE workers SET first_name = $1, last_name = $2, email = $3, phone = $4, version = version + 1, updated_at = NOW()
+		WHERE id = $5 AND ($6 = 0 OR version = $6)
+		RETURNING auth_subject, auth_linked_at, version, created_at, updated_at`,
+		worker.FirstName, worker.LastName, worker.Email, worker.Phone, worker.ID, worker.Version).
+		Scan(&worker.AuthSubject, &worker.AuthLinkedAt, &worker.Version, &worker.CreatedAt, &worker.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrVersionMismatch
+	}
+	if isDuplicate(err) {
+		return ErrDuplicate
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update worker: %w", err)
 	}
 	return nil
 }
 
+func (r *workerRepo) Link(ctx context.Context, worker *model.Worker) (bool, error) {
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE workers SET auth_subject = $1, first_name = $2, last_name = $3, auth_linked_at = NOW(), updated_at = NOW()
+		WHERE id = $4 AND auth_linked_at IS NULL
+		RETURNING auth_linked_at, updated_at`,
+		worker.AuthSubject, worker.FirstName, worker.LastName, worker.ID).
+		Scan(&worker.AuthLinkedAt, &worker.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to link worker: %w", err)
+	}
+	return true, nil
+}
+
 func (r *workerRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM workers WHERE id = $1`, id)
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM workers WHERE id = $1`, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete worker: %w", err)
 	}
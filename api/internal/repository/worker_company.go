@@ -6,29 +6,32 @@ import (
 	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 type WorkerCompanyRepository interface {
 	ListByWorker(ctx context.Context, workerID string) ([]model.WorkerCompany, error)
+	ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.WorkerCompany], error)
 	ListByCompany(ctx context.Context, companyID string) ([]model.WorkerCompany, error)
 	Get(ctx context.Context, workerID, companyID string) (*model.WorkerCompany, error)
 	Create(ctx context.Context, wc *model.WorkerCompany) error
-	UpdateRole(ctx context.Context, workerID, companyID string, role model.WorkerRole) error
+	UpdateRole(ctx context.Context, wc *model.WorkerCompany) error
 	UpdateStatus(ctx context.Context, workerID, companyID string, status model.MembershipStatus) error
-	Delete(ctx context.Context, workerID, companyID string) error
+	Delete(ctx context.Context, workerID, companyID string, version int) error
 }
 
 type workerCompanyRepo struct {
-	db *sql.DB
+	db Querier
 }
 
-func NewWorkerCompanyRepository(db *sql.DB) WorkerCompanyRepository {
+func NewWorkerCompanyRepository(db Querier) WorkerCompanyRepository {
 	return &workerCompanyRepo{db: db}
 }
 
 func (r *workerCompanyRepo) ListByWorker(ctx context.Context, workerID string) ([]model.WorkerCompany, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT worker_id, company_id, role, status, joined_at
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT worker_id, company_id, role, status, version, joined_at
 		FROM worker_companies WHERE worker_id = $1`, workerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list worker companies: %w", err)
@@ -38,7 +41,7 @@ func (r *workerCompanyRepo) ListByWorker(ctx context.Context, workerID string) (
 	var memberships []model.WorkerCompany
 	for rows.Next() {
 		var wc model.WorkerCompany
-		if err := rows.Scan(&wc.WorkerID, &wc.CompanyID, &wc.Role, &wc.Status, &wc.JoinedAt); err != nil {
+		if err := rows.Scan(&wc.WorkerID, &wc.CompanyID, &wc.Role, &wc.Status, &wc.Version, &wc.JoinedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan worker company: %w", err)
 		}
 		memberships = append(memberships, wc)
@@ -47,8 +50,8 @@ func (r *workerCompanyRepo) ListByWorker(ctx context.Context, workerID string) (
 }
 
 func (r *workerCompanyRepo) ListByCompany(ctx context.Context, companyID string) ([]model.WorkerCompany, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT worker_id, company_id, role, status, joined_at
+	rows, err := conn(ctx, r.db).QueryContext(ctx,
+		`SELECT worker_id, company_id, role, status, version, joined_at
 		FROM worker_companies WHERE company_id = $1`, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list company workers: %w", err)
@@ -58,7 +61,7 @@ func (r *workerCompanyRepo) ListByCompany(ctx context.Context, companyID string)
 	var memberships []model.WorkerCompany
 	for rows.Next() {
 		var wc model.WorkerCompany
-		if err := rows.Scan(&wc.WorkerID, &wc.CompanyID, &wc.Role, &wc.Status, &wc.JoinedAt); err != nil {
+		if err := rows.Scan(&wc.WorkerID, &wc.CompanyID, &wc.Role, &wc.Status, &wc.Version, &wc.JoinedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan worker company: %w", err)
 		}
 		memberships = append(memberships, wc)
@@ -68,10 +71,10 @@ func (r *workerCompanyRepo) ListByCompany(ctx context.Context, companyID string)
 
 func (r *workerCompanyRepo) Get(ctx context.Context, workerID, companyID string) (*model.WorkerCompany, error) {
 	var wc model.WorkerCompany
-	err := r.db.QueryRowContext(ctx,
-		`SELECT worker_id, company_id, role, status, joined_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT worker_id, company_id, role, status, version, joined_at
 		FROM worker_companies WHERE worker_id = $1 AND company_id = $2`, workerID, companyID).
-		Scan(&wc.WorkerID, &wc.CompanyID, &wc.Role, &wc.Status, &wc.JoinedAt)
+		Scan(&wc.WorkerID, &wc.CompanyID, &wc.Role, &wc.Status, &wc.Version, &wc.JoinedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -82,22 +85,33 @@ func (r *workerCompanyRepo) Get(ctx context.Context, workerID, companyID string)
 }
 
 func (r *workerCompanyRepo) Create(ctx context.Context, wc *model.WorkerCompany) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO worker_companies (worker_id, company_id, role, status)
 		VALUES ($1, $2, $3, $4)
-		RETURNING joined_at`,
+		RETURNING version, joined_at`,
 		wc.WorkerID, wc.CompanyID, wc.Role, wc.Status).
-		Scan(&wc.JoinedAt)
+		Scan(&wc.Version, &wc.JoinedAt)
+	if isDuplicate(err) {
+		return ErrDuplicate
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create worker company: %w", err)
 	}
 	return nil
 }
 
-func (r *workerCompanyRepo) UpdateRole(ctx context.Context, workerID, companyID string, role model.WorkerRole) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE worker_companies SET role = $1 WHERE worker_id = $2 AND company_id = $3`,
-		role, workerID, companyID)
+// UpdateRole sets the membership's role, conditional on wc.Version unless
+// it is 0, and sets wc.Version to the new one.
+func (r *workerCompanyRepo) UpdateRole(ctx context.Context, wc *model.WorkerCompany) error {
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE worker_companies SET role = $1, version = version + 1
+		WHERE worker_id = $2 AND company_id = $3 AND ($4 = 0 OR version = $4)
+		RETURNING version`,
+		wc.Role, wc.WorkerID, wc.CompanyID, wc.Version).
+		Scan(&wc.Version)
+	if err == sql.ErrNoRows {
+		return ErrVersionMismatch
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update worker role: %w", err)
 	}
@@ -105,8 +119,8 @@ func (r *workerCompanyRepo) UpdateRole(ctx context.Context, workerID, companyID
 }
 
 func (r *workerCompanyRepo) UpdateStatus(ctx context.Context, workerID, companyID string, status model.MembershipStatus) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE worker_companies SET status = $1 WHERE worker_id = $2 AND company_id = $3`,
+	_, err := conn(ctx, r.db).ExecContext(ctx,
+		`UPDATE worker_companies SET status = $1, version = version + 1 WHERE worker_id = $2 AND company_id = $3`,
 		status, workerID, companyID)
 	if err != nil {
 		return fmt.Errorf("failed to update membership status: %w", err)
@@ -114,12 +128,54 @@ func (r *workerCompanyRepo) UpdateStatus(ctx context.Context, workerID, companyI
 	return nil
 }
 
-func (r *workerCompanyRepo) Delete(ctx context.Context, workerID, companyID string) error {
-	_, err := r.db.ExecContext(ctx,
-		`DELETE FROM worker_companies WHERE worker_id = $1 AND company_id = $2`,
-		workerID, companyID)
+func (r *workerCompanyRepo) Delete(ctx context.Context, workerID, companyID string, version int) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM worker_companies WHERE worker_id = $1 AND company_id = $2 AND ($3 = 0 OR version = $3)`,
+		workerID, companyID, version)
 	if err != nil {
 		return fmt.Errorf("failed to delete worker company: %w", err)
 	}
-	return nil
+	return matched(res)
+}
+
+// MembershipQuery is the filters and sort order of a worker's memberships,
+// most recently joined first by default.
+var MembershipQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"company_id": {Column: "company_id", Type: query.Text},
+		"status": {Column: "status", Type: query.Text, Values: []string{
+			string(model.MembershipActive), string(model.MembershipInactive)}},
+		"role": {Column: "role", Type: query.Text, Values: []string{
+			string(model.RoleWorker), string(model.RoleCompanyAdmin), string(model.RoleSiteAdmin)}},
+		"joined_at": {Column: "joined_at", Type: query.Time, Sortable: true},
+	},
+	Sort: query.Sort{Field: "joined_at", Desc: true},
+}
+
+var membershipListing = listing[model.WorkerCompany]{
+	columns: `worker_id, company_id, role, status, version, joined_at`,
+	from:    "worker_companies",
+	schema:  MembershipQuery,
+	scan: func(row rowScanner) (model.WorkerCompany, error) {
+		var wc model.WorkerCompany
+		if err := row.Scan(&wc.WorkerID, &wc.CompanyID, &wc.Role, &wc.Status, &wc.Version, &wc.JoinedAt); err != nil {
+			return wc, fmt.Errorf("failed to scan worker company: %w", err)
+		}
+		return wc, nil
+	},
+	keys: map[string]func(model.WorkerCompany) []string{
+		"joined_at": func(wc model.WorkerCompany) []string { return []string{timeKey(wc.JoinedAt)} },
+	},
+	unique: "company_id",
+	id:     func(wc model.WorkerCompany) string { return wc.CompanyID },
+}
+
+func (r *workerCompanyRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.WorkerCompany], error) {
+	var cond conditions
+	cond.add("worker_id = ?", workerID)
+	page, err := membershipListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worker companies: %w", err)
+	}
+	return page, nil
 }
@@ -6,50 +6,70 @@ import (
 	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 )
 
 type WorksiteRepository interface {
-	List(ctx context.Context, companyID string, limit, offset int) ([]model.Worksite, error)
+	List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Worksite], error)
 	GetByID(ctx context.Context, id string) (*model.Worksite, error)
 	Create(ctx context.Context, worksite *model.Worksite) error
 	Update(ctx context.Context, worksite *model.Worksite) error
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string, version int) error
 }
 
 type worksiteRepo struct {
-	db *sql.DB
+	db Querier
 }
 
-func NewWorksiteRepository(db *sql.DB) WorksiteRepository {
+func NewWorksiteRepository(db Querier) WorksiteRepository {
 	return &worksiteRepo{db: db}
 }
 
-func (r *worksiteRepo) List(ctx context.Context, companyID string, limit, offset int) ([]model.Worksite, error) {
-	query := `SELECT id, company_id, name, address, latitude, longitude, created_at, updated_at
-		FROM worksites WHERE company_id = $1 ORDER BY name LIMIT $2 OFFSET $3`
-	rows, err := r.db.QueryContext(ctx, query, companyID, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list worksites: %w", err)
-	}
-	defer rows.Close()
+// WorksiteQuery is the sort orders of the worksite list, by name by default.
+var WorksiteQuery = query.Schema{
+	Fields: map[string]query.Field{
+		"name":       {Column: "name", Sortable: true},
+		"created_at": {Column: "created_at", Type: query.Time, Sortable: true},
+	},
+	Sort: query.Sort{Field: "name"},
+}
 
-	var worksites []model.Worksite
-	for rows.Next() {
+var worksiteListing = listing[model.Worksite]{
+	columns: `id, company_id, name, address, latitude, longitude, version, created_at, updated_at`,
+	from:    "worksites",
+	schema:  WorksiteQuery,
+	scan: func(row rowScanner) (model.Worksite, error) {
 		var w model.Worksite
-		if err := rows.Scan(&w.ID, &w.CompanyID, &w.Name, &w.Address, &w.Latitude, &w.Longitude, &w.CreatedAt, &w.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan worksite: %w", err)
+		if err := row.Scan(&w.ID, &w.CompanyID, &w.Name, &w.Address, &w.Latitude, &w.Longitude, &w.Version, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return w, fmt.Errorf("failed to scan worksite: %w", err)
 		}
-		worksites = append(worksites, w)
+		return w, nil
+	},
+	keys: map[string]func(model.Worksite) []string{
+		"name":       func(w model.Worksite) []string { return []string{w.Name} },
+		"created_at": func(w model.Worksite) []string { return []string{timeKey(w.CreatedAt)} },
+	},
+	unique: "id",
+	id:     func(w model.Worksite) string { return w.ID },
+}
+
+func (r *worksiteRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Worksite], error) {
+	var cond conditions
+	cond.add("company_id = ?", companyID)
+	page, err := worksiteListing.page(ctx, r.db, cond, spec, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worksites: %w", err)
 	}
-	return worksites, rows.Err()
+	return page, nil
 }
 
 func (r *worksiteRepo) GetByID(ctx context.Context, id string) (*model.Worksite, error) {
 	var w model.Worksite
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, company_id, name, address, latitude, longitude, created_at, updated_at
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`SELECT id, company_id, name, address, latitude, longitude, version, created_at, updated_at
 		FROM worksites WHERE id = $1`, id).
-		Scan(&w.ID, &w.CompanyID, &w.Name, &w.Address, &w.Latitude, &w.Longitude, &w.CreatedAt, &w.UpdatedAt)
+		Scan(&w.ID, &w.CompanyID, &w.Name, &w.Address, &w.Latitude, &w.Longitude, &w.Version, &w.CreatedAt, &w.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -60,12 +80,12 @@ func (r *worksiteRepo) GetByID(ctx context.Context, id string) (*model.Worksite,
 }
 
 func (r *worksiteRepo) Create(ctx context.Context, worksite *model.Worksite) error {
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		`INSERT INTO worksites (company_id, name, address, latitude, longitude)
 		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, updated_at`,
+		RETURNING id, version, created_at, updated_at`,
 		worksite.CompanyID, worksite.Name, worksite.Address, worksite.Latitude, worksite.Longitude).
-		Scan(&worksite.ID, &worksite.CreatedAt, &worksite.UpdatedAt)
+		Scan(&worksite.ID, &worksite.Version, &worksite.CreatedAt, &worksite.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create worksite: %w", err)
 	}
@@ -73,20 +93,26 @@ func (r *worksiteRepo) Create(ctx context.Context, worksite *model.Worksite) err
 }
 
 func (r *worksiteRepo) Update(ctx context.Context, worksite *model.Worksite) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE worksites SET name = $1, address = $2, latitude = $3, longitude = $4, updated_at = NOW()
-		WHERE id = $5`,
-		worksite.Name, worksite.Address, worksite.Latitude, worksite.Longitude, worksite.ID)
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		`UPDATE worksites SET name = $1, address = $2, latitude = $3, longitude = $4, version = version + 1, updated_at = NOW()
+		WHERE id = $5 AND ($6 = 0 OR version = $6)
+		RETURNING company_id, version, created_at, updated_at`,
+		worksite.Name, worksite.Address, worksite.Latitude, worksite.Longitude, worksite.ID, worksite.Version).
+		Scan(&worksite.CompanyID, &worksite.Version, &worksite.CreatedAt, &worksite.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrVersionMismatch
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update worksite: %w", err)
 	}
 	return nil
 }
 
-func (r *worksiteRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM worksites WHERE id = $1`, id)
+func (r *worksiteRepo) Delete(ctx context.Context, id string, version int) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		`DELETE FROM worksites WHERE id = $1 AND ($2 = 0 OR version = $2)`, id, version)
 	if err != nil {
 		return fmt.Errorf("failed to delete worksite: %w", err)
 	}
-	return nil
+	return matched(res)
 }
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+var (
+	// ErrForbidden is returned when the caller has no qualifying
+	// membership of the company that owns a resource.
+	ErrForbidden = errors.New("forbidden")
+	// ErrScopeNotFound is returned when the resource being authorised does
+	// not exist, so it has no owning company.
+	ErrScopeNotFound = errors.New("resource not found")
+)
+
+// ScopeKind names a type of resource whose owning company can be resolved.
+type ScopeKind string
+
+const (
+	ScopeCompany        ScopeKind = "company"
+	ScopeWorksite       ScopeKind = "worksite"
+	ScopeShift          ScopeKind = "shift"
+	ScopeReportTemplate ScopeKind = "shift report template"
+	ScopeShiftReport    ScopeKind = "shift report"
+	ScopeAlarm          ScopeKind = "alarm"
+	ScopeWorker         ScopeKind = "worker"
+	ScopeAPIKey         ScopeKind = "api key"
+)
+
+// Scope identifies the resource an action targets.
+type Scope struct {
+	Kind ScopeKind
+	ID   string
+}
+
+// AdminRoles are the membership roles allowed to manage a company's sites,
+// shifts, report templates and alarms.
+var AdminRoles = []model.WorkerRole{model.RoleCompanyAdmin, model.RoleSiteAdmin}
+
+// Caller is the authenticated worker an action is authorised for, with any
+// company memberships the identity provider grants for this request, such
+// as from a /companies/<id>/admins group. Grants count alongside the
+// memberships stored for the worker.
+type Caller struct {
+	Worker *model.Worker
+	Grants []model.WorkerCompany
+}
+
+// AccessService authorises actions against the caller's membership of the
+// company that owns the target resource: a worksite belongs to its company,
+// a shift to its worksite's company, and so on.
+type AccessService struct {
+	scopes repository.ScopeRepository
+	wcRepo repository.WorkerCompanyRepository
+	audit  *AuditService
+}
+
+// NewAccessService creates a new AccessService.
+func NewAccessService(scopes repository.ScopeRepository, wcRepo repository.WorkerCompanyRepository, audit *AuditService) *AccessService {
+	return &AccessService{scopes: scopes, wcRepo: wcRepo, audit: audit}
+}
+
+// Authorize checks that the caller is an active member, with one of roles,
+// of a company that owns the scoped resource. With no roles any active
+// membership will do. A worker always has access to their own record.
+func (s *AccessService) Authorize(ctx context.Context, caller Caller, scope Scope, roles ...model.WorkerRole) error {
+	ctx, span := tracer.Start(ctx, "AccessService.Authorize")
+	defer span.End()
+	if caller.Worker == nil {
+		return ErrForbidden
+	}
+	if scope.Kind == ScopeWorker && scope.ID == caller.Worker.ID && len(roles) == 0 {
+		return nil
+	}
+
+	companyIDs, err := resolveScope(ctx, s.scopes, scope)
+	if err != nil {
+		return err
+	}
+	return s.authorizeAny(ctx, caller, companyIDs, roles)
+}
+
+// AuthorizeAnyCompany checks that the caller holds one of roles in at least
+// one company, for actions such as creating a worker that are not yet tied
+// to a company.
+func (s *AccessService) AuthorizeAnyCompany(ctx context.Context, caller Caller, roles ...model.WorkerRole) error {
+	ctx, span := tracer.Start(ctx, "AccessService.AuthorizeAnyCompany")
+	defer span.End()
+	if caller.Worker == nil {
+		return ErrForbidden
+	}
+	memberships, err := s.wcRepo.ListByWorker(ctx, caller.Worker.ID)
+	if err != nil {
+		return err
+	}
+	for _, m := range append(memberships, caller.Grants...) {
+		if qualifies(m, roles) {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+// Companies returns the companies the caller is an active member of,
+// through a stored membership or a grant.
+func (s *AccessService) Companies(ctx context.Context, caller Caller) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "AccessService.Companies")
+	defer span.End()
+	if caller.Worker == nil {
+		return nil, nil
+	}
+	memberships, err := s.wcRepo.ListByWorker(ctx, caller.Worker.ID)
+	if err != nil {
+		return nil, err
+	}
+	var companyIDs []string
+	for _, m := range append(memberships, caller.Grants...) {
+		if qualifies(m, nil) && !slices.Contains(companyIDs, m.CompanyID) {
+			companyIDs = append(companyIDs, m.CompanyID)
+		}
+	}
+	return companyIDs, nil
+}
+
+// GrantCompanyAdmin makes worker an administrator of a company they have
+// just created.
+func (s *AccessService) GrantCompanyAdmin(ctx context.Context, workerID, companyID string) error {
+	ctx, span := tracer.Start(ctx, "AccessService.GrantCompanyAdmin")
+	defer span.End()
+	membership := &model.WorkerCompany{
+		WorkerID:  workerID,
+		CompanyID: companyID,
+		Role:      model.RoleCompanyAdmin,
+		Status:    model.MembershipActive,
+	}
+	if err := s.wcRepo.Create(ctx, membership); err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, membershipChange("create", nil, membership))
+}
+
+// resolveScope returns the companies that own the scoped resource.
+func resolveScope(ctx context.Context, scopes repository.ScopeRepository, scope Scope) ([]string, error) {
+	var companyIDs []string
+	var companyID string
+	var err error
+
+	switch scope.Kind {
+	case ScopeCompany:
+		var exists bool
+		exists, err = scopes.CompanyExists(ctx, scope.ID)
+		if exists {
+			companyID = scope.ID
+		}
+	case ScopeWorksite:
+		companyID, err = scopes.CompanyOfWorksite(ctx, scope.ID)
+	case ScopeShift:
+		companyID, err = scopes.CompanyOfShift(ctx, scope.ID)
+	case ScopeReportTemplate:
+		companyID, err = scopes.CompanyOfTemplate(ctx, scope.ID)
+	case ScopeShiftReport:
+		companyID, err = scopes.CompanyOfShiftReport(ctx, scope.ID)
+	case ScopeAlarm:
+		companyIDs, err = scopes.CompaniesOfAlarm(ctx, scope.ID)
+	case ScopeWorker:
+		companyIDs, err = scopes.CompaniesOfWorker(ctx, scope.ID)
+	case ScopeAPIKey:
+		companyID, err = scopes.CompanyOfAPIKey(ctx, scope.ID)
+	default:
+		return nil, fmt.Errorf("unknown scope kind %q", scope.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if companyID != "" {
+		companyIDs = []string{companyID}
+	}
+	// A resource no company owns, such as a worker with no active
+	// memberships, is treated as missing.
+	if len(companyIDs) == 0 {
+		return nil, fmt.Errorf("%s not found: %w", scope.Kind, ErrScopeNotFound)
+	}
+	return companyIDs, nil
+}
+
+// authorizeAny checks the caller against each owning company in turn and
+// names the one that granted access on the request's log lines.
+func (s *AccessService) authorizeAny(ctx context.Context, caller Caller, companyIDs []string, roles []model.WorkerRole) error {
+	for _, companyID := range companyIDs {
+		for _, g := range caller.Grants {
+			if g.CompanyID == companyID && qualifies(g, roles) {
+				logging.Add(ctx, slog.String("company_id", companyID))
+				return nil
+			}
+		}
+		m, err := s.wcRepo.Get(ctx, caller.Worker.ID, companyID)
+		if err != nil {
+			return err
+		}
+		if m != nil && qualifies(*m, roles) {
+			logging.Add(ctx, slog.String("company_id", companyID))
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+func qualifies(m model.WorkerCompany, roles []model.WorkerRole) bool {
+	if m.Status != model.MembershipActive {
+		return false
+	}
+	if len(roles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if m.Role == role {
+			return true
+		}
+	}
+	return false
+}
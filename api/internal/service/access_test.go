@@ -0,0 +1,102 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// mockScopeRepo is a test double for repository.ScopeRepository.
+type mockScopeRepo struct {
+	worksites map[string]string
+	shifts    map[string]string
+	workers   map[string][]string
+}
+
+func (m *mockScopeRepo) CompanyExists(ctx context.Context, companyID string) (bool, error) {
+	return true, nil
+}
+func (m *mockScopeRepo) CompanyOfWorksite(ctx context.Context, id string) (string, error) {
+	return m.worksites[id], nil
+}
+func (m *mockScopeRepo) CompanyOfShift(ctx context.Context, id string) (string, error) {
+	return m.shifts[id], nil
+}
+func (m *mockScopeRepo) CompanyOfTemplate(ctx context.Context, id string) (string, error) {
+	return "", nil
+}
+func (m *mockScopeRepo) CompanyOfShiftReport(ctx context.Context, id string) (string, error) {
+	return "", nil
+}
+func (m *mockScopeRepo) CompaniesOfAlarm(ctx context.Context, id string) ([]string, error) {
+	return nil, nil
+}
+func (m *mockScopeRepo) CompaniesOfWorker(ctx context.Context, id string) ([]string, error) {
+	return m.workers[id], nil
+}
+func (m *mockScopeRepo) CompanyOfAPIKey(ctx context.Context, id string) (string, error) {
+	return "", nil
+}
+
+func TestAccessService_Authorize(t *testing.T) {
+	scopes := &mockScopeRepo{
+		shifts:  map[string]string{"s1": "c1"},
+		workers: map[string][]string{"guard": {"c1", "c2"}},
+	}
+	wcRepo := &mockWCRepo{memberships: []model.WorkerCompany{
+		{WorkerID: "admin", CompanyID: "c2", Role: model.RoleCompanyAdmin, Status: model.MembershipActive},
+		{WorkerID: "site", CompanyID: "c1", Role: model.RoleSiteAdmin, Status: model.MembershipActive},
+		{WorkerID: "left", CompanyID: "c1", Role: model.RoleSiteAdmin, Status: model.MembershipInactive},
+	}}
+	svc := service.NewAccessService(scopes, wcRepo, nil)
+	ctx := context.Background()
+	shift := service.Scope{Kind: service.ScopeShift, ID: "s1"}
+
+	tests := []struct {
+		name   string
+		worker string
+		scope  service.Scope
+		roles  []model.WorkerRole
+		want   error
+	}{
+		{"site admin of owning company", "site", shift, service.AdminRoles, nil},
+		{"inactive membership", "left", shift, service.AdminRoles, service.ErrForbidden},
+		{"admin of another company", "admin", shift, service.AdminRoles, service.ErrForbidden},
+		{"role not allowed", "site", shift, []model.WorkerRole{model.RoleCompanyAdmin}, service.ErrForbidden},
+		{"unknown shift", "site", service.Scope{Kind: service.ScopeShift, ID: "s9"}, nil, service.ErrScopeNotFound},
+		{"own worker record", "guard", service.Scope{Kind: service.ScopeWorker, ID: "guard"}, nil, nil},
+		{"admin of any of the worker's companies", "admin", service.Scope{Kind: service.ScopeWorker, ID: "guard"}, []model.WorkerRole{model.RoleCompanyAdmin}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.Authorize(ctx, service.Caller{Worker: &model.Worker{ID: tt.worker}}, tt.scope, tt.roles...)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if err := svc.Authorize(ctx, service.Caller{}, shift); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("expected ErrForbidden without a worker, got %v", err)
+	}
+
+	// Company roles granted by the identity provider count as active
+	// memberships without a stored row.
+	granted := service.Caller{
+		Worker: &model.Worker{ID: "sso-admin"},
+		Grants: []model.WorkerCompany{{WorkerID: "sso-admin", CompanyID: "c1", Role: model.RoleSiteAdmin, Status: model.MembershipActive}},
+	}
+	if err := svc.Authorize(ctx, granted, shift, service.AdminRoles...); err != nil {
+		t.Errorf("expected granted site admin to be allowed, got %v", err)
+	}
+	if err := svc.Authorize(ctx, granted, shift, model.RoleCompanyAdmin); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("expected ErrForbidden for a role the grant does not carry, got %v", err)
+	}
+	if err := svc.AuthorizeAnyCompany(ctx, granted, model.RoleSiteAdmin); err != nil {
+		t.Errorf("expected grant to satisfy AuthorizeAnyCompany, got %v", err)
+	}
+}
@@ -2,90 +2,138 @@ package service
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/chrishaylesai/sitesecurity/api/internal/metrics"
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 )
 
 // AlarmService handles business logic for alarms.
 type AlarmService struct {
-	repo repository.AlarmRepository
+	repo  repository.AlarmRepository
+	audit *AuditService
 }
 
 // NewAlarmService creates a new AlarmService.
-func NewAlarmService(repo repository.AlarmRepository) *AlarmService {
-	return &AlarmService{repo: repo}
+func NewAlarmService(repo repository.AlarmRepository, audit *AuditService) *AlarmService {
+	return &AlarmService{repo: repo, audit: audit}
 }
 
-func (s *AlarmService) List(ctx context.Context, page, perPage int) ([]model.Alarm, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.repo.List(ctx, perPage, offset)
-}
-
-func (s *AlarmService) ListByStatus(ctx context.Context, status model.AlarmStatus, page, perPage int) ([]model.Alarm, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.repo.ListByStatus(ctx, status, perPage, offset)
+// List returns a page of alarms matching spec, limited to companyID's when
+// it is set.
+func (s *AlarmService) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Alarm], error) {
+	ctx, span := tracer.Start(ctx, "AlarmService.List")
+	defer span.End()
+	return s.repo.List(ctx, companyID, spec, p)
 }
 
 func (s *AlarmService) ListByWorker(ctx context.Context, workerID string) ([]model.Alarm, error) {
+	ctx, span := tracer.Start(ctx, "AlarmService.ListByWorker")
+	defer span.End()
 	return s.repo.ListByWorker(ctx, workerID)
 }
 
+// ListWorkerAlarms returns a page of the alarms a worker has raised.
+func (s *AlarmService) ListWorkerAlarms(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Alarm], error) {
+	ctx, span := tracer.Start(ctx, "AlarmService.ListWorkerAlarms")
+	defer span.End()
+	return s.repo.ListForWorker(ctx, workerID, spec, p)
+}
+
 func (s *AlarmService) GetByID(ctx context.Context, id string) (*model.Alarm, error) {
+	ctx, span := tracer.Start(ctx, "AlarmService.GetByID")
+	defer span.End()
 	alarm, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if alarm == nil {
-		return nil, fmt.Errorf("alarm not found")
+		return nil, notFound("alarm")
 	}
 	return alarm, nil
 }
 
 func (s *AlarmService) Raise(ctx context.Context, alarm *model.Alarm) error {
+	ctx, span := tracer.Start(ctx, "AlarmService.Raise")
+	defer span.End()
 	if alarm.WorkerID == "" {
-		return fmt.Errorf("worker_id is required")
+		return invalid("workerId", "is required")
+	}
+	if err := s.repo.Create(ctx, alarm); err != nil {
+		return err
 	}
-	return s.repo.Create(ctx, alarm)
+	if err := s.audit.Record(ctx, Change{
+		Action:       "raise",
+		ResourceType: "alarm",
+		ResourceID:   alarm.ID,
+		Owner:        workerActivityOwner(alarm.WorkerID, alarm.ShiftID),
+		After:        alarm,
+	}); err != nil {
+		return err
+	}
+	metrics.AlarmsRaised.Inc()
+	return nil
 }
 
-func (s *AlarmService) Acknowledge(ctx context.Context, id string) error {
+// Acknowledge marks a raised alarm as acknowledged. version, if not 0, is
+// the version the caller read.
+func (s *AlarmService) Acknowledge(ctx context.Context, id string, version int) error {
+	ctx, span := tracer.Start(ctx, "AlarmService.Acknowledge")
+	defer span.End()
 	alarm, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if alarm == nil {
-		return fmt.Errorf("alarm not found")
+		return notFound("alarm")
+	}
+	if err := checkVersion(alarm.Version, version); err != nil {
+		return err
 	}
 	if alarm.Status != model.AlarmRaised {
-		return fmt.Errorf("alarm must be in 'raised' status to acknowledge")
+		return &InvalidTransitionError{Resource: "alarm", From: string(alarm.Status), To: string(model.AlarmAcknowledged)}
 	}
-	return s.repo.UpdateStatus(ctx, id, model.AlarmAcknowledged)
+	return s.setStatus(ctx, alarm, "acknowledge", model.AlarmAcknowledged)
 }
 
-func (s *AlarmService) Resolve(ctx context.Context, id string) error {
+// Resolve marks a raised or acknowledged alarm as resolved. version, if not
+// 0, is the version the caller read.
+func (s *AlarmService) Resolve(ctx context.Context, id string, version int) error {
+	ctx, span := tracer.Start(ctx, "AlarmService.Resolve")
+	defer span.End()
 	alarm, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if alarm == nil {
-		return fmt.Errorf("alarm not found")
+		return notFound("alarm")
+	}
+	if err := checkVersion(alarm.Version, version); err != nil {
+		return err
 	}
 	if alarm.Status != model.AlarmRaised && alarm.Status != model.AlarmAcknowledged {
-		return fmt.Errorf("alarm must be in 'raised' or 'acknowledged' status to resolve")
+		return &InvalidTransitionError{Resource: "alarm", From: string(alarm.Status), To: string(model.AlarmResolved)}
+	}
+	return s.setStatus(ctx, alarm, "resolve", model.AlarmResolved)
+}
+
+// setStatus moves alarm to status, conditional on the version its
+// transition was checked against so two dispatchers cannot both act on it.
+func (s *AlarmService) setStatus(ctx context.Context, alarm *model.Alarm, action string, status model.AlarmStatus) error {
+	if err := s.repo.UpdateStatus(ctx, alarm.ID, status, alarm.Version); err != nil {
+		return versioned(err)
 	}
-	return s.repo.UpdateStatus(ctx, id, model.AlarmResolved)
+	updated := *alarm
+	updated.Status = status
+	updated.Version++
+	return s.audit.Record(ctx, Change{
+		Action:       action,
+		ResourceType: "alarm",
+		ResourceID:   alarm.ID,
+		Owner:        workerActivityOwner(alarm.WorkerID, alarm.ShiftID),
+		Before:       alarm,
+		After:        &updated,
+	})
 }
@@ -2,44 +2,53 @@ package service_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+	"github.com/chrishaylesai/sitesecurity/api/internal/tracing/tracingtest"
 )
 
 // mockAlarmRepo is a test double for repository.AlarmRepository.
+// pageOf returns a mock's rows as a single page.
+func pageOf[T any](items []T, err error) (*pagination.Page[T], error) {
+	if err != nil {
+		return nil, err
+	}
+	return &pagination.Page[T]{Items: items}, nil
+}
+
 type mockAlarmRepo struct {
 	alarms []model.Alarm
 	err    error
 }
 
-func (m *mockAlarmRepo) List(ctx context.Context, limit, offset int) ([]model.Alarm, error) {
+func (m *mockAlarmRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Alarm], error) {
 	if m.err != nil {
 		return nil, m.err
 	}
-	end := offset + limit
-	if end > len(m.alarms) {
-		end = len(m.alarms)
-	}
-	if offset >= len(m.alarms) {
-		return nil, nil
-	}
-	return m.alarms[offset:end], nil
-}
-
-func (m *mockAlarmRepo) ListByStatus(ctx context.Context, status model.AlarmStatus, limit, offset int) ([]model.Alarm, error) {
-	if m.err != nil {
-		return nil, m.err
-	}
-	var result []model.Alarm
+	var alarms []model.Alarm
 	for _, a := range m.alarms {
-		if a.Status == status {
-			result = append(result, a)
+		if matches(spec, "status", string(a.Status)) {
+			alarms = append(alarms, a)
 		}
 	}
-	return result, nil
+	end := p.Offset + p.Size()
+	if end > len(alarms) {
+		end = len(alarms)
+	}
+	if p.Offset >= len(alarms) {
+		return &pagination.Page[model.Alarm]{}, nil
+	}
+	return &pagination.Page[model.Alarm]{Items: alarms[p.Offset:end]}, nil
 }
 
 func (m *mockAlarmRepo) ListByWorker(ctx context.Context, workerID string) ([]model.Alarm, error) {
@@ -55,6 +64,10 @@ func (m *mockAlarmRepo) ListByWorker(ctx context.Context, workerID string) ([]mo
 	return result, nil
 }
 
+func (m *mockAlarmRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Alarm], error) {
+	return pageOf(m.ListByWorker(ctx, workerID))
+}
+
 func (m *mockAlarmRepo) GetByID(ctx context.Context, id string) (*model.Alarm, error) {
 	if m.err != nil {
 		return nil, m.err
@@ -78,13 +91,17 @@ func (m *mockAlarmRepo) Create(ctx context.Context, alarm *model.Alarm) error {
 	return nil
 }
 
-func (m *mockAlarmRepo) UpdateStatus(ctx context.Context, id string, status model.AlarmStatus) error {
+func (m *mockAlarmRepo) UpdateStatus(ctx context.Context, id string, status model.AlarmStatus, version int) error {
 	if m.err != nil {
 		return m.err
 	}
 	for i := range m.alarms {
 		if m.alarms[i].ID == id {
+			if version != 0 && version != m.alarms[i].Version {
+				return repository.ErrVersionMismatch
+			}
 			m.alarms[i].Status = status
+			m.alarms[i].Version++
 			return nil
 		}
 	}
@@ -93,7 +110,7 @@ func (m *mockAlarmRepo) UpdateStatus(ctx context.Context, id string, status mode
 
 func TestAlarmService_Raise_Valid(t *testing.T) {
 	repo := &mockAlarmRepo{}
-	svc := service.NewAlarmService(repo)
+	svc := service.NewAlarmService(repo, nil)
 
 	alarm := &model.Alarm{WorkerID: "worker-1"}
 	err := svc.Raise(context.Background(), alarm)
@@ -105,9 +122,40 @@ func TestAlarmService_Raise_Valid(t *testing.T) {
 	}
 }
 
+// spanAlarmRepo records the span its Create was called under.
+type spanAlarmRepo struct {
+	mockAlarmRepo
+	span trace.SpanContext
+}
+
+func (r *spanAlarmRepo) Create(ctx context.Context, alarm *model.Alarm) error {
+	r.span = trace.SpanContextFromContext(ctx)
+	return r.mockAlarmRepo.Create(ctx, alarm)
+}
+
+func TestAlarmService_Raise_Traced(t *testing.T) {
+	spans := tracingtest.Record(t)
+	repo := &spanAlarmRepo{}
+	svc := service.NewAlarmService(repo, nil)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "POST /alarms")
+	if err := svc.Raise(ctx, &model.Alarm{WorkerID: "worker-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	span := tracingtest.Find(t, spans, "AlarmService.Raise")
+	if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the service span to be a child of the request's span")
+	}
+	if repo.span.SpanID() != span.SpanContext.SpanID() {
+		t.Error("expected the repository to be called under the service span")
+	}
+}
+
 func TestAlarmService_Raise_MissingWorkerID(t *testing.T) {
 	repo := &mockAlarmRepo{}
-	svc := service.NewAlarmService(repo)
+	svc := service.NewAlarmService(repo, nil)
 
 	alarm := &model.Alarm{}
 	err := svc.Raise(context.Background(), alarm)
@@ -122,9 +170,9 @@ func TestAlarmService_Acknowledge_Valid(t *testing.T) {
 			{ID: "alarm-1", WorkerID: "worker-1", Status: model.AlarmRaised},
 		},
 	}
-	svc := service.NewAlarmService(repo)
+	svc := service.NewAlarmService(repo, nil)
 
-	err := svc.Acknowledge(context.Background(), "alarm-1")
+	err := svc.Acknowledge(context.Background(), "alarm-1", 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -136,9 +184,9 @@ func TestAlarmService_Acknowledge_WrongStatus(t *testing.T) {
 			{ID: "alarm-1", WorkerID: "worker-1", Status: model.AlarmResolved},
 		},
 	}
-	svc := service.NewAlarmService(repo)
+	svc := service.NewAlarmService(repo, nil)
 
-	err := svc.Acknowledge(context.Background(), "alarm-1")
+	err := svc.Acknowledge(context.Background(), "alarm-1", 0)
 	if err == nil {
 		t.Error("expected error for wrong status")
 	}
@@ -150,17 +198,37 @@ func TestAlarmService_Resolve_Valid(t *testing.T) {
 			{ID: "alarm-1", WorkerID: "worker-1", Status: model.AlarmAcknowledged},
 		},
 	}
-	svc := service.NewAlarmService(repo)
+	svc := service.NewAlarmService(repo, nil)
 
-	err := svc.Resolve(context.Background(), "alarm-1")
+	err := svc.Resolve(context.Background(), "alarm-1", 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
 
+func TestAlarmService_Resolve_StaleVersion(t *testing.T) {
+	repo := &mockAlarmRepo{
+		alarms: []model.Alarm{
+			{ID: "alarm-1", WorkerID: "worker-1", Status: model.AlarmRaised, Version: 1},
+		},
+	}
+	svc := service.NewAlarmService(repo, nil)
+
+	if err := svc.Acknowledge(context.Background(), "alarm-1", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A second dispatcher still holding version 1 must not act on it.
+	if err := svc.Resolve(context.Background(), "alarm-1", 1); !errors.Is(err, service.ErrPreconditionFailed) {
+		t.Errorf("expected ErrPreconditionFailed, got %v", err)
+	}
+	if repo.alarms[0].Status != model.AlarmAcknowledged {
+		t.Errorf("expected the alarm to stay acknowledged, got %s", repo.alarms[0].Status)
+	}
+}
+
 func TestAlarmService_GetByID_NotFound(t *testing.T) {
 	repo := &mockAlarmRepo{alarms: []model.Alarm{}}
-	svc := service.NewAlarmService(repo)
+	svc := service.NewAlarmService(repo, nil)
 
 	_, err := svc.GetByID(context.Background(), "missing")
 	if err == nil {
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/auth"
+	"github.com/chrishaylesai/sitesecurity/api/internal/logging"
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+// APIKeyPrefix starts every API key, telling them apart from JWTs in an
+// Authorization header.
+const APIKeyPrefix = "ssk_"
+
+// APIKeyScopes are the scopes an API key may be granted, each naming a
+// resource and whether the key may read or write it.
+var APIKeyScopes = []string{
+	"alarms:read", "alarms:write",
+	"check-ins:read", "check-ins:write",
+	"reports:read", "reports:write",
+	"shifts:read", "shifts:write",
+	"worksites:read",
+	"workers:read",
+}
+
+// ErrInvalidAPIKey is returned for an unknown, revoked or expired API key.
+var ErrInvalidAPIKey = errors.New("invalid or expired api key")
+
+// APIKeyRoles are the membership roles an API key's service account may be
+// given. A site_admin key, the default, has a site admin's reach within its
+// scopes: an alarms:write key may acknowledge and resolve any of the
+// company's alarms, and a :write key may backfill check-ins, alarms and
+// reports for any of its workers. A worker key acts only as itself.
+var APIKeyRoles = []model.WorkerRole{model.RoleWorker, model.RoleSiteAdmin}
+
+// lastUsedResolution limits how often authenticating a key writes its
+// last_used_at.
+const lastUsedResolution = time.Minute
+
+type APIKeyService struct {
+	repo  repository.APIKeyRepository
+	audit *AuditService
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, audit *AuditService) *APIKeyService {
+	return &APIKeyService{repo: repo, audit: audit}
+}
+
+func (s *APIKeyService) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.APIKey], error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.List")
+	defer span.End()
+	if companyID == "" {
+		return nil, invalid("company_id", "is required")
+	}
+	return s.repo.ListByCompany(ctx, companyID, spec, p)
+}
+
+// Create issues a key for key.CompanyID with a service-account worker to
+// act as, returning the key itself. Only its hash is stored, so it cannot
+// be shown again.
+func (s *APIKeyService) Create(ctx context.Context, key *model.APIKey, createdBy string) (string, error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.Create")
+	defer span.End()
+	now := time.Now()
+	var v validation
+	v.check(key.Name != "", "name", "is required")
+	v.check(key.CompanyID != "", "companyId", "is required")
+	v.check(len(key.Scopes) > 0, "scopes", "must include at least one scope")
+	for _, scope := range key.Scopes {
+		v.check(slices.Contains(APIKeyScopes, scope), "scopes", fmt.Sprintf("has unknown scope %q", scope))
+	}
+	v.check(key.ExpiresAt == nil || key.ExpiresAt.After(now), "expiresAt", "must be in the future")
+	if key.Role == "" {
+		key.Role = model.RoleSiteAdmin
+	}
+	v.check(slices.Contains(APIKeyRoles, key.Role), "role", "must be worker or site_admin")
+	if err := v.err(); err != nil {
+		return "", err
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate api key id: %w", err)
+	}
+	key.ID = id
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	secret := APIKeyPrefix + hex.EncodeToString(buf)
+
+	key.Prefix = secret[:len(APIKeyPrefix)+8]
+	key.KeyHash = hashAPIKey(secret)
+	key.CreatedBy = nil
+	if createdBy != "" {
+		key.CreatedBy = &createdBy
+	}
+	key.RevokedAt = nil
+	key.LastUsedAt = nil
+
+	account := &model.Worker{
+		AuthSubject:  serviceAccountSubject(key.ID),
+		FirstName:    key.Name,
+		LastName:     "(API key)",
+		Email:        key.ID + "@api-keys.invalid",
+		AuthLinkedAt: &now,
+	}
+	if err := s.repo.Create(ctx, key, account); err != nil {
+		return "", err
+	}
+	if err := s.audit.Record(ctx, apiKeyChange("create", nil, key)); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Revoke stops a key from authenticating. Revoking a revoked key is a
+// no-op.
+func (s *APIKeyService) Revoke(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "APIKeyService.Revoke")
+	defer span.End()
+	existing, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return notFound("api key")
+	}
+	if existing.RevokedAt != nil {
+		return nil
+	}
+	if err := s.repo.Revoke(ctx, id); err != nil {
+		return err
+	}
+	revoked := *existing
+	now := time.Now()
+	revoked.RevokedAt = &now
+	return s.audit.Record(ctx, apiKeyChange("revoke", existing, &revoked))
+}
+
+// apiKeyChange files a key change under its company. The key's hash is
+// never encoded.
+func apiKeyChange(action string, before, after *model.APIKey) Change {
+	current := before
+	if current == nil {
+		current = after
+	}
+	return Change{
+		Action:       action,
+		ResourceType: "api_key",
+		ResourceID:   current.ID,
+		Owner:        Scope{ScopeCompany, current.CompanyID},
+		Before:       before,
+		After:        after,
+	}
+}
+
+// Authenticate resolves an API key to the claims of its service account,
+// recording when it was last used.
+func (s *APIKeyService) Authenticate(ctx context.Context, secret string) (*auth.Claims, error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.Authenticate")
+	defer span.End()
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := s.repo.GetByHash(ctx, hashAPIKey(secret))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key == nil || key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		// Recording use is best effort; failing it must not lock out a
+		// valid key.
+		if err := s.repo.TouchLastUsed(ctx, key.ID); err != nil {
+			logging.FromContext(ctx).Warn("failed to record api key use",
+				slog.String("api_key_id", key.ID), logging.Error(err))
+		}
+	}
+
+	return &auth.Claims{
+		Subject:  serviceAccountSubject(key.ID),
+		Name:     key.Name,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}, nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// serviceAccountSubject is the subject a key's service account is known
+// by: its key's ID, which unlike the prefix is unique.
+func serviceAccountSubject(keyID string) string {
+	return "api-key:" + keyID
+}
+
+// newUUID returns a random (version 4) UUID, so a key's ID is known before
+// the service account named after it is created.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
@@ -0,0 +1,209 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+type mockAPIKeyRepo struct {
+	keys     []model.APIKey
+	accounts []model.Worker
+	touched  []string
+	touchErr error
+}
+
+func (m *mockAPIKeyRepo) ListByCompany(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.APIKey], error) {
+	return &pagination.Page[model.APIKey]{Items: m.keys}, nil
+}
+
+func (m *mockAPIKeyRepo) GetByID(ctx context.Context, id string) (*model.APIKey, error) {
+	for _, k := range m.keys {
+		if k.ID == id {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockAPIKeyRepo) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	for _, k := range m.keys {
+		if k.KeyHash == keyHash {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockAPIKeyRepo) Create(ctx context.Context, key *model.APIKey, account *model.Worker) error {
+	account.ID = "service-account-1"
+	key.WorkerID = account.ID
+	m.keys = append(m.keys, *key)
+	m.accounts = append(m.accounts, *account)
+	return nil
+}
+
+func (m *mockAPIKeyRepo) Revoke(ctx context.Context, id string) error {
+	for i := range m.keys {
+		if m.keys[i].ID == id {
+			now := time.Now()
+			m.keys[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockAPIKeyRepo) TouchLastUsed(ctx context.Context, id string) error {
+	m.touched = append(m.touched, id)
+	return m.touchErr
+}
+
+func TestAPIKeyService_Create_Validation(t *testing.T) {
+	svc := service.NewAPIKeyService(&mockAPIKeyRepo{}, nil)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		key  model.APIKey
+	}{
+		{"missing name", model.APIKey{CompanyID: "c1", Scopes: []string{"alarms:write"}}},
+		{"missing company", model.APIKey{Name: "Panel", Scopes: []string{"alarms:write"}}},
+		{"no scopes", model.APIKey{Name: "Panel", CompanyID: "c1"}},
+		{"unknown scope", model.APIKey{Name: "Panel", CompanyID: "c1", Scopes: []string{"api-keys:write"}}},
+		{"expiry in the past", model.APIKey{Name: "Panel", CompanyID: "c1", Scopes: []string{"alarms:write"}, ExpiresAt: &past}},
+		{"company admin role", model.APIKey{Name: "Panel", CompanyID: "c1", Scopes: []string{"alarms:write"}, Role: model.RoleCompanyAdmin}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Create(context.Background(), &tt.key, "admin"); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestAPIKeyService_CreateAndAuthenticate(t *testing.T) {
+	repo := &mockAPIKeyRepo{}
+	svc := service.NewAPIKeyService(repo, nil)
+	ctx := context.Background()
+
+	key := &model.APIKey{Name: "Gate panel", CompanyID: "c1", Scopes: []string{"alarms:write", "check-ins:write"}}
+	secret, err := svc.Create(ctx, key, "admin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(secret, service.APIKeyPrefix) || !strings.HasPrefix(secret, key.Prefix) {
+		t.Errorf("expected key %q to start with its prefix %q", secret, key.Prefix)
+	}
+	if key.KeyHash == "" || strings.Contains(key.KeyHash, secret[len(key.Prefix):]) {
+		t.Errorf("expected only a hash of the key to be stored, got %q", key.KeyHash)
+	}
+	if key.CreatedBy == nil || *key.CreatedBy != "admin" {
+		t.Errorf("expected createdBy to be recorded, got %v", key.CreatedBy)
+	}
+	if len(repo.accounts) != 1 || key.Role != model.RoleSiteAdmin {
+		t.Fatalf("expected a site_admin service account by default, got %+v %v", repo.accounts, key.Role)
+	}
+	if key.ID == "" || repo.accounts[0].AuthSubject != "api-key:"+key.ID {
+		t.Errorf("expected the service account to be named after the key's ID, got %q for key %q",
+			repo.accounts[0].AuthSubject, key.ID)
+	}
+
+	claims, err := svc.Authenticate(ctx, secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != repo.accounts[0].AuthSubject || claims.APIKeyID != key.ID {
+		t.Errorf("expected claims for the service account, got %+v", claims)
+	}
+	if len(claims.Scopes) != 2 {
+		t.Errorf("expected the key's scopes, got %v", claims.Scopes)
+	}
+	if len(repo.touched) != 1 {
+		t.Errorf("expected last use to be recorded, got %v", repo.touched)
+	}
+
+	// Uses within a minute of the last are not written again.
+	now := time.Now()
+	repo.keys[0].LastUsedAt = &now
+	if _, err := svc.Authenticate(ctx, secret); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.touched) != 1 {
+		t.Errorf("expected no further last-used write, got %v", repo.touched)
+	}
+}
+
+func TestAPIKeyService_Create_WorkerRole(t *testing.T) {
+	repo := &mockAPIKeyRepo{}
+	svc := service.NewAPIKeyService(repo, nil)
+
+	key := &model.APIKey{Name: "Payroll", CompanyID: "c1", Scopes: []string{"reports:read"}, Role: model.RoleWorker}
+	if _, err := svc.Create(context.Background(), key, "admin"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.keys) != 1 || repo.keys[0].Role != model.RoleWorker {
+		t.Errorf("expected the key to be stored with the worker role, got %+v", repo.keys)
+	}
+}
+
+func TestAPIKeyService_Authenticate_LastUsedFailure(t *testing.T) {
+	repo := &mockAPIKeyRepo{}
+	svc := service.NewAPIKeyService(repo, nil)
+	ctx := context.Background()
+
+	key := &model.APIKey{Name: "Panel", CompanyID: "c1", Scopes: []string{"alarms:write"}}
+	secret, err := svc.Create(ctx, key, "admin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	repo.touchErr = errors.New("connection reset")
+
+	claims, err := svc.Authenticate(ctx, secret)
+	if err != nil {
+		t.Fatalf("expected the key to authenticate when its use cannot be recorded, got %v", err)
+	}
+	if claims.APIKeyID != key.ID || len(repo.touched) != 1 {
+		t.Errorf("unexpected claims %+v after %d touches", claims, len(repo.touched))
+	}
+}
+
+func TestAPIKeyService_Authenticate_Rejects(t *testing.T) {
+	repo := &mockAPIKeyRepo{}
+	svc := service.NewAPIKeyService(repo, nil)
+	ctx := context.Background()
+
+	key := &model.APIKey{Name: "Payroll", CompanyID: "c1", Scopes: []string{"reports:read"}}
+	secret, err := svc.Create(ctx, key, "admin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, bad := range []string{"", "not-a-key", service.APIKeyPrefix + "0000", secret + "x"} {
+		if _, err := svc.Authenticate(ctx, bad); !errors.Is(err, service.ErrInvalidAPIKey) {
+			t.Errorf("expected ErrInvalidAPIKey for %q, got %v", bad, err)
+		}
+	}
+
+	expired := time.Now().Add(-time.Second)
+	repo.keys[0].ExpiresAt = &expired
+	if _, err := svc.Authenticate(ctx, secret); !errors.Is(err, service.ErrInvalidAPIKey) {
+		t.Errorf("expected expired key to be rejected, got %v", err)
+	}
+
+	repo.keys[0].ExpiresAt = nil
+	if err := svc.Revoke(ctx, key.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, secret); !errors.Is(err, service.ErrInvalidAPIKey) {
+		t.Errorf("expected revoked key to be rejected, got %v", err)
+	}
+}
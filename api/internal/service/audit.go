@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+// Actor is who is making a change and the request it arrived in. It is
+// carried in the context so every service can audit its writes.
+type Actor struct {
+	WorkerID  string
+	Subject   string
+	APIKeyID  string
+	IP        string
+	RequestID string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose changes are audited as made by actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor carried by ctx, or the zero Actor for
+// changes made by system jobs.
+func ActorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// Change describes one write for the audit log. The event is filed under
+// the companies that own Owner, usually the resource's parent: a resource
+// created in the request's transaction cannot be resolved until it
+// commits, and a deleted one no longer can be.
+type Change struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Owner        Scope
+	Before       interface{}
+	After        interface{}
+}
+
+// AuditService records and reads the audit log.
+type AuditService struct {
+	repo   repository.AuditEventRepository
+	scopes repository.ScopeRepository
+}
+
+// NewAuditService creates a new AuditService.
+func NewAuditService(repo repository.AuditEventRepository, scopes repository.ScopeRepository) *AuditService {
+	return &AuditService{repo: repo, scopes: scopes}
+}
+
+// Record adds change to the audit log as made by the actor in ctx. Within
+// a tenant session the event commits or rolls back with the change itself.
+// A nil AuditService records nothing.
+func (s *AuditService) Record(ctx context.Context, change Change) error {
+	ctx, span := tracer.Start(ctx, "AuditService.Record")
+	defer span.End()
+	if s == nil {
+		return nil
+	}
+	companyIDs, err := s.companies(ctx, change.Owner)
+	if err != nil {
+		return err
+	}
+	before, err := auditState(change.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditState(change.After)
+	if err != nil {
+		return err
+	}
+
+	actor := ActorFrom(ctx)
+	return s.repo.Create(ctx, &model.AuditEvent{
+		ActorWorkerID: optional(actor.WorkerID),
+		ActorSubject:  optional(actor.Subject),
+		APIKeyID:      optional(actor.APIKeyID),
+		Action:        change.Action,
+		ResourceType:  change.ResourceType,
+		ResourceID:    change.ResourceID,
+		CompanyIDs:    companyIDs,
+		Before:        before,
+		After:         after,
+		IP:            optional(actor.IP),
+		RequestID:     optional(actor.RequestID),
+	})
+}
+
+// List returns a page of a company's audit events, newest first.
+func (s *AuditService) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.AuditEvent], error) {
+	ctx, span := tracer.Start(ctx, "AuditService.List")
+	defer span.End()
+	if companyID == "" {
+		return nil, invalid("company_id", "is required")
+	}
+	return s.repo.List(ctx, companyID, spec, p)
+}
+
+// companies resolves the companies an event is filed under. A company is
+// taken as given, so creating and deleting one is audited against it; an
+// owner no company holds, such as a worker with no memberships, files the
+// event under none.
+func (s *AuditService) companies(ctx context.Context, owner Scope) ([]string, error) {
+	if owner.Kind == ScopeCompany {
+		return []string{owner.ID}, nil
+	}
+	companyIDs, err := resolveScope(ctx, s.scopes, owner)
+	if errors.Is(err, ErrScopeNotFound) {
+		return nil, nil
+	}
+	return companyIDs, err
+}
+
+// auditState encodes a resource's state, leaving nil, including a nil
+// pointer, as no state.
+func auditState(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil, nil
+	}
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit state: %w", err)
+	}
+	return doc, nil
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,138 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/service"
+)
+
+// mockAuditRepo is a test double for repository.AuditEventRepository.
+type mockAuditRepo struct {
+	events    []model.AuditEvent
+	companyID string
+	spec      query.Spec
+}
+
+func (m *mockAuditRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.AuditEvent], error) {
+	m.companyID, m.spec = companyID, spec
+	return &pagination.Page[model.AuditEvent]{Items: m.events}, nil
+}
+
+func (m *mockAuditRepo) Create(ctx context.Context, event *model.AuditEvent) error {
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func TestAuditService_RecordsActorAndState(t *testing.T) {
+	repo := &mockAuditRepo{}
+	scopes := &mockScopeRepo{worksites: map[string]string{"ws-1": "c1"}}
+	audit := service.NewAuditService(repo, scopes)
+	shiftRepo := &mockShiftRepo{shifts: []model.Shift{{ID: "s1", WorksiteID: "ws-1", Status: model.ShiftOpen}}}
+	svc := service.NewShiftService(shiftRepo, &mockShiftAssignmentRepo{}, audit, nil)
+
+	ctx := service.WithActor(context.Background(), service.Actor{
+		WorkerID: "dispatcher", Subject: "kc|dispatcher", IP: "203.0.113.7", RequestID: "req-1",
+	})
+	if err := svc.UpdateStatus(ctx, "s1", model.ShiftCancelled, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(repo.events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(repo.events))
+	}
+	e := repo.events[0]
+	if e.Action != "update_status" || e.ResourceType != "shift" || e.ResourceID != "s1" {
+		t.Errorf("unexpected event %s %s %s", e.Action, e.ResourceType, e.ResourceID)
+	}
+	if e.ActorWorkerID == nil || *e.ActorWorkerID != "dispatcher" || *e.ActorSubject != "kc|dispatcher" {
+		t.Errorf("expected the actor to be recorded, got %v %v", e.ActorWorkerID, e.ActorSubject)
+	}
+	if e.APIKeyID != nil {
+		t.Errorf("expected no api key, got %v", *e.APIKeyID)
+	}
+	if *e.IP != "203.0.113.7" || *e.RequestID != "req-1" {
+		t.Errorf("expected ip and request id, got %v %v", *e.IP, *e.RequestID)
+	}
+	if len(e.CompanyIDs) != 1 || e.CompanyIDs[0] != "c1" {
+		t.Errorf("expected the event filed under c1, got %v", e.CompanyIDs)
+	}
+
+	var before, after model.Shift
+	json.Unmarshal(e.Before, &before)
+	json.Unmarshal(e.After, &after)
+	if before.Status != model.ShiftOpen || after.Status != model.ShiftCancelled {
+		t.Errorf("expected open -> cancelled, got %s -> %s", before.Status, after.Status)
+	}
+}
+
+func TestAuditService_CreateAndDeleteHaveOneSide(t *testing.T) {
+	repo := &mockAuditRepo{}
+	svc := service.NewCompanyService(&mockCompanyRepo{}, service.NewAuditService(repo, &mockScopeRepo{}))
+	ctx := context.Background()
+
+	company := &model.Company{Name: "Sentinel"}
+	if err := svc.Create(ctx, company); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := svc.Delete(ctx, company.ID, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(repo.events) != 2 {
+		t.Fatalf("expected 2 audit events, got %d", len(repo.events))
+	}
+	created, deleted := repo.events[0], repo.events[1]
+	if created.Before != nil || created.After == nil {
+		t.Errorf("expected a create to record only the new state, got %s / %s", created.Before, created.After)
+	}
+	if deleted.Before == nil || deleted.After != nil {
+		t.Errorf("expected a delete to record only the old state, got %s / %s", deleted.Before, deleted.After)
+	}
+	for _, e := range repo.events {
+		if len(e.CompanyIDs) != 1 || e.CompanyIDs[0] != company.ID {
+			t.Errorf("expected %s event filed under the company, got %v", e.Action, e.CompanyIDs)
+		}
+		if e.ActorWorkerID != nil {
+			t.Errorf("expected a system change to have no actor, got %v", *e.ActorWorkerID)
+		}
+	}
+}
+
+func TestAuditService_OwnerWithoutCompany(t *testing.T) {
+	repo := &mockAuditRepo{}
+	audit := service.NewAuditService(repo, &mockScopeRepo{})
+
+	err := audit.Record(context.Background(), service.Change{
+		Action: "create", ResourceType: "worker", ResourceID: "w1",
+		Owner: service.Scope{Kind: service.ScopeWorker, ID: "w1"},
+	})
+	if err != nil {
+		t.Fatalf("expected a worker with no memberships to be audited, got %v", err)
+	}
+	if len(repo.events) != 1 || len(repo.events[0].CompanyIDs) != 0 {
+		t.Errorf("expected one event under no company, got %+v", repo.events)
+	}
+}
+
+func TestAuditService_List(t *testing.T) {
+	repo := &mockAuditRepo{}
+	audit := service.NewAuditService(repo, &mockScopeRepo{})
+	ctx := context.Background()
+
+	if _, err := audit.List(ctx, "", query.Spec{}, pagination.Request{}); err == nil {
+		t.Error("expected an error without a company")
+	}
+
+	spec := query.Spec{Filters: []query.Filter{{Field: "resource_type", Op: query.Eq, Values: []string{"shift"}}}}
+	if _, err := audit.List(ctx, "c1", spec, pagination.Request{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.companyID != "c1" || len(repo.spec.Equal("resource_type")) != 1 {
+		t.Errorf("expected the filter to be passed through, got %q %+v", repo.companyID, repo.spec)
+	}
+}
@@ -2,72 +2,98 @@ package service
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 )
 
 // CompanyService handles business logic for companies.
 type CompanyService struct {
-	repo repository.CompanyRepository
+	repo  repository.CompanyRepository
+	audit *AuditService
 }
 
 // NewCompanyService creates a new CompanyService.
-func NewCompanyService(repo repository.CompanyRepository) *CompanyService {
-	return &CompanyService{repo: repo}
+func NewCompanyService(repo repository.CompanyRepository, audit *AuditService) *CompanyService {
+	return &CompanyService{repo: repo, audit: audit}
 }
 
-func (s *CompanyService) List(ctx context.Context, page, perPage int) ([]model.Company, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.repo.List(ctx, perPage, offset)
+// List returns a page of the companies in companyIDs, the caller's own.
+func (s *CompanyService) List(ctx context.Context, companyIDs []string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Company], error) {
+	ctx, span := tracer.Start(ctx, "CompanyService.List")
+	defer span.End()
+	return s.repo.List(ctx, companyIDs, spec, p)
 }
 
 func (s *CompanyService) GetByID(ctx context.Context, id string) (*model.Company, error) {
+	ctx, span := tracer.Start(ctx, "CompanyService.GetByID")
+	defer span.End()
 	company, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if company == nil {
-		return nil, fmt.Errorf("company not found")
+		return nil, notFound("company")
 	}
 	return company, nil
 }
 
 func (s *CompanyService) Create(ctx context.Context, company *model.Company) error {
+	ctx, span := tracer.Start(ctx, "CompanyService.Create")
+	defer span.End()
 	if company.Name == "" {
-		return fmt.Errorf("company name is required")
+		return invalid("name", "is required")
 	}
-	return s.repo.Create(ctx, company)
+	if err := s.repo.Create(ctx, company); err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, companyChange("create", company.ID, nil, company))
 }
 
 func (s *CompanyService) Update(ctx context.Context, company *model.Company) error {
+	ctx, span := tracer.Start(ctx, "CompanyService.Update")
+	defer span.End()
 	if company.Name == "" {
-		return fmt.Errorf("company name is required")
+		return invalid("name", "is required")
 	}
 	existing, err := s.repo.GetByID(ctx, company.ID)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
-		return fmt.Errorf("company not found")
+		return notFound("company")
+	}
+	if err := s.repo.Update(ctx, company); err != nil {
+		return versioned(err)
 	}
-	return s.repo.Update(ctx, company)
+	return s.audit.Record(ctx, companyChange("update", company.ID, existing, company))
 }
 
-func (s *CompanyService) Delete(ctx context.Context, id string) error {
+func (s *CompanyService) Delete(ctx context.Context, id string, version int) error {
+	ctx, span := tracer.Start(ctx, "CompanyService.Delete")
+	defer span.End()
 	existing, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
-		return fmt.Errorf("company not found")
+		return notFound("company")
+	}
+	if err := s.repo.Delete(ctx, id, version); err != nil {
+		return versioned(err)
+	}
+	return s.audit.Record(ctx, companyChange("delete", id, existing, nil))
+}
+
+func companyChange(action, id string, before, after *model.Company) Change {
+	return Change{
+		Action:       action,
+		ResourceType: "company",
+		ResourceID:   id,
+		Owner:        Scope{ScopeCompany, id},
+		Before:       before,
+		After:        after,
 	}
-	return s.repo.Delete(ctx, id)
 }
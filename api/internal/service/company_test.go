@@ -3,9 +3,12 @@ package service_test
 import (
 	"context"
 	"fmt"
+	"slices"
 	"testing"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
@@ -13,22 +16,31 @@ import (
 type mockCompanyRepo struct {
 	companies []model.Company
 	err       error
+	listed    pagination.Request
 }
 
-func (m *mockCompanyRepo) List(ctx context.Context, limit, offset int) ([]model.Company, error) {
+func (m *mockCompanyRepo) List(ctx context.Context, companyIDs []string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Company], error) {
 	if m.err != nil {
 		return nil, m.err
 	}
-	end := offset + limit
-	if end > len(m.companies) {
-		end = len(m.companies)
+	m.listed = p
+	var companies []model.Company
+	for _, c := range m.companies {
+		if slices.Contains(companyIDs, c.ID) {
+			companies = append(companies, c)
+		}
 	}
-	if offset >= len(m.companies) {
-		return nil, nil
+	if p.Offset >= len(companies) {
+		return pagination.Slice([]model.Company(nil), p, companyKey), nil
 	}
-	return m.companies[offset:end], nil
+	// Like the repository, read one row past the page to tell whether
+	// another follows.
+	end := min(p.Offset+p.Size()+1, len(companies))
+	return pagination.Slice(companies[p.Offset:end], p, companyKey), nil
 }
 
+func companyKey(c model.Company) []string { return []string{c.ID} }
+
 func (m *mockCompanyRepo) GetByID(ctx context.Context, id string) (*model.Company, error) {
 	if m.err != nil {
 		return nil, m.err
@@ -54,7 +66,7 @@ func (m *mockCompanyRepo) Update(ctx context.Context, company *model.Company) er
 	return m.err
 }
 
-func (m *mockCompanyRepo) Delete(ctx context.Context, id string) error {
+func (m *mockCompanyRepo) Delete(ctx context.Context, id string, version int) error {
 	return m.err
 }
 
@@ -65,32 +77,48 @@ func TestCompanyService_List(t *testing.T) {
 			{ID: "2", Name: "Beta Guard"},
 		},
 	}
-	svc := service.NewCompanyService(repo)
+	svc := service.NewCompanyService(repo, nil)
 
-	companies, err := svc.List(context.Background(), 1, 25)
+	companies, err := svc.List(context.Background(), []string{"2"}, query.Spec{}, pagination.Request{Limit: 25})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(companies) != 2 {
-		t.Errorf("expected 2 companies, got %d", len(companies))
+	if len(companies.Items) != 1 || companies.Items[0].ID != "2" {
+		t.Errorf("expected only the caller's company, got %v", companies.Items)
 	}
 }
 
 func TestCompanyService_List_DefaultPagination(t *testing.T) {
-	repo := &mockCompanyRepo{companies: []model.Company{}}
-	svc := service.NewCompanyService(repo)
+	repo := &mockCompanyRepo{}
+	var ids []string
+	for i := range pagination.DefaultLimit + 5 {
+		id := fmt.Sprintf("c%02d", i)
+		repo.companies = append(repo.companies, model.Company{ID: id, Name: "Company " + id})
+		ids = append(ids, id)
+	}
+	svc := service.NewCompanyService(repo, nil)
 
-	_, err := svc.List(context.Background(), 0, 0)
+	page, err := svc.List(context.Background(), ids, query.Spec{}, pagination.Request{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if size := repo.listed.Size(); size != pagination.DefaultLimit {
+		t.Errorf("expected the repository to be asked for %d companies, got %d", pagination.DefaultLimit, size)
+	}
+	if len(page.Items) != pagination.DefaultLimit {
+		t.Fatalf("expected %d companies, got %d", pagination.DefaultLimit, len(page.Items))
+	}
+	last := page.Items[len(page.Items)-1].ID
+	if !slices.Equal(page.Next, []string{last}) {
+		t.Errorf("expected the next cursor to follow %s, got %v", last, page.Next)
+	}
 }
 
 func TestCompanyService_GetByID_Found(t *testing.T) {
 	repo := &mockCompanyRepo{
 		companies: []model.Company{{ID: "abc", Name: "Test Corp"}},
 	}
-	svc := service.NewCompanyService(repo)
+	svc := service.NewCompanyService(repo, nil)
 
 	company, err := svc.GetByID(context.Background(), "abc")
 	if err != nil {
@@ -103,7 +131,7 @@ func TestCompanyService_GetByID_Found(t *testing.T) {
 
 func TestCompanyService_GetByID_NotFound(t *testing.T) {
 	repo := &mockCompanyRepo{companies: []model.Company{}}
-	svc := service.NewCompanyService(repo)
+	svc := service.NewCompanyService(repo, nil)
 
 	_, err := svc.GetByID(context.Background(), "missing")
 	if err == nil {
@@ -113,7 +141,7 @@ func TestCompanyService_GetByID_NotFound(t *testing.T) {
 
 func TestCompanyService_Create_Valid(t *testing.T) {
 	repo := &mockCompanyRepo{}
-	svc := service.NewCompanyService(repo)
+	svc := service.NewCompanyService(repo, nil)
 
 	company := &model.Company{Name: "New Security Co"}
 	err := svc.Create(context.Background(), company)
@@ -127,7 +155,7 @@ func TestCompanyService_Create_Valid(t *testing.T) {
 
 func TestCompanyService_Create_EmptyName(t *testing.T) {
 	repo := &mockCompanyRepo{}
-	svc := service.NewCompanyService(repo)
+	svc := service.NewCompanyService(repo, nil)
 
 	company := &model.Company{Name: ""}
 	err := svc.Create(context.Background(), company)
@@ -138,9 +166,9 @@ func TestCompanyService_Create_EmptyName(t *testing.T) {
 
 func TestCompanyService_Delete_NotFound(t *testing.T) {
 	repo := &mockCompanyRepo{companies: []model.Company{}}
-	svc := service.NewCompanyService(repo)
+	svc := service.NewCompanyService(repo, nil)
 
-	err := svc.Delete(context.Background(), "missing")
+	err := svc.Delete(context.Background(), "missing", 0)
 	if err == nil {
 		t.Error("expected error for missing company")
 	}
@@ -148,9 +176,9 @@ func TestCompanyService_Delete_NotFound(t *testing.T) {
 
 func TestCompanyService_List_RepoError(t *testing.T) {
 	repo := &mockCompanyRepo{err: fmt.Errorf("database error")}
-	svc := service.NewCompanyService(repo)
+	svc := service.NewCompanyService(repo, nil)
 
-	_, err := svc.List(context.Background(), 1, 25)
+	_, err := svc.List(context.Background(), nil, query.Spec{}, pagination.Request{Limit: 25})
 	if err == nil {
 		t.Error("expected error from repo")
 	}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
+)
+
+// NotFoundError is returned when the resource an operation targets does
+// not exist.
+type NotFoundError struct {
+	Resource string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Resource + " not found"
+}
+
+func notFound(resource string) error {
+	return &NotFoundError{Resource: resource}
+}
+
+// FieldError describes one invalid field of a request, named as it
+// appears in the JSON body or query string.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when input fails validation, listing every
+// invalid field so a form can mark them all at once.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func invalid(field, message string) error {
+	return &ValidationError{Fields: []FieldError{{Field: field, Message: message}}}
+}
+
+// validation collects field errors while checking a request.
+type validation []FieldError
+
+func (v *validation) check(ok bool, field, message string) {
+	if !ok {
+		*v = append(*v, FieldError{Field: field, Message: message})
+	}
+}
+
+// err returns the collected errors as a ValidationError, or nil if there
+// are none.
+func (v validation) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v}
+}
+
+// oneOf reports whether v is one of values, so an unknown enum value is
+// rejected as invalid input before Postgres rejects it.
+func oneOf[T comparable](v T, values ...T) bool {
+	return slices.Contains(values, v)
+}
+
+// ConflictError is returned when an operation clashes with existing state,
+// such as adding a membership that already exists.
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// InvalidTransitionError is returned when a resource cannot move from its
+// current status to the one requested.
+type InvalidTransitionError struct {
+	Resource string
+	From     string
+	To       string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("%s cannot move from status %s to %s", e.Resource, e.From, e.To)
+}
+
+// ErrPreconditionFailed is returned when a conditional write names a version
+// of the resource other than its current one, because someone else changed
+// it since the caller read it.
+var ErrPreconditionFailed = errors.New("resource has been modified since it was read")
+
+// checkVersion rejects a conditional write whose expected version is not
+// current. An expected version of 0 makes the write unconditional.
+func checkVersion(current, expected int) error {
+	if expected != 0 && expected != current {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// versioned reports a conditional write that matched no row as
+// ErrPreconditionFailed.
+func versioned(err error) error {
+	if errors.Is(err, repository.ErrVersionMismatch) {
+		return ErrPreconditionFailed
+	}
+	return err
+}
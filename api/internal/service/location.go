@@ -2,43 +2,72 @@ package service
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/chrishaylesai/sitesecurity/api/internal/metrics"
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 )
 
 // LocationService handles business logic for location check-ins.
 type LocationService struct {
-	repo repository.LocationCheckInRepository
+	repo  repository.LocationCheckInRepository
+	audit *AuditService
 }
 
 // NewLocationService creates a new LocationService.
-func NewLocationService(repo repository.LocationCheckInRepository) *LocationService {
-	return &LocationService{repo: repo}
+func NewLocationService(repo repository.LocationCheckInRepository, audit *AuditService) *LocationService {
+	return &LocationService{repo: repo, audit: audit}
 }
 
 func (s *LocationService) Create(ctx context.Context, checkIn *model.LocationCheckIn) error {
-	if checkIn.WorkerID == "" {
-		return fmt.Errorf("worker_id is required")
-	}
+	ctx, span := tracer.Start(ctx, "LocationService.Create")
+	defer span.End()
+	var v validation
+	v.check(checkIn.WorkerID != "", "workerId", "is required")
 	if checkIn.Latitude == 0 && checkIn.Longitude == 0 {
-		return fmt.Errorf("latitude and longitude are required")
+		v.check(false, "latitude", "is required")
+		v.check(false, "longitude", "is required")
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+	if err := s.repo.Create(ctx, checkIn); err != nil {
+		return err
+	}
+	if err := s.audit.Record(ctx, Change{
+		Action:       "create",
+		ResourceType: "location_check_in",
+		ResourceID:   checkIn.ID,
+		Owner:        workerActivityOwner(checkIn.WorkerID, checkIn.ShiftID),
+		After:        checkIn,
+	}); err != nil {
+		return err
 	}
-	return s.repo.Create(ctx, checkIn)
+	metrics.CheckIns.Inc()
+	return nil
 }
 
-func (s *LocationService) ListByWorker(ctx context.Context, workerID string, page, perPage int) ([]model.LocationCheckIn, error) {
-	if page < 1 {
-		page = 1
+// workerActivityOwner is the scope a worker's check-in or alarm belongs
+// to: its shift, or outside a shift every company the worker is an active
+// member of.
+func workerActivityOwner(workerID string, shiftID *string) Scope {
+	if shiftID != nil {
+		return Scope{ScopeShift, *shiftID}
 	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.repo.ListByWorker(ctx, workerID, perPage, offset)
+	return Scope{ScopeWorker, workerID}
+}
+
+// ListWorkerCheckIns returns a page of a worker's location check-ins.
+func (s *LocationService) ListWorkerCheckIns(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.LocationCheckIn], error) {
+	ctx, span := tracer.Start(ctx, "LocationService.ListWorkerCheckIns")
+	defer span.End()
+	return s.repo.ListForWorker(ctx, workerID, spec, p)
 }
 
 func (s *LocationService) ListByShift(ctx context.Context, shiftID string) ([]model.LocationCheckIn, error) {
+	ctx, span := tracer.Start(ctx, "LocationService.ListByShift")
+	defer span.End()
 	return s.repo.ListByShift(ctx, shiftID)
 }
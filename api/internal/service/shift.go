@@ -2,9 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 )
 
@@ -12,116 +15,159 @@ import (
 type ShiftService struct {
 	shiftRepo      repository.ShiftRepository
 	assignmentRepo repository.ShiftAssignmentRepository
+	audit          *AuditService
+	uow            UnitOfWork
 }
 
 // NewShiftService creates a new ShiftService.
-func NewShiftService(shiftRepo repository.ShiftRepository, assignmentRepo repository.ShiftAssignmentRepository) *ShiftService {
-	return &ShiftService{shiftRepo: shiftRepo, assignmentRepo: assignmentRepo}
+func NewShiftService(shiftRepo repository.ShiftRepository, assignmentRepo repository.ShiftAssignmentRepository, audit *AuditService, uow UnitOfWork) *ShiftService {
+	return &ShiftService{shiftRepo: shiftRepo, assignmentRepo: assignmentRepo, audit: audit, uow: uow}
 }
 
-func (s *ShiftService) List(ctx context.Context, page, perPage int) ([]model.Shift, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.shiftRepo.List(ctx, perPage, offset)
-}
-
-func (s *ShiftService) ListByWorksite(ctx context.Context, worksiteID string, page, perPage int) ([]model.Shift, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.shiftRepo.ListByWorksite(ctx, worksiteID, perPage, offset)
-}
-
-func (s *ShiftService) ListByStatus(ctx context.Context, status model.ShiftStatus, page, perPage int) ([]model.Shift, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.shiftRepo.ListByStatus(ctx, status, perPage, offset)
+// List returns a page of shifts matching spec, limited to companyID's
+// worksites when it is set.
+func (s *ShiftService) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Shift], error) {
+	ctx, span := tracer.Start(ctx, "ShiftService.List")
+	defer span.End()
+	return s.shiftRepo.List(ctx, companyID, spec, p)
 }
 
 func (s *ShiftService) GetByID(ctx context.Context, id string) (*model.Shift, error) {
+	ctx, span := tracer.Start(ctx, "ShiftService.GetByID")
+	defer span.End()
 	shift, err := s.shiftRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if shift == nil {
-		return nil, fmt.Errorf("shift not found")
+		return nil, notFound("shift")
 	}
 	return shift, nil
 }
 
 func (s *ShiftService) Create(ctx context.Context, shift *model.Shift) error {
-	if shift.Title == "" {
-		return fmt.Errorf("shift title is required")
-	}
-	if shift.WorksiteID == "" {
-		return fmt.Errorf("worksite_id is required")
-	}
-	if !shift.StartTime.Before(shift.EndTime) {
-		return fmt.Errorf("start_time must be before end_time")
+	ctx, span := tracer.Start(ctx, "ShiftService.Create")
+	defer span.End()
+	if err := validateShift(shift); err != nil {
+		return err
 	}
 	if shift.Status == "" {
 		shift.Status = model.ShiftOpen
 	}
-	return s.shiftRepo.Create(ctx, shift)
+	if !validShiftStatus(shift.Status) {
+		return invalid("status", "is not a valid shift status")
+	}
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		if err := s.shiftRepo.Create(ctx, shift); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, shiftChange("create", nil, shift))
+	})
 }
 
 func (s *ShiftService) Update(ctx context.Context, shift *model.Shift) error {
-	if shift.Title == "" {
-		return fmt.Errorf("shift title is required")
-	}
-	if shift.WorksiteID == "" {
-		return fmt.Errorf("worksite_id is required")
-	}
-	if !shift.StartTime.Before(shift.EndTime) {
-		return fmt.Errorf("start_time must be before end_time")
-	}
-	existing, err := s.shiftRepo.GetByID(ctx, shift.ID)
-	if err != nil {
+	ctx, span := tracer.Start(ctx, "ShiftService.Update")
+	defer span.End()
+	if err := validateShift(shift); err != nil {
 		return err
 	}
-	if existing == nil {
-		return fmt.Errorf("shift not found")
-	}
-	return s.shiftRepo.Update(ctx, shift)
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		existing, err := s.shiftRepo.GetByID(ctx, shift.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return notFound("shift")
+		}
+		if err := s.shiftRepo.Update(ctx, shift); err != nil {
+			return versioned(err)
+		}
+		return s.audit.Record(ctx, shiftChange("update", existing, shift))
+	})
 }
 
-func (s *ShiftService) UpdateStatus(ctx context.Context, id string, status model.ShiftStatus) error {
-	existing, err := s.shiftRepo.GetByID(ctx, id)
-	if err != nil {
-		return err
-	}
-	if existing == nil {
-		return fmt.Errorf("shift not found")
-	}
+// UpdateStatus moves a shift to status. The write is conditional on the
+// version the transition was checked against, so a concurrent change fails
+// rather than skipping a step; version, if not 0, is the one the caller read.
+func (s *ShiftService) UpdateStatus(ctx context.Context, id string, status model.ShiftStatus, version int) error {
+	ctx, span := tracer.Start(ctx, "ShiftService.UpdateStatus")
+	defer span.End()
+	if !validShiftStatus(status) {
+		return invalid("status", "is not a valid shift status")
+	}
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		existing, err := s.shiftRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return notFound("shift")
+		}
+		if err := checkVersion(existing.Version, version); err != nil {
+			return err
+		}
+		return s.setStatus(ctx, existing, status)
+	})
+}
+
+// setStatus moves a loaded shift to status if the transition is allowed.
+func (s *ShiftService) setStatus(ctx context.Context, existing *model.Shift, status model.ShiftStatus) error {
 	if !isValidShiftTransition(existing.Status, status) {
-		return fmt.Errorf("invalid status transition from %s to %s", existing.Status, status)
+		return &InvalidTransitionError{Resource: "shift", From: string(existing.Status), To: string(status)}
+	}
+	if err := s.shiftRepo.UpdateStatus(ctx, existing.ID, status, existing.Version); err != nil {
+		return versioned(err)
 	}
-	return s.shiftRepo.UpdateStatus(ctx, id, status)
+	updated := *existing
+	updated.Status = status
+	updated.Version++
+	return s.audit.Record(ctx, shiftChange("update_status", existing, &updated))
 }
 
-func (s *ShiftService) Delete(ctx context.Context, id string) error {
-	existing, err := s.shiftRepo.GetByID(ctx, id)
-	if err != nil {
-		return err
-	}
-	if existing == nil {
-		return fmt.Errorf("shift not found")
+func (s *ShiftService) Delete(ctx context.Context, id string, version int) error {
+	ctx, span := tracer.Start(ctx, "ShiftService.Delete")
+	defer span.End()
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		existing, err := s.shiftRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return notFound("shift")
+		}
+		if err := s.shiftRepo.Delete(ctx, id, version); err != nil {
+			return versioned(err)
+		}
+		return s.audit.Record(ctx, shiftChange("delete", existing, nil))
+	})
+}
+
+// shiftChange files a shift change under its worksite's company.
+func shiftChange(action string, before, after *model.Shift) Change {
+	current := before
+	if current == nil {
+		current = after
+	}
+	return Change{
+		Action:       action,
+		ResourceType: "shift",
+		ResourceID:   current.ID,
+		Owner:        Scope{ScopeWorksite, current.WorksiteID},
+		Before:       before,
+		After:        after,
 	}
-	return s.shiftRepo.Delete(ctx, id)
+}
+
+func validateShift(shift *model.Shift) error {
+	var v validation
+	v.check(shift.Title != "", "title", "is required")
+	v.check(shift.WorksiteID != "", "worksiteId", "is required")
+	v.check(shift.StartTime.Before(shift.EndTime), "endTime", "must be after startTime")
+	return v.err()
+}
+
+func validShiftStatus(status model.ShiftStatus) bool {
+	return oneOf(status, model.ShiftOpen, model.ShiftAssigned, model.ShiftInProgress, model.ShiftCompleted, model.ShiftCancelled)
 }
 
 // isValidShiftTransition checks whether a shift status transition is allowed.
@@ -141,67 +187,202 @@ func isValidShiftTransition(from, to model.ShiftStatus) bool {
 	}
 }
 
-// CreateAssignment creates a new shift assignment (offers a shift to a worker).
+// CreateAssignment creates a new shift assignment (offers a shift to a
+// worker). An assignment created already accepted fills an open shift, as
+// AcceptAssignment does.
 func (s *ShiftService) CreateAssignment(ctx context.Context, assignment *model.ShiftAssignment) error {
-	shift, err := s.shiftRepo.GetByID(ctx, assignment.ShiftID)
-	if err != nil {
-		return err
-	}
-	if shift == nil {
-		return fmt.Errorf("shift not found")
-	}
+	ctx, span := tracer.Start(ctx, "ShiftService.CreateAssignment")
+	defer span.End()
 	if assignment.Status == "" {
 		assignment.Status = model.AssignmentOffered
 	}
-	return s.assignmentRepo.Create(ctx, assignment)
+	var v validation
+	v.check(assignment.WorkerID != "", "workerId", "is required")
+	v.check(oneOf(assignment.Status, model.AssignmentOffered, model.AssignmentAccepted, model.AssignmentDeclined, model.AssignmentCompleted),
+		"status", "is not a valid assignment status")
+	if err := v.err(); err != nil {
+		return err
+	}
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		shift, err := s.shiftRepo.GetByID(ctx, assignment.ShiftID)
+		if err != nil {
+			return err
+		}
+		if shift == nil {
+			return notFound("shift")
+		}
+		err = s.assignmentRepo.Create(ctx, assignment)
+		if errors.Is(err, repository.ErrDuplicate) {
+			return &ConflictError{Message: "worker is already assigned to this shift"}
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, assignmentChange("create", nil, assignment)); err != nil {
+			return err
+		}
+		if assignment.Status == model.AssignmentAccepted {
+			return s.fill(ctx, shift)
+		}
+		return nil
+	})
 }
 
-// AcceptAssignment marks a shift assignment as accepted.
-func (s *ShiftService) AcceptAssignment(ctx context.Context, id string) error {
-	assignment, err := s.assignmentRepo.GetByID(ctx, id)
+// AcceptAssignment marks a shift assignment as accepted and moves an open
+// shift to assigned, together, returning the assignment. Only the assigned
+// worker can accept it, and the assignment must belong to shiftID.
+// version, if not 0, is the assignment's version the caller read.
+func (s *ShiftService) AcceptAssignment(ctx context.Context, shiftID, id, workerID string, version int) (*model.ShiftAssignment, error) {
+	ctx, span := tracer.Start(ctx, "ShiftService.AcceptAssignment")
+	defer span.End()
+	var accepted *model.ShiftAssignment
+	err := atomically(ctx, s.uow, func(ctx context.Context) error {
+		assignment, err := s.ownAssignment(ctx, shiftID, id, workerID, version)
+		if err != nil {
+			return err
+		}
+		if assignment.Status != model.AssignmentOffered {
+			return &InvalidTransitionError{Resource: "assignment", From: string(assignment.Status), To: string(model.AssignmentAccepted)}
+		}
+		if accepted, err = s.setAssignmentStatus(ctx, assignment, model.AssignmentAccepted); err != nil {
+			return err
+		}
+		shift, err := s.shiftRepo.GetByID(ctx, shiftID)
+		if err != nil {
+			return err
+		}
+		if shift == nil {
+			return notFound("shift")
+		}
+		return s.fill(ctx, shift)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if assignment == nil {
-		return fmt.Errorf("assignment not found")
+	return accepted, nil
+}
+
+// fill moves an open shift to assigned once a worker has accepted it. A
+// shift that has moved on already is left as it is, including one filled
+// by a concurrent acceptance since it was read, which the update's
+// condition on the status finds rather than its version.
+func (s *ShiftService) fill(ctx context.Context, shift *model.Shift) error {
+	if shift.Status != model.ShiftOpen {
+		return nil
+	}
+	version, err := s.shiftRepo.Fill(ctx, shift.ID)
+	if err != nil || version == 0 {
+		return err
 	}
-	if assignment.Status != model.AssignmentOffered {
-		return fmt.Errorf("assignment cannot be accepted from status %s", assignment.Status)
+	updated := *shift
+	updated.Status = model.ShiftAssigned
+	updated.Version = version
+	return s.audit.Record(ctx, shiftChange("update_status", shift, &updated))
+}
+
+// DeclineAssignment marks a shift assignment as declined, with the same
+// checks as AcceptAssignment, and returns it.
+func (s *ShiftService) DeclineAssignment(ctx context.Context, shiftID, id, workerID string, version int) (*model.ShiftAssignment, error) {
+	ctx, span := tracer.Start(ctx, "ShiftService.DeclineAssignment")
+	defer span.End()
+	var declined *model.ShiftAssignment
+	err := atomically(ctx, s.uow, func(ctx context.Context) error {
+		assignment, err := s.ownAssignment(ctx, shiftID, id, workerID, version)
+		if err != nil {
+			return err
+		}
+		if assignment.Status != model.AssignmentOffered {
+			return &InvalidTransitionError{Resource: "assignment", From: string(assignment.Status), To: string(model.AssignmentDeclined)}
+		}
+		declined, err = s.setAssignmentStatus(ctx, assignment, model.AssignmentDeclined)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return s.assignmentRepo.UpdateStatus(ctx, id, model.AssignmentAccepted)
+	return declined, nil
 }
 
-// DeclineAssignment marks a shift assignment as declined.
-func (s *ShiftService) DeclineAssignment(ctx context.Context, id string) error {
+// ownAssignment loads an assignment on behalf of the worker responding
+// to it, at version unless that is 0.
+func (s *ShiftService) ownAssignment(ctx context.Context, shiftID, id, workerID string, version int) (*model.ShiftAssignment, error) {
 	assignment, err := s.assignmentRepo.GetByID(ctx, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if assignment == nil {
-		return fmt.Errorf("assignment not found")
+	if assignment == nil || assignment.ShiftID != shiftID {
+		return nil, notFound("assignment")
 	}
-	if assignment.Status != model.AssignmentOffered {
-		return fmt.Errorf("assignment cannot be declined from status %s", assignment.Status)
+	if assignment.WorkerID != workerID {
+		return nil, fmt.Errorf("assignment belongs to another worker: %w", ErrForbidden)
 	}
-	return s.assignmentRepo.UpdateStatus(ctx, id, model.AssignmentDeclined)
+	if err := checkVersion(assignment.Version, version); err != nil {
+		return nil, err
+	}
+	return assignment, nil
 }
 
 // CompleteAssignment marks a shift assignment as completed.
 func (s *ShiftService) CompleteAssignment(ctx context.Context, id string) error {
-	assignment, err := s.assignmentRepo.GetByID(ctx, id)
-	if err != nil {
+	ctx, span := tracer.Start(ctx, "ShiftService.CompleteAssignment")
+	defer span.End()
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		assignment, err := s.assignmentRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if assignment == nil {
+			return notFound("assignment")
+		}
+		if assignment.Status != model.AssignmentAccepted {
+			return &InvalidTransitionError{Resource: "assignment", From: string(assignment.Status), To: string(model.AssignmentCompleted)}
+		}
+		_, err = s.setAssignmentStatus(ctx, assignment, model.AssignmentCompleted)
 		return err
+	})
+}
+
+// setAssignmentStatus moves a loaded assignment to status, conditional on
+// the version its transition was checked against, and returns it updated.
+func (s *ShiftService) setAssignmentStatus(ctx context.Context, assignment *model.ShiftAssignment, status model.AssignmentStatus) (*model.ShiftAssignment, error) {
+	updated := *assignment
+	updated.Status = status
+	if err := s.assignmentRepo.UpdateStatus(ctx, &updated); err != nil {
+		return nil, versioned(err)
+	}
+	if err := s.audit.Record(ctx, assignmentChange("update_status", assignment, &updated)); err != nil {
+		return nil, err
 	}
-	if assignment == nil {
-		return fmt.Errorf("assignment not found")
-	}
-	if assignment.Status != model.AssignmentAccepted {
-		return fmt.Errorf("assignment cannot be completed from status %s", assignment.Status)
+	return &updated, nil
+}
+
+// assignmentChange files an assignment change under its shift's company.
+func assignmentChange(action string, before, after *model.ShiftAssignment) Change {
+	current := before
+	if current == nil {
+		current = after
+	}
+	return Change{
+		Action:       action,
+		ResourceType: "shift_assignment",
+		ResourceID:   current.ID,
+		Owner:        Scope{ScopeShift, current.ShiftID},
+		Before:       before,
+		After:        after,
 	}
-	return s.assignmentRepo.UpdateStatus(ctx, id, model.AssignmentCompleted)
 }
 
 // ListAssignmentsByShift returns all assignments for a given shift.
 func (s *ShiftService) ListAssignmentsByShift(ctx context.Context, shiftID string) ([]model.ShiftAssignment, error) {
+	ctx, span := tracer.Start(ctx, "ShiftService.ListAssignmentsByShift")
+	defer span.End()
 	return s.assignmentRepo.ListByShift(ctx, shiftID)
 }
+
+// ListWorkerAssignments returns a page of a worker's shift assignments with
+// their shifts.
+func (s *ShiftService) ListWorkerAssignments(ctx context.Context, workerID string, filter repository.AssignmentFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.AssignmentWithShift], error) {
+	ctx, span := tracer.Start(ctx, "ShiftService.ListWorkerAssignments")
+	defer span.End()
+	return s.assignmentRepo.ListForWorker(ctx, workerID, filter, spec, p)
+}
@@ -2,9 +2,10 @@ package service
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 )
 
@@ -12,118 +13,150 @@ import (
 type ShiftReportService struct {
 	templateRepo repository.ShiftReportTemplateRepository
 	reportRepo   repository.ShiftReportRepository
+	audit        *AuditService
 }
 
 // NewShiftReportService creates a new ShiftReportService.
-func NewShiftReportService(templateRepo repository.ShiftReportTemplateRepository, reportRepo repository.ShiftReportRepository) *ShiftReportService {
-	return &ShiftReportService{templateRepo: templateRepo, reportRepo: reportRepo}
+func NewShiftReportService(templateRepo repository.ShiftReportTemplateRepository, reportRepo repository.ShiftReportRepository, audit *AuditService) *ShiftReportService {
+	return &ShiftReportService{templateRepo: templateRepo, reportRepo: reportRepo, audit: audit}
 }
 
 // ListTemplates returns templates for a company with pagination.
-func (s *ShiftReportService) ListTemplates(ctx context.Context, companyID string, page, perPage int) ([]model.ShiftReportTemplate, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.templateRepo.ListByCompany(ctx, companyID, perPage, offset)
+func (s *ShiftReportService) ListTemplates(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReportTemplate], error) {
+	ctx, span := tracer.Start(ctx, "ShiftReportService.ListTemplates")
+	defer span.End()
+	return s.templateRepo.ListByCompany(ctx, companyID, spec, p)
 }
 
 // GetTemplateByID returns a single template by ID.
 func (s *ShiftReportService) GetTemplateByID(ctx context.Context, id string) (*model.ShiftReportTemplate, error) {
+	ctx, span := tracer.Start(ctx, "ShiftReportService.GetTemplateByID")
+	defer span.End()
 	template, err := s.templateRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if template == nil {
-		return nil, fmt.Errorf("shift report template not found")
+		return nil, notFound("shift report template")
 	}
 	return template, nil
 }
 
 // CreateTemplate creates a new shift report template.
 func (s *ShiftReportService) CreateTemplate(ctx context.Context, template *model.ShiftReportTemplate) error {
-	if template.Name == "" {
-		return fmt.Errorf("template name is required")
+	ctx, span := tracer.Start(ctx, "ShiftReportService.CreateTemplate")
+	defer span.End()
+	var v validation
+	v.check(template.Name != "", "name", "is required")
+	v.check(template.CompanyID != "", "companyId", "is required")
+	if err := v.err(); err != nil {
+		return err
 	}
-	if template.CompanyID == "" {
-		return fmt.Errorf("company_id is required")
+	if err := s.templateRepo.Create(ctx, template); err != nil {
+		return err
 	}
-	return s.templateRepo.Create(ctx, template)
+	return s.audit.Record(ctx, templateChange("create", nil, template))
 }
 
 // UpdateTemplate updates an existing shift report template.
 func (s *ShiftReportService) UpdateTemplate(ctx context.Context, template *model.ShiftReportTemplate) error {
+	ctx, span := tracer.Start(ctx, "ShiftReportService.UpdateTemplate")
+	defer span.End()
 	if template.Name == "" {
-		return fmt.Errorf("template name is required")
+		return invalid("name", "is required")
 	}
 	existing, err := s.templateRepo.GetByID(ctx, template.ID)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
-		return fmt.Errorf("shift report template not found")
+		return notFound("shift report template")
+	}
+	if err := s.templateRepo.Update(ctx, template); err != nil {
+		return versioned(err)
 	}
-	return s.templateRepo.Update(ctx, template)
+	return s.audit.Record(ctx, templateChange("update", existing, template))
 }
 
 // DeleteTemplate deletes a shift report template.
-func (s *ShiftReportService) DeleteTemplate(ctx context.Context, id string) error {
+func (s *ShiftReportService) DeleteTemplate(ctx context.Context, id string, version int) error {
+	ctx, span := tracer.Start(ctx, "ShiftReportService.DeleteTemplate")
+	defer span.End()
 	existing, err := s.templateRepo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
-		return fmt.Errorf("shift report template not found")
+		return notFound("shift report template")
+	}
+	if err := s.templateRepo.Delete(ctx, id, version); err != nil {
+		return versioned(err)
 	}
-	return s.templateRepo.Delete(ctx, id)
+	return s.audit.Record(ctx, templateChange("delete", existing, nil))
 }
 
-// ListReportsByShift returns reports for a shift with pagination.
-func (s *ShiftReportService) ListReportsByShift(ctx context.Context, shiftID string, page, perPage int) ([]model.ShiftReport, error) {
-	if page < 1 {
-		page = 1
+// templateChange files a template change under its company.
+func templateChange(action string, before, after *model.ShiftReportTemplate) Change {
+	current := before
+	if current == nil {
+		current = after
+	}
+	return Change{
+		Action:       action,
+		ResourceType: "shift_report_template",
+		ResourceID:   current.ID,
+		Owner:        Scope{ScopeCompany, current.CompanyID},
+		Before:       before,
+		After:        after,
 	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.reportRepo.ListByShift(ctx, shiftID, perPage, offset)
 }
 
-// ListReportsByWorker returns reports for a worker with pagination.
-func (s *ShiftReportService) ListReportsByWorker(ctx context.Context, workerID string, page, perPage int) ([]model.ShiftReport, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.reportRepo.ListByWorker(ctx, workerID, perPage, offset)
+// ListReports returns a page of reports matching spec.
+func (s *ShiftReportService) ListReports(ctx context.Context, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReport], error) {
+	ctx, span := tracer.Start(ctx, "ShiftReportService.ListReports")
+	defer span.End()
+	return s.reportRepo.List(ctx, spec, p)
+}
+
+// ListWorkerReports returns a page of the reports a worker has submitted.
+func (s *ShiftReportService) ListWorkerReports(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.ShiftReport], error) {
+	ctx, span := tracer.Start(ctx, "ShiftReportService.ListWorkerReports")
+	defer span.End()
+	return s.reportRepo.ListForWorker(ctx, workerID, spec, p)
 }
 
 // GetReportByID returns a single report by ID.
 func (s *ShiftReportService) GetReportByID(ctx context.Context, id string) (*model.ShiftReport, error) {
+	ctx, span := tracer.Start(ctx, "ShiftReportService.GetReportByID")
+	defer span.End()
 	report, err := s.reportRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if report == nil {
-		return nil, fmt.Errorf("shift report not found")
+		return nil, notFound("shift report")
 	}
 	return report, nil
 }
 
 // CreateReport creates a new shift report.
 func (s *ShiftReportService) CreateReport(ctx context.Context, report *model.ShiftReport) error {
-	if report.ShiftID == "" {
-		return fmt.Errorf("shift_id is required")
+	ctx, span := tracer.Start(ctx, "ShiftReportService.CreateReport")
+	defer span.End()
+	var v validation
+	v.check(report.ShiftID != "", "shiftId", "is required")
+	v.check(report.WorkerID != "", "workerId", "is required")
+	if err := v.err(); err != nil {
+		return err
 	}
-	if report.WorkerID == "" {
-		return fmt.Errorf("worker_id is required")
+	if err := s.reportRepo.Create(ctx, report); err != nil {
+		return err
 	}
-	return s.reportRepo.Create(ctx, report)
+	return s.audit.Record(ctx, Change{
+		Action:       "create",
+		ResourceType: "shift_report",
+		ResourceID:   report.ID,
+		Owner:        Scope{ScopeShift, report.ShiftID},
+		After:        report,
+	})
 }
@@ -2,10 +2,16 @@ package service_test
 
 import (
 	"context"
+	"errors"
+	"reflect"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
@@ -13,46 +19,35 @@ import (
 type mockShiftRepo struct {
 	shifts []model.Shift
 	err    error
+	// atomic records, for each status change, whether it was made in a
+	// unit of work.
+	atomic []bool
 }
 
-func (m *mockShiftRepo) List(ctx context.Context, limit, offset int) ([]model.Shift, error) {
+func (m *mockShiftRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Shift], error) {
 	if m.err != nil {
 		return nil, m.err
 	}
-	end := offset + limit
-	if end > len(m.shifts) {
-		end = len(m.shifts)
-	}
-	if offset >= len(m.shifts) {
-		return nil, nil
-	}
-	return m.shifts[offset:end], nil
-}
-
-func (m *mockShiftRepo) ListByWorksite(ctx context.Context, worksiteID string, limit, offset int) ([]model.Shift, error) {
-	if m.err != nil {
-		return nil, m.err
-	}
-	var result []model.Shift
+	var shifts []model.Shift
 	for _, s := range m.shifts {
-		if s.WorksiteID == worksiteID {
-			result = append(result, s)
+		if matches(spec, "worksite_id", s.WorksiteID) && matches(spec, "status", string(s.Status)) {
+			shifts = append(shifts, s)
 		}
 	}
-	return result, nil
-}
-
-func (m *mockShiftRepo) ListByStatus(ctx context.Context, status model.ShiftStatus, limit, offset int) ([]model.Shift, error) {
-	if m.err != nil {
-		return nil, m.err
+	end := p.Offset + p.Size()
+	if end > len(shifts) {
+		end = len(shifts)
 	}
-	var result []model.Shift
-	for _, s := range m.shifts {
-		if s.Status == status {
-			result = append(result, s)
-		}
+	if p.Offset >= len(shifts) {
+		return &pagination.Page[model.Shift]{}, nil
 	}
-	return result, nil
+	return &pagination.Page[model.Shift]{Items: shifts[p.Offset:end]}, nil
+}
+
+// matches reports whether value passes the spec's equality filters on field.
+func matches(spec query.Spec, field, value string) bool {
+	values := spec.Equal(field)
+	return values == nil || slices.Contains(values, value)
 }
 
 func (m *mockShiftRepo) GetByID(ctx context.Context, id string) (*model.Shift, error) {
@@ -80,14 +75,53 @@ func (m *mockShiftRepo) Update(ctx context.Context, shift *model.Shift) error {
 	return m.err
 }
 
-func (m *mockShiftRepo) UpdateStatus(ctx context.Context, id string, status model.ShiftStatus) error {
-	return m.err
+func (m *mockShiftRepo) UpdateStatus(ctx context.Context, id string, status model.ShiftStatus, version int) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.atomic = append(m.atomic, inUnitOfWork(ctx))
+	for i := range m.shifts {
+		if m.shifts[i].ID == id {
+			m.shifts[i].Status = status
+		}
+	}
+	return nil
+}
+
+func (m *mockShiftRepo) Fill(ctx context.Context, id string) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.atomic = append(m.atomic, inUnitOfWork(ctx))
+	for i := range m.shifts {
+		if m.shifts[i].ID == id && m.shifts[i].Status == model.ShiftOpen {
+			m.shifts[i].Status = model.ShiftAssigned
+			m.shifts[i].Version++
+			return m.shifts[i].Version, nil
+		}
+	}
+	return 0, nil
 }
 
-func (m *mockShiftRepo) Delete(ctx context.Context, id string) error {
+func (m *mockShiftRepo) Delete(ctx context.Context, id string, version int) error {
 	return m.err
 }
 
+// staleShiftRepo reads every shift as open, as a worker accepting a shift
+// that another acceptance has filled since would.
+type staleShiftRepo struct {
+	*mockShiftRepo
+}
+
+func (m staleShiftRepo) GetByID(ctx context.Context, id string) (*model.Shift, error) {
+	shift, err := m.mockShiftRepo.GetByID(ctx, id)
+	if shift != nil {
+		shift.Status = model.ShiftOpen
+		shift.Version = 1
+	}
+	return shift, err
+}
+
 // mockShiftAssignmentRepo is a test double for repository.ShiftAssignmentRepository.
 type mockShiftAssignmentRepo struct {
 	assignments []model.ShiftAssignment
@@ -120,6 +154,18 @@ func (m *mockShiftAssignmentRepo) ListByWorker(ctx context.Context, workerID str
 	return result, nil
 }
 
+func (m *mockShiftAssignmentRepo) ListForWorker(ctx context.Context, workerID string, filter repository.AssignmentFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.AssignmentWithShift], error) {
+	assignments, err := m.ListByWorker(ctx, workerID)
+	if err != nil {
+		return nil, err
+	}
+	var result []model.AssignmentWithShift
+	for _, a := range assignments {
+		result = append(result, model.AssignmentWithShift{ShiftAssignment: a})
+	}
+	return &pagination.Page[model.AssignmentWithShift]{Items: result}, nil
+}
+
 func (m *mockShiftAssignmentRepo) GetByID(ctx context.Context, id string) (*model.ShiftAssignment, error) {
 	if m.err != nil {
 		return nil, m.err
@@ -153,18 +199,49 @@ func (m *mockShiftAssignmentRepo) Create(ctx context.Context, assignment *model.
 	return nil
 }
 
-func (m *mockShiftAssignmentRepo) UpdateStatus(ctx context.Context, id string, status model.AssignmentStatus) error {
-	return m.err
+func (m *mockShiftAssignmentRepo) UpdateStatus(ctx context.Context, assignment *model.ShiftAssignment) error {
+	if m.err != nil {
+		return m.err
+	}
+	for i := range m.assignments {
+		if m.assignments[i].ID == assignment.ID {
+			if assignment.Version != 0 && assignment.Version != m.assignments[i].Version {
+				return repository.ErrVersionMismatch
+			}
+			assignment.Version = m.assignments[i].Version + 1
+			m.assignments[i] = *assignment
+			return nil
+		}
+	}
+	return repository.ErrVersionMismatch
 }
 
 func (m *mockShiftAssignmentRepo) Delete(ctx context.Context, id string) error {
 	return m.err
 }
 
+// fakeUnitOfWork is a service.UnitOfWork for in-memory test doubles: it
+// runs each unit of work directly, counts them, and marks their context so
+// doubles can check their writes are made inside one.
+type fakeUnitOfWork struct {
+	runs int
+}
+
+type unitOfWorkKey struct{}
+
+func (u *fakeUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	u.runs++
+	return fn(context.WithValue(ctx, unitOfWorkKey{}, true))
+}
+
+func inUnitOfWork(ctx context.Context) bool {
+	return ctx.Value(unitOfWorkKey{}) != nil
+}
+
 func TestShiftService_Create_Valid(t *testing.T) {
 	shiftRepo := &mockShiftRepo{}
 	assignmentRepo := &mockShiftAssignmentRepo{}
-	svc := service.NewShiftService(shiftRepo, assignmentRepo)
+	svc := service.NewShiftService(shiftRepo, assignmentRepo, nil, nil)
 
 	now := time.Now()
 	shift := &model.Shift{
@@ -188,7 +265,7 @@ func TestShiftService_Create_Valid(t *testing.T) {
 func TestShiftService_Create_MissingTitle(t *testing.T) {
 	shiftRepo := &mockShiftRepo{}
 	assignmentRepo := &mockShiftAssignmentRepo{}
-	svc := service.NewShiftService(shiftRepo, assignmentRepo)
+	svc := service.NewShiftService(shiftRepo, assignmentRepo, nil, nil)
 
 	now := time.Now()
 	shift := &model.Shift{
@@ -206,7 +283,7 @@ func TestShiftService_Create_MissingTitle(t *testing.T) {
 func TestShiftService_Create_InvalidTimeRange(t *testing.T) {
 	shiftRepo := &mockShiftRepo{}
 	assignmentRepo := &mockShiftAssignmentRepo{}
-	svc := service.NewShiftService(shiftRepo, assignmentRepo)
+	svc := service.NewShiftService(shiftRepo, assignmentRepo, nil, nil)
 
 	now := time.Now()
 	shift := &model.Shift{
@@ -221,43 +298,174 @@ func TestShiftService_Create_InvalidTimeRange(t *testing.T) {
 	}
 }
 
+func TestShiftService_Create_ReportsEveryInvalidField(t *testing.T) {
+	svc := service.NewShiftService(&mockShiftRepo{}, &mockShiftAssignmentRepo{}, nil, nil)
+
+	now := time.Now()
+	err := svc.Create(context.Background(), &model.Shift{StartTime: now, EndTime: now})
+	var invalid *service.ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	var fields []string
+	for _, f := range invalid.Fields {
+		fields = append(fields, f.Field)
+	}
+	if want := []string{"title", "worksiteId", "endTime"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected invalid fields %v, got %v", want, fields)
+	}
+}
+
+func TestShiftService_UpdateStatus_UnknownStatus(t *testing.T) {
+	shiftRepo := &mockShiftRepo{shifts: []model.Shift{{ID: "s-1", Status: model.ShiftOpen}}}
+	svc := service.NewShiftService(shiftRepo, &mockShiftAssignmentRepo{}, nil, nil)
+
+	var invalid *service.ValidationError
+	if err := svc.UpdateStatus(context.Background(), "s-1", "paused", 0); !errors.As(err, &invalid) {
+		t.Errorf("expected a ValidationError for an unknown status, got %v", err)
+	}
+	var transition *service.InvalidTransitionError
+	if err := svc.UpdateStatus(context.Background(), "s-1", model.ShiftCompleted, 0); !errors.As(err, &transition) {
+		t.Errorf("expected an InvalidTransitionError, got %v", err)
+	}
+}
+
 func TestShiftService_GetByID_NotFound(t *testing.T) {
 	shiftRepo := &mockShiftRepo{shifts: []model.Shift{}}
 	assignmentRepo := &mockShiftAssignmentRepo{}
-	svc := service.NewShiftService(shiftRepo, assignmentRepo)
+	svc := service.NewShiftService(shiftRepo, assignmentRepo, nil, nil)
 
 	_, err := svc.GetByID(context.Background(), "missing")
-	if err == nil {
-		t.Error("expected error for missing shift")
+	var notFound *service.NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected a NotFoundError for missing shift, got %v", err)
 	}
 }
 
 func TestShiftService_AcceptAssignment_Valid(t *testing.T) {
-	shiftRepo := &mockShiftRepo{}
+	shiftRepo := &mockShiftRepo{shifts: []model.Shift{{ID: "s-1", Status: model.ShiftOpen}}}
 	assignmentRepo := &mockShiftAssignmentRepo{
 		assignments: []model.ShiftAssignment{
 			{ID: "a-1", ShiftID: "s-1", WorkerID: "w-1", Status: model.AssignmentOffered},
 		},
 	}
-	svc := service.NewShiftService(shiftRepo, assignmentRepo)
+	uow := &fakeUnitOfWork{}
+	svc := service.NewShiftService(shiftRepo, assignmentRepo, nil, uow)
 
-	err := svc.AcceptAssignment(context.Background(), "a-1")
+	_, err := svc.AcceptAssignment(context.Background(), "s-1", "a-1", "w-1", 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if shiftRepo.shifts[0].Status != model.ShiftAssigned {
+		t.Errorf("expected the open shift to become assigned, got %s", shiftRepo.shifts[0].Status)
+	}
+	if uow.runs != 1 || !reflect.DeepEqual(shiftRepo.atomic, []bool{true}) {
+		t.Errorf("expected the shift to change in the accepting unit of work, got %d runs, %v", uow.runs, shiftRepo.atomic)
+	}
+}
+
+func TestShiftService_AcceptAssignment_LeavesStartedShift(t *testing.T) {
+	shiftRepo := &mockShiftRepo{shifts: []model.Shift{{ID: "s-1", Status: model.ShiftInProgress}}}
+	assignmentRepo := &mockShiftAssignmentRepo{
+		assignments: []model.ShiftAssignment{
+			{ID: "a-1", ShiftID: "s-1", WorkerID: "w-1", Status: model.AssignmentOffered},
+		},
+	}
+	svc := service.NewShiftService(shiftRepo, assignmentRepo, nil, &fakeUnitOfWork{})
+
+	if _, err := svc.AcceptAssignment(context.Background(), "s-1", "a-1", "w-1", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shiftRepo.shifts[0].Status != model.ShiftInProgress || len(shiftRepo.atomic) != 0 {
+		t.Errorf("expected a shift in progress to be left alone, got %s", shiftRepo.shifts[0].Status)
+	}
+}
+
+func TestShiftService_AcceptAssignment_AlreadyFilled(t *testing.T) {
+	shiftRepo := &mockShiftRepo{shifts: []model.Shift{{ID: "s-1", Status: model.ShiftAssigned, Version: 2}}}
+	assignmentRepo := &mockShiftAssignmentRepo{
+		assignments: []model.ShiftAssignment{
+			{ID: "a-2", ShiftID: "s-1", WorkerID: "w-2", Status: model.AssignmentOffered},
+		},
+	}
+	svc := service.NewShiftService(staleShiftRepo{shiftRepo}, assignmentRepo, nil, &fakeUnitOfWork{})
+
+	if _, err := svc.AcceptAssignment(context.Background(), "s-1", "a-2", "w-2", 0); err != nil {
+		t.Fatalf("expected the second acceptance to succeed, got %v", err)
+	}
+	if shiftRepo.shifts[0].Status != model.ShiftAssigned || shiftRepo.shifts[0].Version != 2 {
+		t.Errorf("expected the filled shift to be left as it is, got %s at version %d",
+			shiftRepo.shifts[0].Status, shiftRepo.shifts[0].Version)
+	}
+}
+
+func TestShiftService_CreateAssignment_Accepted(t *testing.T) {
+	shiftRepo := &mockShiftRepo{shifts: []model.Shift{{ID: "s-1", Status: model.ShiftOpen}}}
+	uow := &fakeUnitOfWork{}
+	svc := service.NewShiftService(shiftRepo, &mockShiftAssignmentRepo{}, nil, uow)
+
+	offer := &model.ShiftAssignment{ShiftID: "s-1", WorkerID: "w-1"}
+	if err := svc.CreateAssignment(context.Background(), offer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shiftRepo.shifts[0].Status != model.ShiftOpen {
+		t.Errorf("expected an offer to leave the shift open, got %s", shiftRepo.shifts[0].Status)
+	}
+
+	accepted := &model.ShiftAssignment{ShiftID: "s-1", WorkerID: "w-2", Status: model.AssignmentAccepted}
+	if err := svc.CreateAssignment(context.Background(), accepted); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shiftRepo.shifts[0].Status != model.ShiftAssigned || uow.runs != 2 {
+		t.Errorf("expected an accepted assignment to fill the shift in its unit of work, got %s after %d runs",
+			shiftRepo.shifts[0].Status, uow.runs)
+	}
+}
+
+func TestShiftService_AcceptAssignment_FailsWithShift(t *testing.T) {
+	shiftRepo := &mockShiftRepo{shifts: []model.Shift{{ID: "s-1", Status: model.ShiftOpen}}}
+	assignmentRepo := &mockShiftAssignmentRepo{
+		assignments: []model.ShiftAssignment{
+			{ID: "a-1", ShiftID: "s-1", WorkerID: "w-1", Status: model.AssignmentOffered},
+		},
+	}
+	svc := service.NewShiftService(shiftRepo, assignmentRepo, nil, &fakeUnitOfWork{})
+	shiftRepo.err = repository.ErrVersionMismatch
+
+	_, err := svc.AcceptAssignment(context.Background(), "s-1", "a-1", "w-1", 0)
+	if err == nil {
+		t.Error("expected the unit of work to fail when the shift cannot be filled")
+	}
 }
 
 func TestShiftService_AcceptAssignment_NotFound(t *testing.T) {
 	shiftRepo := &mockShiftRepo{}
 	assignmentRepo := &mockShiftAssignmentRepo{assignments: []model.ShiftAssignment{}}
-	svc := service.NewShiftService(shiftRepo, assignmentRepo)
+	svc := service.NewShiftService(shiftRepo, assignmentRepo, nil, nil)
 
-	err := svc.AcceptAssignment(context.Background(), "missing")
+	_, err := svc.AcceptAssignment(context.Background(), "s-1", "missing", "w-1", 0)
 	if err == nil {
 		t.Error("expected error for missing assignment")
 	}
 }
 
+func TestShiftService_AcceptAssignment_RejectsOthers(t *testing.T) {
+	assignmentRepo := &mockShiftAssignmentRepo{
+		assignments: []model.ShiftAssignment{
+			{ID: "a-1", ShiftID: "s-1", WorkerID: "w-1", Status: model.AssignmentOffered},
+		},
+	}
+	svc := service.NewShiftService(&mockShiftRepo{}, assignmentRepo, nil, nil)
+
+	if _, err := svc.AcceptAssignment(context.Background(), "s-2", "a-1", "w-1", 0); err == nil {
+		t.Error("expected error for assignment on another shift")
+	}
+	_, err := svc.AcceptAssignment(context.Background(), "s-1", "a-1", "w-2", 0)
+	if !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("expected ErrForbidden for another worker's assignment, got %v", err)
+	}
+}
+
 func TestShiftService_DeclineAssignment_Valid(t *testing.T) {
 	shiftRepo := &mockShiftRepo{}
 	assignmentRepo := &mockShiftAssignmentRepo{
@@ -265,10 +473,34 @@ func TestShiftService_DeclineAssignment_Valid(t *testing.T) {
 			{ID: "a-1", ShiftID: "s-1", WorkerID: "w-1", Status: model.AssignmentOffered},
 		},
 	}
-	svc := service.NewShiftService(shiftRepo, assignmentRepo)
+	svc := service.NewShiftService(shiftRepo, assignmentRepo, nil, nil)
+
+	_, err := svc.DeclineAssignment(context.Background(), "s-1", "a-1", "w-1", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestShiftService_DeclineAssignment_Version(t *testing.T) {
+	assignmentRepo := &mockShiftAssignmentRepo{
+		assignments: []model.ShiftAssignment{
+			{ID: "a-1", ShiftID: "s-1", WorkerID: "w-1", Status: model.AssignmentOffered, Version: 2},
+		},
+	}
+	svc := service.NewShiftService(&mockShiftRepo{}, assignmentRepo, nil, nil)
 
-	err := svc.DeclineAssignment(context.Background(), "a-1")
+	if _, err := svc.DeclineAssignment(context.Background(), "s-1", "a-1", "w-1", 1); !errors.Is(err, service.ErrPreconditionFailed) {
+		t.Fatalf("expected a stale version to fail the precondition, got %v", err)
+	}
+	if assignmentRepo.assignments[0].Status != model.AssignmentOffered {
+		t.Errorf("expected a stale response to leave the offer, got %s", assignmentRepo.assignments[0].Status)
+	}
+
+	declined, err := svc.DeclineAssignment(context.Background(), "s-1", "a-1", "w-1", 2)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if declined.Status != model.AssignmentDeclined || declined.Version != 3 {
+		t.Errorf("expected the assignment declined at version 3, got %s at version %d", declined.Status, declined.Version)
+	}
 }
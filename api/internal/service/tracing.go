@@ -0,0 +1,7 @@
+package service
+
+import "github.com/chrishaylesai/sitesecurity/api/internal/tracing"
+
+// tracer records a span for each service call, between the request's span
+// and its statements' spans.
+var tracer = tracing.Tracer("service")
@@ -0,0 +1,23 @@
+package service
+
+import "context"
+
+// UnitOfWork runs fn with a context whose repository calls share one
+// transaction, committed only if fn returns nil. Implementations may run fn
+// more than once when the transaction conflicts with a concurrent one, so
+// fn must not have effects outside the repositories it calls. Within a
+// request the transaction is not serializable, so fn must make its own
+// writes safe against concurrent ones, e.g. with a conditional update.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// atomically runs fn as one unit of work. A nil UnitOfWork runs fn
+// directly, for repositories that have no transactions, such as in-memory
+// fakes.
+func atomically(ctx context.Context, uow UnitOfWork, fn func(ctx context.Context) error) error {
+	if uow == nil {
+		return fn(ctx)
+	}
+	return uow.Do(ctx, fn)
+}
@@ -2,177 +2,534 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 )
 
+// ErrEmailConflict is returned when an identity's email belongs to a worker
+// already linked to a different identity.
+var ErrEmailConflict error = &ConflictError{Message: "email is already linked to another account"}
+
+var (
+	errWorkerExists     = &ConflictError{Message: "a worker with this email or identity already exists"}
+	errMembershipExists = &ConflictError{Message: "membership already exists"}
+)
+
+// ErrEmailUnverified is returned when a worker would be linked or created
+// from an email address the identity provider has not verified.
+var ErrEmailUnverified = errors.New("email address has not been verified")
+
+// Identity is the profile an identity provider asserts for a subject.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// ProfileLoader fetches the caller's full profile from the identity
+// provider. Provision only calls it when the subject has no worker yet.
+type ProfileLoader func(ctx context.Context) (*Identity, error)
+
 type WorkerService struct {
 	workerRepo repository.WorkerRepository
 	certRepo   repository.CertificateRepository
 	wcRepo     repository.WorkerCompanyRepository
+	audit      *AuditService
+	uow        UnitOfWork
 }
 
 func NewWorkerService(
 	workerRepo repository.WorkerRepository,
 	certRepo repository.CertificateRepository,
 	wcRepo repository.WorkerCompanyRepository,
+	audit *AuditService,
+	uow UnitOfWork,
 ) *WorkerService {
 	return &WorkerService{
 		workerRepo: workerRepo,
 		certRepo:   certRepo,
 		wcRepo:     wcRepo,
+		audit:      audit,
+		uow:        uow,
 	}
 }
 
-func (s *WorkerService) List(ctx context.Context, page, perPage int) ([]model.Worker, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
+func (s *WorkerService) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Worker], error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.List")
+	defer span.End()
+	if companyID == "" {
+		return nil, invalid("company_id", "is required")
 	}
-	offset := (page - 1) * perPage
-	return s.workerRepo.List(ctx, perPage, offset)
+	return s.workerRepo.List(ctx, companyID, spec, p)
 }
 
 func (s *WorkerService) GetByID(ctx context.Context, id string) (*model.Worker, error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.GetByID")
+	defer span.End()
 	worker, err := s.workerRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if worker == nil {
-		return nil, fmt.Errorf("worker not found")
+		return nil, notFound("worker")
 	}
 	return worker, nil
 }
 
 func (s *WorkerService) GetByAuthSubject(ctx context.Context, authSubject string) (*model.Worker, error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.GetByAuthSubject")
+	defer span.End()
 	return s.workerRepo.GetByAuthSubject(ctx, authSubject)
 }
 
-func (s *WorkerService) Create(ctx context.Context, worker *model.Worker) error {
-	if worker.FirstName == "" || worker.LastName == "" {
-		return fmt.Errorf("first name and last name are required")
+// Provision returns the worker for an authenticated identity, linking or
+// creating one on first login:
+//
+//   - a worker already holding the subject has its name and email synced
+//     from the token claims; an email change is skipped if another worker
+//     owns the address;
+//   - otherwise a not-yet-linked worker with the same verified email (an
+//     admin invite) is claimed;
+//   - otherwise a new worker is created from the loaded profile.
+func (s *WorkerService) Provision(ctx context.Context, claimed Identity, loadProfile ProfileLoader) (*model.Worker, error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.Provision")
+	defer span.End()
+	if claimed.Subject == "" {
+		return nil, fmt.Errorf("auth subject is required")
 	}
-	if worker.Email == "" {
-		return fmt.Errorf("email is required")
+
+	worker, err := s.workerRepo.GetByAuthSubject(ctx, claimed.Subject)
+	if err != nil {
+		return nil, err
 	}
-	if worker.AuthSubject == "" {
-		return fmt.Errorf("auth subject is required")
+	if worker != nil {
+		return s.syncWorker(ctx, worker, claimed)
 	}
-	return s.workerRepo.Create(ctx, worker)
-}
 
-func (s *WorkerService) Update(ctx context.Context, worker *model.Worker) error {
-	existing, err := s.workerRepo.GetByID(ctx, worker.ID)
+	profile := claimed
+	if loadProfile != nil {
+		loaded, err := loadProfile(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load profile: %w", err)
+		}
+		if loaded.Subject != "" && loaded.Subject != claimed.Subject {
+			return nil, fmt.Errorf("profile subject does not match token")
+		}
+		profile = *loaded
+		profile.Subject = claimed.Subject
+	}
+	if profile.Email == "" {
+		return nil, fmt.Errorf("identity has no email address")
+	}
+	if !profile.EmailVerified {
+		return nil, ErrEmailUnverified
+	}
+
+	invited, err := s.workerRepo.GetByEmail(ctx, profile.Email)
 	if err != nil {
+		return nil, err
+	}
+	if invited != nil {
+		if invited.AuthLinkedAt != nil {
+			return nil, ErrEmailConflict
+		}
+		before := *invited
+		invited.AuthSubject = profile.Subject
+		mergeNames(invited, profile)
+		linked, err := s.workerRepo.Link(ctx, invited)
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			return nil, ErrEmailConflict
+		}
+		if err := s.audit.Record(ctx, workerChange("link", &before, invited)); err != nil {
+			return nil, err
+		}
+		return invited, nil
+	}
+
+	now := time.Now()
+	worker = &model.Worker{
+		AuthSubject:  profile.Subject,
+		Email:        profile.Email,
+		AuthLinkedAt: &now,
+	}
+	mergeNames(worker, profile)
+	if err := s.workerRepo.Create(ctx, worker); err != nil {
+		// A concurrent request for the same subject may have won the race.
+		if existing, getErr := s.workerRepo.GetByAuthSubject(ctx, profile.Subject); getErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	if err := s.audit.Record(ctx, workerChange("create", nil, worker)); err != nil {
+		return nil, err
+	}
+	return worker, nil
+}
+
+// syncWorker copies changed profile fields from the token onto a linked
+// worker and marks admin-created workers whose subject matched as linked.
+func (s *WorkerService) syncWorker(ctx context.Context, worker *model.Worker, claimed Identity) (*model.Worker, error) {
+	before := *worker
+	if worker.AuthLinkedAt == nil {
+		mergeNames(worker, claimed)
+		if _, err := s.workerRepo.Link(ctx, worker); err != nil {
+			return nil, err
+		}
+		if err := s.audit.Record(ctx, workerChange("link", &before, worker)); err != nil {
+			return nil, err
+		}
+		before = *worker
+	}
+
+	changed := false
+	if claimed.FirstName != "" && claimed.FirstName != worker.FirstName {
+		worker.FirstName = claimed.FirstName
+		changed = true
+	}
+	if claimed.LastName != "" && claimed.LastName != worker.LastName {
+		worker.LastName = claimed.LastName
+		changed = true
+	}
+	if claimed.Email != "" && claimed.EmailVerified && !strings.EqualFold(claimed.Email, worker.Email) {
+		owner, err := s.workerRepo.GetByEmail(ctx, claimed.Email)
+		if err != nil {
+			return nil, err
+		}
+		if owner == nil {
+			worker.Email = claimed.Email
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := s.workerRepo.Update(ctx, worker); err != nil {
+			return nil, err
+		}
+		if err := s.audit.Record(ctx, workerChange("update", &before, worker)); err != nil {
+			return nil, err
+		}
+	}
+	return worker, nil
+}
+
+// mergeNames fills the worker's name from the identity, falling back to the
+// email's local part when the provider supplies no name at all.
+func mergeNames(worker *model.Worker, id Identity) {
+	if id.FirstName != "" {
+		worker.FirstName = id.FirstName
+	}
+	if id.LastName != "" {
+		worker.LastName = id.LastName
+	}
+	if worker.FirstName == "" && worker.LastName == "" {
+		worker.FirstName, _, _ = strings.Cut(id.Email, "@")
+	}
+}
+
+func (s *WorkerService) Create(ctx context.Context, worker *model.Worker) error {
+	ctx, span := tracer.Start(ctx, "WorkerService.Create")
+	defer span.End()
+	var v validation
+	v.check(worker.FirstName != "", "firstName", "is required")
+	v.check(worker.LastName != "", "lastName", "is required")
+	v.check(worker.Email != "", "email", "is required")
+	v.check(worker.AuthSubject != "", "authSubject", "is required")
+	if err := v.err(); err != nil {
 		return err
 	}
-	if existing == nil {
-		return fmt.Errorf("worker not found")
+	// Workers created by an admin are invites until their first login.
+	worker.AuthLinkedAt = nil
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		err := s.workerRepo.Create(ctx, worker)
+		if errors.Is(err, repository.ErrDuplicate) {
+			return errWorkerExists
+		}
+		if err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, workerChange("create", nil, worker))
+	})
+}
+
+func (s *WorkerService) Update(ctx context.Context, worker *model.Worker) error {
+	ctx, span := tracer.Start(ctx, "WorkerService.Update")
+	defer span.End()
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		existing, err := s.workerRepo.GetByID(ctx, worker.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return notFound("worker")
+		}
+		err = s.workerRepo.Update(ctx, worker)
+		if errors.Is(err, repository.ErrDuplicate) {
+			return errWorkerExists
+		}
+		if err != nil {
+			return versioned(err)
+		}
+		return s.audit.Record(ctx, workerChange("update", existing, worker))
+	})
+}
+
+// workerChange files a worker change under the companies the worker is an
+// active member of.
+func workerChange(action string, before, after *model.Worker) Change {
+	current := before
+	if current == nil {
+		current = after
+	}
+	return Change{
+		Action:       action,
+		ResourceType: "worker",
+		ResourceID:   current.ID,
+		Owner:        Scope{ScopeWorker, current.ID},
+		Before:       before,
+		After:        after,
 	}
-	return s.workerRepo.Update(ctx, worker)
 }
 
 // Certificates
 
 func (s *WorkerService) ListCertificates(ctx context.Context, workerID string) ([]model.Certificate, error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.ListCertificates")
+	defer span.End()
 	return s.certRepo.ListByWorker(ctx, workerID)
 }
 
+// ListWorkerCertificates returns a page of a worker's certificates.
+func (s *WorkerService) ListWorkerCertificates(ctx context.Context, workerID string, filter repository.CertificateFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.Certificate], error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.ListWorkerCertificates")
+	defer span.End()
+	return s.certRepo.ListForWorker(ctx, workerID, filter, spec, p)
+}
+
 func (s *WorkerService) GetCertificate(ctx context.Context, id string) (*model.Certificate, error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.GetCertificate")
+	defer span.End()
 	cert, err := s.certRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if cert == nil {
-		return nil, fmt.Errorf("certificate not found")
+		return nil, notFound("certificate")
 	}
 	return cert, nil
 }
 
 func (s *WorkerService) CreateCertificate(ctx context.Context, cert *model.Certificate) error {
-	if cert.Name == "" {
-		return fmt.Errorf("certificate name is required")
-	}
-	if cert.WorkerID == "" {
-		return fmt.Errorf("worker ID is required")
+	ctx, span := tracer.Start(ctx, "WorkerService.CreateCertificate")
+	defer span.End()
+	var v validation
+	v.check(cert.Name != "", "name", "is required")
+	v.check(cert.WorkerID != "", "workerId", "is required")
+	if err := v.err(); err != nil {
+		return err
 	}
-	return s.certRepo.Create(ctx, cert)
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		if err := s.certRepo.Create(ctx, cert); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, certificateChange("create", nil, cert))
+	})
 }
 
 func (s *WorkerService) UpdateCertificate(ctx context.Context, cert *model.Certificate) error {
-	existing, err := s.certRepo.GetByID(ctx, cert.ID)
-	if err != nil {
-		return err
-	}
-	if existing == nil {
-		return fmt.Errorf("certificate not found")
-	}
-	return s.certRepo.Update(ctx, cert)
+	ctx, span := tracer.Start(ctx, "WorkerService.UpdateCertificate")
+	defer span.End()
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		existing, err := s.certRepo.GetByID(ctx, cert.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return notFound("certificate")
+		}
+		if err := s.certRepo.Update(ctx, cert); err != nil {
+			return versioned(err)
+		}
+		return s.audit.Record(ctx, certificateChange("update", existing, cert))
+	})
 }
 
-func (s *WorkerService) DeleteCertificate(ctx context.Context, id string) error {
-	existing, err := s.certRepo.GetByID(ctx, id)
-	if err != nil {
-		return err
+func (s *WorkerService) DeleteCertificate(ctx context.Context, id string, version int) error {
+	ctx, span := tracer.Start(ctx, "WorkerService.DeleteCertificate")
+	defer span.End()
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		existing, err := s.certRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return notFound("certificate")
+		}
+		if err := s.certRepo.Delete(ctx, id, version); err != nil {
+			return versioned(err)
+		}
+		return s.audit.Record(ctx, certificateChange("delete", existing, nil))
+	})
+}
+
+// certificateChange files a certificate change with its worker's.
+func certificateChange(action string, before, after *model.Certificate) Change {
+	current := before
+	if current == nil {
+		current = after
 	}
-	if existing == nil {
-		return fmt.Errorf("certificate not found")
+	return Change{
+		Action:       action,
+		ResourceType: "certificate",
+		ResourceID:   current.ID,
+		Owner:        Scope{ScopeWorker, current.WorkerID},
+		Before:       before,
+		After:        after,
 	}
-	return s.certRepo.Delete(ctx, id)
 }
 
 // Memberships
 
 func (s *WorkerService) ListMemberships(ctx context.Context, workerID string) ([]model.WorkerCompany, error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.ListMemberships")
+	defer span.End()
 	return s.wcRepo.ListByWorker(ctx, workerID)
 }
 
+// ListWorkerMemberships returns a page of a worker's company memberships.
+func (s *WorkerService) ListWorkerMemberships(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.WorkerCompany], error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.ListWorkerMemberships")
+	defer span.End()
+	return s.wcRepo.ListForWorker(ctx, workerID, spec, p)
+}
+
 func (s *WorkerService) ListCompanyMembers(ctx context.Context, companyID string) ([]model.WorkerCompany, error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.ListCompanyMembers")
+	defer span.End()
 	return s.wcRepo.ListByCompany(ctx, companyID)
 }
 
 func (s *WorkerService) AddMembership(ctx context.Context, wc *model.WorkerCompany) error {
-	if wc.WorkerID == "" || wc.CompanyID == "" {
-		return fmt.Errorf("worker ID and company ID are required")
-	}
-	existing, err := s.wcRepo.Get(ctx, wc.WorkerID, wc.CompanyID)
-	if err != nil {
-		return err
-	}
-	if existing != nil {
-		return fmt.Errorf("membership already exists")
-	}
+	ctx, span := tracer.Start(ctx, "WorkerService.AddMembership")
+	defer span.End()
+	var v validation
+	v.check(wc.WorkerID != "", "workerId", "is required")
+	v.check(wc.CompanyID != "", "companyId", "is required")
 	if wc.Status == "" {
 		wc.Status = model.MembershipActive
 	}
 	if wc.Role == "" {
 		wc.Role = model.RoleWorker
 	}
-	return s.wcRepo.Create(ctx, wc)
+	v.check(validRole(wc.Role), "role", "is not a valid role")
+	v.check(oneOf(wc.Status, model.MembershipActive, model.MembershipInactive), "status", "is not a valid membership status")
+	if err := v.err(); err != nil {
+		return err
+	}
+	// The check and the insert share a transaction, and the insert still
+	// maps a unique violation, so a concurrent add of the same membership
+	// is a conflict rather than a failure.
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		existing, err := s.wcRepo.Get(ctx, wc.WorkerID, wc.CompanyID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return errMembershipExists
+		}
+		err = s.wcRepo.Create(ctx, wc)
+		if errors.Is(err, repository.ErrDuplicate) {
+			return errMembershipExists
+		}
+		if err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, membershipChange("create", nil, wc))
+	})
 }
 
-func (s *WorkerService) UpdateMembershipRole(ctx context.Context, workerID, companyID string, role model.WorkerRole) error {
-	existing, err := s.wcRepo.Get(ctx, workerID, companyID)
-	if err != nil {
-		return err
+// UpdateMembershipRole changes a membership's role and returns the
+// membership. version, if not 0, is the version the caller read.
+func (s *WorkerService) UpdateMembershipRole(ctx context.Context, workerID, companyID string, role model.WorkerRole, version int) (*model.WorkerCompany, error) {
+	ctx, span := tracer.Start(ctx, "WorkerService.UpdateMembershipRole")
+	defer span.End()
+	if !validRole(role) {
+		return nil, invalid("role", "is not a valid role")
 	}
-	if existing == nil {
-		return fmt.Errorf("membership not found")
+	var updated model.WorkerCompany
+	err := atomically(ctx, s.uow, func(ctx context.Context) error {
+		existing, err := s.wcRepo.Get(ctx, workerID, companyID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return notFound("membership")
+		}
+		if err := checkVersion(existing.Version, version); err != nil {
+			return err
+		}
+		updated = *existing
+		updated.Role = role
+		if err := s.wcRepo.UpdateRole(ctx, &updated); err != nil {
+			return versioned(err)
+		}
+		return s.audit.Record(ctx, membershipChange("update_role", existing, &updated))
+	})
+	if err != nil {
+		return nil, err
 	}
-	return s.wcRepo.UpdateRole(ctx, workerID, companyID, role)
+	return &updated, nil
 }
 
-func (s *WorkerService) RemoveMembership(ctx context.Context, workerID, companyID string) error {
-	existing, err := s.wcRepo.Get(ctx, workerID, companyID)
-	if err != nil {
-		return err
+func validRole(role model.WorkerRole) bool {
+	return oneOf(role, model.RoleWorker, model.RoleCompanyAdmin, model.RoleSiteAdmin)
+}
+
+// RemoveMembership ends a worker's membership of a company. version, if
+// not 0, is the version the caller read.
+func (s *WorkerService) RemoveMembership(ctx context.Context, workerID, companyID string, version int) error {
+	ctx, span := tracer.Start(ctx, "WorkerService.RemoveMembership")
+	defer span.End()
+	return atomically(ctx, s.uow, func(ctx context.Context) error {
+		existing, err := s.wcRepo.Get(ctx, workerID, companyID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return notFound("membership")
+		}
+		if err := s.wcRepo.Delete(ctx, workerID, companyID, version); err != nil {
+			return versioned(err)
+		}
+		return s.audit.Record(ctx, membershipChange("delete", existing, nil))
+	})
+}
+
+// membershipChange files a membership change under its company. A
+// membership has no ID of its own, so the event's resource ID is the
+// worker's.
+func membershipChange(action string, before, after *model.WorkerCompany) Change {
+	current := before
+	if current == nil {
+		current = after
 	}
-	if existing == nil {
-		return fmt.Errorf("membership not found")
+	return Change{
+		Action:       action,
+		ResourceType: "membership",
+		ResourceID:   current.WorkerID,
+		Owner:        Scope{ScopeCompany, current.CompanyID},
+		Before:       before,
+		After:        after,
 	}
-	return s.wcRepo.Delete(ctx, workerID, companyID)
 }
@@ -2,9 +2,16 @@ package service_test
 
 import (
 	"context"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
+	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
@@ -13,11 +20,11 @@ type mockWorkerRepo struct {
 	err     error
 }
 
-func (m *mockWorkerRepo) List(ctx context.Context, limit, offset int) ([]model.Worker, error) {
+func (m *mockWorkerRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Worker], error) {
 	if m.err != nil {
 		return nil, m.err
 	}
-	return m.workers, nil
+	return &pagination.Page[model.Worker]{Items: m.workers}, nil
 }
 
 func (m *mockWorkerRepo) GetByID(ctx context.Context, id string) (*model.Worker, error) {
@@ -53,12 +60,55 @@ func (m *mockWorkerRepo) Create(ctx context.Context, worker *model.Worker) error
 	return nil
 }
 
-func (m *mockWorkerRepo) Update(ctx context.Context, worker *model.Worker) error { return m.err }
-func (m *mockWorkerRepo) Delete(ctx context.Context, id string) error             { return m.err }
+func (m *mockWorkerRepo) GetByEmail(ctx context.Context, email string) (*model.Worker, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, w := range m.workers {
+		if strings.EqualFold(w.Email, email) {
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockWorkerRepo) Update(ctx context.Context, worker *model.Worker) error {
+	if m.err != nil {
+		return m.err
+	}
+	for i := range m.workers {
+		if m.workers[i].ID == worker.ID {
+			m.workers[i] = *worker
+		}
+	}
+	return nil
+}
+
+func (m *mockWorkerRepo) Link(ctx context.Context, worker *model.Worker) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	for i := range m.workers {
+		if m.workers[i].ID == worker.ID {
+			if m.workers[i].AuthLinkedAt != nil {
+				return false, nil
+			}
+			now := time.Now()
+			worker.AuthLinkedAt = &now
+			m.workers[i] = *worker
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockWorkerRepo) Delete(ctx context.Context, id string) error { return m.err }
 
 type mockCertRepo struct {
 	certs []model.Certificate
 	err   error
+
+	page pagination.Request
 }
 
 func (m *mockCertRepo) ListByWorker(ctx context.Context, workerID string) ([]model.Certificate, error) {
@@ -74,6 +124,11 @@ func (m *mockCertRepo) ListByWorker(ctx context.Context, workerID string) ([]mod
 	return result, nil
 }
 
+func (m *mockCertRepo) ListForWorker(ctx context.Context, workerID string, filter repository.CertificateFilter, spec query.Spec, p pagination.Request) (*pagination.Page[model.Certificate], error) {
+	m.page = p
+	return pageOf(m.ListByWorker(ctx, workerID))
+}
+
 func (m *mockCertRepo) GetByID(ctx context.Context, id string) (*model.Certificate, error) {
 	if m.err != nil {
 		return nil, m.err
@@ -95,7 +150,7 @@ func (m *mockCertRepo) Create(ctx context.Context, cert *model.Certificate) erro
 }
 
 func (m *mockCertRepo) Update(ctx context.Context, cert *model.Certificate) error { return m.err }
-func (m *mockCertRepo) Delete(ctx context.Context, id string) error               { return m.err }
+func (m *mockCertRepo) Delete(ctx context.Context, id string, version int) error  { return m.err }
 
 type mockWCRepo struct {
 	memberships []model.WorkerCompany
@@ -115,6 +170,10 @@ func (m *mockWCRepo) ListByWorker(ctx context.Context, workerID string) ([]model
 	return result, nil
 }
 
+func (m *mockWCRepo) ListForWorker(ctx context.Context, workerID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.WorkerCompany], error) {
+	return pageOf(m.ListByWorker(ctx, workerID))
+}
+
 func (m *mockWCRepo) ListByCompany(ctx context.Context, companyID string) ([]model.WorkerCompany, error) {
 	return nil, m.err
 }
@@ -132,16 +191,31 @@ func (m *mockWCRepo) Get(ctx context.Context, workerID, companyID string) (*mode
 }
 
 func (m *mockWCRepo) Create(ctx context.Context, wc *model.WorkerCompany) error { return m.err }
-func (m *mockWCRepo) UpdateRole(ctx context.Context, workerID, companyID string, role model.WorkerRole) error {
-	return m.err
+func (m *mockWCRepo) UpdateRole(ctx context.Context, wc *model.WorkerCompany) error {
+	if m.err != nil {
+		return m.err
+	}
+	for i := range m.memberships {
+		if m.memberships[i].WorkerID == wc.WorkerID && m.memberships[i].CompanyID == wc.CompanyID {
+			if wc.Version != 0 && wc.Version != m.memberships[i].Version {
+				return repository.ErrVersionMismatch
+			}
+			wc.Version = m.memberships[i].Version + 1
+			m.memberships[i] = *wc
+			return nil
+		}
+	}
+	return repository.ErrVersionMismatch
 }
 func (m *mockWCRepo) UpdateStatus(ctx context.Context, workerID, companyID string, status model.MembershipStatus) error {
 	return m.err
 }
-func (m *mockWCRepo) Delete(ctx context.Context, workerID, companyID string) error { return m.err }
+func (m *mockWCRepo) Delete(ctx context.Context, workerID, companyID string, version int) error {
+	return m.err
+}
 
 func TestWorkerService_Create_Valid(t *testing.T) {
-	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{})
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
 	worker := &model.Worker{
 		AuthSubject: "sub-123",
 		FirstName:   "John",
@@ -158,7 +232,7 @@ func TestWorkerService_Create_Valid(t *testing.T) {
 }
 
 func TestWorkerService_Create_MissingName(t *testing.T) {
-	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{})
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
 	err := svc.Create(context.Background(), &model.Worker{
 		AuthSubject: "sub-123",
 		Email:       "test@example.com",
@@ -169,7 +243,7 @@ func TestWorkerService_Create_MissingName(t *testing.T) {
 }
 
 func TestWorkerService_Create_MissingEmail(t *testing.T) {
-	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{})
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
 	err := svc.Create(context.Background(), &model.Worker{
 		AuthSubject: "sub-123",
 		FirstName:   "John",
@@ -181,7 +255,7 @@ func TestWorkerService_Create_MissingEmail(t *testing.T) {
 }
 
 func TestWorkerService_Create_MissingAuthSubject(t *testing.T) {
-	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{})
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
 	err := svc.Create(context.Background(), &model.Worker{
 		FirstName: "John",
 		LastName:  "Smith",
@@ -193,7 +267,7 @@ func TestWorkerService_Create_MissingAuthSubject(t *testing.T) {
 }
 
 func TestWorkerService_GetByID_NotFound(t *testing.T) {
-	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{})
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
 	_, err := svc.GetByID(context.Background(), "missing")
 	if err == nil {
 		t.Error("expected error for missing worker")
@@ -201,7 +275,7 @@ func TestWorkerService_GetByID_NotFound(t *testing.T) {
 }
 
 func TestWorkerService_CreateCertificate_Valid(t *testing.T) {
-	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{})
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
 	cert := &model.Certificate{WorkerID: "w1", Name: "SIA Door Supervisor"}
 	err := svc.CreateCertificate(context.Background(), cert)
 	if err != nil {
@@ -213,7 +287,7 @@ func TestWorkerService_CreateCertificate_Valid(t *testing.T) {
 }
 
 func TestWorkerService_CreateCertificate_MissingName(t *testing.T) {
-	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{})
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
 	err := svc.CreateCertificate(context.Background(), &model.Certificate{WorkerID: "w1"})
 	if err == nil {
 		t.Error("expected error for missing cert name")
@@ -226,17 +300,222 @@ func TestWorkerService_AddMembership_Duplicate(t *testing.T) {
 			{WorkerID: "w1", CompanyID: "c1", Role: model.RoleWorker, Status: model.MembershipActive},
 		},
 	}
-	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, wcRepo)
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, wcRepo, nil, nil)
 	err := svc.AddMembership(context.Background(), &model.WorkerCompany{WorkerID: "w1", CompanyID: "c1"})
-	if err == nil {
-		t.Error("expected error for duplicate membership")
+	var conflict *service.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Errorf("expected a ConflictError for duplicate membership, got %v", err)
+	}
+}
+
+// racingWCRepo loses a race to add a membership: another request inserts
+// it between the duplicate check and the insert.
+type racingWCRepo struct {
+	mockWCRepo
+	checkedInUnit bool
+}
+
+func (r *racingWCRepo) Get(ctx context.Context, workerID, companyID string) (*model.WorkerCompany, error) {
+	r.checkedInUnit = inUnitOfWork(ctx)
+	return nil, nil
+}
+
+func (r *racingWCRepo) Create(ctx context.Context, wc *model.WorkerCompany) error {
+	return repository.ErrDuplicate
+}
+
+func TestWorkerService_AddMembership_Race(t *testing.T) {
+	wcRepo := &racingWCRepo{}
+	uow := &fakeUnitOfWork{}
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, wcRepo, nil, uow)
+	err := svc.AddMembership(context.Background(), &model.WorkerCompany{WorkerID: "w1", CompanyID: "c1"})
+	var conflict *service.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Errorf("expected a ConflictError for a membership added concurrently, got %v", err)
+	}
+	if uow.runs != 1 || !wcRepo.checkedInUnit {
+		t.Errorf("expected the check and insert to share a unit of work, got %d runs", uow.runs)
+	}
+}
+
+func TestWorkerService_AddMembership_UnknownRole(t *testing.T) {
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
+	err := svc.AddMembership(context.Background(), &model.WorkerCompany{WorkerID: "w1", CompanyID: "c1", Role: "owner"})
+	var invalid *service.ValidationError
+	if !errors.As(err, &invalid) || invalid.Fields[0].Field != "role" {
+		t.Errorf("expected a role ValidationError, got %v", err)
+	}
+}
+
+func TestWorkerService_Create_DuplicateEmail(t *testing.T) {
+	svc := service.NewWorkerService(&mockWorkerRepo{err: repository.ErrDuplicate}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
+	err := svc.Create(context.Background(), &model.Worker{FirstName: "Ann", LastName: "Lee", Email: "ann@example.com", AuthSubject: "kc-ann"})
+	var conflict *service.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Errorf("expected a ConflictError for a duplicate worker, got %v", err)
 	}
 }
 
 func TestWorkerService_RemoveMembership_NotFound(t *testing.T) {
-	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{})
-	err := svc.RemoveMembership(context.Background(), "w1", "c1")
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
+	err := svc.RemoveMembership(context.Background(), "w1", "c1", 0)
 	if err == nil {
 		t.Error("expected error for missing membership")
 	}
 }
+
+func TestWorkerService_UpdateMembershipRole_Version(t *testing.T) {
+	wcRepo := &mockWCRepo{memberships: []model.WorkerCompany{
+		{WorkerID: "w1", CompanyID: "c1", Role: model.RoleWorker, Status: model.MembershipActive, Version: 2},
+	}}
+	svc := service.NewWorkerService(&mockWorkerRepo{}, &mockCertRepo{}, wcRepo, nil, nil)
+
+	if _, err := svc.UpdateMembershipRole(context.Background(), "w1", "c1", model.RoleSiteAdmin, 1); !errors.Is(err, service.ErrPreconditionFailed) {
+		t.Fatalf("expected a stale version to fail the precondition, got %v", err)
+	}
+	if wcRepo.memberships[0].Role != model.RoleWorker {
+		t.Errorf("expected a stale update to leave the role, got %s", wcRepo.memberships[0].Role)
+	}
+
+	updated, err := svc.UpdateMembershipRole(context.Background(), "w1", "c1", model.RoleSiteAdmin, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Role != model.RoleSiteAdmin || updated.Version != 3 {
+		t.Errorf("expected the membership updated to version 3, got %s at version %d", updated.Role, updated.Version)
+	}
+}
+
+func TestWorkerService_ListWorkerCertificates_Paging(t *testing.T) {
+	p := pagination.Request{Limit: 10, After: []string{"2030-01-01", "c9"}}
+	certRepo := &mockCertRepo{}
+	svc := service.NewWorkerService(&mockWorkerRepo{}, certRepo, &mockWCRepo{}, nil, nil)
+	if _, err := svc.ListWorkerCertificates(context.Background(), "w1", repository.CertificateFilter{}, query.Spec{}, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(certRepo.page, p) {
+		t.Errorf("expected the page %+v to reach the repository, got %+v", p, certRepo.page)
+	}
+}
+
+func linkedWorker(id, subject, email string) model.Worker {
+	linkedAt := time.Now().Add(-24 * time.Hour)
+	return model.Worker{ID: id, AuthSubject: subject, FirstName: "John", LastName: "Smith", Email: email, AuthLinkedAt: &linkedAt}
+}
+
+func TestWorkerService_Provision_ClaimsInvite(t *testing.T) {
+	repo := &mockWorkerRepo{workers: []model.Worker{
+		{ID: "w1", AuthSubject: "john.smith", FirstName: "John", LastName: "Smith", Email: "john.smith@example.com"},
+	}}
+	svc := service.NewWorkerService(repo, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
+
+	worker, err := svc.Provision(context.Background(), service.Identity{
+		Subject:       "kc-uuid-1",
+		Email:         "John.Smith@example.com",
+		EmailVerified: true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if worker.ID != "w1" || worker.AuthSubject != "kc-uuid-1" || worker.AuthLinkedAt == nil {
+		t.Errorf("expected invite w1 to be linked to kc-uuid-1, got %+v", worker)
+	}
+	if repo.workers[0].AuthSubject != "kc-uuid-1" {
+		t.Errorf("expected link to be persisted, got subject %q", repo.workers[0].AuthSubject)
+	}
+}
+
+func TestWorkerService_Provision_CreatesFromProfile(t *testing.T) {
+	repo := &mockWorkerRepo{}
+	svc := service.NewWorkerService(repo, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
+
+	loaded := false
+	worker, err := svc.Provision(context.Background(), service.Identity{Subject: "kc-uuid-2"},
+		func(ctx context.Context) (*service.Identity, error) {
+			loaded = true
+			return &service.Identity{Subject: "kc-uuid-2", Email: "jane@example.com", EmailVerified: true, FirstName: "Jane", LastName: "Doe"}, nil
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !loaded {
+		t.Error("expected the profile to be loaded from the provider")
+	}
+	if len(repo.workers) != 1 || worker.FirstName != "Jane" || worker.Email != "jane@example.com" || worker.AuthLinkedAt == nil {
+		t.Errorf("unexpected worker created: %+v", worker)
+	}
+}
+
+func TestWorkerService_Provision_SyncsLinkedWorker(t *testing.T) {
+	repo := &mockWorkerRepo{workers: []model.Worker{linkedWorker("w1", "kc-uuid-1", "john@example.com")}}
+	svc := service.NewWorkerService(repo, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
+
+	worker, err := svc.Provision(context.Background(), service.Identity{
+		Subject:       "kc-uuid-1",
+		Email:         "j.smith@example.com",
+		EmailVerified: true,
+		FirstName:     "Johnny",
+	}, func(ctx context.Context) (*service.Identity, error) {
+		t.Fatal("profile should not be loaded for a linked worker")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if worker.FirstName != "Johnny" || worker.LastName != "Smith" || worker.Email != "j.smith@example.com" {
+		t.Errorf("expected name and email to be synced, got %+v", worker)
+	}
+	if repo.workers[0].Email != "j.smith@example.com" {
+		t.Errorf("expected sync to be persisted, got %+v", repo.workers[0])
+	}
+}
+
+func TestWorkerService_Provision_SyncSkipsCollidingEmail(t *testing.T) {
+	repo := &mockWorkerRepo{workers: []model.Worker{
+		linkedWorker("w1", "kc-uuid-1", "john@example.com"),
+		linkedWorker("w2", "kc-uuid-2", "taken@example.com"),
+	}}
+	svc := service.NewWorkerService(repo, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
+
+	worker, err := svc.Provision(context.Background(), service.Identity{
+		Subject:       "kc-uuid-1",
+		Email:         "taken@example.com",
+		EmailVerified: true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if worker.Email != "john@example.com" {
+		t.Errorf("expected email to be left unchanged, got %q", worker.Email)
+	}
+}
+
+func TestWorkerService_Provision_Rejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity service.Identity
+		wantErr  error
+	}{
+		{"email linked to another identity", service.Identity{Subject: "intruder", Email: "john@example.com", EmailVerified: true}, service.ErrEmailConflict},
+		{"unverified email claiming invite", service.Identity{Subject: "intruder", Email: "invited@example.com"}, service.ErrEmailUnverified},
+		{"unverified email for new worker", service.Identity{Subject: "intruder", Email: "new@example.com"}, service.ErrEmailUnverified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockWorkerRepo{workers: []model.Worker{
+				linkedWorker("w1", "kc-uuid-1", "john@example.com"),
+				{ID: "w2", AuthSubject: "invited", FirstName: "New", LastName: "Starter", Email: "invited@example.com"},
+			}}
+			svc := service.NewWorkerService(repo, &mockCertRepo{}, &mockWCRepo{}, nil, nil)
+
+			_, err := svc.Provision(context.Background(), tt.identity, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if len(repo.workers) != 2 || repo.workers[0].AuthSubject != "kc-uuid-1" || repo.workers[1].AuthLinkedAt != nil {
+				t.Errorf("expected workers to be untouched, got %+v", repo.workers)
+			}
+		})
+	}
+}
@@ -2,76 +2,107 @@ package service
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 	"github.com/chrishaylesai/sitesecurity/api/internal/repository"
 )
 
 type WorksiteService struct {
-	repo repository.WorksiteRepository
+	repo  repository.WorksiteRepository
+	audit *AuditService
 }
 
-func NewWorksiteService(repo repository.WorksiteRepository) *WorksiteService {
-	return &WorksiteService{repo: repo}
+func NewWorksiteService(repo repository.WorksiteRepository, audit *AuditService) *WorksiteService {
+	return &WorksiteService{repo: repo, audit: audit}
 }
 
-func (s *WorksiteService) List(ctx context.Context, companyID string, page, perPage int) ([]model.Worksite, error) {
+func (s *WorksiteService) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Worksite], error) {
+	ctx, span := tracer.Start(ctx, "WorksiteService.List")
+	defer span.End()
 	if companyID == "" {
-		return nil, fmt.Errorf("company ID is required")
+		return nil, invalid("company_id", "is required")
 	}
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 25
-	}
-	offset := (page - 1) * perPage
-	return s.repo.List(ctx, companyID, perPage, offset)
+	return s.repo.List(ctx, companyID, spec, p)
 }
 
 func (s *WorksiteService) GetByID(ctx context.Context, id string) (*model.Worksite, error) {
+	ctx, span := tracer.Start(ctx, "WorksiteService.GetByID")
+	defer span.End()
 	worksite, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if worksite == nil {
-		return nil, fmt.Errorf("worksite not found")
+		return nil, notFound("worksite")
 	}
 	return worksite, nil
 }
 
 func (s *WorksiteService) Create(ctx context.Context, worksite *model.Worksite) error {
-	if worksite.Name == "" {
-		return fmt.Errorf("worksite name is required")
+	ctx, span := tracer.Start(ctx, "WorksiteService.Create")
+	defer span.End()
+	var v validation
+	v.check(worksite.Name != "", "name", "is required")
+	v.check(worksite.CompanyID != "", "companyId", "is required")
+	if err := v.err(); err != nil {
+		return err
 	}
-	if worksite.CompanyID == "" {
-		return fmt.Errorf("company ID is required")
+	if err := s.repo.Create(ctx, worksite); err != nil {
+		return err
 	}
-	return s.repo.Create(ctx, worksite)
+	return s.audit.Record(ctx, worksiteChange("create", nil, worksite))
 }
 
 func (s *WorksiteService) Update(ctx context.Context, worksite *model.Worksite) error {
+	ctx, span := tracer.Start(ctx, "WorksiteService.Update")
+	defer span.End()
 	if worksite.Name == "" {
-		return fmt.Errorf("worksite name is required")
+		return invalid("name", "is required")
 	}
 	existing, err := s.repo.GetByID(ctx, worksite.ID)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
-		return fmt.Errorf("worksite not found")
+		return notFound("worksite")
+	}
+	if err := s.repo.Update(ctx, worksite); err != nil {
+		return versioned(err)
 	}
-	return s.repo.Update(ctx, worksite)
+	return s.audit.Record(ctx, worksiteChange("update", existing, worksite))
 }
 
-func (s *WorksiteService) Delete(ctx context.Context, id string) error {
+func (s *WorksiteService) Delete(ctx context.Context, id string, version int) error {
+	ctx, span := tracer.Start(ctx, "WorksiteService.Delete")
+	defer span.End()
 	existing, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
-		return fmt.Errorf("worksite not found")
+		return notFound("worksite")
+	}
+	if err := s.repo.Delete(ctx, id, version); err != nil {
+		return versioned(err)
+	}
+	return s.audit.Record(ctx, worksiteChange("delete", existing, nil))
+}
+
+// worksiteChange files a worksite change under the company it belongs to,
+// which an update cannot move it out of.
+func worksiteChange(action string, before, after *model.Worksite) Change {
+	current := before
+	if current == nil {
+		current = after
+	}
+	return Change{
+		Action:       action,
+		ResourceType: "worksite",
+		ResourceID:   current.ID,
+		Owner:        Scope{ScopeCompany, current.CompanyID},
+		Before:       before,
+		After:        after,
 	}
-	return s.repo.Delete(ctx, id)
 }
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/chrishaylesai/sitesecurity/api/internal/model"
+	"github.com/chrishaylesai/sitesecurity/api/internal/pagination"
+	"github.com/chrishaylesai/sitesecurity/api/internal/query"
 	"github.com/chrishaylesai/sitesecurity/api/internal/service"
 )
 
@@ -14,7 +16,7 @@ type mockWorksiteRepo struct {
 	err       error
 }
 
-func (m *mockWorksiteRepo) List(ctx context.Context, companyID string, limit, offset int) ([]model.Worksite, error) {
+func (m *mockWorksiteRepo) List(ctx context.Context, companyID string, spec query.Spec, p pagination.Request) (*pagination.Page[model.Worksite], error) {
 	if m.err != nil {
 		return nil, m.err
 	}
@@ -24,7 +26,7 @@ func (m *mockWorksiteRepo) List(ctx context.Context, companyID string, limit, of
 			result = append(result, w)
 		}
 	}
-	return result, nil
+	return &pagination.Page[model.Worksite]{Items: result}, nil
 }
 
 func (m *mockWorksiteRepo) GetByID(ctx context.Context, id string) (*model.Worksite, error) {
@@ -49,11 +51,11 @@ func (m *mockWorksiteRepo) Create(ctx context.Context, worksite *model.Worksite)
 }
 
 func (m *mockWorksiteRepo) Update(ctx context.Context, worksite *model.Worksite) error { return m.err }
-func (m *mockWorksiteRepo) Delete(ctx context.Context, id string) error                { return m.err }
+func (m *mockWorksiteRepo) Delete(ctx context.Context, id string, version int) error   { return m.err }
 
 func TestWorksiteService_List_RequiresCompanyID(t *testing.T) {
-	svc := service.NewWorksiteService(&mockWorksiteRepo{})
-	_, err := svc.List(context.Background(), "", 1, 25)
+	svc := service.NewWorksiteService(&mockWorksiteRepo{}, nil)
+	_, err := svc.List(context.Background(), "", query.Spec{}, pagination.Request{})
 	if err == nil {
 		t.Error("expected error for empty company ID")
 	}
@@ -61,7 +63,7 @@ func TestWorksiteService_List_RequiresCompanyID(t *testing.T) {
 
 func TestWorksiteService_Create_Valid(t *testing.T) {
 	repo := &mockWorksiteRepo{}
-	svc := service.NewWorksiteService(repo)
+	svc := service.NewWorksiteService(repo, nil)
 
 	ws := &model.Worksite{Name: "Test Site", CompanyID: "company-1"}
 	err := svc.Create(context.Background(), ws)
@@ -74,7 +76,7 @@ func TestWorksiteService_Create_Valid(t *testing.T) {
 }
 
 func TestWorksiteService_Create_EmptyName(t *testing.T) {
-	svc := service.NewWorksiteService(&mockWorksiteRepo{})
+	svc := service.NewWorksiteService(&mockWorksiteRepo{}, nil)
 	err := svc.Create(context.Background(), &model.Worksite{CompanyID: "c1"})
 	if err == nil {
 		t.Error("expected error for empty name")
@@ -82,7 +84,7 @@ func TestWorksiteService_Create_EmptyName(t *testing.T) {
 }
 
 func TestWorksiteService_Create_EmptyCompanyID(t *testing.T) {
-	svc := service.NewWorksiteService(&mockWorksiteRepo{})
+	svc := service.NewWorksiteService(&mockWorksiteRepo{}, nil)
 	err := svc.Create(context.Background(), &model.Worksite{Name: "Site"})
 	if err == nil {
 		t.Error("expected error for empty company ID")
@@ -90,7 +92,7 @@ func TestWorksiteService_Create_EmptyCompanyID(t *testing.T) {
 }
 
 func TestWorksiteService_GetByID_NotFound(t *testing.T) {
-	svc := service.NewWorksiteService(&mockWorksiteRepo{})
+	svc := service.NewWorksiteService(&mockWorksiteRepo{}, nil)
 	_, err := svc.GetByID(context.Background(), "missing")
 	if err == nil {
 		t.Error("expected error for missing worksite")
@@ -98,8 +100,8 @@ func TestWorksiteService_GetByID_NotFound(t *testing.T) {
 }
 
 func TestWorksiteService_Delete_NotFound(t *testing.T) {
-	svc := service.NewWorksiteService(&mockWorksiteRepo{})
-	err := svc.Delete(context.Background(), "missing")
+	svc := service.NewWorksiteService(&mockWorksiteRepo{}, nil)
+	err := svc.Delete(context.Background(), "missing", 0)
 	if err == nil {
 		t.Error("expected error for missing worksite")
 	}
@@ -107,8 +109,8 @@ func TestWorksiteService_Delete_NotFound(t *testing.T) {
 
 func TestWorksiteService_List_RepoError(t *testing.T) {
 	repo := &mockWorksiteRepo{err: fmt.Errorf("db error")}
-	svc := service.NewWorksiteService(repo)
-	_, err := svc.List(context.Background(), "c1", 1, 25)
+	svc := service.NewWorksiteService(repo, nil)
+	_, err := svc.List(context.Background(), "c1", query.Spec{}, pagination.Request{})
 	if err == nil {
 		t.Error("expected error from repo")
 	}
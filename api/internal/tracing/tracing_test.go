@@ -0,0 +1,63 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/chrishaylesai/sitesecurity/api/internal/config"
+	"github.com/chrishaylesai/sitesecurity/api/internal/tracing"
+)
+
+func TestSetup_Disabled(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected shutdown error: %v", err)
+	}
+}
+
+func TestSetup_ExportsToCollector(t *testing.T) {
+	paths := make(chan string, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case paths <- r.URL.Path:
+		default:
+		}
+	}))
+	defer collector.Close()
+
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConfig{
+		Endpoint:    collector.URL,
+		ServiceName: "sitesecurity-api-test",
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "check-in")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+
+	select {
+	case path := <-paths:
+		if path != "/v1/traces" {
+			t.Errorf("expected spans at /v1/traces, got %s", path)
+		}
+	default:
+		t.Error("expected the span to be exported on shutdown")
+	}
+}
+
+func TestSetup_InvalidEndpoint(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), config.TracingConfig{Endpoint: "http://[::1"}); err == nil {
+		t.Error("expected an invalid endpoint to be rejected")
+	}
+}
@@ -0,0 +1,52 @@
+// Package tracingtest records the spans a test produces in memory.
+package tracingtest
+
+import (
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	once     sync.Once
+	exporter *tracetest.InMemoryExporter
+)
+
+// Record installs, once per test binary, a tracer provider that exports
+// every span synchronously to memory, and returns its exporter emptied of
+// earlier tests' spans. Tests using it must not run in parallel.
+//
+// The provider is installed only once because tracers taken from the
+// global provider before the first one is set keep delegating to it.
+func Record(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	once.Do(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	exporter.Reset()
+	return exporter
+}
+
+// Find returns the recorded span named name, failing the test if there is
+// none.
+func Find(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	t.Helper()
+	spans := exporter.GetSpans()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+	}
+	t.Fatalf("expected a span named %q, got %q", name, names)
+	return tracetest.SpanStub{}
+}
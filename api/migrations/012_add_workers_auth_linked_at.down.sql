@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_workers_email_lower;
+ALTER TABLE workers DROP COLUMN IF EXISTS auth_linked_at;
@@ -0,0 +1,5 @@
+-- Workers created by an admin invite carry a placeholder auth_subject until
+-- the invitee first logs in; auth_linked_at records when that happened.
+ALTER TABLE workers ADD COLUMN auth_linked_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX idx_workers_email_lower ON workers (LOWER(email));
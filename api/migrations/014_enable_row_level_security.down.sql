@@ -0,0 +1,44 @@
+DROP POLICY IF EXISTS tenant_isolation ON alarms;
+DROP POLICY IF EXISTS own_rows ON alarms;
+ALTER TABLE alarms DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON location_check_ins;
+DROP POLICY IF EXISTS own_rows ON location_check_ins;
+ALTER TABLE location_check_ins DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON shift_reports;
+DROP POLICY IF EXISTS own_rows ON shift_reports;
+ALTER TABLE shift_reports DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON shift_assignments;
+DROP POLICY IF EXISTS own_rows ON shift_assignments;
+ALTER TABLE shift_assignments DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON shifts;
+ALTER TABLE shifts DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON worker_companies;
+DROP POLICY IF EXISTS own_rows ON worker_companies;
+ALTER TABLE worker_companies DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON api_keys;
+ALTER TABLE api_keys DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON shift_report_templates;
+ALTER TABLE shift_report_templates DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON worksites;
+ALTER TABLE worksites DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS companies_read ON companies;
+DROP POLICY IF EXISTS companies_create ON companies;
+DROP POLICY IF EXISTS companies_update ON companies;
+DROP POLICY IF EXISTS companies_delete ON companies;
+ALTER TABLE companies DISABLE ROW LEVEL SECURITY;
+
+DROP FUNCTION IF EXISTS app_current_worker_id();
+DROP FUNCTION IF EXISTS app_current_company_ids();
+
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE SELECT, INSERT, UPDATE, DELETE ON TABLES FROM sitesecurity_tenant;
+REVOKE SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public FROM sitesecurity_tenant;
+REVOKE USAGE ON SCHEMA public FROM sitesecurity_tenant;
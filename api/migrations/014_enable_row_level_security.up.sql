@@ -0,0 +1,99 @@
+-- Row-level security isolates tenants as defence in depth behind the API's
+-- own access checks. Requests run as sitesecurity_tenant with
+-- app.current_company_ids set to the caller's companies and
+-- app.current_worker_id to the caller; the migrating role owns the tables
+-- and bypasses the policies for system jobs.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'sitesecurity_tenant') THEN
+        CREATE ROLE sitesecurity_tenant NOLOGIN;
+    END IF;
+END
+$$;
+
+GRANT sitesecurity_tenant TO CURRENT_USER;
+GRANT USAGE ON SCHEMA public TO sitesecurity_tenant;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO sitesecurity_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO sitesecurity_tenant;
+
+CREATE FUNCTION app_current_company_ids() RETURNS UUID[]
+LANGUAGE sql STABLE AS $$
+    SELECT COALESCE(string_to_array(NULLIF(current_setting('app.current_company_ids', true), ''), ',')::UUID[], '{}')
+$$;
+
+CREATE FUNCTION app_current_worker_id() RETURNS UUID
+LANGUAGE sql STABLE AS $$
+    SELECT NULLIF(current_setting('app.current_worker_id', true), '')::UUID
+$$;
+
+-- Companies are a directory any caller may read or add to; only members
+-- may change one.
+ALTER TABLE companies ENABLE ROW LEVEL SECURITY;
+CREATE POLICY companies_read ON companies FOR SELECT TO sitesecurity_tenant USING (true);
+CREATE POLICY companies_create ON companies FOR INSERT TO sitesecurity_tenant WITH CHECK (true);
+CREATE POLICY companies_update ON companies FOR UPDATE TO sitesecurity_tenant
+    USING (id = ANY (app_current_company_ids()));
+CREATE POLICY companies_delete ON companies FOR DELETE TO sitesecurity_tenant
+    USING (id = ANY (app_current_company_ids()));
+
+ALTER TABLE worksites ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON worksites TO sitesecurity_tenant
+    USING (company_id = ANY (app_current_company_ids()));
+
+ALTER TABLE shift_report_templates ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON shift_report_templates TO sitesecurity_tenant
+    USING (company_id = ANY (app_current_company_ids()));
+
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON api_keys TO sitesecurity_tenant
+    USING (company_id = ANY (app_current_company_ids()));
+
+-- A worker can always read their own memberships, but only a company's
+-- members can change its memberships.
+ALTER TABLE worker_companies ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON worker_companies TO sitesecurity_tenant
+    USING (company_id = ANY (app_current_company_ids()));
+CREATE POLICY own_rows ON worker_companies FOR SELECT TO sitesecurity_tenant
+    USING (worker_id = app_current_worker_id());
+
+-- Tables below inherit their company through another tenant table, whose
+-- own policy limits the subquery.
+ALTER TABLE shifts ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON shifts TO sitesecurity_tenant
+    USING (worksite_id IN (SELECT id FROM worksites));
+
+ALTER TABLE shift_assignments ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON shift_assignments TO sitesecurity_tenant
+    USING (shift_id IN (SELECT id FROM shifts));
+CREATE POLICY own_rows ON shift_assignments FOR SELECT TO sitesecurity_tenant
+    USING (worker_id = app_current_worker_id());
+
+ALTER TABLE shift_reports ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON shift_reports TO sitesecurity_tenant
+    USING (shift_id IN (SELECT id FROM shifts));
+CREATE POLICY own_rows ON shift_reports FOR SELECT TO sitesecurity_tenant
+    USING (worker_id = app_current_worker_id());
+
+-- Check-ins and alarms outside a shift belong to every company the worker
+-- is an active member of. Workers may record their own.
+ALTER TABLE location_check_ins ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON location_check_ins TO sitesecurity_tenant
+    USING (
+        shift_id IN (SELECT id FROM shifts)
+        OR (shift_id IS NULL AND worker_id IN (
+            SELECT worker_id FROM worker_companies
+            WHERE status = 'active' AND company_id = ANY (app_current_company_ids())))
+    );
+CREATE POLICY own_rows ON location_check_ins TO sitesecurity_tenant
+    USING (worker_id = app_current_worker_id());
+
+ALTER TABLE alarms ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON alarms TO sitesecurity_tenant
+    USING (
+        shift_id IN (SELECT id FROM shifts)
+        OR (shift_id IS NULL AND worker_id IN (
+            SELECT worker_id FROM worker_companies
+            WHERE status = 'active' AND company_id = ANY (app_current_company_ids())))
+    );
+CREATE POLICY own_rows ON alarms TO sitesecurity_tenant
+    USING (worker_id = app_current_worker_id());
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS audit_events CASCADE;
+DROP FUNCTION IF EXISTS audit_events_immutable();
@@ -0,0 +1,46 @@
+-- The audit log records every change made through the API: who made it,
+-- from where, and the resource before and after. Rows are never updated or
+-- deleted, and carry no foreign keys so they outlive what they describe.
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    actor_worker_id UUID,
+    actor_subject VARCHAR(255),
+    api_key_id UUID,
+    action VARCHAR(50) NOT NULL,
+    resource_type VARCHAR(50) NOT NULL,
+    resource_id VARCHAR(255) NOT NULL,
+    company_ids UUID[] NOT NULL DEFAULT '{}',
+    before JSONB,
+    after JSONB,
+    ip VARCHAR(64),
+    request_id VARCHAR(255)
+);
+
+CREATE INDEX idx_audit_events_company_ids ON audit_events USING GIN (company_ids);
+CREATE INDEX idx_audit_events_resource ON audit_events (resource_type, resource_id);
+CREATE INDEX idx_audit_events_actor ON audit_events (actor_worker_id);
+CREATE INDEX idx_audit_events_occurred_at ON audit_events (occurred_at);
+
+CREATE FUNCTION audit_events_immutable() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events cannot be changed or removed';
+END
+$$;
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_immutable();
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_immutable();
+
+-- Tenants read their companies' events and their own, and may only record
+-- events as themselves.
+REVOKE UPDATE, DELETE ON audit_events FROM sitesecurity_tenant;
+ALTER TABLE audit_events ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_read ON audit_events FOR SELECT TO sitesecurity_tenant
+    USING (company_ids && app_current_company_ids());
+CREATE POLICY own_events ON audit_events FOR SELECT TO sitesecurity_tenant
+    USING (actor_worker_id = app_current_worker_id());
+CREATE POLICY tenant_record ON audit_events FOR INSERT TO sitesecurity_tenant
+    WITH CHECK (actor_worker_id IS NOT DISTINCT FROM app_current_worker_id());
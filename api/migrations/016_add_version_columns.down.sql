@@ -0,0 +1,7 @@
+ALTER TABLE alarms DROP COLUMN IF EXISTS version;
+ALTER TABLE shift_report_templates DROP COLUMN IF EXISTS version;
+ALTER TABLE shifts DROP COLUMN IF EXISTS version;
+ALTER TABLE certificates DROP COLUMN IF EXISTS version;
+ALTER TABLE workers DROP COLUMN IF EXISTS version;
+ALTER TABLE worksites DROP COLUMN IF EXISTS version;
+ALTER TABLE companies DROP COLUMN IF EXISTS version;
@@ -0,0 +1,10 @@
+-- Every editable resource carries a version, bumped on each update, that
+-- the API serves as its ETag. Conditional writes match on it so a stale
+-- edit is rejected instead of overwriting a newer one.
+ALTER TABLE companies ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE worksites ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE workers ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE certificates ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE shifts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE shift_report_templates ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE alarms ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
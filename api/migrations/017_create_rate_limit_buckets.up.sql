@@ -0,0 +1,49 @@
+-- Token buckets shared by API replicas when rate limits are kept in
+-- Postgres. A bucket past full_at has refilled and may be removed.
+CREATE TABLE rate_limit_buckets (
+    key VARCHAR(512) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    full_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_rate_limit_buckets_full_at ON rate_limit_buckets (full_at);
+
+-- rate_limit_take takes a token from a bucket holding up to capacity
+-- tokens and refilling at rate tokens a second, creating it full, and
+-- reports whether one was available and, if not, how many seconds until
+-- one will be. The row lock serialises replicas taking from one bucket.
+CREATE FUNCTION rate_limit_take(bucket_key VARCHAR, capacity DOUBLE PRECISION, rate DOUBLE PRECISION,
+                                OUT allowed BOOLEAN, OUT retry_after DOUBLE PRECISION)
+LANGUAGE plpgsql AS $$
+DECLARE
+    now_ts TIMESTAMPTZ := clock_timestamp();
+    available DOUBLE PRECISION;
+BEGIN
+    INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+    VALUES (bucket_key, capacity, now_ts, now_ts)
+    ON CONFLICT (key) DO NOTHING;
+
+    SELECT LEAST(capacity, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM now_ts - b.updated_at)) * rate)
+    INTO available
+    FROM rate_limit_buckets b WHERE b.key = bucket_key
+    FOR UPDATE;
+
+    allowed := available >= 1;
+    retry_after := 0;
+    IF allowed THEN
+        available := available - 1;
+    ELSE
+        retry_after := (1 - available) / rate;
+    END IF;
+
+    UPDATE rate_limit_buckets
+    SET tokens = available,
+        updated_at = now_ts,
+        full_at = now_ts + make_interval(secs => (capacity - available) / rate)
+    WHERE key = bucket_key;
+END
+$$;
+
+-- Buckets are kept for the API itself, never for a tenant session.
+REVOKE ALL ON rate_limit_buckets FROM sitesecurity_tenant;
@@ -0,0 +1,24 @@
+-- Requests sent with an Idempotency-Key, per caller. A row is claimed,
+-- with no response, while the first request runs, and completed with its
+-- response in the same transaction as the request's own changes, so a
+-- retry either replays a committed response or finds the key free.
+CREATE TABLE idempotency_keys (
+    subject VARCHAR(255) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    worker_id UUID NOT NULL REFERENCES workers(id) ON DELETE CASCADE,
+    request_hash CHAR(64) NOT NULL,
+    status_code INTEGER,
+    headers JSONB,
+    body BYTEA,
+    locked_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (subject, key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
+
+-- Claims are made outside the tenant session; within it a caller only
+-- completes their own.
+ALTER TABLE idempotency_keys ENABLE ROW LEVEL SECURITY;
+CREATE POLICY own_keys ON idempotency_keys TO sitesecurity_tenant
+    USING (worker_id = app_current_worker_id());
@@ -0,0 +1,7 @@
+DROP POLICY IF EXISTS tenant_isolation ON certificates;
+ALTER TABLE certificates DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS workers_create ON workers;
+DROP POLICY IF EXISTS own_rows ON workers;
+DROP POLICY IF EXISTS tenant_isolation ON workers;
+ALTER TABLE workers DISABLE ROW LEVEL SECURITY;
@@ -0,0 +1,19 @@
+-- Workers belong to every company they have a membership of, in any
+-- status, and can always read their own row. Any caller may add a worker,
+-- as an admin inviting one does; the worker becomes visible to the
+-- company once given a membership, so inserts do not read the row back.
+ALTER TABLE workers ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON workers TO sitesecurity_tenant
+    USING (id IN (
+        SELECT worker_id FROM worker_companies
+        WHERE company_id = ANY (app_current_company_ids())));
+CREATE POLICY own_rows ON workers TO sitesecurity_tenant
+    USING (id = app_current_worker_id());
+CREATE POLICY workers_create ON workers FOR INSERT TO sitesecurity_tenant
+    WITH CHECK (true);
+
+-- Certificates inherit their companies through the worker, whose policies
+-- limit the subquery.
+ALTER TABLE certificates ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON certificates TO sitesecurity_tenant
+    USING (worker_id IN (SELECT id FROM workers));
@@ -0,0 +1,3 @@
+ALTER TABLE shift_reports DROP COLUMN IF EXISTS version;
+ALTER TABLE shift_assignments DROP COLUMN IF EXISTS version;
+ALTER TABLE worker_companies DROP COLUMN IF EXISTS version;
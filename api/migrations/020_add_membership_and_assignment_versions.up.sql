@@ -0,0 +1,6 @@
+-- Memberships and shift assignments are edited too: a role changed or an
+-- offer answered on a stale read is rejected like any other edit. Reports
+-- carry a version so they are served with an ETag as well.
+ALTER TABLE worker_companies ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE shift_assignments ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE shift_reports ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
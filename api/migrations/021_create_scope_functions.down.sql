@@ -0,0 +1,9 @@
+DROP FUNCTION IF EXISTS app_company_of_api_key(TEXT);
+DROP FUNCTION IF EXISTS app_companies_of_worker(TEXT);
+DROP FUNCTION IF EXISTS app_companies_of_alarm(TEXT);
+DROP FUNCTION IF EXISTS app_company_of_shift_report(TEXT);
+DROP FUNCTION IF EXISTS app_company_of_template(TEXT);
+DROP FUNCTION IF EXISTS app_company_of_shift(TEXT);
+DROP FUNCTION IF EXISTS app_company_of_worksite(TEXT);
+DROP FUNCTION IF EXISTS app_company_exists(TEXT);
+DROP FUNCTION IF EXISTS app_uuid(TEXT);
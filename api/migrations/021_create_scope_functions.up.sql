@@ -0,0 +1,91 @@
+-- Access checks resolve which company owns a resource inside the request's
+-- tenant session, where row-level security would hide another company's
+-- rows and report them as missing rather than forbidden. These functions
+-- run as the migrating role, which bypasses the policies, and return only
+-- the owning company. A malformed ID resolves to nothing instead of raising
+-- an error that would abort the session's transaction.
+CREATE FUNCTION app_uuid(TEXT) RETURNS UUID
+LANGUAGE plpgsql IMMUTABLE AS $$
+BEGIN
+    IF $1 ~* '^[0-9a-f]{8}-?([0-9a-f]{4}-?){3}[0-9a-f]{12}$' THEN
+        RETURN $1::UUID;
+    END IF;
+    RETURN NULL;
+END
+$$;
+
+CREATE FUNCTION app_company_exists(TEXT) RETURNS BOOLEAN
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+    SELECT EXISTS (SELECT 1 FROM companies WHERE id = app_uuid($1))
+$$;
+
+CREATE FUNCTION app_company_of_worksite(TEXT) RETURNS UUID
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+    SELECT company_id FROM worksites WHERE id = app_uuid($1)
+$$;
+
+CREATE FUNCTION app_company_of_shift(TEXT) RETURNS UUID
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+    SELECT ws.company_id FROM shifts s
+    JOIN worksites ws ON ws.id = s.worksite_id
+    WHERE s.id = app_uuid($1)
+$$;
+
+CREATE FUNCTION app_company_of_template(TEXT) RETURNS UUID
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+    SELECT company_id FROM shift_report_templates WHERE id = app_uuid($1)
+$$;
+
+CREATE FUNCTION app_company_of_shift_report(TEXT) RETURNS UUID
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+    SELECT ws.company_id FROM shift_reports sr
+    JOIN shifts s ON s.id = sr.shift_id
+    JOIN worksites ws ON ws.id = s.worksite_id
+    WHERE sr.id = app_uuid($1)
+$$;
+
+-- An alarm raised outside a shift belongs to every company the raising
+-- worker is an active member of.
+CREATE FUNCTION app_companies_of_alarm(TEXT) RETURNS SETOF UUID
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+    SELECT ws.company_id FROM alarms a
+    JOIN shifts s ON s.id = a.shift_id
+    JOIN worksites ws ON ws.id = s.worksite_id
+    WHERE a.id = app_uuid($1)
+    UNION
+    SELECT wc.company_id FROM alarms a
+    JOIN worker_companies wc ON wc.worker_id = a.worker_id AND wc.status = 'active'
+    WHERE a.id = app_uuid($1) AND a.shift_id IS NULL
+$$;
+
+CREATE FUNCTION app_companies_of_worker(TEXT) RETURNS SETOF UUID
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+    SELECT wc.company_id FROM worker_companies wc
+    WHERE wc.worker_id = app_uuid($1) AND wc.status = 'active'
+$$;
+
+CREATE FUNCTION app_company_of_api_key(TEXT) RETURNS UUID
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+    SELECT company_id FROM api_keys WHERE id = app_uuid($1)
+$$;
+
+REVOKE EXECUTE ON FUNCTION
+    app_company_exists(TEXT),
+    app_company_of_worksite(TEXT),
+    app_company_of_shift(TEXT),
+    app_company_of_template(TEXT),
+    app_company_of_shift_report(TEXT),
+    app_companies_of_alarm(TEXT),
+    app_companies_of_worker(TEXT),
+    app_company_of_api_key(TEXT)
+FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION
+    app_company_exists(TEXT),
+    app_company_of_worksite(TEXT),
+    app_company_of_shift(TEXT),
+    app_company_of_template(TEXT),
+    app_company_of_shift_report(TEXT),
+    app_companies_of_alarm(TEXT),
+    app_companies_of_worker(TEXT),
+    app_company_of_api_key(TEXT)
+TO sitesecurity_tenant;
@@ -0,0 +1,5 @@
+UPDATE workers w SET auth_subject = 'api-key:' || k.prefix
+FROM api_keys k
+WHERE k.worker_id = w.id;
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS role;
@@ -0,0 +1,11 @@
+-- An API key records the membership role its service account was given, so
+-- a key can be issued with less than a site admin's reach. Keys issued
+-- before now were all site admins.
+ALTER TABLE api_keys ADD COLUMN role VARCHAR(50) NOT NULL DEFAULT 'site_admin'
+    CHECK (role IN ('worker', 'site_admin'));
+
+-- Service accounts are identified by their key's ID rather than its short
+-- prefix, which two keys may share.
+UPDATE workers w SET auth_subject = 'api-key:' || k.id
+FROM api_keys k
+WHERE k.worker_id = w.id;
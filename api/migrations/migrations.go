@@ -0,0 +1,14 @@
+// Package migrations holds the versioned SQL schema, embedded in the API
+// binary so it can migrate the database it serves.
+//
+// Each version is a pair of files, NNN_name.up.sql and NNN_name.down.sql.
+// Migrations are never edited once released; a change to the schema is a
+// new version.
+package migrations
+
+import "embed"
+
+// FS is the migration files.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,17 @@
+#!/bin/sh
+set -e
+
+# Loads the development seed data into a migrated database, once: a
+# database that already has companies is left alone.
+
+if [ "$(psql -tAc 'SELECT EXISTS (SELECT 1 FROM companies)')" = "t" ]; then
+  echo "Database already has data, skipping seeds."
+  exit 0
+fi
+
+for f in /seeds/*.sql; do
+  echo "Seeding: $(basename "$f")"
+  psql -v ON_ERROR_STOP=1 -f "$f"
+done
+
+echo "Seeding complete."
@@ -17,7 +17,8 @@ INSERT INTO worksites (id, company_id, name, address, latitude, longitude) VALUE
   ('b2c3d4e5-0001-4000-8000-000000000006', 'a1b2c3d4-0001-4000-8000-000000000003', 'Buchanan Galleries', '220 Buchanan Street, Glasgow G1 2GF', 55.8636, -4.2518),
   ('b2c3d4e5-0001-4000-8000-000000000007', 'a1b2c3d4-0001-4000-8000-000000000003', 'Glasgow Royal Infirmary', '84 Castle Street, Glasgow G4 0SF', 55.8625, -4.2381);
 
--- Workers (auth_subject matches Keycloak user IDs — will be updated on first login)
+-- Workers (auth_subject is a placeholder until the matching Keycloak user first logs in
+-- and the API links the row by email)
 INSERT INTO workers (id, auth_subject, first_name, last_name, email, phone) VALUES
   ('c3d4e5f6-0001-4000-8000-000000000001', 'admin.user', 'Admin', 'User', 'admin@sitesecurity.local', '+44 7700 900001'),
   ('c3d4e5f6-0001-4000-8000-000000000002', 'site.manager', 'Site', 'Manager', 'manager@sitesecurity.local', '+44 7700 900002'),
@@ -61,7 +61,7 @@ export default function AlarmsPage() {
   const handleRaiseAlarm = async () => {
     setSubmitting(true);
     try {
-      await apiClient("/api/v1/alarms", {
+      await apiClient("/api/v1/alarms?backfill=true", {
         method: "POST",
         body: JSON.stringify({
           workerId: form.workerId,
@@ -52,7 +52,7 @@ export default function CheckInsPage() {
   const handleCreate = async () => {
     setSubmitting(true);
     try {
-      await apiClient("/api/v1/check-ins", {
+      await apiClient("/api/v1/check-ins?backfill=true", {
         method: "POST",
         body: JSON.stringify({
           workerId: form.workerId,
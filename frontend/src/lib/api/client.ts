@@ -1,7 +1,14 @@
 import { getAccessToken } from "@/lib/auth";
+import type { Problem } from "@/lib/types";
 
 const API_URL = process.env.NEXT_PUBLIC_API_URL || "http://localhost:8080";
 
+export class ApiError extends Error {
+  constructor(public problem: Problem) {
+    super(problem.detail || `API error: ${problem.status}`);
+  }
+}
+
 export async function apiClient<T>(
   path: string,
   options?: RequestInit
@@ -22,7 +29,12 @@ export async function apiClient<T>(
   });
 
   if (!response.ok) {
-    throw new Error(`API error: ${response.status}`);
+    const problem: Problem = await response.json().catch(() => ({
+      type: "about:blank",
+      title: response.statusText,
+      status: response.status,
+    }));
+    throw new ApiError(problem);
   }
 
   return response.json();
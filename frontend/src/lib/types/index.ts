@@ -4,6 +4,7 @@ export interface Company {
   address?: string;
   phone?: string;
   email?: string;
+  version: number;
   createdAt: string;
   updatedAt: string;
 }
@@ -15,6 +16,7 @@ export interface Worksite {
   address?: string;
   latitude?: number;
   longitude?: number;
+  version: number;
   createdAt: string;
   updatedAt: string;
 }
@@ -26,6 +28,7 @@ export interface Worker {
   lastName: string;
   email: string;
   phone?: string;
+  version: number;
   createdAt: string;
   updatedAt: string;
 }
@@ -49,6 +52,7 @@ export interface Certificate {
   certificateNumber?: string;
   issuedDate?: string;
   expiryDate?: string;
+  version: number;
   createdAt: string;
   updatedAt: string;
 }
@@ -64,6 +68,7 @@ export interface Shift {
   startTime: string;
   endTime: string;
   status: ShiftStatus;
+  version: number;
   createdAt: string;
   updatedAt: string;
 }
@@ -84,6 +89,7 @@ export interface ShiftReportTemplate {
   companyId: string;
   name: string;
   fields: string;
+  version: number;
   createdAt: string;
   updatedAt: string;
 }
@@ -116,7 +122,21 @@ export interface Alarm {
   longitude?: number;
   message?: string;
   status: AlarmStatus;
+  version: number;
   raisedAt: string;
   acknowledgedAt?: string;
   resolvedAt?: string;
 }
+
+export interface FieldError {
+  field: string;
+  message: string;
+}
+
+export interface Problem {
+  type: string;
+  title: string;
+  status: number;
+  detail?: string;
+  errors?: FieldError[];
+}
@@ -36,3 +36,19 @@ app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
 {{- define "sitesecurity.frontendHost" -}}
 {{ include "sitesecurity.fullname" . }}-frontend
 {{- end }}
+
+{{- define "sitesecurity.dbEnv" -}}
+- name: DB_HOST
+  value: {{ include "sitesecurity.dbHost" . }}
+- name: DB_PORT
+  value: {{ .Values.db.port | quote }}
+- name: DB_USER
+  value: {{ .Values.db.user | quote }}
+- name: DB_PASSWORD
+  valueFrom:
+    secretKeyRef:
+      name: {{ include "sitesecurity.fullname" . }}
+      key: db-password
+- name: DB_NAME
+  value: {{ .Values.db.name | quote }}
+{{- end }}